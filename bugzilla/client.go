@@ -96,6 +96,8 @@ func (c *Client) BugsByID(ctx context.Context, bugs ...int) (*BugInfoList, error
 
 type ClientError struct {
 	Err Error
+	// StatusCode is the HTTP status of the response that reported the error
+	StatusCode int `json:"-"`
 }
 
 func (e *ClientError) Error() string {
@@ -138,8 +140,9 @@ func readJSONIntoObject(ctx context.Context, retries int, client *http.Client, f
 					}
 				}
 				if !clientErr.Err.Error {
-					return &ClientError{Err: Error{Error: true, Code: resp.StatusCode, Message: fmt.Sprintf("unknown client error %d", resp.StatusCode)}}
+					return &ClientError{Err: Error{Error: true, Code: resp.StatusCode, Message: fmt.Sprintf("unknown client error %d", resp.StatusCode)}, StatusCode: resp.StatusCode}
 				}
+				clientErr.StatusCode = resp.StatusCode
 				return &clientErr
 			}
 
@@ -2,6 +2,9 @@ package bugzilla
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
@@ -16,18 +19,29 @@ import (
 	"k8s.io/klog/v2"
 )
 
+// commentClient retrieves the comments of bugs.
+type commentClient interface {
+	BugCommentsByID(ctx context.Context, bugs ...int) (*BugCommentsList, error)
+}
+
 type CommentStore struct {
 	store          cache.Store
 	persistedStore PersistentCommentStore
 	hasSynced      []cache.InformerSynced
-	client         *Client
+	client         commentClient
 	includePrivate bool
 
-	queue workqueue.Interface
+	queue workqueue.RateLimitingInterface
 
 	refreshInterval time.Duration
 	maxBatch        int
 	rateLimit       *rate.Limiter
+	// backoff bounds the retries of a batch of comments before it is split or its bug
+	// is requeued
+	backoff wait.Backoff
+	// failures is the number of consecutive times the comments of a bug could not be
+	// retrieved on its own, and is only accessed by run
+	failures map[int]int
 
 	// lock keeps the comment list in sync with the bug list
 	lock sync.Mutex
@@ -44,15 +58,28 @@ func NewCommentStore(client *Client, refreshInterval time.Duration, includePriva
 	s := &CommentStore{
 		store:          cache.NewStore(cache.MetaNamespaceKeyFunc),
 		persistedStore: persisted,
-		client:         client,
 
 		includePrivate: includePrivate,
 
-		queue: workqueue.NewNamed("comment_store"),
+		queue: workqueue.NewRateLimitingQueueWithConfig(
+			workqueue.NewItemExponentialFailureRateLimiter(15*time.Second, 10*time.Minute),
+			workqueue.RateLimitingQueueConfig{Name: "comment_store"},
+		),
 
 		refreshInterval: refreshInterval,
 		rateLimit:       rate.NewLimiter(rate.Every(15*time.Second), 3),
 		maxBatch:        250,
+		backoff: wait.Backoff{
+			Duration: time.Second,
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    4,
+		},
+		failures: make(map[int]int),
+	}
+	// avoid storing a nil client as a non-nil interface
+	if client != nil {
+		s.client = client
 	}
 	return s
 }
@@ -67,6 +94,18 @@ func (s *CommentStore) Stats() Stats {
 	}
 }
 
+// Freshness returns the most recent time the comments of any bug in the store were
+// refreshed, or the zero time if the store is empty.
+func (s *CommentStore) Freshness() time.Time {
+	var newest time.Time
+	for _, item := range s.store.List() {
+		if t := item.(*BugComments).RefreshTime; t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
+
 func (s *CommentStore) Get(id int) (*BugComments, bool) {
 	item, ok, err := s.store.GetByKey(strconv.Itoa(id))
 	if err != nil || !ok {
@@ -75,6 +114,29 @@ func (s *CommentStore) Get(id int) (*BugComments, bool) {
 	return item.(*BugComments), true
 }
 
+// Refresh fetches the comments of a bug in the store immediately instead of waiting for
+// the next refresh interval, and returns the updated comments.
+func (s *CommentStore) Refresh(ctx context.Context, id int) (*BugComments, error) {
+	if s.client == nil {
+		return nil, fmt.Errorf("bug comments are not being fetched")
+	}
+	if _, ok := s.Get(id); !ok {
+		return nil, fmt.Errorf("bug %d is not indexed", id)
+	}
+	now := time.Now()
+	bugComments, err := s.fetchComments(ctx, []int{id})
+	if err != nil {
+		return nil, err
+	}
+	s.filterComments(bugComments)
+	s.mergeBugs(bugComments, now)
+	comments, ok := s.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("bug %d is not indexed", id)
+	}
+	return comments, nil
+}
+
 func (s *CommentStore) Run(ctx context.Context, informer cache.SharedInformer) error {
 	defer klog.V(2).Infof("Comment worker exited")
 	if s.refreshInterval == 0 {
@@ -139,10 +201,6 @@ func (s *CommentStore) run(ctx context.Context) error {
 				return nil
 			}
 		}
-		if err := s.rateLimit.Wait(ctx); err != nil {
-			return err
-		}
-
 		if l > s.maxBatch {
 			l = s.maxBatch
 		}
@@ -164,16 +222,104 @@ func (s *CommentStore) run(ctx context.Context) error {
 			l--
 		}
 
-		now := time.Now()
-		klog.V(7).Infof("Fetching %d comments", len(bugIDs))
-		bugComments, err := s.client.BugCommentsByID(ctx, bugIDs...)
+		if err := s.fetchBatch(ctx, bugIDs); err != nil {
+			return err
+		}
+	}
+}
+
+// maxCommentFailures is the number of times the comments of a single bug may fail to be
+// retrieved before the bug is dropped from the queue until its next refresh.
+const maxCommentFailures = 3
+
+// fetchBatch retrieves and stores the comments of bugIDs. If the server rejects the
+// batch because of one of its bugs, the batch is split in half and each half is
+// retrieved separately, so that a bug whose comments cannot be retrieved does not
+// prevent the rest of its batch from updating. A single bug that is rejected is
+// requeued until it has failed maxCommentFailures times in a row. Any other error
+// (server errors, network failures) requeues the whole batch with backoff.
+func (s *CommentStore) fetchBatch(ctx context.Context, bugIDs []int) error {
+	if len(bugIDs) == 0 {
+		return nil
+	}
+	if err := s.rateLimit.Wait(ctx); err != nil {
+		return err
+	}
+	now := time.Now()
+	klog.V(7).Infof("Fetching %d comments", len(bugIDs))
+	bugComments, err := s.fetchComments(ctx, bugIDs)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !isBugError(err) {
+			klog.Warningf("comment store failed to retrieve comments for %d bugs, requeueing: %v", len(bugIDs), err)
+			for _, id := range bugIDs {
+				s.queue.AddRateLimited(strconv.Itoa(id))
+			}
+			return nil
+		}
+		if len(bugIDs) > 1 {
+			klog.Warningf("comment store failed to retrieve comments for %d bugs, retrying in smaller batches: %v", len(bugIDs), err)
+			half := len(bugIDs) / 2
+			if err := s.fetchBatch(ctx, bugIDs[:half]); err != nil {
+				return err
+			}
+			return s.fetchBatch(ctx, bugIDs[half:])
+		}
+		id := bugIDs[0]
+		s.failures[id]++
+		if s.failures[id] >= maxCommentFailures {
+			klog.Warningf("comment store failed to retrieve comments for bug %d %d times, skipping until its next refresh: %v", id, s.failures[id], err)
+			delete(s.failures, id)
+			return nil
+		}
+		// retry the bug on a later pass instead of waiting for the next refresh
+		klog.Warningf("comment store failed to retrieve comments for bug %d, requeueing: %v", id, err)
+		s.queue.AddRateLimited(strconv.Itoa(id))
+		return nil
+	}
+	for _, id := range bugIDs {
+		delete(s.failures, id)
+		s.queue.Forget(strconv.Itoa(id))
+	}
+	s.filterComments(bugComments)
+	s.mergeBugs(bugComments, now)
+	return nil
+}
+
+// isBugError returns true if err is a client error that the server reported for the
+// request itself, such as an invalid or inaccessible bug, rather than a transient failure.
+func isBugError(err error) bool {
+	var clientErr *ClientError
+	if !errors.As(err, &clientErr) {
+		return false
+	}
+	switch clientErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return clientErr.StatusCode >= 400 && clientErr.StatusCode < 500
+}
+
+// fetchComments retrieves the comments for bugIDs, retrying with backoff on failure.
+func (s *CommentStore) fetchComments(ctx context.Context, bugIDs []int) (*BugCommentsList, error) {
+	var bugComments *BugCommentsList
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, s.backoff, func(ctx context.Context) (bool, error) {
+		var err error
+		bugComments, err = s.client.BugCommentsByID(ctx, bugIDs...)
 		if err != nil {
-			klog.Warningf("comment store failed to retrieve comments: %v", err)
-			continue
+			klog.V(4).Infof("Failed to retrieve comments for %d bugs: %v", len(bugIDs), err)
+			lastErr = err
+			return false, nil
 		}
-		s.filterComments(bugComments)
-		s.mergeBugs(bugComments, now)
+		return true, nil
+	})
+	if err != nil && lastErr != nil {
+		return nil, lastErr
 	}
+	return bugComments, err
 }
 
 func (s *CommentStore) filterComments(bugComments *BugCommentsList) {
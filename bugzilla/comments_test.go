@@ -2,17 +2,23 @@ package bugzilla
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"golang.org/x/time/rate"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 )
 
@@ -42,7 +48,7 @@ func TestCommentStore(t *testing.T) {
 		return SearchBugsArgs{
 			Quicksearch: "cf_internal_whiteboard:buildcop",
 		}
-	}, func(*BugInfo) bool { return true })
+	}, func(*BugInfo) bool { return true }, "")
 	lister := NewBugLister(informer.GetIndexer())
 	diskStore := NewCommentDiskStore(dir, 10*time.Minute)
 	store := NewCommentStore(c, 5*time.Minute, false, diskStore)
@@ -85,3 +91,220 @@ func TestCommentStore(t *testing.T) {
 		break
 	}
 }
+
+// failingCommentClient fails the first failures calls and then returns no comments.
+type failingCommentClient struct {
+	lock     sync.Mutex
+	failures int
+	calls    int
+}
+
+func (c *failingCommentClient) BugCommentsByID(ctx context.Context, bugs ...int) (*BugCommentsList, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.calls++
+	if c.calls <= c.failures {
+		return nil, fmt.Errorf("server error")
+	}
+	return &BugCommentsList{Bugs: map[IDString]BugCommentInfo{}}, nil
+}
+
+func (c *failingCommentClient) Calls() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.calls
+}
+
+func TestCommentStore_fetchCommentsRetries(t *testing.T) {
+	client := &failingCommentClient{failures: 2}
+	s := NewCommentStore(nil, time.Minute, false, nil)
+	s.client = client
+	s.backoff = wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 3}
+
+	if _, err := s.fetchComments(context.Background(), []int{1, 2}); err != nil {
+		t.Fatalf("expected the batch to succeed after retries: %v", err)
+	}
+	if calls := client.Calls(); calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+
+	client = &failingCommentClient{failures: 100}
+	s.client = client
+	if _, err := s.fetchComments(context.Background(), []int{1, 2}); err == nil || err.Error() != "server error" {
+		t.Fatalf("expected the last error after all retries failed: %v", err)
+	}
+	if calls := client.Calls(); calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestCommentStore_requeuesFailedBatch(t *testing.T) {
+	client := &failingCommentClient{failures: 100}
+	s := NewCommentStore(nil, time.Minute, false, nil)
+	s.client = client
+	s.backoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 2}
+	s.rateLimit = rate.NewLimiter(rate.Inf, 1)
+	s.queue = newImmediateQueue()
+	s.queue.Add("1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.run(ctx)
+
+	// a batch that fails every retry is fetched again instead of being dropped
+	if err := wait.PollImmediate(time.Millisecond, 5*time.Second, func() (bool, error) {
+		return client.Calls() > 2*s.backoff.Steps, nil
+	}); err != nil {
+		t.Fatalf("failed batch was not retried, %d calls", client.Calls())
+	}
+}
+
+// newImmediateQueue returns a queue that requeues rate limited items without delay.
+func newImmediateQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(0, 0))
+}
+
+func TestCommentStore_requeuesTransientFailureWithoutSplitting(t *testing.T) {
+	client := &failingCommentClient{failures: 100}
+	s := NewCommentStore(nil, time.Minute, false, nil)
+	s.client = client
+	s.backoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 2}
+	s.rateLimit = rate.NewLimiter(rate.Inf, 1)
+	s.queue = newImmediateQueue()
+
+	bugIDs := []int{1, 2, 3, 4}
+	if err := s.fetchBatch(context.Background(), bugIDs); err != nil {
+		t.Fatal(err)
+	}
+	// the whole batch is retried with backoff instead of being split into smaller requests
+	if calls := client.Calls(); calls != s.backoff.Steps {
+		t.Errorf("expected %d calls, got %d", s.backoff.Steps, calls)
+	}
+	if s.queue.Len() != len(bugIDs) {
+		t.Errorf("expected the whole batch to be requeued, queue has %d", s.queue.Len())
+	}
+	for _, id := range bugIDs {
+		if n := s.queue.NumRequeues(strconv.Itoa(id)); n != 1 {
+			t.Errorf("expected bug %d to be requeued with backoff once, got %d", id, n)
+		}
+	}
+	if len(s.failures) != 0 {
+		t.Errorf("expected transient failures not to count against bugs: %v", s.failures)
+	}
+}
+
+// poisonCommentClient rejects every batch that contains the poison bug.
+type poisonCommentClient struct {
+	lock    sync.Mutex
+	poison  int
+	fetched map[int]int
+	failed  int
+}
+
+func (c *poisonCommentClient) BugCommentsByID(ctx context.Context, bugs ...int) (*BugCommentsList, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, id := range bugs {
+		if id == c.poison {
+			c.failed++
+			return nil, &ClientError{StatusCode: http.StatusBadRequest, Err: Error{Error: true, Code: 101, Message: "invalid bug"}}
+		}
+	}
+	list := &BugCommentsList{Bugs: map[IDString]BugCommentInfo{}}
+	for _, id := range bugs {
+		c.fetched[id]++
+		list.Bugs[IDString(id)] = BugCommentInfo{}
+	}
+	return list, nil
+}
+
+func TestCommentStore_splitsFailedBatch(t *testing.T) {
+	client := &poisonCommentClient{poison: 3, fetched: make(map[int]int)}
+	s := NewCommentStore(nil, time.Minute, false, nil)
+	s.client = client
+	s.backoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 1}
+	s.rateLimit = rate.NewLimiter(rate.Inf, 1)
+	s.queue = newImmediateQueue()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bugIDs := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	if err := s.fetchBatch(ctx, bugIDs); err != nil {
+		t.Fatal(err)
+	}
+	// every other bug in the batch is retrieved once
+	for _, id := range bugIDs {
+		if id != 3 && client.fetched[id] != 1 {
+			t.Errorf("expected bug %d to be fetched once, got %d", id, client.fetched[id])
+		}
+	}
+	if s.queue.Len() != 1 || s.failures[3] != 1 {
+		t.Fatalf("expected only the failing bug to be requeued: len=%d failures=%d", s.queue.Len(), s.failures[3])
+	}
+
+	// the failing bug is dropped after failing on its own repeatedly
+	for i := 1; i < maxCommentFailures; i++ {
+		k, _ := s.queue.Get()
+		s.queue.Done(k)
+		if err := s.fetchBatch(ctx, []int{3}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.queue.Len() != 0 {
+		t.Errorf("expected the failing bug to be dropped, queue has %d", s.queue.Len())
+	}
+	if _, ok := s.failures[3]; ok {
+		t.Errorf("expected the failures of a dropped bug to be reset")
+	}
+}
+
+// staticCommentClient returns the same comments for every bug.
+type staticCommentClient struct {
+	comments []BugComment
+}
+
+func (c *staticCommentClient) BugCommentsByID(ctx context.Context, bugs ...int) (*BugCommentsList, error) {
+	list := &BugCommentsList{Bugs: map[IDString]BugCommentInfo{}}
+	for _, id := range bugs {
+		list.Bugs[IDString(id)] = BugCommentInfo{Comments: c.comments}
+	}
+	return list, nil
+}
+
+func TestCommentStore_Refresh(t *testing.T) {
+	s := NewCommentStore(nil, time.Minute, true, nil)
+	if _, err := s.Refresh(context.Background(), 1); err == nil {
+		t.Fatalf("expected an error without a client")
+	}
+	s.client = &staticCommentClient{comments: []BugComment{{Text: "first"}, {Text: "second"}}}
+	if _, err := s.Refresh(context.Background(), 1); err == nil {
+		t.Fatalf("expected an error for a bug that is not in the store")
+	}
+
+	if err := s.store.Add(&BugComments{ObjectMeta: metav1.ObjectMeta{Name: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	comments, err := s.Refresh(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments.Comments) != 2 || comments.RefreshTime.IsZero() {
+		t.Fatalf("unexpected comments: %#v", comments)
+	}
+}
+
+func TestCommentStore_Freshness(t *testing.T) {
+	s := NewCommentStore(nil, time.Minute, true, nil)
+	if !s.Freshness().IsZero() {
+		t.Fatalf("expected an empty store to have no refresh time")
+	}
+	newest := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	for i, refreshed := range []time.Time{newest.Add(-time.Hour), newest, newest.Add(-2 * time.Hour)} {
+		if err := s.store.Add(&BugComments{ObjectMeta: metav1.ObjectMeta{Name: strconv.Itoa(i)}, RefreshTime: refreshed}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.Freshness(); !got.Equal(newest) {
+		t.Errorf("unexpected freshness %s", got)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/workqueue"
@@ -20,6 +21,27 @@ import (
 	"github.com/openshift/ci-search/walk"
 )
 
+var (
+	metricDiskFiles = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "bugzilla_disk_files",
+		Help: "The number of bug files on disk as of the last compaction.",
+	})
+	metricDiskBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "bugzilla_disk_bytes",
+		Help: "The total size in bytes of the bug files on disk as of the last compaction.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		metricDiskFiles,
+		metricDiskBytes,
+	)
+}
+
+// tempFileMaxAge is how long a temporary file from an interrupted write is kept.
+const tempFileMaxAge = 15 * time.Minute
+
 type CommentDiskStore struct {
 	base   string
 	maxAge time.Duration
@@ -41,12 +63,22 @@ func NewCommentDiskStore(path string, maxAge time.Duration) *CommentDiskStore {
 
 func (s *CommentDiskStore) Run(ctx context.Context, lister *BugLister, store CommentAccessor, disableWrite bool) {
 	defer klog.V(2).Infof("Comment disk worker exited")
+	// stop waiting for changes once the context is cancelled, so that Run returns after
+	// any in-flight write completes
+	go func() {
+		<-ctx.Done()
+		s.queue.ShutDown()
+	}()
 	wait.UntilWithContext(ctx, func(ctx context.Context) {
 		for {
 			obj, done := s.queue.Get()
 			if done {
 				return
 			}
+			if ctx.Err() != nil {
+				s.queue.Done(obj)
+				return
+			}
 			if disableWrite {
 				s.queue.Done(obj)
 				return
@@ -87,7 +119,7 @@ func (s *CommentDiskStore) Sync(keys []string) ([]*BugComments, error) {
 	start := time.Now()
 	mustExpire := s.maxAge != 0
 	expiredAt := start.Add(-s.maxAge)
-	tempExpiredAfter := start.Add(-15 * time.Minute)
+	tempExpiredAfter := start.Add(-tempFileMaxAge)
 
 	bugs := make([]*BugComments, 0, 2048)
 
@@ -160,6 +192,55 @@ func (s *CommentDiskStore) Sync(keys []string) ([]*BugComments, error) {
 	return bugs, nil
 }
 
+// RunCompaction compacts the store every interval until ctx is cancelled.
+func (s *CommentDiskStore) RunCompaction(ctx context.Context, interval time.Duration) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := s.Compact(time.Now()); err != nil {
+			klog.Errorf("Unable to compact bug directory: %v", err)
+		}
+	}, interval)
+}
+
+// Compact removes temporary files left by interrupted writes that are older than
+// tempFileMaxAge as of now, and records the number and size of the remaining bug files.
+func (s *CommentDiskStore) Compact(now time.Time) error {
+	start := time.Now()
+	tempExpiredAfter := now.Add(-tempFileMaxAge)
+	var files, size, removed int64
+	err := walk.Walk(s.base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch {
+		case strings.HasPrefix(info.Name(), "z-bug-"):
+			if tempExpiredAfter.After(info.ModTime()) {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					klog.Errorf("Unable to remove temporary file %s: %v", path, err)
+					return nil
+				}
+				removed++
+			}
+		case strings.HasPrefix(info.Name(), "bug-"):
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metricDiskFiles.Set(float64(files))
+	metricDiskBytes.Set(float64(size))
+	klog.V(2).Infof("Compacted bug directory: files=%d bytes=%d removedTemporary=%d duration=%s", files, size, removed, time.Since(start).Truncate(time.Millisecond))
+	return nil
+}
+
 func (s *CommentDiskStore) DeleteBug(bug *Bug) error {
 	_, path := s.pathForBug(bug)
 	return os.Remove(path)
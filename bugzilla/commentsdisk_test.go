@@ -3,11 +3,13 @@ package bugzilla
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/diff"
 )
@@ -132,3 +134,44 @@ func TestCommentDiskStore_write(t *testing.T) {
 		t.Fatalf("%#v", list)
 	}
 }
+
+func TestCommentDiskStore_Compact(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for name, modTime := range map[string]time.Time{
+		"bug-1":   now.Add(-time.Hour),
+		"bug-2":   now,
+		"z-bug-3": now.Add(-time.Hour),
+		"z-bug-4": now.Add(-time.Minute),
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("data"), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewCommentDiskStore(dir, 0)
+	if err := s.Compact(now); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"bug-1", "bug-2", "z-bug-4"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("unexpected files after compaction: %v", names)
+	}
+	if files := testutil.ToFloat64(metricDiskFiles); files != 2 {
+		t.Errorf("unexpected file count: %v", files)
+	}
+	if size := testutil.ToFloat64(metricDiskBytes); size != 8 {
+		t.Errorf("unexpected size: %v", size)
+	}
+}
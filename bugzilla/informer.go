@@ -2,7 +2,9 @@ package bugzilla
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
 	"strconv"
 	"sync"
@@ -48,13 +50,25 @@ func (s *BugLister) Get(id int) (*Bug, error) {
 	return obj.(*Bug), nil
 }
 
-func NewInformer(client *Client, interval, maxInterval, resyncInterval time.Duration, argsFn func(metav1.ListOptions) SearchBugsArgs, includeFn func(*BugInfo) bool) cache.SharedIndexInformer {
+// fullListInterval is how often every matching bug is listed, instead of only the bugs
+// that changed since the last list. A bug that changes so that it no longer matches the
+// search is only removed by a full list.
+const fullListInterval = 24 * time.Hour
+
+// NewInformer lists and watches the bugs matching argsFn. If statePath is set, the bugs
+// from the last list are persisted to that file so that after a restart only the bugs
+// that changed since are requested.
+func NewInformer(client *Client, interval, maxInterval, resyncInterval time.Duration, argsFn func(metav1.ListOptions) SearchBugsArgs, includeFn func(*BugInfo) bool, statePath string) cache.SharedIndexInformer {
 	lw := &ListWatcher{
 		client:      client,
 		argsFn:      argsFn,
 		includeFn:   includeFn,
 		interval:    interval,
 		maxInterval: maxInterval,
+		statePath:   statePath,
+	}
+	if err := lw.loadState(); err != nil {
+		klog.Warningf("Unable to load bug list state, all bugs will be listed: %v", err)
 	}
 	lwPager := &cache.ListWatch{ListFunc: lw.List, WatchFunc: lw.Watch}
 	return cache.NewSharedIndexInformer(lwPager, &Bug{}, resyncInterval, nil)
@@ -66,9 +80,149 @@ type ListWatcher struct {
 	includeFn   func(*BugInfo) bool
 	interval    time.Duration
 	maxInterval time.Duration
+	statePath   string
+
+	lock sync.Mutex
+	// state is the result of the last complete list, or nil if no list has completed
+	state *listState
+	// pending accumulates the pages of a full list in progress
+	pending map[int]BugInfo
+}
+
+// listState is the set of bugs from the last complete list, merged with the bugs that
+// changed since.
+type listState struct {
+	// Watermark is the newest change time of any listed bug.
+	Watermark time.Time `json:"watermark"`
+	// FullListed is the time the last list of every matching bug completed.
+	FullListed time.Time `json:"fullListed"`
+	Bugs       []BugInfo `json:"bugs"`
+}
+
+// loadState reads the state persisted by a previous process, if any.
+func (lw *ListWatcher) loadState() error {
+	if len(lw.statePath) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(lw.statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var state listState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	lw.state = &state
+	klog.V(4).Infof("Loaded %d bugs changed before %s from %s", len(state.Bugs), timeToRV(metav1.Time{Time: state.Watermark}), lw.statePath)
+	return nil
+}
+
+// setState records the result of a list and persists it if configured. It is invoked
+// with the lock held.
+func (lw *ListWatcher) setState(state *listState) {
+	lw.state = state
+	if len(lw.statePath) == 0 {
+		return
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		klog.Errorf("Unable to serialize bug list state: %v", err)
+		return
+	}
+	tmp := lw.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		klog.Errorf("Unable to persist bug list state: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, lw.statePath); err != nil {
+		klog.Errorf("Unable to persist bug list state: %v", err)
+	}
+}
+
+// newListState returns the state for the bugs in byID, which have already been filtered.
+func newListState(byID map[int]BugInfo, watermark, fullListed time.Time) *listState {
+	state := &listState{Watermark: watermark, FullListed: fullListed, Bugs: make([]BugInfo, 0, len(byID))}
+	for _, info := range byID {
+		if t := info.LastChangeTime.Time; t.After(state.Watermark) {
+			state.Watermark = t
+		}
+		state.Bugs = append(state.Bugs, info)
+	}
+	sort.Slice(state.Bugs, func(i, j int) bool { return state.Bugs[i].ID < state.Bugs[j].ID })
+	return state
+}
+
+// listChanged returns the bugs from the last list merged with the bugs that changed
+// since its watermark. If there is no previous list or a full list is due, false is
+// returned.
+func (lw *ListWatcher) listChanged(options metav1.ListOptions) (*BugList, bool, error) {
+	lw.lock.Lock()
+	previous := lw.state
+	lw.lock.Unlock()
+	if previous == nil || previous.Watermark.IsZero() || time.Since(previous.FullListed) > fullListInterval {
+		return nil, false, nil
+	}
+
+	args := lw.argsFn(options)
+	args.LastChangeTime = previous.Watermark
+	changed, err := lw.client.SearchBugs(context.Background(), args)
+	if err != nil {
+		return nil, true, err
+	}
+	byID := make(map[int]BugInfo, len(previous.Bugs)+len(changed.Bugs))
+	for _, info := range previous.Bugs {
+		byID[info.ID] = info
+	}
+	for _, info := range changed.Bugs {
+		if lw.includeFn != nil && !lw.includeFn(&info) {
+			delete(byID, info.ID)
+			continue
+		}
+		byID[info.ID] = info
+	}
+	state := newListState(byID, previous.Watermark, previous.FullListed)
+
+	lw.lock.Lock()
+	lw.setState(state)
+	lw.lock.Unlock()
+
+	klog.V(5).Infof("Listed %d bugs changed since %s, %d bugs known", len(changed.Bugs), timeToRV(metav1.Time{Time: previous.Watermark}), len(state.Bugs))
+	return NewBugList(&BugInfoList{Bugs: state.Bugs}, nil), true, nil
+}
+
+// recordPage accumulates a page of a full list, and records the state of the list once
+// its last page has been listed.
+func (lw *ListWatcher) recordPage(options metav1.ListOptions, list *BugList) {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	if len(options.Continue) == 0 || lw.pending == nil {
+		lw.pending = make(map[int]BugInfo, len(list.Items))
+	}
+	for _, bug := range list.Items {
+		lw.pending[bug.Info.ID] = bug.Info
+	}
+	if len(list.Continue) > 0 {
+		return
+	}
+	lw.setState(newListState(lw.pending, time.Time{}, time.Now()))
+	lw.pending = nil
 }
 
 func (lw *ListWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
+	if len(options.Continue) == 0 {
+		if list, ok, err := lw.listChanged(options); ok {
+			if err != nil {
+				return nil, err
+			}
+			return list, nil
+		}
+	}
+
 	args := lw.argsFn(options)
 	if options.Limit > 0 {
 		args.Limit = int(options.Limit) + 1
@@ -96,6 +250,7 @@ func (lw *ListWatcher) List(options metav1.ListOptions) (runtime.Object, error)
 	} else {
 		klog.V(6).Infof("Listed bugs offset=%d limit=%d total=%d items=%d", args.Offset, options.Limit, len(bugs.Bugs), len(list.Items))
 	}
+	lw.recordPage(options, list)
 	return list, nil
 }
 
@@ -2,13 +2,21 @@ package bugzilla
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
@@ -78,7 +86,7 @@ func TestInformer(t *testing.T) {
 		return SearchBugsArgs{
 			Quicksearch: "cf_internal_whiteboard:buildcop",
 		}
-	}, func(*BugInfo) bool { return true })
+	}, func(*BugInfo) bool { return true }, "")
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			if bug, ok := obj.(*Bug); ok {
@@ -105,3 +113,80 @@ func TestInformer(t *testing.T) {
 
 	time.Sleep(2 * time.Minute)
 }
+
+func TestListWatcher_Incremental(t *testing.T) {
+	t1 := time.Date(2020, 1, 2, 3, 0, 0, 0, time.UTC)
+	bug := func(id int, changed time.Time, keywords ...string) BugInfo {
+		return BugInfo{ID: id, Keywords: keywords, LastChangeTime: metav1.Time{Time: changed}}
+	}
+	var since []string
+	responses := [][]BugInfo{
+		{bug(1, t1), bug(2, t1.Add(time.Hour))},
+		{bug(2, t1.Add(2*time.Hour)), bug(3, t1.Add(2*time.Hour), "Security"), bug(1, t1, "Security")},
+		{},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		since = append(since, req.URL.Query().Get("last_change_time"))
+		var bugs []BugInfo
+		if len(responses) > 0 {
+			bugs, responses = responses[0], responses[1:]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BugInfoList{Bugs: bugs})
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	u.Path = "/rest"
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	newListWatcher := func() *ListWatcher {
+		lw := &ListWatcher{
+			client:    NewClient(*u),
+			argsFn:    func(metav1.ListOptions) SearchBugsArgs { return SearchBugsArgs{Quicksearch: "test"} },
+			includeFn: func(info *BugInfo) bool { return !sets.NewString(info.Keywords...).Has("Security") },
+			statePath: statePath,
+		}
+		if err := lw.loadState(); err != nil {
+			t.Fatal(err)
+		}
+		return lw
+	}
+	ids := func(obj runtime.Object) []string {
+		var ids []string
+		for _, bug := range obj.(*BugList).Items {
+			ids = append(ids, fmt.Sprintf("%s@%s", bug.Name, bug.ResourceVersion))
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	lw := newListWatcher()
+	obj, err := lw.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(obj), []string{"1@2020-01-02T03:00:00Z", "2@2020-01-02T04:00:00Z"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected full list: %v", got)
+	}
+
+	// only changes are requested, and changed bugs that are now excluded are removed
+	obj, err = lw.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(obj), []string{"2@2020-01-02T05:00:00Z"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected incremental list: %v", got)
+	}
+
+	// the watermark and known bugs survive a restart
+	obj, err = newListWatcher().List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(obj), []string{"2@2020-01-02T05:00:00Z"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected list after restart: %v", got)
+	}
+	if want := []string{"", "2020-01-02T04:00:00Z", "2020-01-02T05:00:00Z"}; !reflect.DeepEqual(since, want) {
+		t.Errorf("unexpected last change times requested: %v", since)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// accessLogEntry is a single request written to the access log as a line of JSON.
+type accessLogEntry struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+	// DurationSeconds is the time taken to write the complete response.
+	DurationSeconds float64 `json:"durationSeconds"`
+	// RequestID matches the request to the server logs and the X-Request-ID header.
+	RequestID string `json:"requestID,omitempty"`
+
+	// the remaining fields are only set by requests that run a search
+	Search       []string `json:"search,omitempty"`
+	SearchType   string   `json:"searchType,omitempty"`
+	IncludeName  string   `json:"includeName,omitempty"`
+	ExcludeName  string   `json:"excludeName,omitempty"`
+	Job          string   `json:"job,omitempty"`
+	Results      *int     `json:"results,omitempty"`
+	BytesScanned int64    `json:"bytesScanned,omitempty"`
+}
+
+// accessLog writes a line of JSON for each request, separately from the klog output of
+// the server, so that usage can be analyzed.
+type accessLog struct {
+	lock   sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+// openAccessLog appends to the access log at path, or writes to stdout if path is "-".
+func openAccessLog(path string) (*accessLog, error) {
+	if path == "-" {
+		return &accessLog{enc: json.NewEncoder(os.Stdout)}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &accessLog{enc: json.NewEncoder(f), closer: f}, nil
+}
+
+func (l *accessLog) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+func (l *accessLog) write(entry *accessLogEntry) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.enc.Encode(entry); err != nil {
+		klog.Errorf("Unable to write access log: %v", err)
+	}
+}
+
+// accessLogRequest is filled in by the handler of a request with the search it ran.
+type accessLogRequest struct {
+	index   *Index
+	results int
+}
+
+type accessLogContextKey struct{}
+
+// recordSearch records the search and number of results of req in the access log, if
+// the request is logged.
+func recordSearch(req *http.Request, index *Index, results int) {
+	if r, ok := req.Context().Value(accessLogContextKey{}).(*accessLogRequest); ok {
+		r.index, r.results = index, results
+	}
+}
+
+// Handler logs each request served by handler. A nil access log returns handler.
+func (l *accessLog) Handler(handler http.Handler) http.Handler {
+	if l == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		r := &accessLogRequest{}
+		rw := &statusResponseWriter{ResponseWriter: w}
+		handler.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), accessLogContextKey{}, r)))
+
+		entry := &accessLogEntry{
+			Time:            start.UTC(),
+			Method:          req.Method,
+			Path:            req.URL.Path,
+			Status:          rw.Status(),
+			DurationSeconds: time.Since(start).Seconds(),
+			RequestID:       requestID(req.Context()),
+		}
+		if index := r.index; index != nil {
+			entry.Search = index.Search
+			entry.SearchType = index.SearchType
+			entry.IncludeName = index.IncludeName
+			entry.ExcludeName = index.ExcludeName
+			entry.Job = index.Job
+			entry.Results = &r.results
+			entry.BytesScanned = index.BytesScanned()
+		}
+		l.write(entry)
+	})
+}
+
+// statusResponseWriter records the status code of a response.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush allows handlers that stream their response to flush through the writer.
+func (w *statusResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Status returns the status code of the response, which is 200 if the handler did not
+// write one.
+func (w *statusResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
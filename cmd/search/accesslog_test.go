@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_accessLog_Handler(t *testing.T) {
+	var out bytes.Buffer
+	l := &accessLog{enc: json.NewEncoder(&out)}
+
+	handler := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/search" {
+			recordSearch(req, &Index{Search: []string{"operator", "etcd"}, SearchType: "build-log", IncludeName: "e2e-aws"}, 3)
+			w.Write([]byte("{}"))
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/search?search=operator&search=etcd", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	dec := json.NewDecoder(&out)
+	var entries []accessLogEntry
+	for dec.More() {
+		var entry accessLogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+	search := entries[0]
+	if search.Path != "/search" || search.Status != http.StatusOK || len(search.Search) != 2 || search.SearchType != "build-log" || search.IncludeName != "e2e-aws" || search.Results == nil || *search.Results != 3 {
+		t.Errorf("unexpected search entry: %#v", search)
+	}
+	missing := entries[1]
+	if missing.Path != "/missing" || missing.Status != http.StatusNotFound || missing.Results != nil || len(missing.Search) != 0 {
+		t.Errorf("unexpected entry: %#v", missing)
+	}
+
+	// requests are not logged without an access log
+	var nilLog *accessLog
+	w := httptest.NewRecorder()
+	nilLog.Handler(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unexpected status %d", w.Code)
+	}
+}
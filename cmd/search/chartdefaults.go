@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// chartSearch is a search shown on the chart when a request does not specify any.
+type chartSearch struct {
+	// Label is shown in the chart legend instead of the regex, if set.
+	Label string `json:"label,omitempty"`
+	Regex string `json:"regex"`
+}
+
+// defaultChartSearches are the chart searches used when --chart-defaults-file is not set.
+var defaultChartSearches = []chartSearch{
+	// CI-cluster issues
+	{Regex: "could not create or restart template instance.*"},
+	{Regex: "could not (wait for|get) build.*"}, // https://bugzilla.redhat.com/show_bug.cgi?id=1696483
+
+	// Installer and bootstrapping issues issues
+	{Regex: "level=error.*timeout while waiting for state.*"}, // https://bugzilla.redhat.com/show_bug.cgi?id=1690069 https://bugzilla.redhat.com/show_bug.cgi?id=1691516
+	{Regex: "Container setup exited with code ., reason Error"},
+
+	// Cluster-under-test issues
+	{Regex: "no providers available to validate pod"},                          // https://bugzilla.redhat.com/show_bug.cgi?id=1705102
+	{Regex: "Error deleting EBS volume .* since volume is currently attached"}, // https://bugzilla.redhat.com/show_bug.cgi?id=1704356
+	{Regex: "clusteroperator/.* changed Degraded to True: .*"},                 // e.g. https://bugzilla.redhat.com/show_bug.cgi?id=1702829 https://bugzilla.redhat.com/show_bug.cgi?id=1702832
+	{Regex: "Cluster operator .* is still updating.*"},                         // e.g. https://bugzilla.redhat.com/show_bug.cgi?id=1700416
+	{Regex: "Pod .* is not healthy"},                                           // e.g. https://bugzilla.redhat.com/show_bug.cgi?id=1700100
+
+	{Regex: "failed: \\(.*"},
+}
+
+// loadChartSearches reads a YAML or JSON list of chart searches from path and verifies
+// that each regex compiles.
+func loadChartSearches(path string) ([]chartSearch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var searches []chartSearch
+	if err := yaml.UnmarshalStrict(data, &searches); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	if len(searches) == 0 {
+		return nil, fmt.Errorf("%s must contain at least one search", path)
+	}
+	for i, search := range searches {
+		if len(search.Regex) == 0 {
+			return nil, fmt.Errorf("search %d in %s has no regex", i+1, path)
+		}
+		if _, err := compileSearch(search.Regex); err != nil {
+			return nil, fmt.Errorf("search %d in %s is not a valid regular expression: %v", i+1, path, err)
+		}
+	}
+	return searches, nil
+}
+
+// applyChartDefaults sets the searches of a chart request that did not specify any to
+// the configured chart searches.
+func (o *options) applyChartDefaults(index *Index) {
+	if len(index.Search) > 0 {
+		return
+	}
+	searches := o.chartSearches
+	if searches == nil {
+		searches = defaultChartSearches
+	}
+	for _, search := range searches {
+		index.Search = append(index.Search, search.Regex)
+	}
+}
+
+// chartLabels returns the legend label of each configured chart search that has one.
+func (o *options) chartLabels() map[string]string {
+	searches := o.chartSearches
+	if searches == nil {
+		searches = defaultChartSearches
+	}
+	labels := make(map[string]string)
+	for _, search := range searches {
+		if len(search.Label) > 0 {
+			labels[search.Regex] = search.Label
+		}
+	}
+	return labels
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_loadChartSearches(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	searches, err := loadChartSearches(write("valid.yaml", "- label: etcd leader changes\n  regex: 'etcdserver: leader changed'\n- regex: 'Pod .* is not healthy'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []chartSearch{{Label: "etcd leader changes", Regex: "etcdserver: leader changed"}, {Regex: "Pod .* is not healthy"}}
+	if !reflect.DeepEqual(searches, want) {
+		t.Errorf("unexpected searches: %#v", searches)
+	}
+	if _, err := loadChartSearches(write("valid.json", `[{"label": "timeouts", "regex": "timeout"}]`)); err != nil {
+		t.Errorf("unexpected error for JSON: %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"empty.yaml":   "[]",
+		"noregex.yaml": "- label: missing\n",
+		"invalid.yaml": "- regex: 'x(?= )'\n",
+		"unknown.yaml": "- regexp: timeout\n",
+	} {
+		if _, err := loadChartSearches(write(name, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func Test_applyChartDefaults(t *testing.T) {
+	index := &Index{}
+	(&options{}).applyChartDefaults(index)
+	if len(index.Search) != len(defaultChartSearches) {
+		t.Errorf("expected the built-in searches: %v", index.Search)
+	}
+
+	o := &options{chartSearches: []chartSearch{{Label: "timeouts", Regex: "timeout"}, {Regex: "panic"}}}
+	index = &Index{}
+	o.applyChartDefaults(index)
+	if !reflect.DeepEqual(index.Search, []string{"timeout", "panic"}) {
+		t.Errorf("unexpected searches: %v", index.Search)
+	}
+	if labels := o.chartLabels(); !reflect.DeepEqual(labels, map[string]string{"timeout": "timeouts"}) {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+
+	// searches in the request are kept
+	index = &Index{Search: []string{"etcd"}}
+	o.applyChartDefaults(index)
+	if !reflect.DeepEqual(index.Search, []string{"etcd"}) {
+		t.Errorf("unexpected searches: %v", index.Search)
+	}
+}
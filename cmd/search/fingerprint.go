@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// topLinesCount is the number of distinct matched lines summarized for a search.
+const topLinesCount = 5
+
+var (
+	fingerprintTimestamp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?|\b[IWEF]\d{4} \d{2}:\d{2}:\d{2}(\.\d+)?|\b\d{2}:\d{2}:\d{2}(\.\d+)?`)
+	fingerprintUUID      = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+	fingerprintIP        = regexp.MustCompile(`\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}(:\d+)?\b`)
+	fingerprintHex       = regexp.MustCompile(`\b(0x)?[0-9a-fA-F]{8,}\b`)
+	fingerprintNumber    = regexp.MustCompile(`\b\d+(\.\d+)?`)
+	fingerprintSpace     = regexp.MustCompile(`\s+`)
+)
+
+// fingerprintLine normalizes the parts of a line that vary between otherwise identical
+// failures, such as timestamps, identifiers, addresses, and numbers, so that lines
+// reporting the same problem compare equal.
+func fingerprintLine(line string) string {
+	line = fingerprintTimestamp.ReplaceAllString(line, "<time>")
+	line = fingerprintUUID.ReplaceAllString(line, "<uuid>")
+	line = fingerprintIP.ReplaceAllString(line, "<ip>")
+	line = fingerprintHex.ReplaceAllStringFunc(line, func(s string) string {
+		// a run of hex letters is more likely a word than an identifier
+		if !strings.ContainsAny(s, "0123456789") {
+			return s
+		}
+		return "<hex>"
+	})
+	line = fingerprintNumber.ReplaceAllString(line, "N")
+	return strings.TrimSpace(fingerprintSpace.ReplaceAllString(line, " "))
+}
+
+// TopLine is a distinct matched line after normalization and the number of matches
+// that had that line.
+type TopLine struct {
+	// Line is the normalized form of the matched line.
+	Line string `json:"line"`
+	// Example is the first matched line seen with this normalized form.
+	Example string `json:"example"`
+	Count   int    `json:"count"`
+}
+
+// lineTally counts matched lines by their fingerprint.
+type lineTally struct {
+	lines map[string]*TopLine
+}
+
+// Add records the line in a match that matched search.
+func (t *lineTally) Add(search string, contextLines int, lines []string) {
+	line := matchedLine(search, contextLines, lines)
+	if len(line) == 0 {
+		return
+	}
+	fingerprint := fingerprintLine(line)
+	if t.lines == nil {
+		t.lines = make(map[string]*TopLine)
+	}
+	if existing, ok := t.lines[fingerprint]; ok {
+		existing.Count++
+		return
+	}
+	t.lines[fingerprint] = &TopLine{Line: fingerprint, Example: line, Count: 1}
+}
+
+// Top returns up to n of the most frequent lines, most frequent first.
+func (t *lineTally) Top(n int) []TopLine {
+	top := make([]TopLine, 0, len(t.lines))
+	for _, line := range t.lines {
+		top = append(top, *line)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Line < top[j].Line
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// renderTopLines writes a summary list of the most frequent matched lines.
+func renderTopLines(w io.Writer, lines []TopLine) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintln(w, `<div class="small mb-3"><strong>Most common matched lines</strong><ul class="list-unstyled mb-0">`)
+	for _, line := range lines {
+		fmt.Fprintf(w, "<li><span class=\"badge badge-secondary\">%d</span> <code title=\"%s\">%s</code></li>\n", line.Count, template.HTMLEscapeString(line.Line), template.HTMLEscapeString(line.Example))
+	}
+	fmt.Fprintln(w, `</ul></div>`)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_fingerprintLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "error: etcdserver: request timed out", want: "error: etcdserver: request timed out"},
+		{line: "E0102 15:04:05.123456    1234 controller.go:42] sync failed", want: "<time> N controller.go:N] sync failed"},
+		{line: "2023-01-02T15:04:05.123Z level=error msg=\"dial tcp 10.0.12.7:6443: i/o timeout\"", want: "<time> level=error msg=\"dial tcp <ip>: i/o timeout\""},
+		{line: "pod 0b1f6a44-2c3d-4e5f-8a9b-0c1d2e3f4a5b was deleted", want: "pod <uuid> was deleted"},
+		{line: "image sha256:4f8c2a9d1e3b5c7a failed to pull, deadbeef", want: "image sha256:<hex> failed to pull, deadbeef"},
+		{line: "  took   12.5s  ", want: "took Ns"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := fingerprintLine(tt.line); got != tt.want {
+				t.Errorf("fingerprintLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lineTally(t *testing.T) {
+	var tally lineTally
+	for _, line := range []string{
+		"dial tcp 10.0.0.1:6443: connection refused",
+		"dial tcp 10.0.0.2:6443: connection refused",
+		"context deadline exceeded after 30s",
+		"dial tcp 10.0.0.3:6443: connection refused",
+		"context deadline exceeded after 45s",
+		"unrelated",
+	} {
+		tally.Add("refused|exceeded|unrelated", 0, []string{line})
+	}
+	want := []TopLine{
+		{Line: "dial tcp <ip>: connection refused", Example: "dial tcp 10.0.0.1:6443: connection refused", Count: 3},
+		{Line: "context deadline exceeded after Ns", Example: "context deadline exceeded after 30s", Count: 2},
+	}
+	if got := tally.Top(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Top() = %#v, want %#v", got, want)
+	}
+}
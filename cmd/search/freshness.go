@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// Freshness describes how far the searchable index is behind the jobs known to the
+// server.
+type Freshness struct {
+	// IndexAge is the time since the job index was last loaded from disk.
+	IndexAge time.Duration `json:"indexAge"`
+	// Lag is the time between the most recently completed failed job known to the
+	// server and the most recently indexed job file.
+	Lag time.Duration `json:"lag"`
+}
+
+// Behind returns the larger of the index age and the indexing lag.
+func (f Freshness) Behind() time.Duration {
+	if f.Lag > f.IndexAge {
+		return f.Lag
+	}
+	return f.IndexAge
+}
+
+// freshness returns how far the job index is behind as of now. Values that cannot be
+// determined, such as before the first load, are zero.
+func (o *options) freshness(now time.Time) Freshness {
+	var f Freshness
+	if o.jobsIndex == nil {
+		return f
+	}
+	loaded, newestIndexed := o.jobsIndex.Freshness()
+	if !loaded.IsZero() {
+		f.IndexAge = now.Sub(loaded)
+	}
+	if o.jobAccessor == nil || newestIndexed.IsZero() {
+		return f
+	}
+	jobs, err := o.jobAccessor.List(labels.Everything())
+	if err != nil {
+		klog.V(4).Infof("Unable to list jobs to compute indexing lag: %v", err)
+		return f
+	}
+	var newestKnown time.Time
+	for _, job := range jobs {
+		// only failed jobs are guaranteed to have indexed files
+		switch job.Status.State {
+		case "failure", "error":
+		default:
+			continue
+		}
+		if len(job.Status.URL) == 0 {
+			continue
+		}
+		if t := job.Status.CompletionTime.Time; t.After(newestKnown) {
+			newestKnown = t
+		}
+	}
+	if newestKnown.After(newestIndexed) {
+		f.Lag = newestKnown.Sub(newestIndexed)
+	}
+	return f
+}
+
+// freshnessWarning returns a warning if the index is further behind than the configured
+// threshold, unless the request asked for the warning to be hidden.
+func (o *options) freshnessWarning(index *Index) string {
+	if o.FreshnessWarningThreshold <= 0 || index.HideFreshnessWarning {
+		return ""
+	}
+	behind := o.freshness(time.Now()).Behind()
+	if behind < o.FreshnessWarningThreshold {
+		return ""
+	}
+	return fmt.Sprintf("Indexing is behind, results may be up to %d minutes out of date.", int(behind.Minutes()))
+}
+
+// renderFreshnessWarning writes the freshness warning for index, if any, as an alert.
+func (o *options) renderFreshnessWarning(w io.Writer, index *Index) {
+	if warning := o.freshnessWarning(index); len(warning) > 0 {
+		fmt.Fprintf(w, `<p class="alert alert-warning">%s</p>`, template.HTMLEscapeString(warning))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_freshness(t *testing.T) {
+	now := time.Now()
+	jobs, err := prow.NewListerForJobs([]*prow.Job{
+		testFreshnessJob("a", "1", "failure", now.Add(-40*time.Minute)),
+		testFreshnessJob("b", "1", "success", now.Add(-time.Minute)),
+		testFreshnessJob("c", "1", "error", now.Add(-50*time.Minute)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &options{
+		jobAccessor: jobs,
+		jobsIndex: &pathIndex{
+			loaded:  now.Add(-5 * time.Minute),
+			ordered: []pathAge{{path: "a/2/build-log.txt", age: now.Add(-2 * time.Hour)}},
+		},
+		FreshnessWarningThreshold: time.Hour,
+	}
+
+	f := o.freshness(now)
+	if f.IndexAge != 5*time.Minute || f.Lag != 80*time.Minute || f.Behind() != 80*time.Minute {
+		t.Fatalf("unexpected freshness: %#v", f)
+	}
+	if warning := o.freshnessWarning(&Index{}); warning != "Indexing is behind, results may be up to 80 minutes out of date." {
+		t.Errorf("unexpected warning: %q", warning)
+	}
+	if warning := o.freshnessWarning(&Index{HideFreshnessWarning: true}); warning != "" {
+		t.Errorf("expected warning to be hidden: %q", warning)
+	}
+	o.FreshnessWarningThreshold = 2 * time.Hour
+	if warning := o.freshnessWarning(&Index{}); warning != "" {
+		t.Errorf("expected no warning below the threshold: %q", warning)
+	}
+}
+
+func testFreshnessJob(job, buildID, state string, completed time.Time) *prow.Job {
+	j := &prow.Job{}
+	j.Name = job + "-" + buildID
+	j.Spec.Job = job
+	j.Status.State = state
+	j.Status.BuildID = buildID
+	j.Status.URL = "https://prow.example.com/view/gs/bucket/logs/" + job + "/" + buildID
+	j.Status.CompletionTime.Time = completed
+	return j
+}
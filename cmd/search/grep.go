@@ -9,17 +9,64 @@ import (
 	"io/ioutil"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/blang/semver/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 )
 
+var (
+	metricRipgrepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "search_ripgrep_duration_seconds",
+		Help:    "The wall-clock time taken by a single ripgrep command, by search type.",
+		Buckets: []float64{0.01, 0.1, 1, 10, 100},
+	}, []string{"type"})
+	metricRipgrepExits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "search_ripgrep_exits_total",
+		Help: "The number of ripgrep commands that exited, by search type and exit code. ripgrep exits 1 when nothing matched, and -1 indicates the command was killed.",
+	}, []string{"type", "code"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		metricRipgrepDuration,
+		metricRipgrepExits,
+	)
+}
+
 var ErrMaxBytes = fmt.Errorf("reached maximum search length, more results not shown")
 
+// maxLineLength is the maximum number of bytes of a single line of output that is
+// captured. Longer lines are truncated so that pathological lines (such as a dumped
+// binary blob) do not consume unbounded memory.
+const maxLineLength = 64 * 1024
+
+// writeLineCapped appends data to buf until buf reaches maxLineLength bytes, and returns
+// the number of bytes that were dropped. If buf is nil, no bytes are written or dropped.
+func writeLineCapped(buf *bytes.Buffer, data []byte) int {
+	if buf == nil {
+		return 0
+	}
+	remaining := maxLineLength - buf.Len()
+	if remaining <= 0 {
+		return len(data)
+	}
+	if len(data) <= remaining {
+		buf.Write(data)
+		return 0
+	}
+	buf.Write(data[:remaining])
+	return len(data) - remaining
+}
+
 type CommandGenerator interface {
 	Command(index *Index, search string, jobNames sets.String) (cmd string, args []string, paths []string, err error)
 	PathPrefix() string
@@ -38,13 +85,18 @@ type ripgrepGenerator struct {
 }
 
 func (g ripgrepGenerator) Command(index *Index, search string, jobNames sets.String) (string, []string, []string, error) {
-	args := []string{g.execPath, "-a", "-z", "-u", "--color", "never", "-S", "--null", "--no-line-number", "--no-heading"}
-	if index.Context >= 0 {
-		args = append(args, "--context", strconv.Itoa(index.Context))
-	} else {
-		args = append(args, "--context", "0")
+	// --stats reports the bytes searched after the results
+	args := []string{g.execPath, "-a", "-z", "-u", "--color", "never", caseArgument(index.Case), "--null", "--no-heading", "--stats"}
+	switch {
+	case index.CountOnly:
+		// each matching file is reported as a single line containing the count of matches
+		args = append(args, "--count", "--no-line-number")
+	case index.Context >= 0:
+		args = append(args, "--line-number", "--context", strconv.Itoa(index.Context))
+	default:
+		args = append(args, "--line-number", "--context", "0")
 	}
-	if index.MaxMatches > 0 {
+	if index.MaxMatches > 0 && !index.CountOnly {
 		// always capture at least one more result than requested because rg terminates
 		// its search at the last result and won't return context for that result
 		if index.Context > 0 {
@@ -53,7 +105,14 @@ func (g ripgrepGenerator) Command(index *Index, search string, jobNames sets.Str
 			args = append(args, "--max-count", strconv.Itoa(index.MaxMatches))
 		}
 	}
-	args = append(args, search)
+	if index.Literal {
+		args = append(args, "--fixed-strings")
+	}
+	if spansLines(index, search) {
+		args = append(args, "--multiline")
+	}
+	// pass the search with -e so that a search starting with a dash is not a flag
+	args = append(args, "-e", search)
 	newArgs, paths, err := g.arguments.RipgrepSourceArguments(index, jobNames)
 	if err != nil {
 		return "", nil, nil, err
@@ -61,19 +120,91 @@ func (g ripgrepGenerator) Command(index *Index, search string, jobNames sets.Str
 	return g.execPath, append(args, newArgs...), paths, nil
 }
 
+// maxMultilineMatchLines is the number of lines each match of a search that spans lines
+// may add to a result before the remaining lines are hidden.
+const maxMultilineMatchLines = 100
+
+// reDotMatchesNewline matches a flag group of a regular expression that enables the s
+// flag, under which . matches a newline.
+var reDotMatchesNewline = regexp.MustCompile(`\(\?[a-zA-Z]*s[a-zA-Z]*(-[a-zA-Z]*)?[:)]`)
+
+// spansLines returns true if search may match text across more than one line, which
+// ripgrep only allows in multiline mode. A literal search spans lines only if it
+// contains a newline.
+func spansLines(index *Index, search string) bool {
+	if strings.Contains(search, "\n") {
+		return true
+	}
+	if index.Literal {
+		return false
+	}
+	return strings.Contains(search, `\n`) || reDotMatchesNewline.MatchString(search)
+}
+
+// caseArgument returns the ripgrep flag for the case sensitivity of a search.
+func caseArgument(sensitivity string) string {
+	switch sensitivity {
+	case "sensitive":
+		return "-s"
+	case "insensitive":
+		return "-i"
+	default:
+		return "-S"
+	}
+}
+
 func (g ripgrepGenerator) PathPrefix() string {
 	return g.searchPath
 }
 
-func NewCommandGenerator(searchPath string, arguments RipgrepSourceArguments) (CommandGenerator, error) {
-	if path, err := exec.LookPath("rg"); err == nil {
-		klog.Infof("Using ripgrep at %s for searches", path)
-		return ripgrepGenerator{execPath: path, searchPath: searchPath, arguments: arguments}, nil
+// minimumRipgrepVersion is the oldest ripgrep whose output runSingleCommand is known to
+// parse correctly.
+var minimumRipgrepVersion = semver.MustParse("11.0.0")
+
+// NewCommandGenerator returns a generator for searches run by the ripgrep binary at
+// execPath, which is looked up on the path if it does not contain a slash. An error is
+// returned if the binary cannot be found or is older than minimumRipgrepVersion.
+func NewCommandGenerator(execPath, searchPath string, arguments RipgrepSourceArguments) (CommandGenerator, error) {
+	path, err := exec.LookPath(execPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not find ripgrep: %v", err)
+	}
+	version, err := ripgrepVersion(path)
+	if err != nil {
+		return nil, err
+	}
+	if version.LT(minimumRipgrepVersion) {
+		return nil, fmt.Errorf("ripgrep at %s is version %s, but at least %s is required", path, version, minimumRipgrepVersion)
+	}
+	klog.Infof("Using ripgrep %s at %s for searches", version, path)
+	return ripgrepGenerator{execPath: path, searchPath: searchPath, arguments: arguments}, nil
+}
+
+// ripgrepVersion returns the version reported by the ripgrep binary at path.
+func ripgrepVersion(path string) (semver.Version, error) {
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return semver.Version{}, fmt.Errorf("unable to get the version of ripgrep at %s: %v", path, err)
+	}
+	return parseRipgrepVersion(string(out))
+}
+
+// parseRipgrepVersion parses the output of rg --version, whose first line looks like
+// "ripgrep 13.0.0 (rev 7ec2fd51ba)".
+func parseRipgrepVersion(out string) (semver.Version, error) {
+	line, _, _ := strings.Cut(out, "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "ripgrep" {
+		return semver.Version{}, fmt.Errorf("unrecognized ripgrep version %q", line)
+	}
+	version, err := semver.ParseTolerant(fields[1])
+	if err != nil {
+		return semver.Version{}, fmt.Errorf("unrecognized ripgrep version %q: %v", line, err)
 	}
-	return nil, fmt.Errorf("could not find 'rg' on the path")
+	return version, nil
 }
 
-type GrepFunc func(name string, search string, lines []bytes.Buffer, moreLines int) error
+type GrepFunc func(name string, search string, lines []bytes.Buffer, lineNumber int, moreLines int) error
 
 // executeGrep search for matches to index and, for each match found,
 // calls fn with the following arguments:
@@ -82,9 +213,31 @@ type GrepFunc func(name string, search string, lines []bytes.Buffer, moreLines i
 //     resolved relative to the index base.
 //   - search, the string from Index.Search which resulted in the callback.
 //   - lines, the match with its surrounding context.
+//   - lineNumber, the line number in the file of the first of lines, counting
+//     from one, or zero if the command does not report line numbers.
 //   - moreLines, the number of elided lines, when the match and context
 //     is truncated due to excessive length.
 func executeGrep(ctx context.Context, gen CommandGenerator, index *Index, jobNames sets.String, fn GrepFunc) error {
+	if len(index.require) > 0 {
+		var err error
+		if fn, err = requireInFile(gen.PathPrefix(), index.require, fn); err != nil {
+			return err
+		}
+	}
+	if len(index.Exclude) > 0 {
+		var err error
+		if fn, err = excludeInFile(gen.PathPrefix(), index, fn); err != nil {
+			return err
+		}
+	}
+	if index.AllOf && len(index.Search) > 1 {
+		return executeGrepAllOf(ctx, gen, index, jobNames, fn)
+	}
+	if index.combineSearches && len(index.Search) > 1 {
+		if matchers, ok := searchMatchers(index); ok {
+			return executeGrepCombined(ctx, gen, index, matchers, jobNames, fn)
+		}
+	}
 	for _, search := range index.Search {
 		if err := executeGrepSingle(ctx, gen, index, search, jobNames, fn); err != nil {
 			return err
@@ -93,6 +246,226 @@ func executeGrep(ctx context.Context, gen CommandGenerator, index *Index, jobNam
 	return nil
 }
 
+// executeGrepAllOf runs each search in index and calls fn only for the files that
+// matched every search. The matches of all but the last search are held until a file
+// matches the last search, and are then reported before the matches of the last search
+// as they are found. The held matches are limited to MaxBytes in total, after which the
+// search stops with ErrMaxBytes. Each search still reports at most MaxMatches matches
+// per file, so a file reports at most MaxMatches times the number of searches. Matches
+// for different searches are reported separately even when their context overlaps, so
+// the same lines may appear once for each search.
+func executeGrepAllOf(ctx context.Context, gen CommandGenerator, index *Index, jobNames sets.String, fn GrepFunc) error {
+	type fileMatch struct {
+		search     string
+		lines      []bytes.Buffer
+		lineNumber int
+		moreLines  int
+	}
+	found := make(map[string][]fileMatch)
+	var held int64
+	last := len(index.Search) - 1
+	for i, search := range index.Search[:last] {
+		matched := sets.NewString()
+		if err := executeGrepSingle(ctx, gen, index, search, jobNames, func(name string, search string, lines []bytes.Buffer, lineNumber int, moreLines int) error {
+			// only files that matched every earlier search can match all of them
+			if _, ok := found[name]; !ok && i > 0 {
+				return nil
+			}
+			// the lines are reused by the caller once fn returns
+			copied := make([]bytes.Buffer, len(lines))
+			for j := range lines {
+				copied[j].Write(lines[j].Bytes())
+				held += int64(lines[j].Len())
+			}
+			if index.MaxBytes > 0 && held > index.MaxBytes {
+				return ErrMaxBytes
+			}
+			found[name] = append(found[name], fileMatch{search: search, lines: copied, lineNumber: lineNumber, moreLines: moreLines})
+			matched.Insert(name)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for name, matches := range found {
+			if !matched.Has(name) {
+				for _, match := range matches {
+					for _, line := range match.lines {
+						held -= int64(line.Len())
+					}
+				}
+				delete(found, name)
+			}
+		}
+	}
+	reported := sets.NewString()
+	return executeGrepSingle(ctx, gen, index, index.Search[last], jobNames, func(name string, search string, lines []bytes.Buffer, lineNumber int, moreLines int) error {
+		if !reported.Has(name) {
+			matches, ok := found[name]
+			if !ok {
+				return nil
+			}
+			// the file matched every search, so its held matches are reported first
+			for _, match := range matches {
+				if err := fn(name, match.search, match.lines, match.lineNumber, match.moreLines); err != nil {
+					return err
+				}
+			}
+			delete(found, name)
+			reported.Insert(name)
+		}
+		return fn(name, search, lines, lineNumber, moreLines)
+	})
+}
+
+// searchMatchers returns a regular expression for each search of index that matches the
+// lines ripgrep matches for it, or false if a search cannot be compiled as a Go regular
+// expression.
+func searchMatchers(index *Index) ([]*regexp.Regexp, bool) {
+	matchers := make([]*regexp.Regexp, 0, len(index.Search))
+	for _, search := range index.Search {
+		re, err := regexp.Compile(searchPattern(index, search))
+		if err != nil {
+			klog.V(4).Infof("Search %q cannot be combined with other searches: %v", search, err)
+			return nil, false
+		}
+		matchers = append(matchers, re)
+	}
+	return matchers, true
+}
+
+// executeGrepCombined runs every search in index as a single ripgrep pass of the
+// alternation of the searches, and calls fn for each search that matched a line of each
+// result. Since any line matching a search is a match in the combined pass, a result is
+// attributed to a search if any of its lines match the search.
+//
+// The matched search is found by matching the lines again with Go regular expressions
+// rather than with ripgrep's --replace and a capture group per search, since replacing
+// would change the lines shown to the user and capture groups in the searches would
+// change the group numbers.
+//
+// The pass allows MaxMatches matches per search in each file. If one search uses up
+// that limit before a file is fully read, the searches that did not match the lines read
+// are looked for in the rest of the file and reported with their first matching line.
+func executeGrepCombined(ctx context.Context, gen CommandGenerator, index *Index, matchers []*regexp.Regexp, jobNames sets.String, fn GrepFunc) error {
+	patterns := make([]string, 0, len(index.Search))
+	for _, search := range index.Search {
+		patterns = append(patterns, "(?:"+searchPattern(index, search)+")")
+	}
+	// literal searches have already been quoted
+	combined := *index
+	combined.Literal = false
+	combined.MaxMatches = index.MaxMatches * len(index.Search)
+	pathPrefix := gen.PathPrefix()
+	found := make([]bool, len(matchers))
+	return executeGrepSingle(ctx, gen, &combined, strings.Join(patterns, "|"), jobNames, func(name string, _ string, lines []bytes.Buffer, lineNumber int, moreLines int) error {
+		matchedLines := 0
+		for j := range lines {
+			for _, re := range matchers {
+				if re.Match(lines[j].Bytes()) {
+					matchedLines++
+					break
+				}
+			}
+		}
+		for i, re := range matchers {
+			found[i] = false
+			for j := range lines {
+				if !re.Match(lines[j].Bytes()) {
+					continue
+				}
+				if err := fn(name, index.Search[i], lines, lineNumber, moreLines); err != nil {
+					return err
+				}
+				found[i] = true
+				break
+			}
+		}
+		if combined.MaxMatches == 0 || matchedLines < combined.MaxMatches {
+			return nil
+		}
+		// ripgrep stopped reading the file at the limit, so later lines may match other searches
+		for i, re := range matchers {
+			if found[i] {
+				continue
+			}
+			line, n, ok := firstMatchingLine(filepath.Join(pathPrefix, filepath.FromSlash(name)), re)
+			if !ok {
+				continue
+			}
+			var buf bytes.Buffer
+			if truncated := writeLineCapped(&buf, line); truncated > 0 {
+				fmt.Fprintf(&buf, " ... (%d bytes truncated)", truncated)
+			}
+			if err := fn(name, index.Search[i], []bytes.Buffer{buf}, n, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// requireInFile wraps fn so that matches are only passed to fn when the matching file
+// also contains a line matching require.
+func requireInFile(pathPrefix string, require string, fn GrepFunc) (GrepFunc, error) {
+	re, err := compileSearch(require)
+	if err != nil {
+		return nil, fmt.Errorf("required pattern is not valid: %v", err)
+	}
+	checked := make(map[string]bool)
+	return func(name string, search string, lines []bytes.Buffer, lineNumber int, moreLines int) error {
+		ok, found := checked[name]
+		if !found {
+			ok = fileContains(filepath.Join(pathPrefix, filepath.FromSlash(name)), re)
+			checked[name] = ok
+		}
+		if !ok {
+			return nil
+		}
+		return fn(name, search, lines, lineNumber, moreLines)
+	}, nil
+}
+
+// excludeMatchers compiles the exclusions of index with the same literal and case
+// settings as its searches.
+func excludeMatchers(index *Index) ([]*regexp.Regexp, error) {
+	matchers := make([]*regexp.Regexp, 0, len(index.Exclude))
+	for _, exclude := range index.Exclude {
+		re, err := regexp.Compile(searchPattern(index, exclude))
+		if err != nil {
+			return nil, fmt.Errorf("exclude %q is not a valid regular expression: %v", exclude, err)
+		}
+		matchers = append(matchers, re)
+	}
+	return matchers, nil
+}
+
+// excludeInFile wraps fn so that matches are not passed to fn when the matching file
+// also contains a line matching any exclusion of index. Each file is checked once, so
+// excluded files do not count towards MaxResults or the grouped results of a job.
+func excludeInFile(pathPrefix string, index *Index, fn GrepFunc) (GrepFunc, error) {
+	matchers, err := excludeMatchers(index)
+	if err != nil {
+		return nil, err
+	}
+	excluded := make(map[string]bool)
+	return func(name string, search string, lines []bytes.Buffer, lineNumber int, moreLines int) error {
+		skip, found := excluded[name]
+		if !found {
+			path := filepath.Join(pathPrefix, filepath.FromSlash(name))
+			for _, re := range matchers {
+				if skip = fileContains(path, re); skip {
+					break
+				}
+			}
+			excluded[name] = skip
+		}
+		if skip {
+			return nil
+		}
+		return fn(name, search, lines, lineNumber, moreLines)
+	}, nil
+}
+
 func estimateLength(arr []string) int {
 	l := 0
 	for _, s := range arr {
@@ -130,8 +503,13 @@ func executeGrepSingle(ctx context.Context, gen CommandGenerator, index *Index,
 	}
 	maxBytes := index.MaxBytes
 	pathPrefix := gen.PathPrefix()
+	lineNumbers := slices.Contains(commandArgs, "--line-number")
 
 	for len(commandPaths) > 0 {
+		// do not start another batch for a caller that has stopped the search
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		var args []string
 		args, commandPaths = splitStringSliceByLength(commandPaths, maxArgs)
 		if len(args) == 0 {
@@ -141,7 +519,11 @@ func executeGrepSingle(ctx context.Context, gen CommandGenerator, index *Index,
 		cmd := &exec.Cmd{}
 		cmd.Path = commandPath
 		cmd.Args = append(commandArgs, args...)
-		bytesRead, err := runSingleCommand(ctx, cmd, pathPrefix, index, maxBytes, search, fn)
+		bytesRead, err := runSingleCommand(ctx, cmd, pathPrefix, index, maxBytes, search, lineNumbers, fn)
+		index.addOutputBytes(bytesRead)
+		if ctxErr := ctx.Err(); ctxErr != nil && (err == nil || err == io.EOF) {
+			return ctxErr
+		}
 		if err != nil && err != io.EOF {
 			if strings.Contains(err.Error(), "argument list too long") {
 				return fmt.Errorf("arguments too long: %d bytes", estimateLength(cmd.Args))
@@ -154,7 +536,10 @@ func executeGrepSingle(ctx context.Context, gen CommandGenerator, index *Index,
 	return nil
 }
 
-func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, index *Index, maxBytes int64, search string, fn GrepFunc) (int64, error) {
+// runSingleCommand runs cmd and passes each block of matching lines it outputs to fn. If
+// lineNumbers is true, each line of output is prefixed by its line number, as ripgrep
+// does with --line-number.
+func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, index *Index, maxBytes int64, search string, lineNumbers bool, fn GrepFunc) (_ int64, runErr error) {
 	errOut := &bytes.Buffer{}
 	cmd.Stderr = errOut
 	pr, err := cmd.StdoutPipe()
@@ -162,14 +547,31 @@ func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, ind
 		return 0, err
 	}
 
+	start := time.Now()
 	if err := cmd.Start(); err != nil {
 		return 0, err
 	}
+	// terminate the command if the caller stops the search, which is checked after the
+	// remaining output is drained
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-finished:
+		}
+	}()
 
 	maxLines := index.MaxMatches
 	if index.Context > 0 {
 		maxLines *= index.Context*2 + 1
 	}
+	// a match of a multiline search is more than one line, so leave room for the lines
+	// of each match as well as its context
+	if spansLines(index, search) {
+		maxLines += index.MaxMatches * (maxMultilineMatchLines - 1)
+	}
 
 	br := bufio.NewReaderSize(pr, 512*1024)
 	filename := bytes.NewBuffer(make([]byte, 1024))
@@ -178,6 +580,8 @@ func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, ind
 	matches := 0
 	match := make([]bytes.Buffer, maxLines)
 	line := 0
+	// firstLine is the line number of the first line of the current match
+	firstLine := 0
 
 	// send dispatches the result to the caller synchronously without allocating
 	send := func() error {
@@ -197,24 +601,40 @@ func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, ind
 		}
 
 		hidden := (line) - len(result)
-		klog.V(7).Infof("Captured %d lines for %s, %d not shown", line, path, hidden)
+		requestLog(ctx).V(7).Infof("Captured %d lines for %s, %d not shown", line, path, hidden)
 		matches++
-		return fn(filepath.ToSlash(relPath), search, result, hidden)
+		return fn(filepath.ToSlash(relPath), search, result, firstLine, hidden)
 	}
 
 	defer func() {
+		// output is left unread and the command is killed when the caller stops the
+		// search or it reaches maxBytes, which is expected
+		stopped := ctx.Err() != nil || (runErr != nil && runErr != io.EOF)
 		n, err := io.Copy(ioutil.Discard, pr)
 		if n > 0 || (err != nil && err != io.EOF) {
-			klog.Errorf("Unread input %d: %v", n, err)
+			if stopped {
+				requestLog(ctx).V(4).Infof("Discarded unread input %d after the search stopped: %v", n, err)
+			} else {
+				requestLog(ctx).Errorf("Unread input %d: %v", n, err)
+			}
+		}
+		requestLog(ctx).V(6).Infof("Waiting for command to finish after reading %d lines and %d bytes", linesRead, bytesRead)
+		err = cmd.Wait()
+		metricRipgrepDuration.WithLabelValues(index.SearchType).Observe(time.Since(start).Seconds())
+		if cmd.ProcessState != nil {
+			metricRipgrepExits.WithLabelValues(index.SearchType, strconv.Itoa(cmd.ProcessState.ExitCode())).Inc()
 		}
-		klog.V(6).Infof("Waiting for command to finish after reading %d lines and %d bytes", linesRead, bytesRead)
-		if err := cmd.Wait(); err != nil {
+		if err != nil {
 			if exitErr, ok := err.(*exec.ExitError); ok && matches == 0 {
 				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 1 {
 					return
 				}
 			}
-			klog.Errorf("Failed to wait for command: %v", err)
+			if stopped {
+				requestLog(ctx).V(4).Infof("Command exited after the search stopped: %v", err)
+				return
+			}
+			requestLog(ctx).Errorf("Failed to wait for command: %v", err)
 		}
 	}()
 
@@ -232,6 +652,16 @@ func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, ind
 		if isMatchLine {
 			// beginning of line, find the filename
 			filenameEnd := bytes.IndexByte(chunk, 0x00)
+			if len(chunk) == 0 {
+				// the statistics printed by --stats follow the results after an empty line
+				if err := send(); err != nil {
+					return bytesRead, err
+				}
+				if n, ok := readBytesSearched(br); ok {
+					index.addBytesScanned(n)
+				}
+				return bytesRead, io.EOF
+			}
 			if filenameEnd < 1 {
 				if len(chunk) > 140 {
 					chunk = chunk[:140]
@@ -242,9 +672,9 @@ func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, ind
 			nextFilename = chunk[:filenameEnd+1]
 			switch {
 			case len(nextFilename) == 0:
-				klog.Errorf("Found empty filename position %d", position)
+				requestLog(ctx).Errorf("Found empty filename position %d", position)
 			case nextFilename[0] != '/':
-				klog.Errorf("Found filename without leading / at position %d: %s", position, string(nextFilename))
+				requestLog(ctx).Errorf("Found filename without leading / at position %d: %s", position, string(nextFilename))
 			}
 			position += filenameEnd + 1
 			chunk = chunk[filenameEnd+1:]
@@ -252,7 +682,15 @@ func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, ind
 				filename.Write(nextFilename)
 			}
 		}
+		lineNumber := 0
+		if isMatchLine && lineNumbers {
+			if n, rest, ok := cutLineNumber(chunk); ok {
+				lineNumber, chunk = n, rest
+			}
+		}
 
+		// current is the buffer the line is being written to, if any
+		var current *bytes.Buffer
 		switch {
 		case !isMatchLine || !bytes.Equal(nextFilename, filename.Bytes()):
 			// filename from current line doesn't match previous filename, so we flush the match to the caller
@@ -268,9 +706,10 @@ func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, ind
 				filename.Reset()
 				filename.Write(nextFilename)
 
-				match[0].Reset()
-				match[0].Write(chunk)
+				current = &match[0]
+				current.Reset()
 				line = 1
+				firstLine = lineNumber
 			}
 
 		case line >= maxLines:
@@ -279,12 +718,16 @@ func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, ind
 
 		default:
 			// add line to the current match
-			match[line].Reset()
-			match[line].Write(chunk)
+			if line == 0 {
+				firstLine = lineNumber
+			}
+			current = &match[line]
+			current.Reset()
 			line++
 		}
+		truncated := writeLineCapped(current, chunk)
 
-		// exhaust the rest of the current line
+		// exhaust the rest of the current line, keeping at most maxLineLength bytes
 		for isPrefix {
 			position += len(chunk)
 			chunk, isPrefix, err = br.ReadLine()
@@ -295,6 +738,10 @@ func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, ind
 				return bytesRead, err
 			}
 			bytesRead += int64(len(chunk))
+			truncated += writeLineCapped(current, chunk)
+		}
+		if truncated > 0 {
+			fmt.Fprintf(current, " ... (%d bytes truncated)", truncated)
 		}
 
 		// read next line
@@ -309,3 +756,37 @@ func runSingleCommand(ctx context.Context, cmd *exec.Cmd, pathPrefix string, ind
 		bytesRead += int64(len(chunk))
 	}
 }
+
+// readBytesSearched reads the statistics ripgrep prints with --stats and returns the
+// number of bytes it searched.
+func readBytesSearched(br *bufio.Reader) (int64, bool) {
+	for {
+		line, err := br.ReadString('\n')
+		if s, ok := strings.CutSuffix(strings.TrimSpace(line), " bytes searched"); ok {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return n, true
+			}
+		}
+		if err != nil {
+			return 0, false
+		}
+	}
+}
+
+// cutLineNumber returns the line number that ripgrep prints before a line of output,
+// followed by a colon for a matching line or a dash for a line of context, and the rest
+// of the line.
+func cutLineNumber(chunk []byte) (int, []byte, bool) {
+	i := 0
+	for i < len(chunk) && chunk[i] >= '0' && chunk[i] <= '9' {
+		i++
+	}
+	if i == 0 || i == len(chunk) || (chunk[i] != ':' && chunk[i] != '-') {
+		return 0, chunk, false
+	}
+	n, err := strconv.Atoi(string(chunk[:i]))
+	if err != nil {
+		return 0, chunk, false
+	}
+	return n, chunk[i+1:], true
+}
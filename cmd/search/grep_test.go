@@ -1,9 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"flag"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 )
 
@@ -38,3 +52,587 @@ func Test_executeGrepSingle(t *testing.T) {
 	// 	t.Fatal(err)
 	// }
 }
+
+func Test_requireInFile_gzip(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w := gzip.NewWriter(f)
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("install.txt.gz", "level=info\nlevel=error msg=\"failed to initialize the cluster\"\n")
+	write("upgrade.txt.gz", "level=error msg=\"upgrade failed\"\n")
+
+	var matched []string
+	fn, err := requireInFile(dir, "failed to initialize", func(name string, search string, lines []bytes.Buffer, _ int, moreLines int) error {
+		matched = append(matched, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"install.txt.gz", "upgrade.txt.gz"} {
+		if err := fn(name, "level=error", nil, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(matched) != 1 || matched[0] != "install.txt.gz" {
+		t.Errorf("expected only the compressed install log to match: %v", matched)
+	}
+}
+
+func Test_runSingleCommand_longLines(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("a", 4*1024*1024) + "needle"
+	output := "/var/lib/ci-search/job/1/build-log.txt\x00" + long + "\n" +
+		"/var/lib/ci-search/job/2/build-log.txt\x00needle short\n"
+	input := filepath.Join(dir, "output")
+	if err := os.WriteFile(input, []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		name  string
+		lines []string
+	}
+	var results []result
+	fn := func(name string, search string, lines []bytes.Buffer, _ int, moreLines int) error {
+		r := result{name: name}
+		for _, line := range lines {
+			r.lines = append(r.lines, line.String())
+		}
+		results = append(results, r)
+		return nil
+	}
+	_, err := runSingleCommand(context.TODO(), exec.Command("cat", input), "/var/lib/ci-search", &Index{MaxMatches: 5}, 64*1024*1024, "needle", false, fn)
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("unexpected results: %d", len(results))
+	}
+	if results[0].name != "job/1/build-log.txt" || len(results[0].lines) != 1 {
+		t.Fatalf("unexpected first result: %s %d", results[0].name, len(results[0].lines))
+	}
+	line := results[0].lines[0]
+	if !strings.HasSuffix(line, " ... (4128774 bytes truncated)") {
+		t.Errorf("expected truncation marker, got suffix %q", line[len(line)-40:])
+	}
+	if len(line) > maxLineLength+64 {
+		t.Errorf("line was not truncated: %d bytes", len(line))
+	}
+	if results[1].name != "job/2/build-log.txt" || len(results[1].lines) != 1 || results[1].lines[0] != "needle short" {
+		t.Errorf("unexpected second result: %#v", results[1])
+	}
+}
+
+func Test_runSingleCommand_lineNumbers(t *testing.T) {
+	prefix := "/var/lib/ci-search"
+	output := prefix + "/bug-1\x003-Status: NEW\n" +
+		prefix + "/bug-1\x004:error: connection refused\n" +
+		"--\n" +
+		prefix + "/bug-1\x0011-Seen again\n" +
+		prefix + "/bug-1\x0012:error: connection refused\n" +
+		prefix + "/bug-2\x001:2020-01-02 error: connection refused\n"
+	input := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(input, []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	fn := func(name string, search string, lines []bytes.Buffer, lineNumber int, moreLines int) error {
+		got = append(got, fmt.Sprintf("%s %d %q", name, lineNumber, trimMatchStrings(lines, nil)))
+		return nil
+	}
+	index := &Index{Search: []string{"connection refused"}, MaxMatches: 1, Context: 1}
+	if _, err := runSingleCommand(context.TODO(), exec.Command("cat", input), prefix, index, 64*1024*1024, "connection refused", true, fn); err != io.EOF {
+		t.Fatal(err)
+	}
+	want := []string{
+		`bug-1 3 ["Status: NEW" "error: connection refused"]`,
+		`bug-1 11 ["Seen again" "error: connection refused"]`,
+		`bug-2 1 ["2020-01-02 error: connection refused"]`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected results:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func Test_runSingleCommand_multiline(t *testing.T) {
+	prefix := "/var/lib/ci-search"
+	// ripgrep separates the blocks of each file with -- and prints every line of a
+	// multiline match, including empty lines
+	output := prefix + "/job/1/build-log.txt\x00before\n" +
+		prefix + "/job/1/build-log.txt\x00panic: runtime error\n" +
+		prefix + "/job/1/build-log.txt\x00\n" +
+		prefix + "/job/1/build-log.txt\x00goroutine 1 [running]:\n" +
+		prefix + "/job/1/build-log.txt\x00main.main()\n" +
+		prefix + "/job/1/build-log.txt\x00after\n" +
+		"--\n" +
+		prefix + "/job/1/build-log.txt\x00later\n" +
+		prefix + "/job/1/build-log.txt\x00panic: nil map\n" +
+		prefix + "/job/1/build-log.txt\x00goroutine 7 [running]:\n" +
+		prefix + "/job/1/build-log.txt\x00end\n" +
+		"--\n" +
+		prefix + "/job/2/build-log.txt\x00panic: again\n" +
+		prefix + "/job/2/build-log.txt\x00goroutine 3 [running]:\n"
+	input := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(input, []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	fn := func(name string, search string, lines []bytes.Buffer, _ int, moreLines int) error {
+		var trimmed []string
+		trimmed = trimMatchStrings(lines, trimmed)
+		got = append(got, fmt.Sprintf("%s %q %d", name, trimmed, moreLines))
+		return nil
+	}
+	search := `(?s)panic: .*?goroutine \d+`
+	index := &Index{Search: []string{search}, MaxMatches: 1, Context: 1}
+	if _, err := runSingleCommand(context.TODO(), exec.Command("cat", input), prefix, index, 64*1024*1024, search, false, fn); err != io.EOF {
+		t.Fatal(err)
+	}
+	want := []string{
+		`job/1/build-log.txt ["before" "panic: runtime error" "" "goroutine 1 [running]:" "main.main()" "after"] 0`,
+		`job/1/build-log.txt ["later" "panic: nil map" "goroutine 7 [running]:" "end"] 0`,
+		`job/2/build-log.txt ["panic: again" "goroutine 3 [running]:"] 0`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected results:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// without a multiline search, the lines beyond the context of each match are hidden
+	got = nil
+	if _, err := runSingleCommand(context.TODO(), exec.Command("cat", input), prefix, &Index{Search: []string{"panic"}, MaxMatches: 1, Context: 1}, 64*1024*1024, "panic", false, fn); err != io.EOF {
+		t.Fatal(err)
+	}
+	if want := `job/1/build-log.txt ["before" "panic: runtime error"] 3`; len(got) != 3 || got[0] != want {
+		t.Errorf("unexpected results for a single line search: %q", got)
+	}
+}
+
+func Test_spansLines(t *testing.T) {
+	for search, want := range map[string]bool{
+		"panic":                false,
+		`(?m)^panic$`:          false,
+		`(?i-s)panic.*`:        false,
+		`(?s)panic.*goroutine`: true,
+		`(?is:panic.*)`:        true,
+		`panic\ngoroutine`:     true,
+		"panic\ngoroutine":     true,
+	} {
+		if got := spansLines(&Index{}, search); got != want {
+			t.Errorf("%q: expected %t", search, want)
+		}
+	}
+	if spansLines(&Index{Literal: true}, `(?s)panic\n`) {
+		t.Errorf("a literal search without a newline does not span lines")
+	}
+
+	g := ripgrepGenerator{execPath: "rg", searchPath: "/var/lib/ci-search", arguments: fixedSourceArguments{"a/build-log.txt"}}
+	for search, want := range map[string]bool{"panic": false, `(?s)panic.*goroutine`: true} {
+		_, args, _, err := g.Command(&Index{}, search, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(strings.Join(args, " "), " --multiline "); got != want {
+			t.Errorf("%q: unexpected arguments: %v", search, args)
+		}
+	}
+}
+
+type fixedSourceArguments []string
+
+func (a fixedSourceArguments) RipgrepSourceArguments(*Index, sets.String) ([]string, []string, error) {
+	return nil, a, nil
+}
+
+func Test_ripgrepGenerator_literal(t *testing.T) {
+	g := ripgrepGenerator{execPath: "rg", searchPath: "/var/lib/ci-search", arguments: fixedSourceArguments{"a/build-log.txt"}}
+	for _, literal := range []bool{false, true} {
+		_, args, paths, err := g.Command(&Index{Literal: literal}, "-failed (x)", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		joined := strings.Join(args, " ")
+		if !strings.HasSuffix(joined, " -e -failed (x)") || !strings.Contains(joined, " -S ") {
+			t.Errorf("unexpected arguments: %v", args)
+		}
+		if got := strings.Contains(joined, "--fixed-strings"); got != literal {
+			t.Errorf("literal=%t: unexpected arguments: %v", literal, args)
+		}
+		if len(paths) != 1 {
+			t.Errorf("unexpected paths: %v", paths)
+		}
+	}
+	if got := (&Index{Literal: true}).Pattern("a.b(c"); got != `a\.b\(c` {
+		t.Errorf("unexpected pattern: %s", got)
+	}
+}
+
+func Test_ripgrepGenerator_case(t *testing.T) {
+	g := ripgrepGenerator{execPath: "rg", searchPath: "/var/lib/ci-search", arguments: fixedSourceArguments{"a/build-log.txt"}}
+	for _, tt := range []struct {
+		sensitivity  string
+		flag         string
+		matchesUpper bool
+	}{
+		{sensitivity: "", flag: "-S", matchesUpper: true},
+		{sensitivity: "sensitive", flag: "-s", matchesUpper: false},
+		{sensitivity: "insensitive", flag: "-i", matchesUpper: true},
+	} {
+		index := &Index{Case: tt.sensitivity}
+		_, args, _, err := g.Command(index, "error", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(strings.Join(args, " "), " "+tt.flag+" ") {
+			t.Errorf("%q: unexpected arguments: %v", tt.sensitivity, args)
+		}
+		// lines are matched the same way ripgrep matched them
+		if got := matchedLine(index.Pattern("error"), 1, []string{"ERROR", "error"}); (got == "ERROR") != tt.matchesUpper {
+			t.Errorf("%q: unexpected matched line %q", tt.sensitivity, got)
+		}
+	}
+	if got := matchedLine((&Index{Case: "insensitive"}).Pattern("Error"), 1, []string{"before", "ERROR", "after"}); got != "ERROR" {
+		t.Errorf("unexpected matched line %q", got)
+	}
+}
+
+// searchOutputCommand prints a different file of ripgrep formatted output for each search.
+type searchOutputCommand struct {
+	prefix  string
+	outputs map[string]string
+}
+
+func (c *searchOutputCommand) Command(index *Index, search string, jobNames sets.String) (string, []string, []string, error) {
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return cat, []string{"cat"}, []string{c.outputs[search]}, nil
+}
+
+func (c *searchOutputCommand) PathPrefix() string { return c.prefix }
+
+func Test_executeGrep_allOf(t *testing.T) {
+	dir := t.TempDir()
+	prefix := "/var/lib/ci-search"
+	gen := &searchOutputCommand{prefix: prefix, outputs: map[string]string{}}
+	for search, output := range map[string]string{
+		"operator": prefix + "/a/build-log.txt\x00operator degraded\n" + prefix + "/b/build-log.txt\x00operator degraded\n" + prefix + "/c/build-log.txt\x00operator degraded\n",
+		"timeout":  prefix + "/c/build-log.txt\x00timeout\n" + prefix + "/a/build-log.txt\x00timeout\n",
+		"etcd":     prefix + "/a/build-log.txt\x00etcd\n" + prefix + "/b/build-log.txt\x00etcd\n",
+	} {
+		path := filepath.Join(dir, search)
+		if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gen.outputs[search] = path
+	}
+
+	var got []string
+	fn := func(name string, search string, lines []bytes.Buffer, _ int, moreLines int) error {
+		got = append(got, name+" "+search+" "+lines[0].String())
+		return nil
+	}
+	index := &Index{Search: []string{"operator", "timeout", "etcd"}, MaxMatches: 1, MaxBytes: 1024 * 1024, AllOf: true}
+	if err := executeGrep(context.TODO(), gen, index, nil, fn); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a/build-log.txt operator operator degraded", "a/build-log.txt timeout timeout", "a/build-log.txt etcd etcd"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected results:\n%q\nwant\n%q", got, want)
+	}
+
+	got = nil
+	index.AllOf = false
+	if err := executeGrep(context.TODO(), gen, index, nil, fn); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 7 {
+		t.Errorf("expected every match without allOf: %q", got)
+	}
+
+	// a search stopped at maxBytes reports no file before it has matched every search
+	got = nil
+	index.AllOf = true
+	index.MaxBytes = int64(len("operator degraded"))
+	if err := executeGrep(context.TODO(), gen, index, nil, fn); err != ErrMaxBytes {
+		t.Fatalf("expected the search to stop at maxBytes: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("unexpected results: %q", got)
+	}
+}
+
+func Test_executeGrep_exclude(t *testing.T) {
+	prefix := t.TempDir()
+	files := map[string]string{
+		"a/build-log.txt": "operator degraded\nretrying in 5s\n",
+		"b/build-log.txt": "operator degraded\n",
+		"c/build-log.txt": "operator degraded\ncontext canceled\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(prefix, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// compressed files are excluded by their decompressed content
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	gw.Write([]byte("operator degraded\nRetrying in 5s\n"))
+	gw.Close()
+	if err := os.MkdirAll(filepath.Join(prefix, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(prefix, "d/build-log.txt.gz"), compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(
+		prefix+"/a/build-log.txt\x00operator degraded\n"+
+			prefix+"/b/build-log.txt\x00operator degraded\n"+
+			prefix+"/c/build-log.txt\x00operator degraded\n"+
+			prefix+"/d/build-log.txt.gz\x00operator degraded\n",
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gen := &outputCommand{prefix: prefix, output: output}
+
+	var got []string
+	fn := func(name string, search string, lines []bytes.Buffer, _ int, moreLines int) error {
+		got = append(got, name)
+		return nil
+	}
+	index := &Index{Search: []string{"operator"}, MaxMatches: 1, MaxBytes: 1024 * 1024, Exclude: []string{"retrying", "context canceled"}}
+	if err := executeGrep(context.TODO(), gen, index, nil, fn); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b/build-log.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected results: %q", got)
+	}
+
+	// exclusions follow the case of the search
+	got = nil
+	index.Case = "sensitive"
+	if err := executeGrep(context.TODO(), gen, index, nil, fn); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b/build-log.txt", "d/build-log.txt.gz"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected case sensitive results: %q", got)
+	}
+
+	if _, err := parseRequest(httptest.NewRequest("GET", "/search?search=operator&exclude=(", nil), "text", time.Hour, nil); err == nil {
+		t.Errorf("expected an invalid exclusion to be rejected")
+	}
+}
+
+// recordingOutputCommand prints a file of ripgrep formatted output for every search and
+// records the searches it was asked to run.
+type recordingOutputCommand struct {
+	outputCommand
+	searches []string
+}
+
+func (c *recordingOutputCommand) Command(index *Index, search string, jobNames sets.String) (string, []string, []string, error) {
+	c.searches = append(c.searches, search)
+	return c.outputCommand.Command(index, search, jobNames)
+}
+
+func Test_executeGrep_combined(t *testing.T) {
+	prefix := "/var/lib/ci-search"
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(
+		prefix+"/a/build-log.txt\x00Operator degraded\n"+
+			prefix+"/b/build-log.txt\x00timeout waiting for etcd\n"+
+			prefix+"/c/build-log.txt\x00failed (x)\n",
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	fn := func(name string, search string, lines []bytes.Buffer, _ int, moreLines int) error {
+		got = append(got, name+" "+search)
+		return nil
+	}
+	gen := &recordingOutputCommand{outputCommand: outputCommand{prefix: prefix, output: output}}
+	index := &Index{Search: []string{"operator", "timeout", "etcd", "(x)"}, MaxMatches: 1, MaxBytes: 1024 * 1024, Literal: true, combineSearches: true}
+	if err := executeGrep(context.TODO(), gen, index, nil, fn); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`(?:(?i)operator)|(?:(?i)timeout)|(?:(?i)etcd)|(?:(?i)\(x\))`}; !reflect.DeepEqual(gen.searches, want) {
+		t.Errorf("unexpected searches:\n%q\nwant\n%q", gen.searches, want)
+	}
+	want := []string{"a/build-log.txt operator", "b/build-log.txt timeout", "b/build-log.txt etcd", "c/build-log.txt (x)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected results:\n%q\nwant\n%q", got, want)
+	}
+
+	// searches Go cannot compile fall back to a pass per search
+	got, gen.searches = nil, nil
+	index.Literal = false
+	index.Search = []string{"operator", "etcd(?= )"}
+	if err := executeGrep(context.TODO(), gen, index, nil, fn); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gen.searches, index.Search) {
+		t.Errorf("expected a pass per search: %q", gen.searches)
+	}
+}
+
+func Test_executeGrep_combinedLaterLines(t *testing.T) {
+	prefix := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(prefix, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(prefix, "a", "build-log.txt"), []byte(
+		"timeout 1\ntimeout 2\nunrelated\netcd leader changed\n",
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// ripgrep stops at the limit of two matches per file before reaching the etcd line
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(
+		prefix+"/a/build-log.txt\x00timeout 1\n"+
+			prefix+"/a/build-log.txt\x00timeout 2\n",
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		search     string
+		lines      []string
+		lineNumber int
+	}
+	var got []result
+	fn := func(name string, search string, lines []bytes.Buffer, lineNumber int, moreLines int) error {
+		r := result{search: search, lineNumber: lineNumber}
+		for _, line := range lines {
+			r.lines = append(r.lines, line.String())
+		}
+		got = append(got, r)
+		return nil
+	}
+	gen := &outputCommand{prefix: prefix, output: output}
+	index := &Index{Search: []string{"timeout", "etcd"}, MaxMatches: 1, MaxBytes: 1024 * 1024, combineSearches: true}
+	if err := executeGrep(context.TODO(), gen, index, nil, fn); err != nil {
+		t.Fatal(err)
+	}
+	want := []result{
+		{search: "timeout", lines: []string{"timeout 1", "timeout 2"}},
+		{search: "etcd", lines: []string{"etcd leader changed"}, lineNumber: 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected results:\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+// benchmarkChartSearches runs the default chart searches against synthetic logs with
+// ripgrep, either combined into a single pass or as a pass per search.
+func benchmarkChartSearches(b *testing.B, combine bool) {
+	rg, err := exec.LookPath("rg")
+	if err != nil {
+		b.Skip("ripgrep is not installed")
+	}
+	index, err := parseRequest(httptest.NewRequest("GET", "/chart", nil), "chart", 24*time.Hour, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	(&options{}).applyChartDefaults(index)
+	index.MaxMatches = 1
+	index.combineSearches = combine
+
+	dir := b.TempDir()
+	var paths []string
+	for i := 0; i < 200; i++ {
+		var log strings.Builder
+		for j := 0; j < 1000; j++ {
+			fmt.Fprintf(&log, "line %d of an uninteresting build log\n", j)
+		}
+		if i%10 == 0 {
+			log.WriteString(index.Search[i%len(index.Search)] + "\n")
+		}
+		path := filepath.Join(strconv.Itoa(i), "build-log.txt")
+		if err := os.MkdirAll(filepath.Join(dir, strconv.Itoa(i)), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(log.String()), 0644); err != nil {
+			b.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	gen := ripgrepGenerator{execPath: rg, searchPath: dir, arguments: fixedSourceArguments(paths)}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := executeGrep(context.TODO(), gen, index, nil, func(string, string, []bytes.Buffer, int, int) error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecuteGrep_chartPerSearch(b *testing.B) { benchmarkChartSearches(b, false) }
+
+func BenchmarkExecuteGrep_chartCombined(b *testing.B) { benchmarkChartSearches(b, true) }
+
+func Test_parseRipgrepVersion(t *testing.T) {
+	for out, want := range map[string]string{
+		"ripgrep 13.0.0 (rev 7ec2fd51ba)\n-SIMD -AVX (compiled)\n": "13.0.0",
+		"ripgrep 11.0.2\n":       "11.0.2",
+		"ripgrep 0.10.0\n":       "0.10.0",
+		"ripgrep 14.1\n":         "14.1.0",
+		"grep (GNU grep) 3.11\n": "",
+		"":                       "",
+	} {
+		version, err := parseRipgrepVersion(out)
+		if len(want) == 0 {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", out, version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", out, err)
+			continue
+		}
+		if version.String() != want {
+			t.Errorf("%q: unexpected version %s", out, version)
+		}
+	}
+}
+
+func TestNewCommandGenerator_minimumVersion(t *testing.T) {
+	dir := t.TempDir()
+	for name, version := range map[string]string{"rg-old": "0.10.0", "rg-new": "13.0.0"} {
+		script := "#!/bin/sh\necho 'ripgrep " + version + "'\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := NewCommandGenerator(filepath.Join(dir, "rg-old"), "/var/lib/ci-search", nil); err == nil {
+		t.Errorf("expected an old ripgrep to be rejected")
+	}
+	if _, err := NewCommandGenerator(filepath.Join(dir, "rg-new"), "/var/lib/ci-search", nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := NewCommandGenerator(filepath.Join(dir, "rg-missing"), "/var/lib/ci-search", nil); err == nil {
+		t.Errorf("expected a missing ripgrep to be rejected")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// highlightPattern returns a regular expression matching the text of a line that any
+// search of index matches, with the case sensitivity the search used, or nil if a search
+// cannot be compiled as a Go regular expression.
+func highlightPattern(index *Index) *regexp.Regexp {
+	var patterns []string
+	for _, search := range index.Search {
+		if len(search) == 0 {
+			continue
+		}
+		patterns = append(patterns, "(?:"+searchPattern(index, search)+")")
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	re, err := regexp.Compile(strings.Join(patterns, "|"))
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// searchPattern returns search as a regular expression that keeps the case sensitivity
+// ripgrep gives the search on its own, even when it is combined with other searches.
+func searchPattern(index *Index, search string) string {
+	pattern := index.Pattern(search)
+	if len(index.Case) == 0 && !hasUppercase(search) {
+		pattern = "(?i)" + pattern
+	}
+	return pattern
+}
+
+// hasUppercase returns true if a search contains an uppercase letter that is not part of
+// an escape sequence, which makes the search case-sensitive under smart casing.
+func hasUppercase(search string) bool {
+	var escaped bool
+	for _, r := range search {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case unicode.IsUpper(r):
+			return true
+		}
+	}
+	return false
+}
+
+// writeHighlighted writes line to w escaped as HTML, with each span that highlight matches
+// wrapped in a mark element.
+func writeHighlighted(w io.Writer, line []byte, highlight *regexp.Regexp) {
+	if highlight == nil {
+		template.HTMLEscape(w, line)
+		return
+	}
+	var last int
+	for _, loc := range highlight.FindAllIndex(line, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		template.HTMLEscape(w, line[last:loc[0]])
+		io.WriteString(w, "<mark>")
+		template.HTMLEscape(w, line[loc[0]:loc[1]])
+		io.WriteString(w, "</mark>")
+		last = loc[1]
+	}
+	template.HTMLEscape(w, line[last:])
+}
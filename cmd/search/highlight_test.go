@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_writeHighlighted(t *testing.T) {
+	tests := []struct {
+		name  string
+		index *Index
+		line  string
+		want  string
+	}{
+		{
+			name:  "smart case",
+			index: &Index{Search: []string{"timeout"}},
+			line:  "Timeout <waiting> for timeout",
+			want:  "<mark>Timeout</mark> &lt;waiting&gt; for <mark>timeout</mark>",
+		},
+		{
+			name:  "uppercase is case sensitive",
+			index: &Index{Search: []string{"Timeout"}},
+			line:  "Timeout or timeout",
+			want:  "<mark>Timeout</mark> or timeout",
+		},
+		{
+			name:  "escaped uppercase is not",
+			index: &Index{Search: []string{`a\Sb`}},
+			line:  "A-B",
+			want:  "<mark>A-B</mark>",
+		},
+		{
+			name:  "literal with markup",
+			index: &Index{Search: []string{"<a&b>"}, Literal: true},
+			line:  `x "<a&b>" y`,
+			want:  `x &#34;<mark>&lt;a&amp;b&gt;</mark>&#34; y`,
+		},
+		{
+			name:  "several searches",
+			index: &Index{Search: []string{"etcd", "leader"}},
+			line:  "etcd lost leader",
+			want:  "<mark>etcd</mark> lost <mark>leader</mark>",
+		},
+		{
+			name:  "incompatible pattern is not marked",
+			index: &Index{Search: []string{`x(?= )`}},
+			line:  "x <y>",
+			want:  "x &lt;y&gt;",
+		},
+		{
+			name:  "empty matches are ignored",
+			index: &Index{Search: []string{"z*"}},
+			line:  "a<b",
+			want:  "a&lt;b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			writeHighlighted(buf, []byte(tt.line), highlightPattern(tt.index))
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -12,18 +15,20 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	jiraBaseClient "github.com/andygrunwald/go-jira"
 	units "github.com/docker/go-units"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
 
 	"github.com/openshift/ci-search/bugzilla"
+	"github.com/openshift/ci-search/metricdb"
 	"github.com/openshift/ci-search/metricdb/httpgraph"
 	"github.com/openshift/ci-search/pkg/httpwriter"
 )
@@ -36,11 +41,27 @@ type Match struct {
 	Name         string                `json:"name,omitempty"`
 	LastModified metav1.Time           `json:"lastModified"`
 	FileType     string                `json:"filename"`
+	Section      string                `json:"section,omitempty"`
+	Flake        bool                  `json:"flake,omitempty"`
 	Context      []string              `json:"context,omitempty"`
 	MoreLines    int                   `json:"moreLines,omitempty"`
 	URL          string                `json:"url,omitempty"`
 	Bug          *bugzilla.BugInfo     `json:"bugInfo,omitempty"`
 	Issue        *jiraBaseClient.Issue `json:"issues,omitempty"`
+
+	// Hits is the number of matches in the file, up to maxMatches, when the search
+	// returns links without context.
+	Hits int `json:"hits,omitempty"`
+
+	// CommentAuthor and CommentCreated identify the bug comment containing the match,
+	// if the match is in a comment.
+	CommentAuthor  string       `json:"commentAuthor,omitempty"`
+	CommentCreated *metav1.Time `json:"commentCreated,omitempty"`
+
+	// trigger and number describe the job run or bug of a match from searchResult, for
+	// exports that are not limited to the JSON fields
+	trigger string
+	number  int
 }
 
 type SearchResponseResult struct {
@@ -49,6 +70,18 @@ type SearchResponseResult struct {
 type SearchResponse struct {
 	// SearchResults is a map of searchstring to search results that matched that search string
 	Results map[string]SearchResponseResult `json:"results"`
+	// TopLines are the most frequent matched lines across all results
+	TopLines []TopLine `json:"topLines,omitempty"`
+	// Total is the number of matches across all search strings, including those not in
+	// the requested page
+	Total int `json:"total"`
+	// NextOffset is the offset of the next page of matches, or zero if there are no more
+	NextOffset int `json:"nextOffset,omitempty"`
+	// BytesScanned is the number of bytes ripgrep searched to answer the request
+	BytesScanned int64 `json:"bytesScanned"`
+	// Truncated is true if the search stopped after reading maxBytes, so that the results
+	// are incomplete
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 func (o *options) handleConfig(w http.ResponseWriter, req *http.Request) {
@@ -66,10 +99,85 @@ func (o *options) handleConfig(w http.ResponseWriter, req *http.Request) {
 	writer := httpwriter.ForRequest(w, req)
 	defer writer.Close()
 	if _, err = writer.Write(data); err != nil {
-		klog.Errorf("Failed to write response: %v", err)
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
 	}
 }
 
+type StatusResponse struct {
+	// MetricDB is the size of the metric database, if metrics are recorded
+	MetricDB *metricdb.Status `json:"metricDB,omitempty"`
+
+	// Jobs, Bugs, and Issues describe the freshness of each indexed source. Bugs and
+	// issues are only reported if they are indexed.
+	Jobs   *SourceStatus `json:"jobs,omitempty"`
+	Bugs   *SourceStatus `json:"bugs,omitempty"`
+	Issues *SourceStatus `json:"issues,omitempty"`
+}
+
+// SourceStatus describes how fresh the index of a single source of search results is.
+type SourceStatus struct {
+	// Newest is the modification time of the most recently indexed job file, or the most
+	// recent time the comments of a bug or issue were refreshed. It is omitted if nothing
+	// has been indexed.
+	Newest *metav1.Time `json:"newest,omitempty"`
+	// AgeSeconds is the time in seconds since Newest.
+	AgeSeconds float64 `json:"ageSeconds,omitempty"`
+	// Loaded is the time the job index was last loaded from disk.
+	Loaded *metav1.Time `json:"loaded,omitempty"`
+	// Entries is the number of indexed job files, bugs, or issues.
+	Entries int `json:"entries"`
+	// MaxAgeSeconds is how long in seconds entries are kept in the index, or zero if they
+	// are kept forever.
+	MaxAgeSeconds float64 `json:"maxAgeSeconds"`
+}
+
+// sourceStatus returns the status of a source whose newest entry is newest as of now.
+func sourceStatus(now, newest time.Time, entries int, maxAge time.Duration) *SourceStatus {
+	status := &SourceStatus{Entries: entries, MaxAgeSeconds: maxAge.Seconds()}
+	if !newest.IsZero() {
+		status.Newest = &metav1.Time{Time: newest}
+		status.AgeSeconds = now.Sub(newest).Seconds()
+	}
+	return status
+}
+
+func (o *options) handleStatus(w http.ResponseWriter, req *http.Request) {
+	var status StatusResponse
+	if o.metrics != nil {
+		metricStatus := o.metrics.Status()
+		status.MetricDB = &metricStatus
+	}
+	now := time.Now()
+	if o.jobsIndex != nil {
+		loaded, newest := o.jobsIndex.Freshness()
+		status.Jobs = sourceStatus(now, newest, o.jobsIndex.Stats().Entries, o.MaxAge)
+		if !loaded.IsZero() {
+			status.Jobs.Loaded = &metav1.Time{Time: loaded}
+		}
+	}
+	if o.bugs != nil && len(o.BugzillaURL) > 0 {
+		status.Bugs = sourceStatus(now, o.bugs.Freshness(), o.bugs.Stats().Bugs, o.MaxAge)
+	}
+	if o.issues != nil && len(o.JiraURL) > 0 {
+		status.Issues = sourceStatus(now, o.issues.Freshness(), o.issues.Stats().Issues, o.MaxAge)
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to serialize status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+	if _, err = writer.Write(data); err != nil {
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
+	}
+}
+
+// groupedJobsPageSize is the number of job groups rendered per page when grouping by job.
+const groupedJobsPageSize = 100
+
 func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Keep-Alive", "timeout=600") // Keep-alive for 600 seconds
@@ -82,22 +190,39 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 		flusher = nopFlusher{}
 	}
 
+	if err := applyPreferences(req); err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
 	var err error
-	index, err = parseRequest(req, "text", o.MaxAge)
+	index, err = parseRequest(req, "text", o.MaxAge, o.jobAliases)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
 	}
+	o.applyInstallScope(req, index)
+	o.applyTypeDefaults(req, index)
 
 	if len(index.Search) == 0 {
 		index.Search = []string{""}
 	}
+	if len(index.Search[0]) > 0 {
+		setPreferences(w, req, index)
+	}
 	if index.MaxMatches == 0 {
 		index.MaxMatches = 5
 	}
 	if index.Context < 0 {
 		index.MaxMatches = 1
 	}
+	index.highlight = highlightPattern(index)
+	if len(index.Search[0]) > 0 {
+		release, ok := o.acquireSearch(w)
+		if !ok {
+			return
+		}
+		defer release()
+	}
 
 	contextOptions := []string{
 		fmt.Sprintf(`<option value="-1" %s>Links</option>`, intSelected(1, index.Context)),
@@ -118,7 +243,7 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 	}
 
 	var searchTypeOptions []string
-	for _, searchType := range []string{"bug+issue+junit", "bug+junit", "bug+issue", "issue", "bug", "junit", "build-log", "all"} {
+	for _, searchType := range []string{"bug+issue+junit", "bug+junit", "bug+issue", "issue", "bug", "junit", "build-log", "must-gather", "e2e-log", "everything", "all"} {
 		var selected string
 		if searchType == index.SearchType {
 			selected = "selected"
@@ -127,15 +252,41 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 	}
 
 	var groupByOptions []string
-	for _, opt := range []string{"job", "none"} {
+	for _, opt := range []string{"job", "component", "none"} {
 		var selected string
 		switch {
-		case !index.GroupByJob && opt == "none", index.GroupByJob && opt != "none":
+		case index.GroupByComponent:
+			if opt == "component" {
+				selected = "selected"
+			}
+		case index.GroupByJob:
+			if opt == "job" {
+				selected = "selected"
+			}
+		case opt == "none":
 			selected = "selected"
 		}
 		groupByOptions = append(groupByOptions, fmt.Sprintf(`<option value="%s" %s>%s</option>`, template.HTMLEscapeString(opt), selected, template.HTMLEscapeString(opt)))
 	}
 
+	var sortOptions []string
+	for _, opt := range []struct{ value, label string }{{"", "found"}, {"impact", "impact"}, {"matches", "matches"}, {"name", "name"}, {"recent", "recent"}} {
+		var selected string
+		if opt.value == index.Sort {
+			selected = "selected"
+		}
+		sortOptions = append(sortOptions, fmt.Sprintf(`<option value="%s" %s>%s</option>`, template.HTMLEscapeString(opt.value), selected, template.HTMLEscapeString(opt.label)))
+	}
+
+	var caseOptions []string
+	for _, opt := range []struct{ value, label string }{{"", "smart case"}, {"sensitive", "case sensitive"}, {"insensitive", "ignore case"}} {
+		var selected string
+		if opt.value == index.Case {
+			selected = "selected"
+		}
+		caseOptions = append(caseOptions, fmt.Sprintf(`<option value="%s" %s>%s</option>`, template.HTMLEscapeString(opt.value), selected, template.HTMLEscapeString(opt.label)))
+	}
+
 	maxAgeOptions := []string{
 		fmt.Sprintf(`<option value="%dh" %s>6h</option>`, 6, durationSelected(6*time.Hour, index.MaxAge)),
 		fmt.Sprintf(`<option value="%dh" %s>12h</option>`, 12, durationSelected(12*time.Hour, index.MaxAge)),
@@ -157,6 +308,23 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 	writer := httpwriter.ForRequest(w, req)
 	defer writer.Close()
 
+	// every exclusion is kept when the form is resubmitted
+	excludeInputs := make([]string, 0, len(index.Exclude)+1)
+	for _, exclude := range index.Exclude {
+		excludeInputs = append(excludeInputs, fmt.Sprintf(htmlExcludeInput, template.HTMLEscapeString(exclude)))
+	}
+	if len(excludeInputs) == 0 {
+		excludeInputs = append(excludeInputs, fmt.Sprintf(htmlExcludeInput, ""))
+	}
+
+	var literalValue string
+	if index.Literal {
+		literalValue = "checked"
+	}
+	var collapseValue string
+	if index.Collapse {
+		collapseValue = "checked"
+	}
 	var wrapValue string
 	nowrapClass := "nowrap"
 	if index.WrapLines {
@@ -173,9 +341,16 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 		strings.Join(searchTypeOptions, ""),
 		template.HTMLEscapeString(index.IncludeName),
 		template.HTMLEscapeString(index.ExcludeName),
+		strings.Join(excludeInputs, ""),
 		strconv.Itoa(index.MaxMatches),
 		strconv.FormatInt(index.MaxBytes, 10),
-		groupByOptions,
+		template.HTMLEscapeString(formTime(index.From)),
+		template.HTMLEscapeString(formTime(index.To)),
+		strings.Join(groupByOptions, ""),
+		strings.Join(sortOptions, ""),
+		strings.Join(caseOptions, ""),
+		literalValue,
+		collapseValue,
 		wrapValue,
 	)
 
@@ -225,67 +400,118 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 
 	// perform a search
 	fmt.Fprintf(writer, `<div style="margin-top: 3rem; position: relative" class="pl-3">`)
+	o.renderFreshnessWarning(writer, index)
+	renderTimeWindow(writer, index, start)
 	flusher.Flush()
 	defer func() {
-		klog.Infof("Render index %s duration=%s success=%t", index.String(), time.Now().Sub(start).Truncate(time.Millisecond), success)
+		requestLog(req.Context()).Infof("Render index %s duration=%s success=%t", index.String(), time.Now().Sub(start).Truncate(time.Millisecond), success)
 	}()
 	switch {
-	case index.GroupByJob:
-		result, err := o.orderedSearchResults(req.Context(), index)
+	case index.GroupByComponent:
+		result, err := o.cachedOrderedSearchResults(req.Context(), index)
 		if err != nil {
-			klog.Errorf("Search %q failed with %d results: command failed: %v", index.Search[0], 0, err)
+			requestLog(req.Context()).Errorf("Search %q failed with %d results: command failed: %v", index.Search[0], 0, err)
 			fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
 			fmt.Fprint(writer, htmlPageEnd)
 			return
 		}
+		components := result.ByComponent()
+		recordSearch(req, index, len(result.Bugs)+len(result.Issues))
+
 		bw := bufio.NewWriterSize(writer, 2048)
-		var numRuns int
-		if result.Matches > 0 {
+		renderTopLines(bw, result.TopLines)
+		if len(components) > 0 {
 			fmt.Fprintln(bw, `<div class="table-responsive"><table class="table table-job-compact"><tbody>`)
-			for _, bug := range result.Bugs {
-				age, _ := formatAge(bug.Matches[0].LastModified.Time, start, index.MaxAge)
-				name := bug.Name
-				if i := strings.Index(name, ": "); i != -1 {
-					name = name[i+2:]
+			for _, component := range components {
+				var counts []string
+				if n := len(component.Bugs); n > 0 {
+					counts = append(counts, fmt.Sprintf("%d %s", n, pluralize(n, "bug", "bugs")))
 				}
-				fmt.Fprintf(bw, "<tr><td><a target=\"_blank\" href=\"%s\">#%d</a></td><td>%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\">%s</td></tr>\n", template.HTMLEscapeString(bug.URI.String()), bug.Number, template.HTMLEscapeString(bug.Matches[0].FileType), template.HTMLEscapeString(age), template.HTMLEscapeString(name))
-				if index.Context >= 0 {
-					fmt.Fprintf(bw, "<tr class=\"row-match\"><td class=\"\" colspan=\"4\"><pre class=\"small\">")
-					for _, match := range bug.Matches {
-						if err := renderLinesString(bw, match.Context, match.MoreLines); err != nil {
-							bw.Flush()
-							klog.Errorf("Search %q failed with %d matches: command failed: %v", index.Search[0], numRuns, err)
-							fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
-							fmt.Fprint(writer, htmlPageEnd)
-							return
-						}
+				if n := len(component.Issues); n > 0 {
+					counts = append(counts, fmt.Sprintf("%d %s", n, pluralize(n, "issue", "issues")))
+				}
+				fmt.Fprintf(bw, "<tr><td colspan=\"4\"><strong>%s</strong> - <em>%s</em></td></tr>\n", template.HTMLEscapeString(component.Name), template.HTMLEscapeString(strings.Join(counts, ", ")))
+				for _, bug := range component.Bugs {
+					if err := renderBugRows(bw, index, bug, start); err != nil {
+						bw.Flush()
+						requestLog(req.Context()).Errorf("Search %q failed with %d matches: command failed: %v", index.Search[0], result.Matches, err)
+						fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
+						fmt.Fprint(writer, htmlPageEnd)
+						return
+					}
+				}
+				for _, issue := range component.Issues {
+					if err := renderIssueRows(bw, index, issue, start); err != nil {
+						bw.Flush()
+						requestLog(req.Context()).Errorf("Search %q failed with %d matches: command failed: %v", index.Search[0], result.Matches, err)
+						fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
+						fmt.Fprint(writer, htmlPageEnd)
+						return
 					}
-					fmt.Fprintln(bw, "</pre></td></tr>")
 				}
 			}
-			for _, issue := range result.Issues {
-				age, _ := formatAge(issue.Matches[0].LastModified.Time, start, index.MaxAge)
-				name := issue.Name
-				if i := strings.Index(name, ": "); i != -1 {
-					name = name[i+2:]
+			fmt.Fprintln(bw, "</table></div>")
+		}
+		bw.Flush()
+
+		fmt.Fprintf(writer, `<p style="position:absolute; top: -2rem;" class="small"><em>`)
+		fmt.Fprintf(writer, `Found %d bugs and %d issues in %d components in %s`, len(result.Bugs), len(result.Issues), len(components), time.Now().Sub(start).Truncate(time.Millisecond))
+		fmt.Fprintf(writer, `</em> - <a href="/">clear search</a> | <a href="/chart?%s">chart view</a> - source code located <a target="_blank" href="https://github.com/openshift/ci-search">on github</a></p>`, template.HTMLEscapeString(req.URL.RawQuery))
+		if result.Truncated {
+			renderTruncatedNotice(writer, index, result.OutputBytes)
+		}
+		if len(components) == 0 {
+			fmt.Fprintf(writer, `<p style="padding-top: 1em;"><em>No matching bugs or issues found.</em></p><p><em>Search uses <a target="_blank" href="https://docs.rs/regex/0.2.5/regex/#syntax">ripgrep regular-expression patterns</a> to find results. Try simplifying your search or using case-insensitive options.</em></p>`)
+		}
+
+	case index.GroupByJob:
+		result, err := o.cachedOrderedSearchResults(req.Context(), index)
+		if err != nil {
+			requestLog(req.Context()).Errorf("Search %q failed with %d results: command failed: %v", index.Search[0], 0, err)
+			fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
+			fmt.Fprint(writer, htmlPageEnd)
+			return
+		}
+		var numRuns int
+		for _, job := range result.Jobs {
+			numRuns += len(job.Instances)
+		}
+		recordSearch(req, index, numRuns)
+		rangeStart, rangeEnd := index.TimeRange(start)
+		// bugs and issues are only shown on the first page
+		var bugs []SearchBugResult
+		var issues []SearchIssuesResult
+		if index.Offset == 0 {
+			bugs, issues = result.Bugs, result.Issues
+		}
+		jobs, nextOffset := result.JobsPage(index.Offset, groupedJobsPageSize)
+
+		bw := bufio.NewWriterSize(writer, 2048)
+		if index.Offset == 0 {
+			renderTopLines(bw, result.TopLines)
+		}
+		if result.Matches > 0 {
+			fmt.Fprintln(bw, `<div class="table-responsive"><table class="table table-job-compact"><tbody>`)
+			for _, bug := range bugs {
+				if err := renderBugRows(bw, index, bug, start); err != nil {
+					bw.Flush()
+					requestLog(req.Context()).Errorf("Search %q failed with %d matches: command failed: %v", index.Search[0], numRuns, err)
+					fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
+					fmt.Fprint(writer, htmlPageEnd)
+					return
 				}
-				fmt.Fprintf(bw, "<tr><td><a class=\"text-nowrap\" target=\"_blank\" href=\"%s\">#%s</a></td><td>%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\">%s</td></tr>\n", template.HTMLEscapeString(issue.URI.String()), template.HTMLEscapeString(issue.Key), template.HTMLEscapeString(issue.Matches[0].FileType), template.HTMLEscapeString(age), template.HTMLEscapeString(name))
-				if index.Context >= 0 {
-					fmt.Fprintf(bw, "<tr class=\"row-match\"><td class=\"\" colspan=\"4\"><pre class=\"small\">")
-					for _, match := range issue.Matches {
-						if err := renderLinesString(bw, match.Context, match.MoreLines); err != nil {
-							bw.Flush()
-							klog.Errorf("Search %q failed with %d matches: command failed: %v", index.Search[0], numRuns, err)
-							fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
-							fmt.Fprint(writer, htmlPageEnd)
-							return
-						}
-					}
-					fmt.Fprintln(bw, "</pre></td></tr>")
+			}
+			for _, issue := range issues {
+				if err := renderIssueRows(bw, index, issue, start); err != nil {
+					bw.Flush()
+					requestLog(req.Context()).Errorf("Search %q failed with %d matches: command failed: %v", index.Search[0], numRuns, err)
+					fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
+					fmt.Fprint(writer, htmlPageEnd)
+					return
 				}
 			}
-			for _, job := range result.Jobs {
-				stats := o.jobAccessor.JobStats(job.Name, nil, start.Add(-index.MaxAge), start.Add(time.Hour))
+			for _, job := range jobs {
+				stats := o.jobAccessor.JobStats(job.Name, nil, rangeStart, rangeEnd.Add(time.Hour))
 				var contents string
 				if stats.Count > 0 {
 					percentFail := math.Round(float64(stats.Failures) / float64(stats.Count) * 100)
@@ -299,43 +525,56 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 						contents = fmt.Sprintf(" - <em title=\"%s\">%d runs, %d%% failed, %d%% of failures match = %d%% impact</em>", template.HTMLEscapeString(title), stats.Count, int(percentFail), int(percentMatch), int(percentImpact))
 					}
 				}
-				numRuns += len(job.Instances)
-
 				uri := *job.Instances[0].URI
+				bucket := o.bucketForJobURI(&uri)
 				if job.Trigger == "pull" {
-					uri.Path = path.Join("job-history", o.IndexBucket, "pr-logs", "directory", job.Name)
+					uri.Path = path.Join("job-history", bucket, "pr-logs", "directory", job.Name)
 				} else {
-					uri.Path = path.Join("job-history", o.IndexBucket, "logs", job.Name)
+					uri.Path = path.Join("job-history", bucket, "logs", job.Name)
 				}
 				copied := *index
 				copied.MaxAge = o.MaxAge
+				copied.Offset = 0
 				copied.ExcludeName = ""
 				copied.IncludeName = fmt.Sprintf("^%s$", regexp.QuoteMeta(job.Name))
 				uriAll := url.URL{Path: "/", RawQuery: copied.Query().Encode()}
 				fmt.Fprintf(bw, "<tr><td colspan=\"4\"><a target=\"_blank\" href=\"%s\">%s</a> <a href=\"%s\">(all)</a>%s</td></tr>\n", template.HTMLEscapeString(uri.String()), template.HTMLEscapeString(job.Name), template.HTMLEscapeString(uriAll.String()), contents)
-				for _, instance := range job.Instances {
-					for _, match := range instance.Matches {
-						age, _ := formatAge(match.LastModified.Time, start, index.MaxAge)
-						fmt.Fprintf(bw, "<tr class=\"row-match\"><td><a target=\"_blank\" href=\"%s\">#%d</a></td><td>%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\"></td></tr>\n", template.HTMLEscapeString(instance.URI.String()), instance.Number, template.HTMLEscapeString(match.FileType), template.HTMLEscapeString(age))
-						if index.Context >= 0 {
-							fmt.Fprintf(bw, "<tr class=\"row-match\"><td class=\"\" colspan=\"4\"><pre class=\"small\">")
-							if err := renderLinesString(bw, match.Context, match.MoreLines); err != nil {
-								bw.Flush()
-								klog.Errorf("Search %q failed with %d matches: command failed: %v", index.Search[0], numRuns, err)
-								fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
-								fmt.Fprint(writer, htmlPageEnd)
-								return
-							}
-							fmt.Fprintln(bw, "</pre></td></tr>")
+				for _, group := range collapseMatches(job.Instances, index.Collapse && index.Context >= 0) {
+					match, instance := group.Match, group.Instances[0]
+					age := formatAge(match.LastModified.Time, start)
+					var badge string
+					if match.Flake {
+						badge = htmlFlakeBadge
+					}
+					var builds string
+					if len(group.Instances) > 1 {
+						builds = renderCollapsedBuilds(group.Instances)
+					}
+					fmt.Fprintf(bw, "<tr class=\"row-match\"><td><a target=\"_blank\" href=\"%s\">#%d</a></td><td>%s%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\">%s</td></tr>\n", template.HTMLEscapeString(instance.URI.String()), instance.Number, template.HTMLEscapeString(match.FileType), badge, template.HTMLEscapeString(age), builds)
+					if index.Context >= 0 {
+						fmt.Fprintf(bw, "<tr class=\"row-match\"><td class=\"\" colspan=\"4\"><pre class=\"small\">")
+						if err := renderLinesString(bw, index.highlight, match.Context, match.MoreLines, renderedLineLength(index)); err != nil {
+							bw.Flush()
+							requestLog(req.Context()).Errorf("Search %q failed with %d matches: command failed: %v", index.Search[0], numRuns, err)
+							fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
+							fmt.Fprint(writer, htmlPageEnd)
+							return
 						}
+						fmt.Fprintln(bw, "</pre></td></tr>")
 					}
 				}
 			}
 			fmt.Fprintln(bw, "</table></div>")
+			if nextOffset > 0 {
+				query := req.URL.Query()
+				query.Set("cursor", encodeCursor(nextOffset))
+				uriMore := url.URL{Path: "/", RawQuery: query.Encode()}
+				fmt.Fprintf(bw, "<p><a href=\"%s\">Load more</a> <em>(showing %d of %d jobs)</em></p>\n", template.HTMLEscapeString(uriMore.String()), nextOffset, len(result.Jobs))
+			}
 		}
 		bw.Flush()
 
-		stats := o.jobAccessor.JobStats("", result.JobNames, start.Add(-index.MaxAge), start)
+		stats := o.jobAccessor.JobStats("", result.JobNames, rangeStart, rangeEnd)
 
 		title := fmt.Sprintf("%d runs, %d failing runs, %d matched runs, %d jobs, %d matched jobs", stats.Count, stats.Failures, numRuns, stats.Jobs, len(result.Jobs))
 		fmt.Fprintf(writer, `<p style="position:absolute; top: -2rem;" class="small"><em title="%s">`, template.HTMLEscapeString(title))
@@ -349,22 +588,39 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 		}
 		fmt.Fprintf(writer, `</em> - <a href="/">clear search</a> | <a href="/chart?%s">chart view</a> - source code located <a target="_blank" href="https://github.com/openshift/ci-search">on github</a></p>`, template.HTMLEscapeString(req.URL.RawQuery))
 
+		if result.Truncated {
+			renderTruncatedNotice(writer, index, result.OutputBytes)
+		}
 		if numRuns == 0 && len(result.Bugs) == 0 && len(result.Issues) == 0 {
 			fmt.Fprintf(writer, `<p style="padding-top: 1em;"><em>No results found.</em></p><p><em>Search uses <a target="_blank" href="https://docs.rs/regex/0.2.5/regex/#syntax">ripgrep regular-expression patterns</a> to find results. Try simplifying your search or using case-insensitive options.</em></p>`)
 		}
 
 	default:
-		count, err := renderMatches(req.Context(), writer, index, o.generator, start, o)
-		if err != nil {
-			klog.Errorf("Search %q failed with %d results: command failed: %v", index.Search[0], count, err)
+		if err := o.findExplained(req.Context(), index); err != nil {
+			requestLog(req.Context()).Errorf("Search %q failed with %d results: command failed: %v", index.Search[0], 0, err)
+			fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
+			fmt.Fprint(writer, htmlPageEnd)
+			return
+		}
+		count, capped, err := renderMatches(req.Context(), writer, index, o.generator, start, o)
+		truncated := errors.Is(err, ErrMaxBytes)
+		if err != nil && !truncated {
+			requestLog(req.Context()).Errorf("Search %q failed with %d results: command failed: %v", index.Search[0], count, err)
 			fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
 			fmt.Fprint(writer, htmlPageEnd)
 			return
 		}
-		klog.V(2).Infof("Search %q over %q for job %s/%s completed with %d results", index.Search[0], index.SearchType, index.IncludeName, index.ExcludeName, count)
+		requestLog(req.Context()).V(2).Infof("Search %q over %q for job %s/%s completed with %d results", index.Search[0], index.SearchType, index.IncludeName, index.ExcludeName, count)
+		recordSearch(req, index, count)
 		fmt.Fprintf(writer, `<p style="position:absolute; top: -2rem;" class="small"><em>`)
 		fmt.Fprintf(writer, `Found %d results in %s`, count, time.Now().Sub(start).Truncate(time.Millisecond))
 		fmt.Fprintf(writer, `</em> - <a href="/">clear search</a> | <a href="/chart?%s">chart view</a> - source code located <a target="_blank" href="https://github.com/openshift/ci-search">on github</a></p>`, template.HTMLEscapeString(req.URL.RawQuery))
+		if capped {
+			fmt.Fprintf(writer, `<p class="alert alert-info">Showing the first %d of many results. Narrow the search or increase maxResults to see more.</p>`, count)
+		}
+		if truncated {
+			renderTruncatedNotice(writer, index, index.OutputBytes())
+		}
 		if count == 0 {
 			fmt.Fprintf(writer, `<p style="padding-top: 1em;"><em>No results found.</em></p><p><em>Search uses <a target="_blank" href="https://docs.rs/regex/0.2.5/regex/#syntax">ripgrep regular-expression patterns</a> to find results. Try simplifying your search or using case-insensitive options.</em></p>`)
 		}
@@ -377,6 +633,154 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 	success = true
 }
 
+// formTime formats t for a from or to form input, or returns an empty string if t is
+// not set.
+func formTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// renderTimeWindow describes the window of failure times searched as of now, if the
+// request set an explicit from or to time.
+func renderTimeWindow(w io.Writer, index *Index, now time.Time) {
+	if index.From.IsZero() && index.To.IsZero() {
+		return
+	}
+	from, to := index.TimeRange(now)
+	switch {
+	case from.IsZero():
+		fmt.Fprintf(w, `<p class="text-muted">Searching jobs that failed before %s.</p>`, template.HTMLEscapeString(formTime(to)))
+	default:
+		fmt.Fprintf(w, `<p class="text-muted">Searching jobs that failed between %s and %s.</p>`, template.HTMLEscapeString(formTime(from)), template.HTMLEscapeString(formTime(to)))
+	}
+}
+
+// renderTruncatedNotice explains that the results of index are incomplete because the
+// search stopped once it had read index.MaxBytes of matches.
+func renderTruncatedNotice(w io.Writer, index *Index, outputBytes int64) {
+	fmt.Fprintf(w, `<p class="alert alert-warning">The search stopped after reading %s of matching lines, the limit set by maxBytes (%s), so these results are incomplete. Narrow the search or increase maxBytes to see more.</p>`,
+		template.HTMLEscapeString(units.HumanSize(float64(outputBytes))), template.HTMLEscapeString(units.HumanSize(float64(index.MaxBytes))))
+}
+
+// renderBugRows writes the table rows for a matching bug and, if context is requested,
+// its matching lines.
+func renderBugRows(bw io.Writer, index *Index, bug SearchBugResult, start time.Time) error {
+	age := formatAge(bug.Matches[0].LastModified.Time, start)
+	name := bug.Name
+	if i := strings.Index(name, ": "); i != -1 {
+		name = name[i+2:]
+	}
+	fmt.Fprintf(bw, "<tr><td><a target=\"_blank\" href=\"%s\">#%d</a></td><td>%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\">%s</td></tr>\n", template.HTMLEscapeString(bug.URI.String()), bug.Number, template.HTMLEscapeString(matchTypeLabel(bug.Matches[0])), template.HTMLEscapeString(age), template.HTMLEscapeString(name))
+	if index.Context < 0 {
+		return nil
+	}
+	fmt.Fprintf(bw, "<tr class=\"row-match\"><td class=\"\" colspan=\"4\"><pre class=\"small\">")
+	for _, match := range bug.Matches {
+		if err := renderLinesString(bw, index.highlight, match.Context, match.MoreLines, renderedLineLength(index)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(bw, "</pre></td></tr>")
+	return err
+}
+
+// renderIssueRows writes the table rows for a matching issue and, if context is requested,
+// its matching lines.
+func renderIssueRows(bw io.Writer, index *Index, issue SearchIssuesResult, start time.Time) error {
+	age := formatAge(issue.Matches[0].LastModified.Time, start)
+	name := issue.Name
+	if i := strings.Index(name, ": "); i != -1 {
+		name = name[i+2:]
+	}
+	fmt.Fprintf(bw, "<tr><td><a class=\"text-nowrap\" target=\"_blank\" href=\"%s\">#%s</a></td><td>%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\">%s</td></tr>\n", template.HTMLEscapeString(issue.URI.String()), template.HTMLEscapeString(issue.Key), template.HTMLEscapeString(matchTypeLabel(issue.Matches[0])), template.HTMLEscapeString(age), template.HTMLEscapeString(name))
+	if index.Context < 0 {
+		return nil
+	}
+	fmt.Fprintf(bw, "<tr class=\"row-match\"><td class=\"\" colspan=\"4\"><pre class=\"small\">")
+	for _, match := range issue.Matches {
+		if err := renderLinesString(bw, index.highlight, match.Context, match.MoreLines, renderedLineLength(index)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(bw, "</pre></td></tr>")
+	return err
+}
+
+// collapsedMatch is a match and the runs of a job that matched with the same context.
+type collapsedMatch struct {
+	Match     Match
+	Instances []SearchJobInstanceResult
+}
+
+// collapseMatches returns the matches of the runs of a job in order. If collapse is true,
+// matches of the same file type whose trimmed context is identical are merged into the
+// first such match, along with the runs that had them.
+func collapseMatches(instances []SearchJobInstanceResult, collapse bool) []collapsedMatch {
+	var groups []collapsedMatch
+	positions := make(map[[sha256.Size]byte]int)
+	for _, instance := range instances {
+		for _, match := range instance.Matches {
+			if !collapse {
+				groups = append(groups, collapsedMatch{Match: match, Instances: []SearchJobInstanceResult{instance}})
+				continue
+			}
+			h := sha256.New()
+			io.WriteString(h, match.FileType)
+			for _, line := range match.Context {
+				h.Write([]byte{0})
+				io.WriteString(h, strings.TrimSpace(line))
+			}
+			var key [sha256.Size]byte
+			h.Sum(key[:0])
+			position, ok := positions[key]
+			if !ok {
+				positions[key] = len(groups)
+				groups = append(groups, collapsedMatch{Match: match, Instances: []SearchJobInstanceResult{instance}})
+				continue
+			}
+			// a run with several identical matches is only listed once
+			group := &groups[position]
+			if group.Instances[len(group.Instances)-1].Number != instance.Number {
+				group.Instances = append(group.Instances, instance)
+			}
+		}
+	}
+	return groups
+}
+
+// renderCollapsedBuilds returns an expandable list of links to the runs that matched
+// with identical context.
+func renderCollapsedBuilds(instances []SearchJobInstanceResult) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<details><summary><em>%d builds matched identically</em></summary>", len(instances))
+	for i, instance := range instances {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		fmt.Fprintf(&sb, "<a target=\"_blank\" href=\"%s\">#%d</a>", template.HTMLEscapeString(instance.URI.String()), instance.Number)
+	}
+	sb.WriteString("</details>")
+	return sb.String()
+}
+
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// matchTypeLabel describes the file type of a match along with the section of the
+// file the match was found in, if known.
+func matchTypeLabel(match Match) string {
+	if len(match.Section) == 0 {
+		return match.FileType
+	}
+	return fmt.Sprintf("%s (%s)", match.FileType, match.Section)
+}
+
 func intSelected(current, expected int) string {
 	if current == expected {
 		return "selected"
@@ -465,45 +869,56 @@ func (w *sortableWriter) Write(buf []byte) (int, error) {
 	return w.bw.Write(buf)
 }
 
-func renderMatches(ctx context.Context, w io.Writer, index *Index, generator CommandGenerator, start time.Time, resolver PathResolver) (int, error) {
+// errMaxResults stops a search once the requested number of results have been shown.
+var errMaxResults = fmt.Errorf("maximum results reached")
+
+// renderMatches writes each matching file as a table row and returns the number of
+// files written and whether the search stopped early because index.MaxResults files
+// were written.
+func renderMatches(ctx context.Context, w io.Writer, index *Index, generator CommandGenerator, start time.Time, resolver PathResolver) (int, bool, error) {
 	count, lineCount, matchCount := 0, 0, 0
 	lines := make([][]byte, 0, 64)
 
-	bw := &sortableWriter{sizeLimit: 2 * 1024 * 1024, bw: bufio.NewWriterSize(w, 256*1024)}
-	var lastName string
-	drop := true
-	err := executeGrep(ctx, generator, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
-		if lastName == name {
-			// continue accumulating matches
-			if drop {
-				return nil
-			}
-			if index.Context > 0 {
-				fmt.Fprintf(bw, "\n&mdash;\n\n")
-			}
+	// cancelling the search terminates ripgrep once enough results are found
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var capped bool
 
+	bw := &sortableWriter{sizeLimit: 2 * 1024 * 1024, bw: bufio.NewWriterSize(w, 256*1024)}
+	// finishRow closes the row of the last file, if one was written
+	finishRow := func() {
+		if index.Context < 0 {
+			fmt.Fprintf(bw, "<td>%d</td></tr>\n", matchCount)
 		} else {
+			fmt.Fprintf(bw, "</pre></td></tr>\n")
+		}
+	}
+	var lastName string
+	var metadata Result
+	var flakes flakeDetector
+	// drop is true if the matches of the current file are not shown, and started is true
+	// once the row of the current file has been written
+	drop, started := true, false
+	err := executeGrep(ctx, generator, index, nil, func(name string, search string, matches []bytes.Buffer, lineNumber int, moreLines int) error {
+		if lastName != name {
 			// finish the last result
 			lastName = name
-			if !drop {
-				if index.Context < 0 {
-					fmt.Fprintf(bw, "<td>%d</td></tr>\n", matchCount)
-				} else {
-					fmt.Fprintf(bw, "</pre></td></tr>\n")
-				}
+			if started {
+				finishRow()
 			}
-			drop = false
+			drop, started = false, false
 			matchCount = 0
 
 			// decide whether to print the next result
-			metadata, err := resolver.MetadataFor(name)
+			var err error
+			metadata, err = resolver.MetadataFor(name)
 			if err != nil {
-				klog.Errorf("unable to resolve metadata for: %s: %v", name, err)
+				requestLog(ctx).Errorf("unable to resolve metadata for: %s: %v", name, err)
 				drop = true
 				return nil
 			}
 			if metadata.URI == nil {
-				klog.Errorf("no job URI for %q", name)
+				requestLog(ctx).Errorf("no job URI for %q", name)
 				drop = true
 				return nil
 			}
@@ -511,14 +926,49 @@ func renderMatches(ctx context.Context, w io.Writer, index *Index, generator Com
 				drop = true
 				return nil
 			}
-
-			age, recent := formatAge(metadata.LastModified, start, index.MaxAge)
-			if !metadata.IgnoreAge && !recent {
-				klog.V(7).Infof("Filtered %s, older than query limit", name)
+			if index.IsExplained(metadata.FileType, search) {
+				drop = true
+				return nil
+			}
+			if !index.InDurationRange(metadata) {
 				drop = true
 				return nil
 			}
+			if !metadata.IgnoreAge && !index.InTimeRange(metadata.LastModified, start) {
+				requestLog(ctx).V(7).Infof("Filtered %s, older than query limit", name)
+				drop = true
+				return nil
+			}
+		}
+		if drop {
+			return nil
+		}
 
+		// remove empty leading and trailing lines, but preserve the line buffer to limit allocations
+		lines = trimMatches(matches, lines[:0])
+
+		// a flaky match is skipped before the row of its file is written, so that a file
+		// whose matches are all hidden is not shown or counted
+		var flake bool
+		if path.Base(name) == "junit.failures" {
+			contextLines := make([]string, 0, len(lines))
+			for _, line := range lines {
+				contextLines = append(contextLines, string(line))
+			}
+			flake = flakes.isFlake(filepath.Join(generator.PathPrefix(), filepath.FromSlash(name)), trimmedLineNumber(matches, lineNumber), index.Pattern(search), index.Context, contextLines)
+			if flake && index.HideFlakes {
+				return nil
+			}
+		}
+
+		if !started {
+			if index.MaxResults > 0 && count >= index.MaxResults {
+				capped = true
+				drop = true
+				cancel()
+				return errMaxResults
+			}
+			started = true
 			count++
 			if count == 1 {
 				if index.Context >= 0 {
@@ -527,6 +977,7 @@ func renderMatches(ctx context.Context, w io.Writer, index *Index, generator Com
 					fmt.Fprintln(bw, `<div class="table-responsive"><table class="table"><tbody><tr><th>Type</th><th>Job</th><th>Age</th><th># of hits</th></tr>`)
 				}
 			}
+			age := formatAge(metadata.LastModified, start)
 			bw.SetIndex(-metadata.LastModified.Unix())
 			switch metadata.FileType {
 			case "bug":
@@ -538,50 +989,54 @@ func renderMatches(ctx context.Context, w io.Writer, index *Index, generator Com
 			if index.Context >= 0 {
 				fmt.Fprintf(bw, "</tr>\n<tr class=\"row-match\"><td class=\"\" colspan=\"3\"><pre class=\"small\">")
 			}
+		} else if index.Context > 0 {
+			// continue accumulating matches
+			fmt.Fprintf(bw, "\n&mdash;\n\n")
 		}
 
 		matchCount++
 		if index.Context < 0 {
 			return nil
 		}
-
-		// remove empty leading and trailing lines, but preserve the line buffer to limit allocations
-		lines = trimMatches(matches, lines[:0])
-		if err := renderLines(bw, lines, moreLines); err != nil {
+		if flake {
+			fmt.Fprintln(bw, htmlFlakeBadge)
+		}
+		if err := renderLines(bw, index.highlight, lines, moreLines, renderedLineLength(index)); err != nil {
 			return err
 		}
 		lineCount += len(lines)
 		return nil
 	})
 
-	if !drop {
-		if index.Context <= 0 {
-			fmt.Fprintf(bw, "<td>%d</td></tr>\n", matchCount)
-		} else {
-			fmt.Fprintf(bw, "</pre></td></tr>\n")
-		}
+	if started {
+		finishRow()
 	}
 	if err := bw.Flush(); err != nil {
-		klog.Errorf("Unable to flush results buffer: %v", err)
+		requestLog(ctx).Errorf("Unable to flush results buffer: %v", err)
 	}
 	if count > 0 {
 		fmt.Fprintf(w, "</table></div>\n")
 	}
-	return count, err
+	if capped {
+		err = nil
+	}
+	return count, capped, err
 }
 
-func formatAge(t time.Time, from time.Time, maxAge time.Duration) (string, bool) {
+func formatAge(t time.Time, from time.Time) string {
 	if t.IsZero() {
-		return "", true
+		return ""
 	}
-	duration := from.Sub(t)
-	return units.HumanDuration(duration) + " ago", duration <= maxAge
+	return units.HumanDuration(from.Sub(t)) + " ago"
 }
 
+// trimMatches appends the lines of a match to lines without trailing spaces, dropping
+// the empty lines before and after the match. Empty lines within the match are kept, so
+// that a match that spans lines is shown as it appears in the file.
 func trimMatches(matches []bytes.Buffer, lines [][]byte) [][]byte {
 	for _, m := range matches {
 		line := bytes.TrimRightFunc(m.Bytes(), func(r rune) bool { return r == ' ' })
-		if len(line) == 0 {
+		if len(line) == 0 && len(lines) == 0 {
 			continue
 		}
 		lines = append(lines, line)
@@ -595,10 +1050,26 @@ func trimMatches(matches []bytes.Buffer, lines [][]byte) [][]byte {
 	return lines
 }
 
+// trimmedLineNumber returns the line number of the first line kept by trimMatches, given
+// the line number of the first of matches, or zero if lineNumber is zero.
+func trimmedLineNumber(matches []bytes.Buffer, lineNumber int) int {
+	if lineNumber == 0 {
+		return 0
+	}
+	for _, m := range matches {
+		if len(bytes.TrimRight(m.Bytes(), " ")) != 0 {
+			break
+		}
+		lineNumber++
+	}
+	return lineNumber
+}
+
+// trimMatchStrings is trimMatches for lines returned as strings.
 func trimMatchStrings(matches []bytes.Buffer, lines []string) []string {
 	for _, m := range matches {
 		line := bytes.TrimRightFunc(m.Bytes(), func(r rune) bool { return r == ' ' })
-		if len(line) == 0 {
+		if len(line) == 0 && len(lines) == 0 {
 			continue
 		}
 		lines = append(lines, string(line))
@@ -612,9 +1083,41 @@ func trimMatchStrings(matches []bytes.Buffer, lines []string) []string {
 	return lines
 }
 
-func renderLines(bw io.Writer, lines [][]byte, moreLines int) error {
+// maxRenderedLineLength is the maximum number of bytes of a single line shown to the
+// user, unless a search asks for a shorter maxLineLength. Longer lines are truncated with
+// a marker.
+const maxRenderedLineLength = 128 * 1024
+
+// renderedLineLength returns the number of bytes of each line that is shown for index.
+func renderedLineLength(index *Index) int {
+	if index.MaxLineLength > 0 && index.MaxLineLength < maxRenderedLineLength {
+		return index.MaxLineLength
+	}
+	return maxRenderedLineLength
+}
+
+// truncateLine returns at most maxLength bytes of line, ending at the start of a UTF-8
+// character so that no character is split, and the number of bytes removed.
+func truncateLine(line []byte, maxLength int) ([]byte, int) {
+	if len(line) <= maxLength {
+		return line, 0
+	}
+	end := maxLength
+	for end > 0 && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	return line[:end], len(line) - end
+}
+
+// renderLines writes lines escaped as HTML, marking the text matched by highlight if it is
+// set. Lines longer than maxLength bytes are truncated with a marker.
+func renderLines(bw io.Writer, highlight *regexp.Regexp, lines [][]byte, moreLines int, maxLength int) error {
 	for _, line := range lines {
-		template.HTMLEscape(bw, line)
+		line, truncated := truncateLine(line, maxLength)
+		writeHighlighted(bw, line, highlight)
+		if truncated > 0 {
+			fmt.Fprintf(bw, " ... (%d bytes truncated)", truncated)
+		}
 		if _, err := fmt.Fprintln(bw); err != nil {
 			return err
 		}
@@ -625,9 +1128,14 @@ func renderLines(bw io.Writer, lines [][]byte, moreLines int) error {
 	return nil
 }
 
-func renderLinesString(bw io.Writer, lines []string, moreLines int) error {
+// renderLinesString is renderLines for lines held as strings.
+func renderLinesString(bw io.Writer, highlight *regexp.Regexp, lines []string, moreLines int, maxLength int) error {
 	for _, line := range lines {
-		template.HTMLEscape(bw, []byte(line))
+		line, truncated := truncateLine([]byte(line), maxLength)
+		writeHighlighted(bw, line, highlight)
+		if truncated > 0 {
+			fmt.Fprintf(bw, " ... (%d bytes truncated)", truncated)
+		}
 		if _, err := fmt.Fprintln(bw); err != nil {
 			return err
 		}
@@ -651,12 +1159,15 @@ const htmlPageStart = `<!DOCTYPE html>
 .row-match TD { border-top: 0; }
 .table TD { padding-bottom: 0.25rem; }
 #results .table-job-compact TD > PRE { margin-bottom: 0; padding-bottom: 0.25rem; }
+#results PRE MARK { padding: 0; }
 </style>
 </head>
 <body>
 <div id="results" class="container-fluid %s">
 `
 
+const htmlFlakeBadge = ` <span class="badge badge-warning" title="This test failed and then passed in the same run">flake</span>`
+
 const htmlPageEnd = `
 </div>
 </body>
@@ -676,35 +1187,68 @@ const htmlIndexForm = `
 		<div class="input-group-prepend"><span class="input-group-text" for="name">Job:</span></div>
 		<input title="A regular expression that matches the name of a job or the title of a bug" class="form-control col-auto" name="name" value="%s" placeholder="Focus job or bug names by regex ...">
 		<input title="A regular expression that matches the name of a job or the title of a bug" class="form-control col-auto" name="excludeName" value="%s" placeholder="Skip job or bug names by regex ...">
+		%s
 		<input title="The number of matches per job / file to show" autocomplete="off" class="form-control col-1" name="maxMatches" value="%s" placeholder="Max matches per job or bug">
 		<input title="The maximum number of bytes for the response" autocomplete="off" class="form-control col-1" name="maxBytes" value="%s" placeholder="Max bytes to return">
-		<select title="Group results by job (with stats) or no grouping" name="groupBy" class="form-control custom-select col-1" onchange="this.form.submit();">%s</select>
+		<input title="Search jobs that failed at or after this time instead of within the max age, as an RFC3339 time or a date" autocomplete="off" class="form-control col-1" name="from" value="%s" placeholder="From time">
+		<input title="Search jobs that failed at or before this time, as an RFC3339 time or a date" autocomplete="off" class="form-control col-1" name="to" value="%s" placeholder="To time">
+		<select title="Group results by job (with stats), bugs and issues by component, or no grouping" name="groupBy" class="form-control custom-select col-1" onchange="this.form.submit();">%s</select>
+		<select title="The order of grouped jobs: as found, by the fraction of runs that failed, by matching runs, by name, or by most recent match" name="sort" class="form-control custom-select col-1" onchange="this.form.submit();">%s</select>
+		<select title="Smart case is case-insensitive unless the search contains an uppercase letter" name="case" class="form-control custom-select col-1" onchange="this.form.submit();">%s</select>
 		<div class="input-group-append"><span class="input-group-text">
+			<input id="literal" type="checkbox" name="literal" value="1" %s onchange="this.form.submit();">
+			<label for="literal" style="margin-bottom: 0; margin-left: 0.4em;" title="Match the search text exactly instead of as a regular expression">Literal</label>
+		</span><span class="input-group-text">
+			<input id="collapse" type="checkbox" name="collapse" value="1" %s onchange="this.form.submit();">
+			<label for="collapse" style="margin-bottom: 0; margin-left: 0.4em;" title="Show the runs of a job that matched with identical context once">Collapse</label>
+		</span><span class="input-group-text">
 			<input id="wrap" type="checkbox" name="wrap" %s onchange="document.getElementById('results').classList.toggle('nowrap')">
 			<label for="wrap" style="margin-bottom: 0; margin-left: 0.4em;">Wrap lines</label>
-		</span></div>
+		</span><button class="btn btn-outline-secondary" type="button" title="Copy a link that reproduces these results with every setting on this page" onclick="copyPermalink(this)">Copy permalink</button></div>
 	</div>
 </form>
+<script>
+function copyPermalink(button) {
+	fetch('/permalink?' + new URLSearchParams(new FormData(button.form)).toString()).then(resp => {
+		if (!resp.ok) {
+			throw new Error(resp.statusText);
+		}
+		return resp.text();
+	}).then(path => {
+		const url = new URL(path, window.location.href).toString();
+		window.history.replaceState(null, '', url);
+		return navigator.clipboard.writeText(url);
+	}).then(() => { button.textContent = 'Copied'; }, () => { button.textContent = 'Copy failed'; });
+}
+</script>
 `
 
+const htmlExcludeInput = `<input title="Skip files that also contain a line matching this regular expression anywhere in the file" class="form-control col-auto" name="exclude" value="%s" placeholder="Skip files containing regex ...">`
+
 const htmlEmptyPage = `
 <div class="ml-3" style="margin-top: 3rem; color: #666;">
 <p>Find bugs and test failures from failed or flaky CI jobs in <a target="_blank" href="%s">OpenShift CI</a>.</p>
 <p>The search input will use <a target="_blank" href="https://docs.rs/regex/0.2.5/regex/#syntax">ripgrep regular-expression patterns</a>.</p>
-<p>Searches are case-insensitive (using ripgrep "smart casing")</p>
+<p>Searches are case-insensitive unless they contain an uppercase letter (using ripgrep "smart casing"). Choose <em>case sensitive</em> or <em>ignore case</em> (or pass <code>case=sensitive</code> or <code>case=insensitive</code>) to override this.</p>
+<p>Check <em>Literal</em> (or pass <code>literal=true</code>) to match the search text exactly, which is useful for pasted errors or stack traces that contain characters like <code>(</code>, <code>[</code>, or <code>.</code>.</p>
+<p>To find files that match a search but not another, pass the other as <code>exclude</code>, which may be repeated. Exclusion applies to the whole file: a file is skipped if any of its lines match an exclusion, even lines far from the match.</p>
 <p>Examples:
 <ul>
 <li><code>timeout</code> - all JUnit failures with 'timeout' in the result</li>
 <li><code>status code \d{3}\s</code> - all failures that contain 'status code' followed by a 3 digit number</li>
-<li><code>(?m)text on one line .* and text on another line</code> - search for text across multiple lines</li>
+<li><code>(?s)text on one line.*text on another line</code> - search for text across multiple lines, which is slower than searching single lines</li>
 </ul>
-<p>You can alter the age of results to search with the dropdown next to the search bar. Note that older results are pruned and may not be available after 14 days.</p>
-<p>The amount of surrounding text returned with each match can be changed, including none.
+<p>The search type chooses which files are searched. <em>all</em> and <em>everything</em> search bugs, issues, and every indexed job file. <em>must-gather</em> and <em>e2e-log</em> search the must-gather files and e2e.log of failed jobs when the server is configured to index them.</p>
+<p>You can alter the age of results to search with the dropdown next to the search bar, or pass a <code>maxAge</code> such as <code>36h</code>, <code>2d</code>, or <code>1w</code>. Note that older results are pruned and may not be available after 14 days.</p>
+<p>To search only the most recent runs of each job, pass <code>perJobLimit</code> with the number of the newest builds of each job to search within that age.</p>
+<p>To search a past window instead, pass <code>from</code> and <code>to</code> times such as <code>from=2024-05-07T09:00:00Z&amp;to=2024-05-07T17:00:00Z</code>. Times without a zone are UTC, and a date alone is midnight UTC. If only <code>to</code> is given, the window is the <code>maxAge</code> before it.</p>
+<p>The amount of surrounding text returned with each match can be changed, including none. Very long lines are shortened to 128KiB, or to the number of bytes passed as <code>maxLineLength</code>, with a count of the bytes removed.</p>
 <p>You may filter by job name using regex controls:
 <ul>
 <li><code>^release-</code> - all jobs that start with 'release-'</li>
 <li><code>UpgradeBlocker</code> - bugs that have 'UpgradeBlocker' in their title</li>
 </ul>
+<p>If the server defines job aliases, a job filter that is exactly an alias, such as a short name for a frequently used job, is replaced by the regex of the alias.</p>
 <div id="width"></div>
 <p id="graph">
 <p>Currently indexing %s across %d results, %d failed jobs of %d, %d bugs and %d issues</p>
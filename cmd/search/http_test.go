@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/openshift/ci-search/bugzilla"
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_renderMatches_maxResults(t *testing.T) {
+	prefix := "/var/lib/ci-search/"
+	output := filepath.Join(t.TempDir(), "output")
+	var lines []string
+	for _, job := range []string{"job-a/1", "job-b/2", "job-c/3"} {
+		lines = append(lines, prefix+"jobs/logs/"+job+"/build-log.txt\x00error: etcdserver: request timed out")
+	}
+	if err := os.WriteFile(output, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	gen := &outputCommand{prefix: prefix, output: output}
+	o := &options{
+		MaxAge:       24 * time.Hour,
+		generator:    gen,
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{},
+		jobAccessor:  prow.Empty,
+	}
+
+	for _, tt := range []struct {
+		maxResults int
+		count      int
+		capped     bool
+	}{
+		{maxResults: 0, count: 3},
+		{maxResults: 2, count: 2, capped: true},
+		{maxResults: 3, count: 3},
+	} {
+		index := &Index{Search: []string{"etcdserver"}, SearchType: "build-log", MaxAge: 24 * time.Hour, MaxMatches: 1, MaxBytes: 1024 * 1024, MaxResults: tt.maxResults}
+		buf := &bytes.Buffer{}
+		count, capped, err := renderMatches(context.TODO(), buf, index, gen, time.Now(), o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != tt.count || capped != tt.capped {
+			t.Errorf("maxResults=%d: unexpected count %d and capped %t", tt.maxResults, count, capped)
+		}
+		if rows := strings.Count(buf.String(), "build-log</td>"); rows != tt.count {
+			t.Errorf("maxResults=%d: unexpected rows %d: %s", tt.maxResults, rows, buf.String())
+		}
+	}
+}
+
+// numberedOutputCommand prints a file of ripgrep formatted output with line numbers for
+// every search. The shell is given --line-number as its script name so that the output
+// is parsed for line numbers.
+type numberedOutputCommand struct {
+	outputCommand
+}
+
+func (c *numberedOutputCommand) Command(index *Index, search string, jobNames sets.String) (string, []string, []string, error) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return sh, []string{"sh", "-c", `cat "$@"`, "--line-number"}, []string{c.output}, nil
+}
+
+func Test_renderMatches_hideFlakes(t *testing.T) {
+	prefix := t.TempDir() + "/"
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(prefix, "jobs/logs", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// job-a has a flaky and a failing test with the same output, job-b only a flaky test,
+	// and job-c only a failing test
+	write("job-a/1/junit.failures", "# [sig-a] flaky\nfailed: timeout\n# [sig-b] broken\nfailed: timeout\n")
+	write("job-a/1/junit.flakes", "[sig-a] flaky\n")
+	write("job-b/2/junit.failures", "# [sig-a] flaky\nfailed: timeout\n")
+	write("job-b/2/junit.flakes", "[sig-a] flaky\n")
+	write("job-c/3/junit.failures", "# [sig-b] broken\nfailed: timeout\n")
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(
+		prefix+"jobs/logs/job-a/1/junit.failures\x002:failed: timeout\n"+
+			"--\n"+
+			prefix+"jobs/logs/job-a/1/junit.failures\x004:failed: timeout\n"+
+			prefix+"jobs/logs/job-b/2/junit.failures\x002:failed: timeout\n"+
+			prefix+"jobs/logs/job-c/3/junit.failures\x002:failed: timeout\n",
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	gen := &numberedOutputCommand{outputCommand{prefix: prefix, output: output}}
+	o := &options{
+		MaxAge:       24 * time.Hour,
+		generator:    gen,
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{},
+		jobAccessor:  prow.Empty,
+	}
+
+	for _, tt := range []struct {
+		name       string
+		hideFlakes bool
+		context    int
+		maxResults int
+		count      int
+		badges     int
+		hits       string
+	}{
+		{name: "shown", context: 0, count: 3, badges: 2},
+		{name: "hidden", hideFlakes: true, context: 0, count: 2},
+		{name: "hidden flakes do not use up results", hideFlakes: true, context: 0, maxResults: 2, count: 2},
+		{name: "hidden without context", hideFlakes: true, context: -1, count: 2, hits: "<td>1</td></tr>\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			index := &Index{Search: []string{"timeout"}, SearchType: "junit", MaxAge: 24 * time.Hour, MaxMatches: 2, MaxBytes: 1024 * 1024, MaxResults: tt.maxResults, Context: tt.context, HideFlakes: tt.hideFlakes}
+			buf := &bytes.Buffer{}
+			count, capped, err := renderMatches(context.TODO(), buf, index, gen, time.Now(), o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			if count != tt.count || capped {
+				t.Errorf("unexpected count %d and capped %t: %s", count, capped, out)
+			}
+			if rows := strings.Count(out, "junit</td>"); rows != tt.count {
+				t.Errorf("unexpected rows %d: %s", rows, out)
+			}
+			if tt.hideFlakes && strings.Contains(out, "job-b") {
+				t.Errorf("expected the job with only flaky matches to be hidden: %s", out)
+			}
+			if badges := strings.Count(out, htmlFlakeBadge); badges != tt.badges {
+				t.Errorf("unexpected flake badges %d: %s", badges, out)
+			}
+			if len(tt.hits) > 0 && strings.Count(out, tt.hits) != tt.count {
+				t.Errorf("expected each row to have one hit: %s", out)
+			}
+		})
+	}
+}
+
+func Test_collapseMatches(t *testing.T) {
+	instance := func(number int, matches ...Match) SearchJobInstanceResult {
+		return SearchJobInstanceResult{Number: number, URI: &url.URL{Path: "/" + strings.Repeat("x", number)}, Matches: matches}
+	}
+	timeout := Match{FileType: "junit", Context: []string{"  error: timeout  "}}
+	timeoutIndented := Match{FileType: "junit", Context: []string{"error: timeout"}}
+	refused := Match{FileType: "junit", Context: []string{"error: connection refused"}}
+	instances := []SearchJobInstanceResult{
+		instance(3, timeout, timeout),
+		instance(2, refused),
+		instance(1, timeoutIndented),
+	}
+
+	if groups := collapseMatches(instances, false); len(groups) != 4 {
+		t.Fatalf("expected every match without collapsing, got %d", len(groups))
+	}
+
+	groups := collapseMatches(instances, true)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %#v", groups)
+	}
+	var numbers []int
+	for _, instance := range groups[0].Instances {
+		numbers = append(numbers, instance.Number)
+	}
+	if len(numbers) != 2 || numbers[0] != 3 || numbers[1] != 1 || groups[0].Match.Context[0] != timeout.Context[0] {
+		t.Errorf("unexpected first group: %v %#v", numbers, groups[0].Match)
+	}
+	if len(groups[1].Instances) != 1 || groups[1].Instances[0].Number != 2 {
+		t.Errorf("unexpected second group: %#v", groups[1])
+	}
+	if html := renderCollapsedBuilds(groups[0].Instances); !strings.Contains(html, "2 builds matched identically") || !strings.Contains(html, ">#1</a>") {
+		t.Errorf("unexpected rendered builds: %s", html)
+	}
+}
+
+func Test_handleStatus_sources(t *testing.T) {
+	newest := time.Now().Add(-time.Hour)
+	o := &options{
+		MaxAge:      24 * time.Hour,
+		BugzillaURL: "https://bugzilla.example.com",
+		bugs:        bugzilla.NewCommentStore(nil, 0, false, nil),
+		jobsIndex: &pathIndex{
+			ordered: []pathAge{{path: "a", age: newest}},
+			stats:   PathIndexStats{Entries: 1},
+			loaded:  time.Now(),
+		},
+	}
+	w := httptest.NewRecorder()
+	o.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+
+	var status StatusResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	jobs := status.Jobs
+	if jobs == nil || jobs.Entries != 1 || jobs.MaxAgeSeconds != 86400 || jobs.Newest == nil || jobs.Loaded == nil || jobs.AgeSeconds < 3540 || jobs.AgeSeconds > 3660 {
+		t.Errorf("unexpected job status: %s", w.Body.String())
+	}
+	// durations are serialized in seconds rather than as nanoseconds
+	var raw struct {
+		Jobs map[string]interface{} `json:"jobs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw.Jobs["maxAgeSeconds"] != float64(86400) || raw.Jobs["maxAge"] != nil || raw.Jobs["age"] != nil {
+		t.Errorf("unexpected serialized job status: %s", w.Body.String())
+	}
+	if status.Bugs == nil || status.Bugs.Entries != 0 || status.Bugs.Newest != nil {
+		t.Errorf("unexpected bug status: %s", w.Body.String())
+	}
+	if status.Issues != nil {
+		t.Errorf("issues are not indexed: %s", w.Body.String())
+	}
+}
+
+func Test_renderLines_maxLineLength(t *testing.T) {
+	lines := [][]byte{[]byte("short"), []byte("data: " + strings.Repeat("é", 20))}
+	buf := &bytes.Buffer{}
+	if err := renderLines(buf, nil, lines, 0, 9); err != nil {
+		t.Fatal(err)
+	}
+	// the multi-byte character at the limit is not split
+	if want := "short\ndata: é ... (38 bytes truncated)\n"; buf.String() != want {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := renderLinesString(buf, nil, []string{"short", strings.Repeat("a", 12)}, 2, 10); err != nil {
+		t.Fatal(err)
+	}
+	if want := "short\naaaaaaaaaa ... (2 bytes truncated)\n\n... 2 lines not shown\n\n"; buf.String() != want {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	if got := renderedLineLength(&Index{}); got != maxRenderedLineLength {
+		t.Errorf("unexpected default length %d", got)
+	}
+	if got := renderedLineLength(&Index{MaxLineLength: 200}); got != 200 {
+		t.Errorf("unexpected length %d", got)
+	}
+	for _, value := range []string{"-1", "x", strconv.Itoa(maxRenderedLineLength + 1)} {
+		if _, err := parseRequest(httptest.NewRequest("GET", "/?search=x&maxLineLength="+value, nil), "text", time.Hour, nil); err == nil {
+			t.Errorf("expected maxLineLength=%s to be rejected", value)
+		}
+	}
+}
+
+func Test_renderTimeWindow(t *testing.T) {
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	from := time.Date(2024, 5, 7, 9, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 5, 7, 17, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name  string
+		index *Index
+		want  string
+	}{
+		{name: "max age only", index: &Index{MaxAge: time.Hour}},
+		{
+			name:  "explicit window",
+			index: &Index{From: from, To: to},
+			want:  "between 2024-05-07T09:00:00Z and 2024-05-07T17:00:00Z",
+		},
+		{
+			name:  "from until now",
+			index: &Index{From: from},
+			want:  "between 2024-05-07T09:00:00Z and 2024-05-10T00:00:00Z",
+		},
+		{
+			name:  "max age before to",
+			index: &Index{MaxAge: 24 * time.Hour, To: to},
+			want:  "between 2024-05-06T17:00:00Z and 2024-05-07T17:00:00Z",
+		},
+		{
+			name:  "unbounded before to",
+			index: &Index{To: to},
+			want:  "before 2024-05-07T17:00:00Z",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			renderTimeWindow(&buf, tt.index, now)
+			if len(tt.want) == 0 {
+				if buf.Len() > 0 {
+					t.Errorf("expected no window, got %s", buf.String())
+				}
+				return
+			}
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("expected %q in %s", tt.want, buf.String())
+			}
+		})
+	}
+}
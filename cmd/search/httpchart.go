@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"github.com/openshift/ci-search/pkg/httpwriter"
-	"k8s.io/klog/v2"
 )
 
 var colors = []color.Color{
@@ -38,7 +37,8 @@ var specialColors = map[string]color.Color{
 }
 
 func (o *options) handleChart(w http.ResponseWriter, req *http.Request) {
-	if req.Header.Get("Accept") == "text/png" {
+	switch req.Header.Get("Accept") {
+	case "text/png", "image/png":
 		o.handleChartPNG(w, req)
 		return
 	}
@@ -47,24 +47,34 @@ func (o *options) handleChart(w http.ResponseWriter, req *http.Request) {
 	var index *Index
 	var success bool
 	defer func() {
-		klog.Infof("Render chart %s duration=%s success=%t", index.String(), time.Now().Sub(start).Truncate(time.Millisecond), success)
+		requestLog(req.Context()).Infof("Render chart %s duration=%s success=%t", index.String(), time.Now().Sub(start).Truncate(time.Millisecond), success)
 	}()
 
 	var err error
-	index, err = parseRequest(req, "chart", o.MaxAge)
+	index, err = parseRequest(req, "chart", o.MaxAge, o.jobAliases)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
 	}
 
+	o.applyChartDefaults(index)
+
+	release, ok := o.acquireSearch(w)
+	if !ok {
+		return
+	}
+	defer release()
+
 	index.MaxMatches = 1
+	index.combineSearches = true
 
 	counts := make(map[string]int, len(index.Search))
-	var lastJob string
-	err = executeGrep(req.Context(), o.generator, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
+	// the results of a combined search may alternate between searches
+	lastJobs := make(map[string]string, len(index.Search))
+	err = executeGrep(req.Context(), o.generator, index, nil, func(name string, search string, matches []bytes.Buffer, _ int, moreLines int) error {
 		metadata, err := o.MetadataFor(name)
 		if err != nil {
-			klog.Errorf("unable to resolve metadata for: %s: %v", name, err)
+			requestLog(req.Context()).Errorf("unable to resolve metadata for: %s: %v", name, err)
 			return nil
 		}
 		if metadata.URI == nil {
@@ -72,12 +82,17 @@ func (o *options) handleChart(w http.ResponseWriter, req *http.Request) {
 		}
 
 		uri := metadata.URI.String()
-		if uri != lastJob {
-			lastJob = uri
+		if uri != lastJobs[search] {
+			lastJobs[search] = uri
 			counts[search] += 1
 		}
 		return nil
 	})
+	var total int
+	for _, count := range counts {
+		total += count
+	}
+	recordSearch(req, index, total)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusBadRequest)
 		return
@@ -96,14 +111,16 @@ func (o *options) handleChart(w http.ResponseWriter, req *http.Request) {
 	}
 
 	err = htmlChart.Execute(writer, map[string]interface{}{
-		"index":          index,
-		"colors":         colors,
-		"counts":         counts,
-		"openGraphImage": openGraphImage.String(),
-		"specialColors":  specialColors,
+		"index":            index,
+		"colors":           colors,
+		"counts":           counts,
+		"labels":           o.chartLabels(),
+		"openGraphImage":   openGraphImage.String(),
+		"specialColors":    specialColors,
+		"freshnessWarning": o.freshnessWarning(index),
 	})
 	if err != nil {
-		klog.Errorf("Failed to execute chart template: %v", err)
+		requestLog(req.Context()).Errorf("Failed to execute chart template: %v", err)
 		return
 	}
 
@@ -143,6 +160,12 @@ var htmlChart = template.Must(template.New("chart").Funcs(map[string]interface{}
         position: absolute;
         z-index: 1000;
       }
+
+      .freshness-warning {
+        padding: 0 0.5em;
+        color: #856404;
+        background-color: #fff3cd;
+      }
     </style>
   </head>
   <body>
@@ -150,6 +173,7 @@ var htmlChart = template.Must(template.New("chart").Funcs(map[string]interface{}
     <div id="overlay">
       <button id="list-view">List view</button>
       <button id="add-regexp">Add regexp</button>
+      {{with .freshnessWarning}}<strong class="freshness-warning">{{.}}</strong>{{end}}
     </div>
     <script>
       var markRadius = 5;
@@ -174,6 +198,8 @@ var htmlChart = template.Must(template.New("chart").Funcs(map[string]interface{}
       var filter = '{{.index.IncludeName}}';
       var dateRange = {{.index.MaxAge.Seconds}};  // in seconds
       var searchType = '{{.index.SearchType}}';
+      var literal = {{.index.Literal}};
+      var caseSensitivity = '{{.index.Case}}';
 
       // {
       //   "regexp-pattern": {
@@ -190,6 +216,12 @@ var htmlChart = template.Must(template.New("chart").Funcs(map[string]interface{}
       regexps.set('{{.}}', new Map());
 {{- end}}
 
+      // labels shown in the legend instead of regexps
+      var regexpLabels = new Map();
+{{range $regexp, $label := .labels}}
+      regexpLabels.set('{{$regexp}}', '{{$label}}');
+{{- end}}
+
       var regexpColors = [
 {{range .colors}}
         '{{hexColor .}}',
@@ -391,7 +423,7 @@ var htmlChart = template.Must(template.New("chart").Funcs(map[string]interface{}
           var matchCount = data.filter(job => regexps.get(regexp).get(job.status.url)).length;
           legend.push({
             color: regexpColors[i],
-            text: matchCount + ' (' + Math.round(matchCount / (totalFailures || 1) * 100)+ '% of all failures) ' + regexp,
+            text: matchCount + ' (' + Math.round(matchCount / (totalFailures || 1) * 100)+ '% of all failures) ' + (regexpLabels.get(regexp) || regexp),
           });
         });
         var matchCount = data.filter(job => job.status.state === 'failure' && regexpMatches(job).size === 0).length;
@@ -480,6 +512,12 @@ var htmlChart = template.Must(template.New("chart").Funcs(map[string]interface{}
         searchParams.append('maxAge', dateRange + 's');  // chart is by start, but maxAge is by finish, so no need to expand this to handle drifting relative times.
         searchParams.append('context', 0);
         searchParams.append('type', searchType);
+        if (literal) {
+          searchParams.append('literal', 'true');
+        }
+        if (caseSensitivity) {
+          searchParams.append('case', caseSensitivity);
+        }
         regexps.forEach((_, regexp) => {
           searchParams.append('search', regexp);
         });
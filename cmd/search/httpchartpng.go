@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/klog/v2"
 )
 
 type scatter struct {
@@ -48,21 +47,29 @@ func (o *options) handleChartPNG(w http.ResponseWriter, req *http.Request) {
 	var index *Index
 	var success bool
 	defer func() {
-		klog.Infof("Render chart PNG %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+		requestLog(req.Context()).Infof("Render chart PNG %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
 	}()
 
 	var err error
-	index, err = parseRequest(req, "chart", o.MaxAge)
+	index, err = parseRequest(req, "chart", o.MaxAge, o.jobAliases)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
 	}
+	o.applyChartDefaults(index)
 
 	if len(index.Search) == 0 {
 		http.Error(w, "The 'search' query parameter is required", http.StatusBadRequest)
 		return
 	}
 
+	release, ok := o.acquireSearch(w)
+	if !ok {
+		return
+	}
+	defer release()
+	index.combineSearches = true
+
 	width := 640
 	height := width / 21 * 9
 
@@ -72,10 +79,9 @@ func (o *options) handleChartPNG(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	maxTime := time.Now()
-	minTime := maxTime.Add(-index.MaxAge)
-	xScale := float64(width) / index.MaxAge.Seconds()
-	result, err := o.searchResult(req.Context(), index)
+	minTime, maxTime := index.TimeRange(time.Now())
+	xScale := float64(width) / maxTime.Sub(minTime).Seconds()
+	result, _, err := o.searchResult(req.Context(), index)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
 		return
@@ -85,7 +91,7 @@ func (o *options) handleChartPNG(w http.ResponseWriter, req *http.Request) {
 	scatters := make([]*scatter, len(index.Search)+4)
 	for _, job := range jobs {
 		start, stop := job.Status.StartTime.Time, job.Status.CompletionTime.Time
-		if start.Before(minTime) {
+		if start.Before(minTime) || start.After(maxTime) {
 			continue
 		}
 
@@ -142,6 +148,10 @@ func (o *options) handleChartPNG(w http.ResponseWriter, req *http.Request) {
 		})
 	}
 
+	// jobs that have just started have no duration
+	if maxDuration == 0 {
+		maxDuration = 1
+	}
 	for _, scatter := range scatters {
 		if scatter == nil {
 			continue
@@ -183,7 +193,7 @@ func (o *options) handleChartPNG(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Cache-Control", "public,max-age=30")
 	w.Header().Set("Content-Type", "image/png")
 	if err = png.Encode(w, img); err != nil {
-		klog.Errorf("Failed to write response: %v", err)
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
 		return
 	}
 
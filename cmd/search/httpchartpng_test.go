@@ -0,0 +1,86 @@
+package main
+
+import (
+	"image/png"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_handleChartPNG(t *testing.T) {
+	prefix := "/var/lib/ci-search/"
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(prefix+"jobs/logs/job-e2e-a/1/build-log.txt\x00error: etcdserver: request timed out\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	var jobs []*prow.Job
+	for _, job := range []struct {
+		name, state string
+		started     time.Time
+		completed   time.Time
+	}{
+		{name: "job-e2e-a", state: "failure", started: now.Add(-2 * time.Hour), completed: now.Add(-time.Hour)},
+		{name: "job-e2e-b", state: "success", started: now.Add(-3 * time.Hour), completed: now.Add(-2 * time.Hour)},
+		{name: "job-e2e-c", state: "pending", started: now.Add(-time.Minute)},
+	} {
+		j := testFreshnessJob(job.name, "1", job.state, job.completed)
+		j.Status.StartTime.Time = job.started
+		jobs = append(jobs, j)
+	}
+	lister, err := prow.NewListerForJobs(jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	o := &options{
+		MaxAge:       24 * time.Hour,
+		generator:    &outputCommand{prefix: prefix, output: output},
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{},
+		jobAccessor:  lister,
+	}
+
+	check := func(t *testing.T, w *httptest.ResponseRecorder) {
+		t.Helper()
+		if w.Code != 200 {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+			t.Fatalf("unexpected content type %q", ct)
+		}
+		img, err := png.Decode(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() != 640 || b.Dy() != 270 {
+			t.Errorf("unexpected size %v", b)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	o.handleChartPNG(w, httptest.NewRequest("GET", "/chart.png?search=etcdserver&type=build-log", nil))
+	check(t, w)
+
+	// the HTML chart serves the image to clients that ask for it
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/chart?search=etcdserver&type=build-log", nil)
+	req.Header.Set("Accept", "image/png")
+	o.handleChart(w, req)
+	check(t, w)
+
+	// jobs without a duration are drawn on the axis
+	j := testFreshnessJob("job-e2e-d", "1", "success", now.Add(-time.Hour))
+	j.Status.StartTime.Time = j.Status.CompletionTime.Time
+	if o.jobAccessor, err = prow.NewListerForJobs([]*prow.Job{j}); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	o.handleChartPNG(w, httptest.NewRequest("GET", "/chart.png?search=etcdserver&type=build-log", nil))
+	check(t, w)
+}
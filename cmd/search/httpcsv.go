@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openshift/ci-search/pkg/httpwriter"
+)
+
+// handleSearchCSV writes the results of a search as CSV, one row per match, for
+// export to a spreadsheet.
+func (o *options) handleSearchCSV(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var index *Index
+	var success bool
+	defer func() {
+		requestLog(req.Context()).Infof("Render search csv %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	var err error
+	index, err = parseRequest(req, "text", o.MaxAge, o.jobAliases)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+	o.applyInstallScope(req, index)
+	o.applyTypeDefaults(req, index)
+
+	if len(index.Search) == 0 {
+		http.Error(w, "The 'search' query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	release, ok := o.acquireSearch(w)
+	if !ok {
+		return
+	}
+	defer release()
+
+	result, _, err := o.searchResult(req.Context(), index)
+	truncated := errors.Is(err, ErrMaxBytes)
+	setSearchHeaders(w, index, truncated)
+	if err != nil && !truncated {
+		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	type row struct {
+		uri    string
+		search string
+		match  *Match
+	}
+	var rows []row
+	for uri, searches := range result {
+		for search, matches := range searches {
+			for _, match := range matches {
+				rows = append(rows, row{uri: uri, search: search, match: match})
+			}
+		}
+	}
+	recordSearch(req, index, len(rows))
+	// newest first, in a stable order
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if !a.match.LastModified.Equal(&b.match.LastModified) {
+			return a.match.LastModified.After(b.match.LastModified.Time)
+		}
+		if a.uri != b.uri {
+			return a.uri < b.uri
+		}
+		return a.search < b.search
+	})
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="search.csv"`)
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+
+	cw := csv.NewWriter(writer)
+	cw.Write([]string{"name", "trigger", "number", "type", "uri", "lastModified", "line"})
+	for _, r := range rows {
+		var lastModified string
+		if !r.match.LastModified.IsZero() {
+			lastModified = r.match.LastModified.UTC().Format(time.RFC3339)
+		}
+		cw.Write([]string{
+			csvText(r.match.Name),
+			csvText(r.match.trigger),
+			strconv.Itoa(r.match.number),
+			csvText(r.match.FileType),
+			csvText(r.uri),
+			lastModified,
+			csvText(matchedLine(index.Pattern(r.search), index.Context, r.match.Context)),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
+		return
+	}
+
+	success = true
+}
+
+// csvText returns value as a cell that spreadsheets display as text. A cell starting
+// with a character that begins a formula is prefixed with a quote, so that a matched
+// log line cannot run a formula when the export is opened.
+func csvText(value string) string {
+	if len(value) > 0 && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_handleSearchCSV(t *testing.T) {
+	prefix := "/var/lib/ci-search/"
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(
+		prefix+"jobs/pr-logs/pull/org_repo/1/job-a/10/build-log.txt\x00error: etcdserver: request timed out\n"+
+			prefix+"jobs/pr-logs/pull/org_repo/1/job-b/11/build-log.txt\x00=HYPERLINK(\"https://example.com\") etcdserver\n",
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	o := &options{
+		MaxAge:       24 * time.Hour,
+		generator:    &outputCommand{prefix: prefix, output: output},
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{},
+		jobAccessor:  prow.Empty,
+	}
+
+	w := httptest.NewRecorder()
+	o.handleSearchCSV(w, httptest.NewRequest("GET", "/search.csv?search=etcdserver&type=build-log&context=1", nil))
+	if w.Code != 200 {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="search.csv"` {
+		t.Errorf("unexpected disposition %q", got)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "trigger", "number", "type", "uri", "lastModified", "line"},
+		{"job-a", "pull", "10", "build-log", "https://prow.example.com/view/gs/bucket/pr-logs/pull/org_repo/1/job-a/10", "", "error: etcdserver: request timed out"},
+		// a line that a spreadsheet would run as a formula is quoted
+		{"job-b", "pull", "11", "build-log", "https://prow.example.com/view/gs/bucket/pr-logs/pull/org_repo/1/job-b/11", "", `'=HYPERLINK("https://example.com") etcdserver`},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("unexpected records:\n%q\nwant\n%q", records, want)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/ci-search/pkg/httpwriter"
+	"github.com/openshift/ci-search/pkg/tokenfilter"
+	"github.com/openshift/ci-search/prow"
+)
+
+var (
+	metricExistsDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "search_exists_duration_seconds",
+		Help:    "The time taken to check whether a search matches, by whether any job files had to be searched.",
+		Buckets: []float64{0.001, 0.01, 0.1, 1, 10, 100},
+	}, []string{"method"})
+	metricExistsFilteredPaths = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "search_exists_filtered_paths",
+		Help: "The number of files skipped by existence checks because the token filter of the build excluded them.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		metricExistsDuration,
+		metricExistsFilteredPaths,
+	)
+}
+
+const (
+	// tokenFilterCacheTTL is how long a token filter read from disk is reused.
+	tokenFilterCacheTTL = 10 * time.Minute
+	// tokenFilterCacheBytes is the most memory the cached token filters may hold. A
+	// filter for a large build may be several megabytes.
+	tokenFilterCacheBytes = 256 * 1024 * 1024
+	// tokenFilterEntryBytes is the memory charged for each cached build in addition to
+	// its filter, so that builds without a filter are also bounded.
+	tokenFilterEntryBytes = 256
+)
+
+// errMatchFound stops a search at the first match.
+var errMatchFound = fmt.Errorf("match found")
+
+type SearchExistsResponse struct {
+	// Results is a map of search string to whether any file matched
+	Results map[string]bool `json:"results"`
+}
+
+// tokenFilterCache holds the most recently used token filters of build directories up
+// to a total size in bytes, instead of a number of builds, because the size of a filter
+// grows with the number of distinct words in the build.
+type tokenFilterCache struct {
+	lock     sync.Mutex
+	maxBytes int
+	bytes    int
+	// entries is ordered from most to least recently used
+	entries *list.List
+	dirs    map[string]*list.Element
+}
+
+type tokenFilterEntry struct {
+	dir     string
+	filter  *tokenfilter.Filter
+	size    int
+	expires time.Time
+}
+
+func newTokenFilterCache(maxBytes int) *tokenFilterCache {
+	return &tokenFilterCache{
+		maxBytes: maxBytes,
+		entries:  list.New(),
+		dirs:     make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached filter of dir, which is nil if the build has no filter, and
+// whether dir was in the cache.
+func (c *tokenFilterCache) Get(dir string, now time.Time) (*tokenfilter.Filter, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.dirs[dir]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*tokenFilterEntry)
+	if now.After(entry.expires) {
+		c.remove(e)
+		return nil, false
+	}
+	c.entries.MoveToFront(e)
+	return entry.filter, true
+}
+
+// Add caches filter as the filter of dir until ttl has passed, removing the least
+// recently used filters until the cache fits within its size. A filter larger than the
+// whole cache is not cached.
+func (c *tokenFilterCache) Add(dir string, filter *tokenfilter.Filter, now time.Time, ttl time.Duration) {
+	size := tokenFilterEntryBytes + len(dir)
+	if filter != nil {
+		size += filter.Size()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.dirs[dir]; ok {
+		c.remove(e)
+	}
+	if size > c.maxBytes {
+		return
+	}
+	for c.bytes+size > c.maxBytes {
+		c.remove(c.entries.Back())
+	}
+	c.dirs[dir] = c.entries.PushFront(&tokenFilterEntry{dir: dir, filter: filter, size: size, expires: now.Add(ttl)})
+	c.bytes += size
+}
+
+// Bytes returns the size of the cached filters.
+func (c *tokenFilterCache) Bytes() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.bytes
+}
+
+func (c *tokenFilterCache) remove(e *list.Element) {
+	entry := c.entries.Remove(e).(*tokenFilterEntry)
+	delete(c.dirs, entry.dir)
+	c.bytes -= entry.size
+}
+
+// tokenFilterFor returns the token filter for the build directory dir, or nil if the
+// build has no filter.
+func (o *options) tokenFilterFor(dir string) *tokenfilter.Filter {
+	if filter, ok := o.tokenFilters.Get(dir, time.Now()); ok {
+		return filter
+	}
+	filter, err := tokenfilter.ReadFile(filepath.Join(dir, prow.TokenFilterFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.V(4).Infof("Unable to read token filter for %s: %v", dir, err)
+		}
+		filter = nil
+	}
+	o.tokenFilters.Add(dir, filter, time.Now(), tokenFilterCacheTTL)
+	return filter
+}
+
+// handleSearchExists reports whether each search string matches any file, stopping at
+// the first match. Literal searches skip any build whose token filter shows the search
+// cannot match, and if no builds remain the search is answered without running ripgrep.
+func (o *options) handleSearchExists(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var index *Index
+	var success bool
+	defer func() {
+		requestLog(req.Context()).Infof("Render search exists %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	var err error
+	index, err = parseRequest(req, "text", o.MaxAge, o.jobAliases)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+	o.applyInstallScope(req, index)
+
+	if len(index.Search) == 0 {
+		http.Error(w, "The 'search' query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	release, ok := o.acquireSearch(w)
+	if !ok {
+		return
+	}
+	defer release()
+
+	index.MaxMatches = 1
+	index.Context = 0
+	if err := o.findExplained(req.Context(), index); err != nil {
+		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	result := SearchExistsResponse{
+		Results: make(map[string]bool, len(index.Search)),
+	}
+	for _, search := range index.Search {
+		searchStart := time.Now()
+		copied := *index
+		copied.Search = []string{search}
+
+		var filtered, remaining int
+		if tokens, ok := tokenfilter.RequiredTokens(index.Pattern(search)); ok && len(tokens) > 0 && o.tokenFilters != nil {
+			copied.pathFilter = func(path string) bool {
+				filter := o.tokenFilterFor(filepath.Dir(path))
+				if filter == nil || filter.MayContainAll(tokens) {
+					remaining++
+					return true
+				}
+				filtered++
+				return false
+			}
+		}
+
+		var found bool
+		err := executeGrep(req.Context(), o.generator, &copied, nil, func(name string, search string, matches []bytes.Buffer, _ int, moreLines int) error {
+			metadata, err := o.MetadataFor(name)
+			if err != nil {
+				requestLog(req.Context()).Errorf("unable to resolve metadata for: %s: %v", name, err)
+				return nil
+			}
+			if metadata.FileType != "bug" && metadata.FileType != "issue" && index.JobFilter != nil && !index.JobFilter(metadata.Name) {
+				return nil
+			}
+			if index.IsExplained(metadata.FileType, search) {
+				return nil
+			}
+			if !index.InDurationRange(metadata) {
+				return nil
+			}
+			found = true
+			return errMatchFound
+		})
+		if err != nil && err != errMatchFound {
+			http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result.Results[search] = found
+
+		metricExistsFilteredPaths.Add(float64(filtered))
+		// no job files were left to search after filtering
+		method := "ripgrep"
+		if filtered > 0 && remaining == 0 {
+			method = "filter"
+		}
+		metricExistsDuration.WithLabelValues(method).Observe(time.Since(searchStart).Seconds())
+		requestLog(req.Context()).V(4).Infof("Existence check for %q found=%t method=%s filtered=%d duration=%s", search, found, method, filtered, time.Since(searchStart).Truncate(time.Millisecond))
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to serialize result: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+
+	if _, err = writer.Write(data); err != nil {
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
+		return
+	}
+
+	success = true
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/openshift/ci-search/pkg/tokenfilter"
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_tokenFilterCache(t *testing.T) {
+	now := time.Now()
+	filter := tokenfilter.New(1000, 0.01)
+	entry := tokenFilterEntryBytes + len("a") + filter.Size()
+	c := newTokenFilterCache(2 * entry)
+
+	c.Add("a", filter, now, time.Minute)
+	c.Add("b", filter, now, time.Minute)
+	// a is now more recently used than b
+	if f, ok := c.Get("a", now); !ok || f != filter {
+		t.Fatalf("expected a to be cached")
+	}
+	c.Add("c", filter, now, time.Minute)
+	if _, ok := c.Get("b", now); ok {
+		t.Errorf("expected the least recently used filter to be evicted")
+	}
+	for _, dir := range []string{"a", "c"} {
+		if _, ok := c.Get(dir, now); !ok {
+			t.Errorf("expected %s to be cached", dir)
+		}
+	}
+	if c.Bytes() > 2*entry {
+		t.Errorf("cache holds %d bytes, more than its limit of %d", c.Bytes(), 2*entry)
+	}
+
+	// builds without a filter are cached and counted
+	c.Add("d", nil, now, time.Minute)
+	if f, ok := c.Get("d", now); !ok || f != nil {
+		t.Errorf("expected a missing filter to be cached")
+	}
+	if _, ok := c.Get("a", now); ok {
+		t.Errorf("expected a to be evicted for d")
+	}
+
+	if _, ok := c.Get("d", now.Add(2*time.Minute)); ok {
+		t.Errorf("expected d to expire")
+	}
+
+	c.Add("large", tokenfilter.New(100000, 0.01), now, time.Minute)
+	if _, ok := c.Get("large", now); ok {
+		t.Errorf("expected a filter larger than the cache to not be cached")
+	}
+	if _, ok := c.Get("c", now); !ok {
+		t.Errorf("expected c to remain cached")
+	}
+}
+
+// filteredSourceArguments passes the paths accepted by the path filter of the index,
+// like the path index does.
+type filteredSourceArguments []string
+
+func (a filteredSourceArguments) RipgrepSourceArguments(index *Index, _ sets.String) ([]string, []string, error) {
+	var paths []string
+	for _, path := range a {
+		if index.pathFilter != nil && !index.pathFilter(path) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return nil, paths, nil
+}
+
+// benchmarkSearchExists measures an existence check for a search that matches none of
+// the builds, either answered from the token filters of the builds or by ripgrep.
+func benchmarkSearchExists(b *testing.B, filtered bool) {
+	rg, err := exec.LookPath("rg")
+	if err != nil {
+		b.Skip("ripgrep is not installed")
+	}
+	dir := b.TempDir()
+	var paths []string
+	for i := 0; i < 200; i++ {
+		var log strings.Builder
+		for j := 0; j < 1000; j++ {
+			fmt.Fprintf(&log, "I0102 12:00:00.%06d controller.go:%d] synced object namespace-%d/pod-%d\n", j, j%500, i, j)
+		}
+		buildDir := filepath.Join(dir, "job", strconv.Itoa(i))
+		if err := os.MkdirAll(buildDir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		path := filepath.Join(buildDir, "build-log.txt")
+		if err := os.WriteFile(path, []byte(log.String()), 0644); err != nil {
+			b.Fatal(err)
+		}
+		filter, err := tokenfilter.Build([]string{path}, 0.01)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := filter.WriteFile(filepath.Join(buildDir, prow.TokenFilterFile)); err != nil {
+			b.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	o := &options{
+		MaxAge:    24 * time.Hour,
+		generator: ripgrepGenerator{execPath: rg, searchPath: dir, arguments: filteredSourceArguments(paths)},
+	}
+	if filtered {
+		o.tokenFilters = newTokenFilterCache(tokenFilterCacheBytes)
+	}
+	target := "/v2/search/exists?" + url.Values{"search": {"etcdserver: request timed out"}, "type": {"build-log"}}.Encode()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		o.handleSearchExists(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusOK {
+			b.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), `:false`) {
+			b.Fatalf("unexpected match: %s", w.Body.String())
+		}
+	}
+}
+
+func BenchmarkSearchExists_ripgrep(b *testing.B) { benchmarkSearchExists(b, false) }
+
+func BenchmarkSearchExists_filter(b *testing.B) { benchmarkSearchExists(b, true) }
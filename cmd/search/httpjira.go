@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// JiraValidateResponse is the result of validating a JQL query against the Jira server.
+type JiraValidateResponse struct {
+	JQL string `json:"jql"`
+	// Total is the number of issues matching the query if it is valid
+	Total int `json:"total"`
+	// Error is the error reported by the server if the query is invalid
+	Error string `json:"error,omitempty"`
+}
+
+// handleJiraValidate runs the jql query parameter against the Jira server and reports the
+// number of matching issues or the error returned by the server, so that a value for
+// --jira-search can be checked without restarting the server. It is only served on the
+// debug listener.
+func (o *options) handleJiraValidate(w http.ResponseWriter, req *http.Request) {
+	if o.jiraClient == nil {
+		http.Error(w, "Jira indexing is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	jql := strings.TrimSpace(req.FormValue("jql"))
+	if len(jql) == 0 {
+		http.Error(w, "The 'jql' query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	result := JiraValidateResponse{JQL: jql}
+	total, err := o.jiraClient.CountIssues(req.Context(), jql)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Total = total
+	}
+	requestLog(req.Context()).V(2).Infof("Validated jql %q total=%d error=%q", jql, result.Total, result.Error)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "Unable to serialize result", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	jiraClient "sigs.k8s.io/prow/prow/jira"
+
+	"github.com/openshift/ci-search/jira"
+)
+
+func Test_handleJiraValidate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/rest/api/2/search" {
+			http.NotFound(w, req)
+			return
+		}
+		if req.URL.Query().Get("jql") != "project = OCPBUGS" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errorMessages":["The value 'OTHER' does not exist for the field 'project'."]}`)
+			return
+		}
+		fmt.Fprint(w, `{"startAt":0,"maxResults":1,"total":42,"issues":[{"id":"1"}]}`)
+	}))
+	defer server.Close()
+
+	jc, err := jiraClient.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &options{jiraClient: &jira.Client{Client: jc}}
+
+	for _, tt := range []struct {
+		name      string
+		jql       string
+		wantCode  int
+		wantTotal int
+		wantError bool
+	}{
+		{name: "valid", jql: "project = OCPBUGS", wantCode: http.StatusOK, wantTotal: 42},
+		{name: "invalid", jql: "project = OTHER", wantCode: http.StatusOK, wantError: true},
+		{name: "missing", wantCode: http.StatusBadRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/debug/jira/validate?jql="+url.QueryEscape(tt.jql), nil)
+			w := httptest.NewRecorder()
+			o.handleJiraValidate(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("unexpected code %d: %s", w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var result JiraValidateResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Total != tt.wantTotal || (len(result.Error) > 0) != tt.wantError {
+				t.Errorf("unexpected result: %#v", result)
+			}
+		})
+	}
+}
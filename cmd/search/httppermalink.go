@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// handlePermalink responds with the path of the search page for the search described by
+// the request, with every setting of the search given explicitly in a stable order. The
+// preferences of the browser and the configured defaults do not apply to an explicit
+// setting, so the link reproduces the same results for anyone who follows it.
+func (o *options) handlePermalink(w http.ResponseWriter, req *http.Request) {
+	if err := applyPreferences(req); err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+	index, err := parseRequest(req, "text", o.MaxAge, o.jobAliases)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+	o.applyInstallScope(req, index)
+	o.applyTypeDefaults(req, index)
+
+	query := index.Query()
+	// the mode is chosen by the page, not the query
+	query.Del("mode")
+	permalink := url.URL{Path: "/", RawQuery: query.Encode()}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := fmt.Fprint(w, permalink.String()); err != nil {
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func Test_handlePermalink(t *testing.T) {
+	o := &options{MaxAge: 14 * 24 * time.Hour}
+
+	req := httptest.NewRequest("GET", "/permalink?search=timeout&wrap=on&groupBy=none&type=junit", nil)
+	req.AddCookie(&http.Cookie{Name: preferencesCookie, Value: "e30"})
+	w := httptest.NewRecorder()
+	o.handlePermalink(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected code %d: %s", w.Code, w.Body.String())
+	}
+	permalink, err := url.Parse(w.Body.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if permalink.Path != "/" {
+		t.Fatalf("unexpected permalink %s", permalink)
+	}
+	query := permalink.Query()
+	for key, value := range map[string]string{"search": "timeout", "wrap": "1", "groupBy": "none", "type": "junit", "context": "1", "maxAge": "48h0m0s"} {
+		if query.Get(key) != value {
+			t.Errorf("expected %s=%s in permalink %s", key, value, permalink)
+		}
+	}
+	if query.Has("mode") {
+		t.Errorf("permalink should not include the mode: %s", permalink)
+	}
+
+	w = httptest.NewRecorder()
+	o.handlePermalink(w, httptest.NewRequest("GET", "/permalink?search=timeout&type=unknown", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected code %d: %s", w.Code, w.Body.String())
+	}
+}
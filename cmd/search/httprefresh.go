@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RefreshResponse is the result of refreshing the comments of a single bug or issue.
+type RefreshResponse struct {
+	Bug   int    `json:"bug,omitempty"`
+	Issue string `json:"issue,omitempty"`
+	// Comments is the number of comments after the refresh
+	Comments int `json:"comments"`
+}
+
+// handleRefresh fetches the comments of the bug or issue named by the bug or issue query
+// parameter immediately, rather than waiting for the comment store to refresh it, and
+// reports the number of comments. An issue may be given by key or by numeric id. It is
+// only served on the debug listener.
+func (o *options) handleRefresh(w http.ResponseWriter, req *http.Request) {
+	var result RefreshResponse
+	bug, issue := strings.TrimSpace(req.FormValue("bug")), strings.TrimSpace(req.FormValue("issue"))
+	switch {
+	case len(bug) > 0 && len(issue) == 0:
+		id, err := strconv.Atoi(bug)
+		if err != nil || id <= 0 {
+			http.Error(w, "The 'bug' query parameter must be a bug number", http.StatusBadRequest)
+			return
+		}
+		if _, ok := o.bugs.Get(id); !ok {
+			http.Error(w, fmt.Sprintf("Bug %d is not indexed", id), http.StatusNotFound)
+			return
+		}
+		comments, err := o.bugs.Refresh(req.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Unable to refresh bug %d: %v", id, err), http.StatusBadGateway)
+			return
+		}
+		result.Bug, result.Comments = id, len(comments.Comments)
+
+	case len(issue) > 0 && len(bug) == 0:
+		id, err := strconv.Atoi(issue)
+		if err != nil {
+			existing, ok := o.issues.GetByKey(issue)
+			if !ok {
+				http.Error(w, fmt.Sprintf("Issue %s is not indexed", issue), http.StatusNotFound)
+				return
+			}
+			if id, err = strconv.Atoi(existing.Name); err != nil {
+				http.Error(w, fmt.Sprintf("Issue %s has an invalid id", issue), http.StatusInternalServerError)
+				return
+			}
+		} else if _, ok := o.issues.Get(id); !ok {
+			http.Error(w, fmt.Sprintf("Issue %d is not indexed", id), http.StatusNotFound)
+			return
+		}
+		comments, err := o.issues.Refresh(req.Context(), id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Unable to refresh issue %s: %v", issue, err), http.StatusBadGateway)
+			return
+		}
+		result.Issue, result.Comments = comments.Info.Key, len(comments.Comments)
+
+	default:
+		http.Error(w, "Exactly one of the 'bug' or 'issue' query parameters is required", http.StatusBadRequest)
+		return
+	}
+	requestLog(req.Context()).V(2).Infof("Refreshed comments bug=%d issue=%s comments=%d", result.Bug, result.Issue, result.Comments)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "Unable to serialize result", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
+	}
+}
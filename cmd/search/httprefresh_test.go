@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openshift/ci-search/bugzilla"
+	"github.com/openshift/ci-search/jira"
+)
+
+func Test_handleRefresh_invalid(t *testing.T) {
+	o := &options{
+		bugs:   bugzilla.NewCommentStore(nil, 0, false, nil),
+		issues: jira.NewCommentStore(nil, 0, nil),
+	}
+	for _, tt := range []struct {
+		name     string
+		query    string
+		wantCode int
+	}{
+		{name: "missing", query: "", wantCode: http.StatusBadRequest},
+		{name: "both", query: "bug=1&issue=OCPBUGS-1", wantCode: http.StatusBadRequest},
+		{name: "invalid bug", query: "bug=abc", wantCode: http.StatusBadRequest},
+		{name: "unknown bug", query: "bug=12345", wantCode: http.StatusNotFound},
+		{name: "unknown issue key", query: "issue=OCPBUGS-1", wantCode: http.StatusNotFound},
+		{name: "unknown issue id", query: "issue=12345", wantCode: http.StatusNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/debug/refresh?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			o.handleRefresh(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("unexpected code %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -4,16 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
-	"k8s.io/klog/v2"
 
 	"github.com/openshift/ci-search/pkg/httpwriter"
+	"github.com/openshift/ci-search/prow"
 )
 
 func (o *options) handleSearch(w http.ResponseWriter, req *http.Request) {
@@ -21,23 +26,34 @@ func (o *options) handleSearch(w http.ResponseWriter, req *http.Request) {
 	var index *Index
 	var success bool
 	defer func() {
-		klog.Infof("Render search %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+		requestLog(req.Context()).Infof("Render search %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
 	}()
 
 	var err error
-	index, err = parseRequest(req, "text", o.MaxAge)
+	index, err = parseRequest(req, "text", o.MaxAge, o.jobAliases)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
 	}
+	o.applyInstallScope(req, index)
+	o.applyTypeDefaults(req, index)
 
 	if len(index.Search) == 0 {
 		http.Error(w, "The 'search' query parameter is required", http.StatusBadRequest)
 		return
 	}
 
-	result, err := o.searchResult(req.Context(), index)
-	if err != nil {
+	release, ok := o.acquireSearch(w)
+	if !ok {
+		return
+	}
+	defer release()
+
+	result, _, err := o.searchResult(req.Context(), index)
+	truncated := errors.Is(err, ErrMaxBytes)
+	setSearchHeaders(w, index, truncated)
+	recordSearch(req, index, len(result))
+	if err != nil && !truncated {
 		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -53,7 +69,7 @@ func (o *options) handleSearch(w http.ResponseWriter, req *http.Request) {
 	defer writer.Close()
 
 	if _, err = writer.Write(data); err != nil {
-		klog.Errorf("Failed to write response: %v", err)
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
 		return
 	}
 
@@ -65,43 +81,65 @@ func (o *options) handleSearchV2(w http.ResponseWriter, req *http.Request) {
 	var index *Index
 	var success bool
 	defer func() {
-		klog.Infof("Render search %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+		requestLog(req.Context()).Infof("Render search %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
 	}()
 
 	var err error
-	index, err = parseRequest(req, "text", o.MaxAge)
+	index, err = parseRequest(req, "text", o.MaxAge, o.jobAliases)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
 	}
+	o.applyInstallScope(req, index)
+	o.applyTypeDefaults(req, index)
 
 	if len(index.Search) == 0 {
 		http.Error(w, "The 'search' query parameter is required", http.StatusBadRequest)
 		return
 	}
 
-	internalResults, err := o.searchResult(req.Context(), index)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+	release, ok := o.acquireSearch(w)
+	if !ok {
+		return
+	}
+	defer release()
+
+	switch format := req.FormValue("format"); format {
+	case "", "json":
+	case "jsonl":
+		success = o.streamSearchV2(w, req, index)
+		return
+	default:
+		http.Error(w, fmt.Sprintf("Bad input: unrecognized format %q", format), http.StatusBadRequest)
 		return
 	}
 
-	result := SearchResponse{
-		Results: make(map[string]SearchResponseResult),
+	var offset, limit int
+	if value := req.FormValue("offset"); len(value) > 0 {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			http.Error(w, "Bad input: offset must be a non-negative number", http.StatusBadRequest)
+			return
+		}
 	}
-	for url, searchResults := range internalResults {
-		for query, matches := range searchResults {
-			for _, match := range matches {
-				match.URL = url
-				if response, found := result.Results[query]; !found {
-					result.Results[query] = SearchResponseResult{Matches: []*Match{match}}
-				} else {
-					response.Matches = append(response.Matches, match)
-					result.Results[query] = response
-				}
-			}
+	if value := req.FormValue("limit"); len(value) > 0 {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			http.Error(w, "Bad input: limit must be a non-negative number", http.StatusBadRequest)
+			return
 		}
 	}
+
+	internalResults, topLines, err := o.searchResult(req.Context(), index)
+	truncated := errors.Is(err, ErrMaxBytes)
+	setSearchHeaders(w, index, truncated)
+	recordSearch(req, index, len(internalResults))
+	if err != nil && !truncated {
+		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	result := newSearchResponse(internalResults, topLines, offset, limit)
+	result.BytesScanned = index.BytesScanned()
+	result.Truncated = truncated
 	data, err := json.Marshal(result)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Unable to serialize result: %v", err), http.StatusInternalServerError)
@@ -113,62 +151,368 @@ func (o *options) handleSearchV2(w http.ResponseWriter, req *http.Request) {
 	defer writer.Close()
 
 	if _, err = writer.Write(data); err != nil {
-		klog.Errorf("Failed to write response: %v", err)
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
 		return
 	}
 
 	success = true
 }
 
-// searchResult returns a result[uri][search][]*Match.
-func (o *options) searchResult(ctx context.Context, index *Index) (map[string]map[string][]*Match, error) {
-	result := map[string]map[string][]*Match{}
+// setSearchHeaders reports the number of bytes ripgrep searched for the searches of
+// index in the X-Search-Bytes-Scanned header of the response, and sets
+// X-Search-Truncated if the searches stopped at maxBytes.
+func setSearchHeaders(w http.ResponseWriter, index *Index, truncated bool) {
+	w.Header().Set("X-Search-Bytes-Scanned", strconv.FormatInt(index.BytesScanned(), 10))
+	if truncated {
+		w.Header().Set("X-Search-Truncated", "true")
+	}
+}
 
-	if index.MaxMatches == 0 {
-		index.MaxMatches = 1
+// newSearchResponse returns the page of matches in results starting at offset and
+// containing at most limit matches, or all remaining matches if limit is zero. Matches are
+// ordered newest first, then by URL, file type, search string, and matched lines, so that
+// repeated searches return and page matches in the same order.
+func newSearchResponse(results map[string]map[string][]*Match, topLines []TopLine, offset, limit int) SearchResponse {
+	type entry struct {
+		url    string
+		search string
+		match  *Match
+	}
+	var entries []entry
+	for url, searchResults := range results {
+		for search, matches := range searchResults {
+			for _, match := range matches {
+				entries = append(entries, entry{url: url, search: search, match: match})
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.match.LastModified.Equal(&b.match.LastModified) {
+			return a.match.LastModified.After(b.match.LastModified.Time)
+		}
+		if a.url != b.url {
+			return a.url < b.url
+		}
+		if a.match.FileType != b.match.FileType {
+			return a.match.FileType < b.match.FileType
+		}
+		if a.search != b.search {
+			return a.search < b.search
+		}
+		// files of the same type in a run are reported in the order ripgrep finds them
+		return slices.Compare(a.match.Context, b.match.Context) < 0
+	})
+
+	response := SearchResponse{
+		Results:  make(map[string]SearchResponseResult),
+		TopLines: topLines,
+		Total:    len(entries),
+	}
+	if offset > len(entries) {
+		offset = len(entries)
+	}
+	entries = entries[offset:]
+	if limit > 0 && limit < len(entries) {
+		entries = entries[:limit]
+		response.NextOffset = offset + limit
+	}
+	for _, e := range entries {
+		e.match.URL = e.url
+		r := response.Results[e.search]
+		r.Matches = append(r.Matches, e.match)
+		response.Results[e.search] = r
+	}
+	return response
+}
+
+type SearchSummaryResponse struct {
+	// Results is a map of search string to the number of matching files of each type
+	Results map[string]map[string]int `json:"results"`
+}
+
+// handleSearchSummary returns the number of files of each type that match each search
+// string, without returning the matches themselves.
+func (o *options) handleSearchSummary(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var index *Index
+	var success bool
+	defer func() {
+		requestLog(req.Context()).Infof("Render search summary %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	var err error
+	index, err = parseRequest(req, "text", o.MaxAge, o.jobAliases)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+	o.applyInstallScope(req, index)
+	o.applyTypeDefaults(req, index)
+
+	if len(index.Search) == 0 {
+		http.Error(w, "The 'search' query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	release, ok := o.acquireSearch(w)
+	if !ok {
+		return
+	}
+	defer release()
+
+	index.CountOnly = true
+	index.MaxMatches = 1
+	index.Context = 0
+	if err := o.findExplained(req.Context(), index); err != nil {
+		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+		return
 	}
 
-	err := executeGrep(ctx, o.generator, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
+	result := SearchSummaryResponse{
+		Results: make(map[string]map[string]int, len(index.Search)),
+	}
+	for _, search := range index.Search {
+		result.Results[search] = make(map[string]int)
+	}
+	err = executeGrep(req.Context(), o.generator, index, nil, func(name string, search string, matches []bytes.Buffer, _ int, moreLines int) error {
 		metadata, err := o.MetadataFor(name)
 		if err != nil {
-			klog.Errorf("unable to resolve metadata for: %s: %v", name, err)
+			requestLog(req.Context()).Errorf("unable to resolve metadata for: %s: %v", name, err)
 			return nil
 		}
-		if metadata.URI == nil {
-			klog.Errorf("Failed to compute job URI for %q", name)
+		if metadata.FileType != "bug" && metadata.FileType != "issue" && index.JobFilter != nil && !index.JobFilter(metadata.Name) {
 			return nil
 		}
-		if metadata.FileType != "bug" && metadata.FileType != "issue" && index.JobFilter != nil && !index.JobFilter(metadata.Name) {
+		if index.IsExplained(metadata.FileType, search) {
 			return nil
 		}
-		uri := metadata.URI.String()
-		_, ok := result[uri]
-		if !ok {
-			result[uri] = make(map[string][]*Match, 1)
+		if !index.InDurationRange(metadata) {
+			return nil
 		}
+		result.Results[search][metadata.FileType]++
+		return nil
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+		return
+	}
 
-		_, ok = result[uri][search]
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to serialize result: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+
+	if _, err = writer.Write(data); err != nil {
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
+		return
+	}
+
+	success = true
+}
+
+// findExplained records which of the index's search strings match an indexed bug or
+// issue, so that job results for those strings can be excluded.
+func (o *options) findExplained(ctx context.Context, index *Index) error {
+	if !index.OnlyUnexplained || index.explained != nil {
+		return nil
+	}
+	index.explained = sets.NewString()
+	if o.bugURIPrefix == nil && o.issueURIPrefix == nil {
+		return nil
+	}
+	copied := *index
+	copied.SearchType = "bug+issue"
+	copied.MaxMatches = 1
+	copied.Context = 0
+	copied.require = ""
+	// each search is explained independently of the others
+	copied.AllOf = false
+	return executeGrep(ctx, o.generator, &copied, nil, func(name string, search string, matches []bytes.Buffer, _ int, moreLines int) error {
+		index.explained.Insert(search)
+		return nil
+	})
+}
+
+// SearchStreamResult is a single line of a format=jsonl search response, either a match
+// or, as the last line, an error that stopped the search.
+type SearchStreamResult struct {
+	// Search is the search string that matched
+	Search string `json:"search,omitempty"`
+	*Match
+	// Error is set on the last line of the response if the search failed after results
+	// were written
+	Error string `json:"error,omitempty"`
+}
+
+// streamSearchV2 writes each match as a line of JSON as soon as it is found, instead of
+// buffering the whole response. Since the status has already been sent, an error during
+// the search is reported as a final line with the error field set. It returns true if
+// the search completed.
+func (o *options) streamSearchV2(w http.ResponseWriter, req *http.Request, index *Index) bool {
+	if index.MaxMatches == 0 {
+		index.MaxMatches = 1
+	}
+	if err := o.findExplained(req.Context(), index); err != nil {
+		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/jsonl")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		flusher = nopFlusher{}
+	}
+	flush := func() {
+		if f, ok := writer.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(writer)
+	var count int
+	var flakes flakeDetector
+	err := executeGrep(req.Context(), o.generator, index, nil, func(name string, search string, matches []bytes.Buffer, lineNumber int, moreLines int) error {
+		uri, match, ok := o.matchFor(req.Context(), index, &flakes, name, search, matches, lineNumber, moreLines)
 		if !ok {
-			result[uri][search] = make([]*Match, 0, 1)
+			return nil
+		}
+		match.URL = uri
+		if err := enc.Encode(SearchStreamResult{Search: search, Match: match}); err != nil {
+			return err
+		}
+		count++
+		flush()
+		return nil
+	})
+	recordSearch(req, index, count)
+	if err != nil {
+		requestLog(req.Context()).Errorf("Search %q failed while streaming: %v", index.Search[0], err)
+		if err := enc.Encode(SearchStreamResult{Error: err.Error()}); err != nil {
+			requestLog(req.Context()).Errorf("Failed to write response: %v", err)
 		}
+		return false
+	}
+	return true
+}
+
+// matchFor returns the URI and match for a file that matched search, or false if the
+// match is excluded by the filters in index.
+func (o *options) matchFor(ctx context.Context, index *Index, flakes *flakeDetector, name string, search string, matches []bytes.Buffer, lineNumber int, moreLines int) (string, *Match, bool) {
+	metadata, err := o.MetadataFor(name)
+	if err != nil {
+		requestLog(ctx).Errorf("unable to resolve metadata for: %s: %v", name, err)
+		return "", nil, false
+	}
+	if metadata.URI == nil {
+		requestLog(ctx).Errorf("Failed to compute job URI for %q", name)
+		return "", nil, false
+	}
+	if metadata.FileType != "bug" && metadata.FileType != "issue" && index.JobFilter != nil && !index.JobFilter(metadata.Name) {
+		return "", nil, false
+	}
+	if index.IsExplained(metadata.FileType, search) {
+		return "", nil, false
+	}
+	if !index.InDurationRange(metadata) {
+		return "", nil, false
+	}
+
+	match := &Match{
+		FileType:  metadata.FileType,
+		MoreLines: moreLines,
+		Name:      metadata.Name,
+		Bug:       metadata.Bug,
+		Issue:     metadata.Issue,
 
-		match := &Match{
-			FileType:  metadata.FileType,
-			MoreLines: moreLines,
-			Name:      metadata.Name,
-			Bug:       metadata.Bug,
-			Issue:     metadata.Issue,
+		LastModified: metav1.Time{Time: metadata.LastModified},
+
+		trigger: metadata.Trigger,
+		number:  metadata.Number,
+	}
+	for _, m := range matches {
+		line := bytes.TrimRightFunc(m.Bytes(), func(r rune) bool { return r == ' ' })
+		match.Context = append(match.Context, string(line))
+	}
+	switch metadata.FileType {
+	case "bug", "issue":
+		match.Section = matchSection(filepath.Join(o.Path, filepath.FromSlash(name)), lineNumber, index.Pattern(search), index.Context, match.Context)
+		if match.Section == "comment" && metadata.FileType == "bug" {
+			if author, created, ok := matchBugComment(filepath.Join(o.Path, filepath.FromSlash(name)), lineNumber, index.Pattern(search), index.Context, match.Context); ok {
+				match.CommentAuthor = author
+				match.CommentCreated = &metav1.Time{Time: created}
+			}
+		}
+	case "junit":
+		match.Flake = flakes.isFlake(filepath.Join(o.Path, filepath.FromSlash(name)), lineNumber, index.Pattern(search), index.Context, match.Context)
+		if match.Flake && index.HideFlakes {
+			return "", nil, false
 		}
+	}
+	return metadata.URI.String(), match, true
+}
+
+// searchResult returns a result[uri][search][]*Match and the most frequent matched lines.
+// If the context of index is negative, only links are requested, so each file has a
+// single match without context that counts the hits in the file.
+func (o *options) searchResult(ctx context.Context, index *Index) (map[string]map[string][]*Match, []TopLine, error) {
+	result := map[string]map[string][]*Match{}
+	var tally lineTally
+	// links holds the match of each file and search when only links are requested
+	var links map[string]*Match
+	if index.Context < 0 {
+		links = make(map[string]*Match)
+	}
 
-		for _, m := range matches {
-			line := bytes.TrimRightFunc(m.Bytes(), func(r rune) bool { return r == ' ' })
-			match.Context = append(match.Context, string(line))
+	if index.MaxMatches == 0 {
+		index.MaxMatches = 1
+	}
+	if err := o.findExplained(ctx, index); err != nil {
+		return nil, nil, err
+	}
+
+	var flakes flakeDetector
+	err := executeGrep(ctx, o.generator, index, nil, func(name string, search string, matches []bytes.Buffer, lineNumber int, moreLines int) error {
+		var key string
+		if links != nil {
+			// without context, every line is a hit
+			key = name + "\x00" + search
+			if match, ok := links[key]; ok {
+				if match.FileType == "junit" && index.HideFlakes && flakes.isFlake(filepath.Join(o.Path, filepath.FromSlash(name)), trimmedLineNumber(matches, lineNumber), index.Pattern(search), index.Context, trimMatchStrings(matches, nil)) {
+					return nil
+				}
+				match.Hits += len(matches) + moreLines
+				return nil
+			}
+		}
+		uri, match, ok := o.matchFor(ctx, index, &flakes, name, search, matches, lineNumber, moreLines)
+		if !ok {
+			return nil
+		}
+		if _, ok := result[uri]; !ok {
+			result[uri] = make(map[string][]*Match, 1)
+		}
+		if _, ok := result[uri][search]; !ok {
+			result[uri][search] = make([]*Match, 0, 1)
+		}
+		tally.Add(index.Pattern(search), index.Context, match.Context)
+		if links != nil {
+			match.Context, match.MoreLines, match.Hits = nil, 0, len(matches)+moreLines
+			links[key] = match
 		}
 		result[uri][search] = append(result[uri][search], match)
 		return nil
 	})
 
-	return result, err
+	return result, tally.Top(topLinesCount), err
 }
 
 type SearchJobInstanceResult struct {
@@ -184,21 +528,34 @@ type SearchJobsResult struct {
 }
 
 type SearchBugResult struct {
-	Name    string
-	Number  int
-	URI     *url.URL
-	Matches []Match
+	Name       string
+	Number     int
+	URI        *url.URL
+	Components []string
+	Matches    []Match
 }
 
 // jira
 type SearchIssuesResult struct {
-	Name    string
-	Number  int
-	Key     string
-	URI     *url.URL
-	Matches []Match
+	Name       string
+	Number     int
+	Key        string
+	URI        *url.URL
+	Components []string
+	Matches    []Match
+}
+
+// SearchComponentResult is the set of matching bugs and issues filed against a
+// single component.
+type SearchComponentResult struct {
+	Name   string
+	Bugs   []SearchBugResult
+	Issues []SearchIssuesResult
 }
 
+// noComponentName groups bugs and issues that have no component.
+const noComponentName = "(no component)"
+
 type SearchResult struct {
 	Matches int
 
@@ -212,6 +569,15 @@ type SearchResult struct {
 	Jobs      []SearchJobsResult
 	JobNames  sets.String
 	jobByName map[string]int
+
+	// TopLines are the most frequent matched lines across all results
+	TopLines []TopLine
+
+	// OutputBytes is the number of bytes of matching lines and context read from ripgrep
+	OutputBytes int64
+	// Truncated is true if the search stopped early because it read the maximum number
+	// of bytes, so that the result is incomplete
+	Truncated bool
 }
 
 func (s *SearchResult) BugByNumber(num int) *SearchBugResult {
@@ -257,6 +623,140 @@ func (s *SearchResult) JobByName(name string) *SearchJobsResult {
 	return &s.Jobs[i]
 }
 
+// ByComponent groups the matching bugs and issues by their components, ordered by the
+// number of matching bugs and issues in each component. Bugs and issues with multiple
+// components are included in each component.
+func (s *SearchResult) ByComponent() []SearchComponentResult {
+	var components []SearchComponentResult
+	byName := make(map[string]int)
+	get := func(name string) *SearchComponentResult {
+		if len(name) == 0 {
+			name = noComponentName
+		}
+		i, ok := byName[name]
+		if !ok {
+			i = len(components)
+			components = append(components, SearchComponentResult{Name: name})
+			byName[name] = i
+		}
+		return &components[i]
+	}
+	for _, bug := range s.Bugs {
+		if len(bug.Components) == 0 {
+			get("").Bugs = append(get("").Bugs, bug)
+		}
+		for _, name := range bug.Components {
+			c := get(name)
+			c.Bugs = append(c.Bugs, bug)
+		}
+	}
+	for _, issue := range s.Issues {
+		if len(issue.Components) == 0 {
+			get("").Issues = append(get("").Issues, issue)
+		}
+		for _, name := range issue.Components {
+			c := get(name)
+			c.Issues = append(c.Issues, issue)
+		}
+	}
+	sort.SliceStable(components, func(i, j int) bool {
+		a, b := len(components[i].Bugs)+len(components[i].Issues), len(components[j].Bugs)+len(components[j].Issues)
+		if a != b {
+			return a > b
+		}
+		return components[i].Name < components[j].Name
+	})
+	return components
+}
+
+// SortJobs orders the matching jobs. For impact, jobs are ordered by the fraction of
+// their runs that failed as reported by stats, for matches by the number of matching
+// runs, for name alphabetically, and for recent by their most recently modified match.
+// Any other order leaves the jobs in the order they were found.
+func (s *SearchResult) SortJobs(order string, stats func(name string) prow.JobStats) {
+	var less func(a, b *SearchJobsResult) bool
+	switch order {
+	case "impact":
+		rates := make(map[string]float64, len(s.Jobs))
+		for _, job := range s.Jobs {
+			if stats := stats(job.Name); stats.Count > 0 {
+				rates[job.Name] = float64(stats.Failures) / float64(stats.Count)
+			}
+		}
+		less = func(a, b *SearchJobsResult) bool {
+			if rates[a.Name] != rates[b.Name] {
+				return rates[a.Name] > rates[b.Name]
+			}
+			return len(a.Instances) > len(b.Instances)
+		}
+	case "matches":
+		less = func(a, b *SearchJobsResult) bool { return len(a.Instances) > len(b.Instances) }
+	case "name":
+		less = func(a, b *SearchJobsResult) bool { return a.Name < b.Name }
+	case "recent":
+		newest := make(map[string]time.Time, len(s.Jobs))
+		for _, job := range s.Jobs {
+			var t time.Time
+			for _, instance := range job.Instances {
+				for _, match := range instance.Matches {
+					if match.LastModified.After(t) {
+						t = match.LastModified.Time
+					}
+				}
+			}
+			newest[job.Name] = t
+		}
+		less = func(a, b *SearchJobsResult) bool { return newest[a.Name].After(newest[b.Name]) }
+	default:
+		return
+	}
+	sort.SliceStable(s.Jobs, func(i, j int) bool { return less(&s.Jobs[i], &s.Jobs[j]) })
+	for i, job := range s.Jobs {
+		s.jobByName[job.Name] = i
+	}
+}
+
+// JobsPage returns up to limit jobs starting at offset in the ordered job list, and
+// the offset of the next page or zero if there are no more jobs.
+func (s *SearchResult) JobsPage(offset, limit int) ([]SearchJobsResult, int) {
+	if offset >= len(s.Jobs) {
+		return nil, 0
+	}
+	end := offset + limit
+	if limit <= 0 || end >= len(s.Jobs) {
+		return s.Jobs[offset:], 0
+	}
+	return s.Jobs[offset:end], end
+}
+
+// groupedResultsCacheTTL is how long an ordered search result is kept for clients
+// requesting subsequent pages.
+const groupedResultsCacheTTL = 5 * time.Minute
+
+// cachedOrderedSearchResults returns the ordered results for index, reusing the results
+// of a recent identical search so that paging through results does not search again.
+// Results are only reused until the path index is next loaded, since a reload may add
+// or remove matching files.
+func (o *options) cachedOrderedSearchResults(ctx context.Context, index *Index) (*SearchResult, error) {
+	if o.groupedResults == nil {
+		return o.orderedSearchResults(ctx, index)
+	}
+	var loaded time.Time
+	if o.jobsIndex != nil {
+		loaded, _ = o.jobsIndex.Freshness()
+	}
+	key := strconv.FormatInt(loaded.UnixNano(), 10) + "\x00" + index.searchKey()
+	if obj, ok := o.groupedResults.Get(key); ok {
+		return obj.(*SearchResult), nil
+	}
+	result, err := o.orderedSearchResults(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	o.groupedResults.Add(key, result, groupedResultsCacheTTL)
+	return result, nil
+}
+
 // searchResult returns an ordered struct containing results by job.
 func (o *options) orderedSearchResults(ctx context.Context, index *Index) (*SearchResult, error) {
 	var result SearchResult
@@ -265,34 +765,51 @@ func (o *options) orderedSearchResults(ctx context.Context, index *Index) (*Sear
 	if index.MaxMatches == 0 {
 		index.MaxMatches = 1
 	}
+	if err := o.findExplained(ctx, index); err != nil {
+		return nil, err
+	}
 
 	count := 0
-	err := executeGrep(ctx, o.generator, index, result.JobNames, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
+	var tally lineTally
+	var flakes flakeDetector
+	err := executeGrep(ctx, o.generator, index, result.JobNames, func(name string, search string, matches []bytes.Buffer, lineNumber int, moreLines int) error {
 		metadata, err := o.MetadataFor(name)
 		if err != nil {
-			klog.Errorf("unable to resolve metadata for: %s: %v", name, err)
+			requestLog(ctx).Errorf("unable to resolve metadata for: %s: %v", name, err)
 			return nil
 		}
 		if metadata.URI == nil {
-			klog.Errorf("Failed to compute job URI for %q", name)
+			requestLog(ctx).Errorf("Failed to compute job URI for %q", name)
 			return nil
 		}
 		if metadata.FileType != "bug" && metadata.FileType != "issue" && index.JobFilter != nil && !index.JobFilter(metadata.Name) {
 			return nil
 		}
+		if index.IsExplained(metadata.FileType, search) {
+			return nil
+		}
+		if !index.InDurationRange(metadata) {
+			return nil
+		}
 		switch metadata.FileType {
 		case "bug":
 			bug := result.BugByNumber(metadata.Number)
 			if len(bug.Name) == 0 {
 				bug.Name = metadata.Name
 				bug.URI = metadata.URI
+				if metadata.Bug != nil {
+					bug.Components = metadata.Bug.Component
+				}
 			}
+			lines := trimMatchStrings(matches, make([]string, 0, len(matches)))
 			bug.Matches = append(bug.Matches, Match{
 				LastModified: metav1.Time{Time: metadata.LastModified},
 				FileType:     metadata.FileType,
+				Section:      matchSection(filepath.Join(o.Path, filepath.FromSlash(name)), trimmedLineNumber(matches, lineNumber), index.Pattern(search), index.Context, lines),
 				MoreLines:    moreLines,
-				Context:      trimMatchStrings(matches, make([]string, 0, len(matches))),
+				Context:      lines,
 			})
+			tally.Add(index.Pattern(search), index.Context, lines)
 			count++
 			return nil
 		case "issue":
@@ -301,16 +818,34 @@ func (o *options) orderedSearchResults(ctx context.Context, index *Index) (*Sear
 				issue.Name = metadata.Name
 				issue.URI = metadata.URI
 				issue.Key = metadata.Key
+				if metadata.Issue != nil && metadata.Issue.Fields != nil {
+					for _, component := range metadata.Issue.Fields.Components {
+						if component != nil && len(component.Name) > 0 {
+							issue.Components = append(issue.Components, component.Name)
+						}
+					}
+				}
 			}
+			lines := trimMatchStrings(matches, make([]string, 0, len(matches)))
 			issue.Matches = append(issue.Matches, Match{
 				LastModified: metav1.Time{Time: metadata.LastModified},
 				FileType:     metadata.FileType,
+				Section:      matchSection(filepath.Join(o.Path, filepath.FromSlash(name)), trimmedLineNumber(matches, lineNumber), index.Pattern(search), index.Context, lines),
 				MoreLines:    moreLines,
-				Context:      trimMatchStrings(matches, make([]string, 0, len(matches))),
+				Context:      lines,
 			})
+			tally.Add(index.Pattern(search), index.Context, lines)
 			count++
 			return nil
 		default:
+			lines := trimMatchStrings(matches, make([]string, 0, len(matches)))
+			var flake bool
+			if metadata.FileType == "junit" {
+				flake = flakes.isFlake(filepath.Join(o.Path, filepath.FromSlash(name)), trimmedLineNumber(matches, lineNumber), index.Pattern(search), index.Context, lines)
+				if flake && index.HideFlakes {
+					return nil
+				}
+			}
 			job := result.JobByName(metadata.Name)
 			if len(job.Trigger) == 0 {
 				job.Trigger = metadata.Trigger
@@ -325,13 +860,25 @@ func (o *options) orderedSearchResults(ctx context.Context, index *Index) (*Sear
 			instance.Matches = append(instance.Matches, Match{
 				LastModified: metav1.Time{Time: metadata.LastModified},
 				FileType:     metadata.FileType,
+				Flake:        flake,
 				MoreLines:    moreLines,
-				Context:      trimMatchStrings(matches, make([]string, 0, len(matches))),
+				Context:      lines,
 			})
+			tally.Add(index.Pattern(search), index.Context, lines)
 			count++
 			return nil
 		}
 	})
 	result.Matches = count
+	result.TopLines = tally.Top(topLinesCount)
+	result.OutputBytes = index.OutputBytes()
+	if errors.Is(err, ErrMaxBytes) {
+		result.Truncated = true
+		err = nil
+	}
+	from, to := index.TimeRange(time.Now())
+	result.SortJobs(index.Sort, func(name string) prow.JobStats {
+		return o.jobAccessor.JobStats(name, nil, from, to.Add(time.Hour))
+	})
 	return &result, err
 }
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+// outputCommand prints a file of ripgrep formatted output for every search.
+type outputCommand struct {
+	prefix string
+	output string
+	err    error
+}
+
+func (c *outputCommand) Command(index *Index, search string, jobNames sets.String) (string, []string, []string, error) {
+	if c.err != nil {
+		return "", nil, nil, c.err
+	}
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return cat, []string{"cat"}, []string{c.output}, nil
+}
+
+func (c *outputCommand) PathPrefix() string { return c.prefix }
+
+func Test_handleSearchV2_jsonl(t *testing.T) {
+	prefix := "/var/lib/ci-search/"
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(
+		prefix+"jobs/logs/job-a/1/build-log.txt\x00error: etcdserver: request timed out\n"+
+			prefix+"jobs/logs/job-b/2/build-log.txt\x00error: etcdserver: request timed out again\n",
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	gen := &outputCommand{prefix: prefix, output: output}
+	o := &options{
+		MaxAge:       24 * time.Hour,
+		generator:    gen,
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{},
+		jobAccessor:  prow.Empty,
+	}
+
+	decode := func(t *testing.T, rawQuery string) []SearchStreamResult {
+		w := httptest.NewRecorder()
+		o.handleSearchV2(w, httptest.NewRequest("GET", "/v2/search?"+rawQuery, nil))
+		if w.Code != 200 {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/jsonl" {
+			t.Fatalf("unexpected content type %q", ct)
+		}
+		var lines []SearchStreamResult
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			var line SearchStreamResult
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	lines := decode(t, "format=jsonl&search=etcdserver&type=build-log")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected lines: %#v", lines)
+	}
+	first := lines[0]
+	if first.Search != "etcdserver" || first.Match == nil || first.URL != "https://prow.example.com/view/gs/bucket/logs/job-a/1" ||
+		first.FileType != "build-log" || first.Name != "job-a" || len(first.Context) != 1 || first.Error != "" {
+		t.Errorf("unexpected first line: %#v %#v", first, first.Match)
+	}
+
+	gen.err = fmt.Errorf("search failed")
+	lines = decode(t, "format=jsonl&search=etcdserver&type=build-log")
+	if len(lines) != 1 || lines[0].Error != "search failed" || lines[0].Match != nil {
+		t.Errorf("expected a trailing error line: %#v", lines)
+	}
+
+	w := httptest.NewRecorder()
+	o.handleSearchV2(w, httptest.NewRequest("GET", "/v2/search?format=xml&search=etcdserver", nil))
+	if w.Code != 400 {
+		t.Errorf("expected unknown format to be rejected: %d", w.Code)
+	}
+}
+
+func Test_newSearchResponse(t *testing.T) {
+	results := map[string]map[string][]*Match{
+		"https://example.com/b": {"error": {{Name: "b-1"}, {Name: "b-2"}}},
+		"https://example.com/a": {"timeout": {{Name: "a-timeout"}}, "error": {{Name: "a-error"}}},
+		"https://example.com/c": {"error": {{Name: "c-1"}}},
+	}
+	page := func(offset, limit int) ([]string, SearchResponse) {
+		response := newSearchResponse(results, nil, offset, limit)
+		var names []string
+		for _, search := range []string{"error", "timeout"} {
+			for _, match := range response.Results[search].Matches {
+				names = append(names, search+":"+match.Name)
+			}
+		}
+		return names, response
+	}
+
+	names, response := page(0, 0)
+	if response.Total != 5 || response.NextOffset != 0 || len(names) != 5 {
+		t.Errorf("unexpected unpaged response: %v %#v", names, response)
+	}
+	names, response = page(0, 2)
+	if want := []string{"error:a-error", "timeout:a-timeout"}; !reflect.DeepEqual(names, want) || response.Total != 5 || response.NextOffset != 2 {
+		t.Errorf("unexpected first page: %v %#v", names, response)
+	}
+	if response.Results["error"].Matches[0].URL != "https://example.com/a" {
+		t.Errorf("expected the match URL to be set: %#v", response.Results["error"].Matches[0])
+	}
+	names, response = page(2, 2)
+	if want := []string{"error:b-1", "error:b-2"}; !reflect.DeepEqual(names, want) || response.NextOffset != 4 {
+		t.Errorf("unexpected second page: %v %#v", names, response)
+	}
+	names, response = page(4, 2)
+	if want := []string{"error:c-1"}; !reflect.DeepEqual(names, want) || response.NextOffset != 0 {
+		t.Errorf("unexpected last page: %v %#v", names, response)
+	}
+	names, response = page(10, 2)
+	if len(names) != 0 || response.Total != 5 || response.NextOffset != 0 {
+		t.Errorf("unexpected page past the end: %v %#v", names, response)
+	}
+}
+
+func Test_newSearchResponse_order(t *testing.T) {
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	results := map[string]map[string][]*Match{
+		"https://example.com/a": {"error": {
+			{Name: "a-junit-2", FileType: "junit", Context: []string{"error 2"}, LastModified: metav1.Time{Time: now}},
+			{Name: "a-junit-1", FileType: "junit", Context: []string{"error 1"}, LastModified: metav1.Time{Time: now}},
+			{Name: "a-build-log", FileType: "build-log", LastModified: metav1.Time{Time: now}},
+		}},
+		"https://example.com/b": {"error": {{Name: "b-new", FileType: "build-log", LastModified: metav1.Time{Time: now.Add(time.Hour)}}}},
+		"https://example.com/c": {"error": {{Name: "c-old", FileType: "build-log", LastModified: metav1.Time{Time: now.Add(-time.Hour)}}}},
+		"https://example.com/d": {"error": {{Name: "d-same", FileType: "build-log", LastModified: metav1.Time{Time: now}}}},
+	}
+	want := []string{"b-new", "a-build-log", "a-junit-1", "a-junit-2", "d-same", "c-old"}
+	for i := 0; i < 20; i++ {
+		// the order of the matches of a file depends on ripgrep, so vary it between runs
+		matches := results["https://example.com/a"]["error"]
+		matches[0], matches[1], matches[2] = matches[1], matches[2], matches[0]
+
+		var names []string
+		for _, match := range newSearchResponse(results, nil, 0, 0).Results["error"].Matches {
+			names = append(names, match.Name)
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Fatalf("unexpected order on run %d: %v", i, names)
+		}
+	}
+}
+
+func Test_cachedOrderedSearchResults(t *testing.T) {
+	prefix := "/var/lib/ci-search/"
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(prefix+"jobs/logs/job-a/1/build-log.txt\x00error: etcdserver: request timed out\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	gen := &recordingOutputCommand{outputCommand: outputCommand{prefix: prefix, output: output}}
+	o := &options{
+		MaxAge:         24 * time.Hour,
+		generator:      gen,
+		jobURIPrefix:   jobURIPrefix,
+		jobsIndex:      &pathIndex{},
+		jobAccessor:    prow.Empty,
+		groupedResults: utilcache.NewLRUExpireCache(4),
+	}
+	search := func(index *Index) *SearchResult {
+		t.Helper()
+		result, err := o.cachedOrderedSearchResults(context.TODO(), index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	first := search(&Index{Search: []string{"etcdserver"}, GroupByJob: true})
+	// later pages and options that only change how results are rendered reuse the results
+	if result := search(&Index{Search: []string{"etcdserver"}, GroupByJob: true, Offset: 10, Collapse: true, WrapLines: true, MaxLineLength: 100}); result != first || len(gen.searches) != 1 {
+		t.Fatalf("expected cached results to be reused: %d searches", len(gen.searches))
+	}
+	if search(&Index{Search: []string{"etcdserver"}, GroupByJob: true, Context: 2}); len(gen.searches) != 2 {
+		t.Fatalf("expected a different search to search again: %d searches", len(gen.searches))
+	}
+
+	// loading the path index drops the cached results
+	o.jobsIndex.loaded = time.Now()
+	if result := search(&Index{Search: []string{"etcdserver"}, GroupByJob: true}); result == first || len(gen.searches) != 3 {
+		t.Errorf("expected results to be searched again after the index was loaded: %d searches", len(gen.searches))
+	}
+}
+
+func TestSearchResult_SortJobs(t *testing.T) {
+	now := time.Now()
+	newResult := func() *SearchResult {
+		var s SearchResult
+		for _, job := range []struct {
+			name string
+			runs int
+			age  time.Duration
+		}{
+			{name: "b", runs: 1, age: time.Hour},
+			{name: "c", runs: 3, age: 3 * time.Hour},
+			{name: "a", runs: 2, age: 2 * time.Hour},
+		} {
+			r := s.JobByName(job.name)
+			for i := 0; i < job.runs; i++ {
+				r.Instances = append(r.Instances, SearchJobInstanceResult{
+					Number:  i,
+					Matches: []Match{{LastModified: metav1.Time{Time: now.Add(-job.age)}}},
+				})
+			}
+		}
+		return &s
+	}
+	stats := map[string]prow.JobStats{
+		"a": {Count: 10, Failures: 2},
+		"b": {Count: 4, Failures: 2},
+		"c": {Count: 10, Failures: 2},
+	}
+	for _, tt := range []struct {
+		order string
+		want  []string
+	}{
+		{order: "", want: []string{"b", "c", "a"}},
+		{order: "impact", want: []string{"b", "c", "a"}},
+		{order: "matches", want: []string{"c", "a", "b"}},
+		{order: "name", want: []string{"a", "b", "c"}},
+		{order: "recent", want: []string{"b", "a", "c"}},
+	} {
+		t.Run(tt.order, func(t *testing.T) {
+			s := newResult()
+			s.SortJobs(tt.order, func(name string) prow.JobStats { return stats[name] })
+			var got []string
+			for _, job := range s.Jobs {
+				got = append(got, job.Name)
+				if s.JobByName(job.Name).Name != job.Name {
+					t.Errorf("job index for %s was not updated", job.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SortJobs(%q) = %v, want %v", tt.order, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_handleSearchV2_bytesScanned(t *testing.T) {
+	prefix := "/var/lib/ci-search/"
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(
+		prefix+"jobs/logs/job-a/1/build-log.txt\x00error: etcdserver: request timed out\n"+
+			prefix+"jobs/logs/job-b/2/build-log.txt\x00error: etcdserver: request timed out again\n"+
+			// the statistics printed by ripgrep --stats
+			"\n2 matches\n2 matched lines\n2 files contained matches\n2 files searched\n"+
+			"145 bytes printed\n4096 bytes searched\n0.000100 seconds spent searching\n0.002000 seconds\n",
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	o := &options{
+		MaxAge:       24 * time.Hour,
+		generator:    &outputCommand{prefix: prefix, output: output},
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{},
+		jobAccessor:  prow.Empty,
+	}
+
+	search := func(t *testing.T, rawQuery string) SearchResponse {
+		w := httptest.NewRecorder()
+		o.handleSearchV2(w, httptest.NewRequest("GET", "/v2/search?"+rawQuery, nil))
+		if w.Code != 200 {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+		var response SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if header := w.Header().Get("X-Search-Bytes-Scanned"); header != fmt.Sprint(response.BytesScanned) {
+			t.Errorf("header %q does not match response %d", header, response.BytesScanned)
+		}
+		return response
+	}
+
+	complete := search(t, "search=etcdserver&type=build-log")
+	if complete.Truncated || complete.Total != 2 || complete.BytesScanned != 4096 {
+		t.Errorf("unexpected complete response: %#v", complete)
+	}
+	// ripgrep is stopped before it reports the bytes it searched
+	truncated := search(t, "search=etcdserver&type=build-log&maxBytes=10")
+	if !truncated.Truncated || truncated.BytesScanned != 0 {
+		t.Errorf("unexpected truncated response: %#v", truncated)
+	}
+
+	// the other search endpoints return the partial results of a truncated search
+	for endpoint, handler := range map[string]http.HandlerFunc{"/search": o.handleSearch, "/search.csv": o.handleSearchCSV} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", endpoint+"?search=etcdserver&type=build-log&maxBytes=100", nil))
+		if w.Code != 200 {
+			t.Fatalf("%s: unexpected status %d: %s", endpoint, w.Code, w.Body.String())
+		}
+		if w.Header().Get("X-Search-Truncated") != "true" || !strings.Contains(w.Body.String(), "job-a") {
+			t.Errorf("%s: unexpected truncated response %v: %s", endpoint, w.Header(), w.Body.String())
+		}
+	}
+}
+
+func Test_handleSearch_linksOnly(t *testing.T) {
+	prefix := "/var/lib/ci-search/"
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(
+		prefix+"jobs/logs/job-a/1/build-log.txt\x00error: etcdserver: request timed out\n"+
+			prefix+"jobs/logs/job-a/1/build-log.txt\x00error: etcdserver: request timed out again\n"+
+			prefix+"jobs/logs/job-b/2/build-log.txt\x00error: etcdserver: leader changed\n",
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	o := &options{
+		MaxAge:       24 * time.Hour,
+		generator:    &outputCommand{prefix: prefix, output: output},
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{},
+		jobAccessor:  prow.Empty,
+	}
+
+	search := func(t *testing.T, context string) map[string]map[string][]*Match {
+		w := httptest.NewRecorder()
+		o.handleSearch(w, httptest.NewRequest("GET", "/search?search=etcdserver&type=build-log&maxMatches=5&context="+context, nil))
+		if w.Code != 200 {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+		var result map[string]map[string][]*Match
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := search(t, "-1")
+	hits := make(map[string]int)
+	for uri, searches := range result {
+		matches := searches["etcdserver"]
+		if len(matches) != 1 {
+			t.Fatalf("%s: expected a single match per file: %#v", uri, matches)
+		}
+		if len(matches[0].Context) > 0 {
+			t.Errorf("%s: expected no context: %#v", uri, matches[0].Context)
+		}
+		hits[path.Base(path.Dir(uri))] = matches[0].Hits
+	}
+	if !reflect.DeepEqual(hits, map[string]int{"job-a": 2, "job-b": 1}) {
+		t.Errorf("unexpected hits: %v", hits)
+	}
+
+	// matches keep their context and omit hits otherwise
+	for uri, searches := range search(t, "0") {
+		for _, match := range searches["etcdserver"] {
+			if match.Hits != 0 || len(match.Context) == 0 {
+				t.Errorf("%s: unexpected match %#v", uri, match)
+			}
+		}
+	}
+}
+
+func Test_handleSearchSummary_matchesSearch(t *testing.T) {
+	prefix := t.TempDir() + "/"
+	var output strings.Builder
+	for _, file := range []struct {
+		name    string
+		content string
+	}{
+		{name: "jobs/logs/job-a/1/build-log.txt", content: "error: etcdserver: request timed out\nlevel=fatal msg=failed to initialize the cluster\n"},
+		{name: "jobs/logs/job-b/2/build-log.txt", content: "error: etcdserver: request timed out\n"},
+	} {
+		path := filepath.Join(prefix, file.name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		output.WriteString(path + "\x00error: etcdserver: request timed out\n")
+	}
+	outputPath := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(outputPath, []byte(output.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	o := &options{
+		MaxAge:            24 * time.Hour,
+		generator:         &outputCommand{prefix: prefix, output: outputPath},
+		jobURIPrefix:      jobURIPrefix,
+		jobsIndex:         &pathIndex{},
+		jobAccessor:       prow.Empty,
+		InstallSearchType: "build-log",
+		InstallPattern:    "level=fatal msg=",
+		DefaultMaxMatches: map[string]int{"build-log": 1},
+	}
+
+	// the type of an install search is defaulted, and only files with an install failure match
+	query := "search=etcdserver&installOnly=1"
+	w := httptest.NewRecorder()
+	o.handleSearch(w, httptest.NewRequest("GET", "/search?"+query, nil))
+	if w.Code != 200 {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	var result map[string]map[string][]*Match
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("expected only the install failure to match: %v", result)
+	}
+
+	w = httptest.NewRecorder()
+	o.handleSearchSummary(w, httptest.NewRequest("GET", "/search/summary?"+query, nil))
+	if w.Code != 200 {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	var summary SearchSummaryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if got := summary.Results["etcdserver"]["build-log"]; got != len(result) {
+		t.Errorf("summary counted %d files, search returned %d: %v", got, len(result), summary.Results)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/openshift/ci-search/pkg/httpwriter"
+)
+
+type SimilarFailuresResponse struct {
+	// Name is the name of the test that was searched for.
+	Name string `json:"name"`
+	// Jobs are the jobs with runs in which the test failed, most failures first.
+	Jobs []SimilarFailuresJob `json:"jobs"`
+	// Failures is the number of runs across all jobs in which the test failed.
+	Failures int `json:"failures"`
+}
+
+type SimilarFailuresJob struct {
+	Name     string `json:"name"`
+	Failures int    `json:"failures"`
+}
+
+// junitTestPattern returns a search that matches the "# NAME" line that precedes the
+// output of a failed test in a junit.failures file.
+func junitTestPattern(name string) string {
+	return "^# " + regexp.QuoteMeta(name) + " *$"
+}
+
+// handleSimilarFailures finds the jobs in which the test passed as the name parameter
+// failed, and the number of runs of each job in which it failed, so that the impact of
+// a single failing test can be seen.
+func (o *options) handleSimilarFailures(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var index *Index
+	var success bool
+	defer func() {
+		requestLog(req.Context()).Infof("Render similar failures %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+	name := req.Form.Get("name")
+	if len(name) == 0 {
+		http.Error(w, "The 'name' query parameter is required", http.StatusBadRequest)
+		return
+	}
+	// the name is the test, not the job name filter that other searches accept
+	req.Form.Del("name")
+
+	var err error
+	index, err = parseRequest(req, "junit", o.MaxAge, o.jobAliases)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	release, ok := o.acquireSearch(w)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// only the test header line of junit failures is searched, exactly as named
+	index.SearchType = "junit"
+	index.Search = []string{junitTestPattern(name)}
+	index.Literal = false
+	index.Case = "sensitive"
+	index.CountOnly = true
+	index.MaxMatches = 1
+	index.Context = 0
+
+	jobs := make(map[string]int)
+	var failures int
+	err = executeGrep(req.Context(), o.generator, index, nil, func(path string, search string, matches []bytes.Buffer, _ int, moreLines int) error {
+		metadata, err := o.MetadataFor(path)
+		if err != nil {
+			requestLog(req.Context()).Errorf("unable to resolve metadata for: %s: %v", path, err)
+			return nil
+		}
+		if metadata.FileType != "junit" {
+			return nil
+		}
+		if index.JobFilter != nil && !index.JobFilter(metadata.Name) {
+			return nil
+		}
+		if !index.InDurationRange(metadata) {
+			return nil
+		}
+		jobs[metadata.Name]++
+		failures++
+		return nil
+	})
+	recordSearch(req, index, failures)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	result := SimilarFailuresResponse{
+		Name:     name,
+		Jobs:     make([]SimilarFailuresJob, 0, len(jobs)),
+		Failures: failures,
+	}
+	for job, count := range jobs {
+		result.Jobs = append(result.Jobs, SimilarFailuresJob{Name: job, Failures: count})
+	}
+	sort.Slice(result.Jobs, func(i, j int) bool {
+		a, b := result.Jobs[i], result.Jobs[j]
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		return a.Name < b.Name
+	})
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to serialize result: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+
+	if _, err = writer.Write(data); err != nil {
+		requestLog(req.Context()).Errorf("Failed to write response: %v", err)
+		return
+	}
+
+	success = true
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_handleSimilarFailures(t *testing.T) {
+	prefix := "/var/lib/ci-search/"
+	output := filepath.Join(t.TempDir(), "output")
+	if err := os.WriteFile(output, []byte(
+		prefix+"jobs/logs/job-a/1/junit.failures\x001\n"+
+			prefix+"jobs/logs/job-b/2/junit.failures\x001\n"+
+			prefix+"jobs/logs/job-a/3/junit.failures\x001\n",
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	gen := &recordingOutputCommand{outputCommand: outputCommand{prefix: prefix, output: output}}
+	o := &options{
+		MaxAge:       24 * time.Hour,
+		generator:    gen,
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{},
+		jobAccessor:  prow.Empty,
+	}
+
+	w := httptest.NewRecorder()
+	o.handleSimilarFailures(w, httptest.NewRequest("GET", "/api/similar?"+url.Values{"name": {"[sig-api] pods (s) should start"}}.Encode(), nil))
+	if w.Code != 200 {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if want := []string{`^# \[sig-api\] pods \(s\) should start *$`}; !reflect.DeepEqual(gen.searches, want) {
+		t.Errorf("unexpected searches: %q", gen.searches)
+	}
+	var result SimilarFailuresResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	want := SimilarFailuresResponse{
+		Name:     "[sig-api] pods (s) should start",
+		Jobs:     []SimilarFailuresJob{{Name: "job-a", Failures: 2}, {Name: "job-b", Failures: 1}},
+		Failures: 3,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("unexpected result: %#v", result)
+	}
+
+	w = httptest.NewRecorder()
+	o.handleSimilarFailures(w, httptest.NewRequest("GET", "/api/similar", nil))
+	if w.Code != 400 {
+		t.Errorf("expected a missing name to be rejected: %d", w.Code)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+// jobAlias is a short name that may be used in a job name filter in place of a longer
+// regular expression.
+type jobAlias struct {
+	Alias string `json:"alias"`
+	Regex string `json:"regex"`
+
+	re *regexp.Regexp
+}
+
+// jobAliases are consulted in order, so the first alias that matches a job name labels it.
+type jobAliases []jobAlias
+
+// loadJobAliases reads a YAML or JSON list of job aliases from path and verifies that
+// each alias is unique and each regex compiles.
+func loadJobAliases(path string) (jobAliases, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var aliases jobAliases
+	if err := yaml.UnmarshalStrict(data, &aliases); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	seen := make(map[string]struct{}, len(aliases))
+	for i := range aliases {
+		alias := &aliases[i]
+		if len(alias.Alias) == 0 || len(alias.Regex) == 0 {
+			return nil, fmt.Errorf("alias %d in %s must have an alias and a regex", i+1, path)
+		}
+		if _, ok := seen[alias.Alias]; ok {
+			return nil, fmt.Errorf("alias %q in %s is defined more than once", alias.Alias, path)
+		}
+		seen[alias.Alias] = struct{}{}
+		if alias.re, err = regexp.Compile(alias.Regex); err != nil {
+			return nil, fmt.Errorf("alias %q in %s is not a valid regular expression: %v", alias.Alias, path, err)
+		}
+	}
+	return aliases, nil
+}
+
+// Expand returns the regex of the alias named value, or value if it is not an alias, so
+// that job name filters that are not aliases continue to work.
+func (a jobAliases) Expand(value string) string {
+	for _, alias := range a {
+		if alias.Alias == value {
+			return alias.Regex
+		}
+	}
+	return value
+}
+
+// Label returns the first alias whose regex matches the job name, or an empty string
+// if none does.
+func (a jobAliases) Label(name string) string {
+	for _, alias := range a {
+		if alias.re != nil && alias.re.MatchString(name) {
+			return alias.Alias
+		}
+	}
+	return ""
+}
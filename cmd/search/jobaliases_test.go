@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_loadJobAliases(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	aliases, err := loadJobAliases(write("valid.yaml", "- alias: 4.8-aws\n  regex: '^periodic-ci-openshift-release-master-ci-4\\.8-e2e-aws$'\n- alias: upgrades\n  regex: '-upgrade'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aliases.Expand("4.8-aws"); got != `^periodic-ci-openshift-release-master-ci-4\.8-e2e-aws$` {
+		t.Errorf("unexpected expansion %q", got)
+	}
+	if got := aliases.Expand("-e2e-gcp"); got != "-e2e-gcp" {
+		t.Errorf("expected a name that is not an alias to be kept: %q", got)
+	}
+	if got := aliases.Label("periodic-ci-openshift-release-master-ci-4.8-e2e-aws"); got != "4.8-aws" {
+		t.Errorf("unexpected label %q", got)
+	}
+	if got := aliases.Label("periodic-ci-openshift-release-master-ci-4.8-e2e-gcp"); got != "" {
+		t.Errorf("unexpected label %q", got)
+	}
+
+	for name, content := range map[string]string{
+		"noregex.yaml":   "- alias: missing\n",
+		"invalid.yaml":   "- alias: bad\n  regex: 'x(?= )'\n",
+		"duplicate.yaml": "- alias: a\n  regex: a\n- alias: a\n  regex: b\n",
+		"unknown.yaml":   "- name: a\n  regex: a\n",
+	} {
+		if _, err := loadJobAliases(write(name, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// an alias in a name filter is expanded, but the request keeps the alias
+	index, err := parseRequest(httptest.NewRequest("GET", "/?search=x&name=4.8-aws&excludeName=upgrades", nil), "text", 24*time.Hour, aliases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.IncludeName != "4.8-aws" || index.ExcludeName != "upgrades" {
+		t.Errorf("unexpected filters %q %q", index.IncludeName, index.ExcludeName)
+	}
+	for name, want := range map[string]bool{
+		"periodic-ci-openshift-release-master-ci-4.8-e2e-aws":         true,
+		"periodic-ci-openshift-release-master-ci-4.8-e2e-aws-upgrade": false,
+		"4.8-aws": false,
+	} {
+		if got := index.JobFilter(name); got != want {
+			t.Errorf("%s: expected filter to return %t", name, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// jobAgeBuckets are the upper bounds in hours of the job age histograms.
+var jobAgeBuckets = []float64{1, 6, 12, 24, 48, 72, 168, 336}
+
+var (
+	descJobs       = prometheus.NewDesc("ci_search_jobs_total", "The number of jobs known to the server.", nil, nil)
+	descFailedJobs = prometheus.NewDesc("ci_search_failed_jobs_total", "The number of jobs known to the server that did not succeed.", nil, nil)
+	descEntries    = prometheus.NewDesc("ci_search_indexed_entries", "The number of job files in the search index.", nil, nil)
+	descSize       = prometheus.NewDesc("ci_search_indexed_bytes", "The total size of the job files in the search index.", nil, nil)
+	descBugs       = prometheus.NewDesc("ci_search_indexed_bugs", "The number of indexed bugs.", nil, nil)
+	descIssues     = prometheus.NewDesc("ci_search_indexed_issues", "The number of indexed issues.", nil, nil)
+	descJobAge     = prometheus.NewDesc("ci_search_jobs_age_hours", "The age in hours of the jobs known to the server, to the nearest hour.", nil, nil)
+	descFailedAge  = prometheus.NewDesc("ci_search_failed_jobs_age_hours", "The age in hours of the jobs known to the server that did not succeed, to the nearest hour.", nil, nil)
+)
+
+// jobStatsCollector reports the index statistics as metrics at the time they are
+// collected.
+type jobStatsCollector struct {
+	stats func() IndexStats
+	now   func() time.Time
+}
+
+func (c *jobStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{descJobs, descFailedJobs, descEntries, descSize, descBugs, descIssues, descJobAge, descFailedAge} {
+		ch <- desc
+	}
+}
+
+func (c *jobStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	ch <- prometheus.MustNewConstMetric(descJobs, prometheus.GaugeValue, float64(stats.Jobs))
+	ch <- prometheus.MustNewConstMetric(descFailedJobs, prometheus.GaugeValue, float64(stats.FailedJobs))
+	ch <- prometheus.MustNewConstMetric(descEntries, prometheus.GaugeValue, float64(stats.Entries))
+	ch <- prometheus.MustNewConstMetric(descSize, prometheus.GaugeValue, float64(stats.Size))
+	ch <- prometheus.MustNewConstMetric(descBugs, prometheus.GaugeValue, float64(stats.Bugs))
+	ch <- prometheus.MustNewConstMetric(descIssues, prometheus.GaugeValue, float64(stats.Issues))
+
+	now := c.now().Unix()
+	ch <- jobAgeHistogram(descJobAge, stats.Buckets, now, func(b JobCountBucket) int { return b.Jobs })
+	ch <- jobAgeHistogram(descFailedAge, stats.Buckets, now, func(b JobCountBucket) int { return b.FailedJobs })
+}
+
+// jobAgeHistogram returns a histogram of the age in hours of the jobs counted by count
+// in each hourly bucket as of now.
+func jobAgeHistogram(desc *prometheus.Desc, buckets []JobCountBucket, now int64, count func(JobCountBucket) int) prometheus.Metric {
+	var total uint64
+	var sum float64
+	cumulative := make(map[float64]uint64, len(jobAgeBuckets))
+	for _, upper := range jobAgeBuckets {
+		cumulative[upper] = 0
+	}
+	for _, bucket := range buckets {
+		n := count(bucket)
+		if n == 0 {
+			continue
+		}
+		age := float64((now - bucket.T) / 3600)
+		if age < 0 {
+			age = 0
+		}
+		total += uint64(n)
+		sum += age * float64(n)
+		for _, upper := range jobAgeBuckets {
+			if age <= upper {
+				cumulative[upper] += uint64(n)
+			}
+		}
+	}
+	return prometheus.MustNewConstHistogram(desc, total, sum, cumulative)
+}
+
+// jobMetricsHandler serves the index statistics in the Prometheus text format. The
+// metrics use their own registry so that they are not included in /metrics.
+func (o *options) jobMetricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&jobStatsCollector{stats: o.Stats, now: time.Now})
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_jobStatsCollector(t *testing.T) {
+	now := time.Unix(100*3600, 0)
+	collector := &jobStatsCollector{
+		now: func() time.Time { return now },
+		stats: func() IndexStats {
+			return IndexStats{
+				Jobs:       6,
+				FailedJobs: 3,
+				Buckets: []JobCountBucket{
+					{T: now.Add(-30 * time.Hour).Unix(), Jobs: 2, FailedJobs: 1},
+					{T: now.Add(-5 * time.Hour).Unix(), Jobs: 1},
+					{T: now.Unix(), Jobs: 3, FailedJobs: 2},
+				},
+			}
+		},
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	expected := `
+# HELP ci_search_jobs_total The number of jobs known to the server.
+# TYPE ci_search_jobs_total gauge
+ci_search_jobs_total 6
+# HELP ci_search_failed_jobs_total The number of jobs known to the server that did not succeed.
+# TYPE ci_search_failed_jobs_total gauge
+ci_search_failed_jobs_total 3
+# HELP ci_search_failed_jobs_age_hours The age in hours of the jobs known to the server that did not succeed, to the nearest hour.
+# TYPE ci_search_failed_jobs_age_hours histogram
+ci_search_failed_jobs_age_hours_bucket{le="1"} 2
+ci_search_failed_jobs_age_hours_bucket{le="6"} 2
+ci_search_failed_jobs_age_hours_bucket{le="12"} 2
+ci_search_failed_jobs_age_hours_bucket{le="24"} 2
+ci_search_failed_jobs_age_hours_bucket{le="48"} 3
+ci_search_failed_jobs_age_hours_bucket{le="72"} 3
+ci_search_failed_jobs_age_hours_bucket{le="168"} 3
+ci_search_failed_jobs_age_hours_bucket{le="336"} 3
+ci_search_failed_jobs_age_hours_bucket{le="+Inf"} 3
+ci_search_failed_jobs_age_hours_sum 30
+ci_search_failed_jobs_age_hours_count 3
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "ci_search_jobs_total", "ci_search_failed_jobs_total", "ci_search_failed_jobs_age_hours"); err != nil {
+		t.Error(err)
+	}
+}
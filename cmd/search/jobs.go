@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 
 	"github.com/openshift/ci-search/pkg/httpwriter"
@@ -62,3 +64,54 @@ func (o *options) handleJobs(w http.ResponseWriter, req *http.Request) {
 
 	success = true
 }
+
+// maxJobNames is the maximum number of job names returned by handleJobNames.
+const maxJobNames = 1000
+
+// handleJobNames returns a sorted JSON array of the distinct names of the known jobs,
+// optionally only those starting with the prefix query parameter, for building job
+// name filters.
+func (o *options) handleJobNames(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var success bool
+	defer func() {
+		klog.Infof("Render job names duration=%s success=%t", time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	if o.jobAccessor == nil {
+		http.Error(w, "Unable to serve job names because no prow data source was configured.", http.StatusInternalServerError)
+		return
+	}
+
+	jobs, err := o.jobAccessor.List(labels.Everything())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load jobs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	prefix := req.FormValue("prefix")
+	names := sets.NewString()
+	for _, job := range jobs {
+		if len(job.Spec.Job) > 0 && strings.HasPrefix(job.Spec.Job, prefix) {
+			names.Insert(job.Spec.Job)
+		}
+	}
+	list := names.List()
+	if len(list) > maxJobNames {
+		list = list[:maxJobNames]
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to write job names: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+	if _, err := writer.Write(data); err != nil {
+		klog.Errorf("Failed to write response: %v", err)
+		return
+	}
+
+	success = true
+}
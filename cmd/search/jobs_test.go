@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_handleJobNames(t *testing.T) {
+	var jobs []*prow.Job
+	for i, name := range []string{"periodic-b", "periodic-a", "pull-a", "periodic-a", ""} {
+		job := &prow.Job{Spec: prow.JobSpec{Job: name}}
+		job.Name = string(rune('a' + i))
+		jobs = append(jobs, job)
+	}
+	lister, err := prow.NewListerForJobs(jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &options{jobAccessor: lister}
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"periodic-a", "periodic-b", "pull-a"}},
+		{query: "?prefix=periodic-", want: []string{"periodic-a", "periodic-b"}},
+		{query: "?prefix=none", want: []string{}},
+	} {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			o.handleJobNames(w, httptest.NewRequest("GET", "/api/jobs/names"+tt.query, nil))
+			if w.Code != 200 {
+				t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+			}
+			var names []string
+			if err := json.Unmarshal(w.Body.Bytes(), &names); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("unexpected names: %v", names)
+			}
+		})
+	}
+}
@@ -10,9 +10,13 @@ import (
 	_ "net/http/pprof"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -20,9 +24,11 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/semaphore"
 	gcpoption "google.golang.org/api/option"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
@@ -53,7 +59,30 @@ func main() {
 		MaxAge:            14 * 24 * time.Hour,
 		JobURIPrefix:      "https://prow.ci.openshift.org/view/gs/",
 		ArtifactURIPrefix: "https://storage.googleapis.com/",
-		IndexBucket:       "test-platform-results",
+		IndexBuckets:      []string{"test-platform-results"},
+		MetricLimits: metricdb.Limits{
+			VacuumThreshold:    10000,
+			VacuumFreeFraction: 0.25,
+			ScrapeBudget:       10 * time.Minute,
+		},
+		MetricGraphMaxQueries:   4,
+		MaxConcurrentSearches:   16,
+		IndexSuccessJunit:       true,
+		IndexConcurrency:        40,
+		IndexArtifacts:          []string{"junit", "build-log"},
+		BugzillaExcludeKeywords: []string{"Security"},
+
+		InstallSearchType: "build-log",
+		InstallPattern:    `level=fatal msg=|failed to initialize the cluster|Bootstrap failed to complete`,
+
+		FreshnessWarningThreshold: 30 * time.Minute,
+		RipgrepPath:               "rg",
+		MustGather: prow.MustGatherOptions{
+			MaxFiles:        50,
+			MaxBytes:        20 * 1024 * 1024,
+			MaxArchiveBytes: 512 * 1024 * 1024,
+			Timeout:         5 * time.Minute,
+		},
 	}
 	cmd := &cobra.Command{
 		Run: func(cmd *cobra.Command, arguments []string) {
@@ -67,30 +96,61 @@ func main() {
 	flag.StringVar(&opt.Path, "path", opt.Path, "The directory to save index results to.")
 	flag.StringVar(&opt.ListenAddr, "listen", opt.ListenAddr, "The address to serve search results on")
 	flag.StringVar(&opt.DebugAddr, "debug-listen", opt.DebugAddr, "The address to serve debug handlers on")
+	flag.StringVar(&opt.AccessLogPath, "access-log-file", opt.AccessLogPath, "A file to append a line of JSON to for each request served, with the search, result count, bytes searched by ripgrep, status, and duration of the request. Use - for stdout. If empty, no access log is written.")
+	flag.IntVar(&opt.MaxConcurrentSearches, "max-concurrent-searches", opt.MaxConcurrentSearches, "The number of search requests that may run at once. Additional requests are rejected with 503 until a search completes. Set to 0 to allow any number of searches.")
+	flag.StringVar(&opt.RipgrepPath, "ripgrep-path", opt.RipgrepPath, "The ripgrep binary used for searches. A name without a slash is looked up on the PATH. The server exits at startup if the binary is older than 11.0.0.")
 	flag.AddGoFlag(original.Lookup("v"))
 
 	flag.DurationVar(&opt.MaxAge, "max-age", opt.MaxAge, "The maximum age of entries to keep cached. Set to 0 to keep all. Defaults to 14 days.")
+	flag.DurationVar(&opt.JobMetadataMaxAge, "job-metadata-max-age", opt.JobMetadataMaxAge, "The maximum age of jobs to keep in memory for statistics and charts. Artifacts are only indexed to disk within --max-age. Defaults to --max-age if unset.")
 	flag.DurationVar(&opt.Interval, "interval", opt.Interval, "(Disabled) The interval to index jobs.")
 	flag.StringVar(&opt.ConfigPath, "config", opt.ConfigPath, "(Disabled) Path on disk to a testgrid config for indexing.")
 	flag.StringVar(&opt.GCPServiceAccount, "gcp-service-account", opt.GCPServiceAccount, "(Disabled) Path to a GCP service account file.")
 	flag.StringVar(&opt.JobURIPrefix, "job-uri-prefix", opt.JobURIPrefix, "URI prefix for converting job-detail pages to index names.  For example, https://prow.ci.openshift.org/view/gs/test-platform-results/logs/release-openshift-origin-installer-e2e-aws-4.1/309 has an index name of test-platform-results/logs/release-openshift-origin-installer-e2e-aws-4.1/309 with the default job-URI prefix.")
 	flag.StringVar(&opt.ArtifactURIPrefix, "artifact-uri-prefix", opt.ArtifactURIPrefix, "URI prefix for artifacts.  For example, test-platform-results/logs/release-openshift-origin-installer-e2e-aws-4.1/309 has build logs at https://storage.googleapis.com/test-platform-results/logs/release-openshift-origin-installer-e2e-aws-4.1/309/build-log.txt with the default artifact-URI prefix.")
 	flag.StringVar(&opt.DeckURI, "deck-uri", opt.DeckURI, "URL to the Deck server to index prow job failures into search.")
-	flag.StringVar(&opt.IndexBucket, "index-bucket", opt.IndexBucket, "A GCS bucket to look for job indices in.")
+	flag.StringSliceVar(&opt.IndexBuckets, "index-bucket", opt.IndexBuckets, "A GCS bucket to look for job indices in. May be repeated to read jobs from several buckets.")
 	flag.StringVar(&opt.MetricDBPath, "metric-db", opt.MetricDBPath, "Path where metrics should be recorded as a SQLite database. If empty, no metrics will be stored.")
 	flag.DurationVar(&opt.MetricMaxAge, "metric-max-age", opt.MetricMaxAge, "The maximum age to retain metrics. If negative, metrics are retained forever. If zero, no metrics are gathered.")
+	flag.Int64Var(&opt.MetricLimits.VacuumThreshold, "metric-db-vacuum-threshold", opt.MetricLimits.VacuumThreshold, "The number of deleted metrics after which the metric database is vacuumed to reclaim space.")
+	flag.Float64Var(&opt.MetricLimits.VacuumFreeFraction, "metric-db-vacuum-free-fraction", opt.MetricLimits.VacuumFreeFraction, "The fraction of the metric database file that may be free space before the database is vacuumed. If zero, the database is only vacuumed after --metric-db-vacuum-threshold deletions.")
+	flag.DurationVar(&opt.MetricLimits.DownsampleMaxAge, "metric-downsample-max-age", opt.MetricLimits.DownsampleMaxAge, "The maximum age to retain daily averages of metrics removed by --metric-max-age. If negative, the averages are retained forever. If zero, metrics are not averaged before they are removed.")
+	flag.DurationVar(&opt.MetricLimits.ScrapeBudget, "metric-scrape-budget", opt.MetricLimits.ScrapeBudget, "The maximum time a single scrape of new metrics may run. Metrics not read within the budget are read by the next scrape. If zero, a scrape reads all new metrics.")
+	flag.IntVar(&opt.MetricGraphMaxQueries, "metric-graph-max-queries", opt.MetricGraphMaxQueries, "The number of metric graph queries that may run at once. Additional requests are rejected until a query completes.")
+	flag.Int64Var(&opt.MetricLimits.MaxSizeBytes, "metric-db-max-size", opt.MetricLimits.MaxSizeBytes, "The maximum size in bytes of the metric database. When exceeded, the oldest metrics are removed regardless of --metric-max-age. If zero, the size is not limited.")
 
 	flag.StringVar(&opt.BugzillaURL, "bugzilla-url", opt.BugzillaURL, "The URL of a bugzilla server to index bugs from.")
 	flag.StringVar(&opt.BugzillaTokenPath, "bugzilla-token-file", opt.BugzillaTokenPath, "A file to read a bugzilla token from.")
 	flag.StringVar(&opt.BugzillaSearch, "bugzilla-search", opt.BugzillaSearch, "A quicksearch query to search for bugs to index.")
+	flag.StringSliceVar(&opt.BugzillaExcludeKeywords, "bugzilla-exclude-keywords", opt.BugzillaExcludeKeywords, "Bugs with any of these keywords are not indexed. Set to an empty value to index all bugs matching --bugzilla-search.")
 
 	// jira
 	flag.StringVar(&opt.JiraURL, "jira-url", opt.JiraURL, "The URL of a Jira server to index issues from.")
 	flag.StringVar(&opt.JiraTokenPath, "jira-token-file", opt.JiraTokenPath, "A file to read a Jira token from.")
 	flag.StringVar(&opt.JiraSearch, "jira-search", opt.JiraSearch, "A JQL query to search for issues to index.")
+	flag.StringSliceVar(&opt.JiraProjects, "jira-projects", opt.JiraProjects, "The keys of the Jira projects to index issues from, e.g. OCPBUGS,TRT. If empty, issues from all projects matching --jira-search are indexed.")
 
 	flag.BoolVar(&opt.NoIndex, "disable-indexing", opt.NoIndex, "Disable all indexing to disk.")
 
+	flag.StringVar(&opt.JobAliasesPath, "job-aliases-file", opt.JobAliasesPath, "A YAML or JSON file with a list of {alias, regex} job aliases. A job name filter that is exactly an alias is replaced by its regex, and the metrics graph labels the jobs matched by an alias with the alias.")
+	flag.StringVar(&opt.ChartDefaultsPath, "chart-defaults-file", opt.ChartDefaultsPath, "A YAML or JSON file with a list of {label, regex} searches to chart when a chart request has no search. The label is optional and replaces the regex in the legend. If unset, a built-in list is used.")
+	flag.StringToIntVar(&opt.DefaultContext, "default-context", opt.DefaultContext, "The lines of context to show for a search type when the request does not specify one, e.g. build-log=3,bug=0.")
+	flag.StringToIntVar(&opt.DefaultMaxMatches, "default-max-matches", opt.DefaultMaxMatches, "The maximum matches per file to show for a search type when the request does not specify one, e.g. build-log=10,bug=1.")
+	flag.StringVar(&opt.InstallSearchType, "install-search-type", opt.InstallSearchType, "The search type used for installOnly requests that do not specify a type.")
+	flag.StringVar(&opt.InstallPattern, "install-pattern", opt.InstallPattern, "A regular expression that files must also match to be included in installOnly results. Uppercase characters make the pattern case sensitive.")
+	flag.DurationVar(&opt.FreshnessWarningThreshold, "freshness-warning-threshold", opt.FreshnessWarningThreshold, "Show a warning on results pages when the index was last loaded or the newest indexed job completed longer ago than this, relative to the newest known job. Set to 0 to disable.")
+	flag.IntVar(&opt.IndexConcurrency, "index-concurrency", opt.IndexConcurrency, "The maximum number of jobs downloaded at once. Fewer are downloaded while GCS throttles requests. The server is not ready until the jobs known at startup are downloaded, so lower values delay readiness when the disk cache is empty.")
+	flag.BoolVar(&opt.IndexSuccessJunit, "index-success-junit", opt.IndexSuccessJunit, "Index the junit failures of successful jobs, such as tests that passed on retry. Build logs are only indexed for jobs that did not succeed.")
+	flag.StringSliceVar(&opt.IndexArtifacts, "index-artifacts", opt.IndexArtifacts, "The kinds of job artifacts to index: junit, build-log, or e2e-log. Build logs and the last 20MB of the e2e.log are only indexed for jobs that did not succeed.")
+	flag.BoolVar(&opt.IndexE2ELog, "index-e2e-log", opt.IndexE2ELog, "Download the last 20MB of the e2e.log of failed jobs so it can be searched with the e2e-log search type. Equivalent to adding e2e-log to --index-artifacts.")
+	flag.BoolVar(&opt.SkipAbortedJobs, "skip-aborted-jobs", opt.SkipAbortedJobs, "Do not download artifacts for aborted jobs. Aborted jobs are still included in job statistics.")
+	flag.BoolVar(&opt.TokenFilters, "index-token-filters", opt.TokenFilters, "Record a filter of the words in each indexed build so that existence checks for literal searches can skip builds that cannot match.")
+	flag.StringSliceVar(&opt.MustGather.Files, "must-gather-files", opt.MustGather.Files, "Glob patterns of files to extract from the must-gather archives of failed jobs, matched against the trailing path segments of each file (e.g. namespaces/*/pods/*/*/*/logs/current.log). If empty, must-gather archives are not indexed.")
+	flag.IntVar(&opt.MustGather.MaxFiles, "must-gather-max-files", opt.MustGather.MaxFiles, "The maximum number of files to extract from a single must-gather archive.")
+	flag.Int64Var(&opt.MustGather.MaxBytes, "must-gather-max-bytes", opt.MustGather.MaxBytes, "The maximum number of bytes to extract from a single must-gather archive.")
+	flag.Int64Var(&opt.MustGather.MaxArchiveBytes, "must-gather-max-archive-bytes", opt.MustGather.MaxArchiveBytes, "Must-gather archives larger than this size are not downloaded.")
+	flag.DurationVar(&opt.MustGather.Timeout, "must-gather-timeout", opt.MustGather.Timeout, "The maximum time to download and extract a single must-gather archive. If zero, there is no limit.")
+
 	if err := cmd.Execute(); err != nil {
 		klog.Exitf("error: %v", err)
 	}
@@ -101,34 +161,86 @@ type options struct {
 	DebugAddr  string
 	Path       string
 
+	// AccessLogPath is the file requests are logged to as JSON, if set
+	AccessLogPath string
+
 	// arguments to indexing
 	MaxAge            time.Duration
+	JobMetadataMaxAge time.Duration
 	Interval          time.Duration
 	GCPServiceAccount string
 	JobURIPrefix      string
 	ArtifactURIPrefix string
 	ConfigPath        string
 	DeckURI           string
-	IndexBucket       string
+	IndexBuckets      []string
 
 	MetricDBPath string
 	MetricMaxAge time.Duration
+	MetricLimits metricdb.Limits
+
+	MetricGraphMaxQueries int
 
 	BugzillaURL       string
 	BugzillaSearch    string
 	BugzillaTokenPath string
+	// BugzillaExcludeKeywords are the keywords of bugs that are not indexed
+	BugzillaExcludeKeywords []string
 
 	// jira
 	JiraURL        string
 	JiraSearch     string
 	JiraTokenPath  string
+	JiraProjects   []string
 	issuesPath     string
 	issues         *jira.CommentStore
 	issueURIPrefix *url.URL
+	// jiraClient is used to validate queries on the debug listener
+	jiraClient *jira.Client
 
 	NoIndex bool
 
-	generator CommandGenerator
+	SkipAbortedJobs   bool
+	IndexConcurrency  int
+	IndexSuccessJunit bool
+	IndexE2ELog       bool
+	IndexArtifacts    []string
+	MustGather        prow.MustGatherOptions
+	TokenFilters      bool
+
+	// per search type defaults for requests that do not specify a value
+	DefaultContext    map[string]int
+	DefaultMaxMatches map[string]int
+
+	// ChartDefaultsPath is a file of the searches charted when a request has none
+	ChartDefaultsPath string
+	chartSearches     []chartSearch
+
+	// JobAliasesPath is a file of short names for job name filters
+	JobAliasesPath string
+	jobAliases     jobAliases
+
+	// installOnly requests are scoped to this search type and pattern
+	InstallSearchType string
+	InstallPattern    string
+
+	// FreshnessWarningThreshold is how far the index may be behind before results pages
+	// show a warning, or zero to never warn.
+	FreshnessWarningThreshold time.Duration
+
+	// RipgrepPath is the ripgrep binary used for searches
+	RipgrepPath string
+	generator   CommandGenerator
+
+	// MaxConcurrentSearches is the number of search requests that may run at once, or
+	// zero for no limit
+	MaxConcurrentSearches int
+	searches              *semaphore.Weighted
+
+	// groupedResults caches recent grouped search results for paging
+	groupedResults *utilcache.LRUExpireCache
+	// tokenFilters caches the token filters of build directories
+	tokenFilters *tokenFilterCache
 
 	jobsIndex    *pathIndex
 	jobAccessor  prow.JobAccessor
@@ -171,59 +283,8 @@ func (o *options) Stats() IndexStats {
 	// jira
 	is := o.issues.Stats()
 
-	var totalJobs, failedJobs int
 	jobs, _ := o.jobAccessor.List(labels.Everything())
-	var buckets []JobCountBucket
-	if len(jobs) > 1 {
-		var min, max int64 = math.MaxInt64, 0
-		for _, job := range jobs {
-			t := job.Status.CompletionTime.Time.Unix()
-			if t <= 0 {
-				t = job.Status.StartTime.Time.Unix()
-			}
-			if t < 0 {
-				continue
-			}
-			if t < min {
-				min = t
-			}
-			if t > max {
-				max = t
-			}
-		}
-		begin := time.Unix(min, 0).Truncate(time.Hour).Unix()
-		bins := (max-begin)/3600 + 1
-		buckets = make([]JobCountBucket, bins)
-		for i := range buckets {
-			buckets[i].T = begin + int64(i)*3600
-		}
-		for _, job := range jobs {
-			failed := job.Status.State != "success"
-			totalJobs++
-			if failed {
-				failedJobs++
-			}
-			t := job.Status.CompletionTime.Time.Unix()
-			if t <= 0 {
-				t = job.Status.StartTime.Time.Unix()
-			}
-			if t <= 0 {
-				continue
-			}
-			i := (t - begin) / 3600
-			buckets[i].Jobs++
-			if failed {
-				buckets[i].FailedJobs++
-			}
-		}
-	} else {
-		for _, job := range jobs {
-			totalJobs++
-			if job.Status.State != "success" {
-				failedJobs++
-			}
-		}
-	}
+	totalJobs, failedJobs, buckets := jobCountBuckets(jobs)
 	return IndexStats{
 		Entries:    j.Entries,
 		Size:       j.Size,
@@ -235,80 +296,177 @@ func (o *options) Stats() IndexStats {
 	}
 }
 
+// jobCountBuckets returns the total and failed jobs, along with the number of total and
+// failed jobs in each hour between the oldest and newest job. A job is placed by its
+// completion time, or by its start time if it has not completed. Buckets are only
+// returned when more than one job is provided and at least one job has a valid time.
+func jobCountBuckets(jobs []*prow.Job) (totalJobs, failedJobs int, buckets []JobCountBucket) {
+	jobTime := func(job *prow.Job) int64 {
+		t := job.Status.CompletionTime.Time.Unix()
+		if t <= 0 {
+			t = job.Status.StartTime.Time.Unix()
+		}
+		return t
+	}
+
+	for _, job := range jobs {
+		totalJobs++
+		if job.Status.State != "success" {
+			failedJobs++
+		}
+	}
+	if len(jobs) <= 1 {
+		return totalJobs, failedJobs, nil
+	}
+
+	var min, max int64 = math.MaxInt64, 0
+	for _, job := range jobs {
+		t := jobTime(job)
+		if t <= 0 {
+			continue
+		}
+		if t < min {
+			min = t
+		}
+		if t > max {
+			max = t
+		}
+	}
+	if max == 0 {
+		return totalJobs, failedJobs, nil
+	}
+
+	begin := time.Unix(min, 0).Truncate(time.Hour).Unix()
+	bins := (max-begin)/3600 + 1
+	buckets = make([]JobCountBucket, bins)
+	for i := range buckets {
+		buckets[i].T = begin + int64(i)*3600
+	}
+	for _, job := range jobs {
+		t := jobTime(job)
+		if t <= 0 {
+			continue
+		}
+		i := (t - begin) / 3600
+		buckets[i].Jobs++
+		if job.Status.State != "success" {
+			buckets[i].FailedJobs++
+		}
+	}
+	return totalJobs, failedJobs, buckets
+}
+
 func (o *options) RipgrepSourceArguments(index *Index, jobNames sets.String) ([]string, []string, error) {
 	var args []string
 	var additionalPaths []string
+	if len(index.buildID) > 0 {
+		// a single build only has job files to search
+		switch index.SearchType {
+		case "bug", "issue", "bug+issue":
+			return nil, nil, fmt.Errorf("job can only be used when searching job files")
+		}
+		return o.jobSearchArguments(index, jobNames, nil, nil)
+	}
 	switch index.SearchType {
 	case "bug":
 		if o.bugURIPrefix == nil {
 			return nil, nil, fmt.Errorf("searching on bugs is not enabled")
 		}
+		if index.ExcludesType("bug") {
+			return nil, nil, nil
+		}
 		return []string{"--glob", "bug-*"}, []string{o.bugsPath}, nil
 	//jira
 	case "issue":
 		if o.issueURIPrefix == nil {
 			return nil, nil, fmt.Errorf("searching on issues is not enabled")
 		}
+		if index.ExcludesType("issue") {
+			return nil, nil, nil
+		}
 		return []string{"--glob", "issue__*"}, []string{o.issuesPath}, nil
 	case "bug+issue":
-		if o.bugURIPrefix != nil {
+		if o.bugURIPrefix != nil && !index.ExcludesType("bug") {
 			args = []string{"--glob", "bug-*"}
 			additionalPaths = []string{o.bugsPath}
 		}
-		if o.issueURIPrefix != nil {
+		if o.issueURIPrefix != nil && !index.ExcludesType("issue") {
 			args = append(args, []string{"--glob", "issue__*"}...)
 			additionalPaths = append(additionalPaths, []string{o.issuesPath}...)
 		}
 		return args, additionalPaths, nil
 	case "bug+junit":
-		if o.bugURIPrefix != nil {
+		if o.bugURIPrefix != nil && !index.ExcludesType("bug") {
 			args = []string{"--glob", "bug-*"}
 			additionalPaths = []string{o.bugsPath}
 		}
-		if o.jobURIPrefix == nil {
-			return nil, nil, fmt.Errorf("searching on jobs is not enabled")
-		}
-		paths, err := o.jobsIndex.SearchPaths(index, jobNames)
-		if err != nil {
-			return nil, nil, err
-		}
-		if paths == nil {
-			if names := o.jobsIndex.FilenamesForSearchType(index.SearchType); len(names) > 0 {
-				for _, name := range names {
-					args = append(args, "--glob", name+"*")
-				}
-				args = append(args, o.jobsPath)
-			}
-		}
-		return args, append(paths, additionalPaths...), nil
-	case "all", "bug+issue+junit":
-		if o.bugURIPrefix != nil {
+		return o.jobSearchArguments(index, jobNames, args, additionalPaths)
+	case "all", "bug+issue+junit", "everything":
+		if o.bugURIPrefix != nil && !index.ExcludesType("bug") {
 			args = []string{"--glob", "bug-*"}
 			additionalPaths = []string{o.bugsPath}
 		}
-		if o.issueURIPrefix != nil {
+		if o.issueURIPrefix != nil && !index.ExcludesType("issue") {
 			args = append(args, []string{"--glob", "issue__*"}...)
 			additionalPaths = append(additionalPaths, []string{o.issuesPath}...)
 		}
 		fallthrough
 	default:
-		if o.jobURIPrefix == nil {
-			return nil, nil, fmt.Errorf("searching on jobs is not enabled")
-		}
-		paths, err := o.jobsIndex.SearchPaths(index, jobNames)
-		if err != nil {
-			return nil, nil, err
-		}
-		if paths == nil {
-			if names := o.jobsIndex.FilenamesForSearchType(index.SearchType); len(names) > 0 {
-				for _, name := range names {
-					args = append(args, "--glob", name+"*")
+		return o.jobSearchArguments(index, jobNames, args, additionalPaths)
+	}
+}
+
+// jobSearchArguments appends the arguments and paths to search the job files for the
+// search type of index. The indexed job files are searched directly, or if the job
+// index has not been built yet, the jobs directory is searched for the file names of
+// the search type.
+func (o *options) jobSearchArguments(index *Index, jobNames sets.String, args, additionalPaths []string) ([]string, []string, error) {
+	if o.jobURIPrefix == nil {
+		return nil, nil, fmt.Errorf("searching on jobs is not enabled")
+	}
+	paths, err := o.jobsIndex.SearchPaths(index, jobNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	if paths == nil {
+		if names := o.jobsIndex.FilenamesForIndex(index); len(names) > 0 {
+			for _, name := range names {
+				if len(index.buildID) > 0 {
+					jobName := index.jobName
+					if len(jobName) == 0 {
+						jobName = "*"
+					}
+					name = path.Join("**", jobName, index.buildID, name)
 				}
-				args = append(args, o.jobsPath)
+				args = append(args, "--glob", name+"*")
 			}
+			args = append(args, o.jobsPath)
+		}
+	}
+	return args, append(paths, additionalPaths...), nil
+}
+
+// indexArtifacts returns the kinds of job artifacts to index.
+func (o *options) indexArtifacts() []string {
+	artifacts := append([]string(nil), o.IndexArtifacts...)
+	if o.IndexE2ELog && !sets.NewString(artifacts...).Has("e2e-log") {
+		artifacts = append(artifacts, "e2e-log")
+	}
+	return artifacts
+}
+
+// bucketForJobURI returns the bucket of a job URI resolved from the job URI prefix, or
+// the first index bucket if the URI does not name one.
+func (o *options) bucketForJobURI(uri *url.URL) string {
+	if o.jobURIPrefix != nil && strings.HasPrefix(uri.Path, o.jobURIPrefix.Path) {
+		if bucket := strings.SplitN(strings.TrimPrefix(uri.Path, o.jobURIPrefix.Path), "/", 2)[0]; len(bucket) > 0 {
+			return bucket
 		}
-		return args, append(paths, additionalPaths...), nil
 	}
+	if len(o.IndexBuckets) > 0 {
+		return o.IndexBuckets[0]
+	}
+	return ""
 }
 
 func (o *options) MetadataFor(path string) (Result, error) {
@@ -450,6 +608,10 @@ func (o *options) MetadataFor(path string) (Result, error) {
 			result.FileType = "build-log"
 		case "junit.failures":
 			result.FileType = "junit"
+		case "must-gather.txt":
+			result.FileType = "must-gather"
+		case "e2e.log":
+			result.FileType = "e2e-log"
 		default:
 			result.FileType = parts[last]
 		}
@@ -476,6 +638,12 @@ func (o *options) MetadataFor(path string) (Result, error) {
 
 		result.LastModified = o.jobsIndex.LastModified(path)
 
+		if job, err := o.jobAccessor.GetBuild(result.Name, parts[last-1]); err == nil {
+			if start, end := job.Status.StartTime.Time, job.Status.CompletionTime.Time; !start.IsZero() && end.After(start) {
+				result.Duration = end.Sub(start)
+			}
+		}
+
 		return result, nil
 	default:
 		return result, fmt.Errorf("unrecognized result path: %s", path)
@@ -528,7 +696,134 @@ func (h *Health) ServeReady(readynessChecks ...ReadinessCheck) {
 	})
 }
 
+// ServeLive starts serving the liveness endpoint, which fails if any check fails so that
+// a wedged process is restarted
+func (h *Health) ServeLive(livenessChecks ...ReadinessCheck) {
+	h.healthMux.HandleFunc("/healthz/live", func(w http.ResponseWriter, r *http.Request) {
+		for _, livenessCheck := range livenessChecks {
+			if !livenessCheck() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, "LivenessCheck failed")
+				return
+			}
+		}
+		fmt.Fprint(w, "OK")
+	})
+}
+
+// shutdownTimeout is how long in-flight requests and disk writes are given to complete
+// when the process is asked to stop.
+const shutdownTimeout = 30 * time.Second
+
+// pathIndexInterval is how often the index of job files is reloaded from disk.
+const pathIndexInterval = 3 * time.Minute
+
+// pathIndexLivenessIntervals is how many reload intervals may pass without a successful
+// reload of the job file index before the process is considered wedged.
+const pathIndexLivenessIntervals = 5
+
+// pathIndexLive returns true if the job file index has been loaded recently, or if the
+// process started recently enough that the first load may still be running.
+func pathIndexLive(index *pathIndex, started, now time.Time) bool {
+	last, _ := index.Freshness()
+	if last.IsZero() {
+		last = started
+	}
+	return now.Sub(last) <= pathIndexLivenessIntervals*pathIndexInterval
+}
+
 func (o *options) Run() error {
+	started := time.Now()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	// stores tracks the goroutines that write to disk, so that in-flight writes can finish
+	// before the process exits
+	var stores sync.WaitGroup
+	runStore := func(fn func()) {
+		stores.Add(1)
+		go func() {
+			defer stores.Done()
+			fn()
+		}()
+	}
+
+	for searchType, value := range o.DefaultContext {
+		if value < -1 || value > 15 {
+			return fmt.Errorf("--default-context for %s must be a number between -1 and 15", searchType)
+		}
+	}
+	for searchType, value := range o.DefaultMaxMatches {
+		if value < 0 || value > 500 {
+			return fmt.Errorf("--default-max-matches for %s must be a number between 0 and 500", searchType)
+		}
+	}
+	if o.MetricLimits.VacuumThreshold <= 0 {
+		return fmt.Errorf("--metric-db-vacuum-threshold must be positive")
+	}
+	if o.MetricLimits.VacuumFreeFraction < 0 || o.MetricLimits.VacuumFreeFraction >= 1 {
+		return fmt.Errorf("--metric-db-vacuum-free-fraction must be at least 0 and less than 1")
+	}
+	for _, artifact := range o.IndexArtifacts {
+		if !sets.NewString(prow.ArtifactKinds...).Has(artifact) {
+			return fmt.Errorf("--index-artifacts must be a list of %s", strings.Join(prow.ArtifactKinds, ", "))
+		}
+	}
+	if o.IndexConcurrency <= 0 {
+		return fmt.Errorf("--index-concurrency must be positive")
+	}
+	if o.MetricGraphMaxQueries <= 0 {
+		return fmt.Errorf("--metric-graph-max-queries must be positive")
+	}
+	if o.MaxConcurrentSearches < 0 {
+		return fmt.Errorf("--max-concurrent-searches must be non-negative")
+	}
+	if o.MaxConcurrentSearches > 0 {
+		o.searches = semaphore.NewWeighted(int64(o.MaxConcurrentSearches))
+	}
+	if o.MetricLimits.MaxSizeBytes < 0 {
+		return fmt.Errorf("--metric-db-max-size must be non-negative")
+	}
+	if o.MetricLimits.ScrapeBudget < 0 {
+		return fmt.Errorf("--metric-scrape-budget must be non-negative")
+	}
+	if o.FreshnessWarningThreshold < 0 {
+		return fmt.Errorf("--freshness-warning-threshold must be non-negative")
+	}
+	if len(o.InstallPattern) > 0 {
+		if _, err := compileSearch(o.InstallPattern); err != nil {
+			return fmt.Errorf("--install-pattern is not a valid regular expression: %v", err)
+		}
+	}
+	if len(o.ChartDefaultsPath) > 0 {
+		searches, err := loadChartSearches(o.ChartDefaultsPath)
+		if err != nil {
+			return fmt.Errorf("--chart-defaults-file is invalid: %v", err)
+		}
+		o.chartSearches = searches
+	}
+	if len(o.JobAliasesPath) > 0 {
+		aliases, err := loadJobAliases(o.JobAliasesPath)
+		if err != nil {
+			return fmt.Errorf("--job-aliases-file is invalid: %v", err)
+		}
+		o.jobAliases = aliases
+	}
+
+	if o.JobMetadataMaxAge == 0 {
+		o.JobMetadataMaxAge = o.MaxAge
+	}
+	if o.MaxAge > 0 && (o.JobMetadataMaxAge < 0 || o.JobMetadataMaxAge < o.MaxAge) {
+		return fmt.Errorf("--job-metadata-max-age must not be less than --max-age")
+	}
+
+	// fail before indexing starts if searches cannot run
+	generator, err := NewCommandGenerator(o.RipgrepPath, o.Path, o)
+	if err != nil {
+		return err
+	}
+	o.generator = generator
+
 	jobURIPrefix, err := url.Parse(o.JobURIPrefix)
 	if err != nil {
 		klog.Exitf("Unable to parse --job-uri-prefix: %v", err)
@@ -583,9 +878,8 @@ func (o *options) Run() error {
 					Quicksearch: o.BugzillaSearch,
 				}
 			},
-			func(info *bugzilla.BugInfo) bool {
-				return !contains(info.Keywords, "Security")
-			},
+			excludeBugKeywords(o.BugzillaExcludeKeywords),
+			filepath.Join(o.bugsPath, "informer-state.json"),
 		)
 		lister := bugzilla.NewBugLister(bzInformer.GetIndexer())
 		if err := os.MkdirAll(o.bugsPath, 0777); err != nil {
@@ -596,10 +890,12 @@ func (o *options) Run() error {
 
 		o.bugs = store
 
-		ctx := context.Background()
 		go bzInformer.Run(ctx.Done())
 		go store.Run(ctx, bzInformer)
-		go diskStore.Run(ctx, lister, store, o.NoIndex)
+		runStore(func() { diskStore.Run(ctx, lister, store, o.NoIndex) })
+		if !o.NoIndex {
+			go diskStore.RunCompaction(ctx, 15*time.Minute)
+		}
 		klog.Infof("Started indexing bugzilla %s with query %q", o.BugzillaURL, o.BugzillaSearch)
 	} else {
 		o.bugs = bugzilla.NewCommentStore(nil, 0, false, nil)
@@ -632,6 +928,7 @@ func (o *options) Run() error {
 		c := &jira.Client{
 			Client: jc,
 		}
+		o.jiraClient = c
 		jiraInformer = jira.NewInformer(
 			c,
 			10*time.Minute,
@@ -642,7 +939,7 @@ func (o *options) Run() error {
 					Jql: o.JiraSearch,
 				}
 			},
-			jira.FilterPrivateIssues,
+			jira.AndFilter(jira.FilterPrivateIssues, jira.FilterByProject(o.JiraProjects...)),
 		)
 		jiraLister := jira.NewIssueLister(jiraInformer.GetIndexer())
 		if err := os.MkdirAll(o.issuesPath, 0777); err != nil {
@@ -654,10 +951,9 @@ func (o *options) Run() error {
 
 		o.issues = jiraStore
 
-		ctx := context.Background()
 		go jiraInformer.Run(ctx.Done())
 		go jiraStore.Run(ctx, jiraInformer)
-		go jiraDiskStore.Run(ctx, jiraLister, jiraStore, o.NoIndex)
+		runStore(func() { jiraDiskStore.Run(ctx, jiraLister, jiraStore, o.NoIndex) })
 		klog.Infof("Started indexing jira %s with query %q", o.JiraURL, o.JiraSearch)
 	} else {
 		o.issues = jira.NewCommentStore(nil, 0, nil)
@@ -683,21 +979,35 @@ func (o *options) Run() error {
 		c := prow.NewClient(*deckURI)
 		c.Client = &http.Client{Transport: rt}
 
-		gcsClient, err := storage.NewClient(context.Background(), gcpoption.WithoutAuthentication())
+		gcsClient, err := storage.NewClient(ctx, gcpoption.WithoutAuthentication())
 		if err != nil {
 			klog.Exitf("Unable to build gcs client: %v", err)
 		}
 
 		var initialJobLister prow.JobLister
-		if len(o.IndexBucket) > 0 {
-			initialJobLister = prow.ListerFunc(func(ctx context.Context) ([]*prow.Job, error) {
-				return prow.ReadFromIndex(ctx, gcsClient, o.IndexBucket, "job-state", o.MaxAge, *u)
-			})
+		var bucketListers prow.MultiLister
+		for _, bucket := range o.IndexBuckets {
+			if len(bucket) == 0 {
+				continue
+			}
+			bucket := bucket
+			bucketListers = append(bucketListers, prow.ListerFunc(func(ctx context.Context) ([]*prow.Job, error) {
+				return prow.ReadFromIndex(ctx, gcsClient, bucket, "job-state", o.JobMetadataMaxAge, *u)
+			}))
+		}
+		if len(bucketListers) > 0 {
+			initialJobLister = bucketListers
 		}
-		informer = prow.NewInformer(2*time.Minute, 30*time.Minute, o.MaxAge, initialJobLister, c)
+		informer = prow.NewInformer(2*time.Minute, 30*time.Minute, o.JobMetadataMaxAge, initialJobLister, c)
 		lister := prow.NewLister(informer.GetIndexer())
 		o.jobAccessor = lister
-		store = prow.NewDiskStore(gcsClient, o.jobsPath, o.MaxAge)
+		store = prow.NewDiskStore(gcsClient, o.jobsPath, o.MaxAge, prow.IndexOptions{
+			SkipAborted:  o.SkipAbortedJobs,
+			MustGather:   o.MustGather,
+			TokenFilter:  o.TokenFilters,
+			SuccessJunit: o.IndexSuccessJunit,
+			Artifacts:    o.indexArtifacts(),
+		})
 
 		if err := os.MkdirAll(o.jobsPath, 0777); err != nil {
 			return fmt.Errorf("unable to create directory for artifact: %w", err)
@@ -706,12 +1016,13 @@ func (o *options) Run() error {
 		h := store.Handler()
 		informer.AddEventHandler(h)
 
-		ctx := context.Background()
 		go informer.Run(ctx.Done())
-		go func() {
-			cache.WaitForCacheSync(ctx.Done(), informer.HasSynced)
-			store.Run(ctx, lister, indexedPaths, o.NoIndex, 40)
-		}()
+		runStore(func() {
+			if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+				return
+			}
+			store.Run(ctx, lister, indexedPaths, o.NoIndex, o.IndexConcurrency)
+		})
 
 		klog.Infof("Started indexing prow jobs %s", o.DeckURI)
 	} else {
@@ -720,37 +1031,50 @@ func (o *options) Run() error {
 
 	// enable metrics
 	if len(o.MetricDBPath) > 0 {
-		o.metrics, err = metricdb.New(o.MetricDBPath, url.URL{}, o.MetricMaxAge)
+		o.metrics, err = metricdb.New(o.MetricDBPath, url.URL{}, o.MetricMaxAge, o.MetricLimits)
 		if err != nil {
 			return err
 		}
-		go wait.Forever(func() {
+		go wait.Until(func() {
 			if err := o.metrics.Run(); err != nil {
 				klog.Fatalf("Unable to read metrics: %v", err)
 			}
-		}, 3*time.Minute)
+		}, 3*time.Minute, ctx.Done())
 	}
-	g := &httpgraph.Server{DB: o.metrics}
+	g := &httpgraph.Server{DB: o.metrics, MaxQueries: o.MetricGraphMaxQueries, JobLabel: o.jobAliases.Label}
 
-	go wait.Forever(func() {
+	go wait.Until(func() {
 		if err := indexedPaths.Load(); err != nil {
 			klog.Fatalf("Unable to index: %v", err)
 		}
-	}, 3*time.Minute)
+	}, pathIndexInterval, ctx.Done())
 
-	o.generator, err = NewCommandGenerator(o.Path, o)
-	if err != nil {
-		return err
+	o.groupedResults = utilcache.NewLRUExpireCache(32)
+	if o.TokenFilters {
+		o.tokenFilters = newTokenFilterCache(tokenFilterCacheBytes)
 	}
 
+	var servers []*http.Server
 	if len(o.DebugAddr) > 0 {
+		http.HandleFunc("/debug/jira/validate", o.handleJiraValidate)
+		http.HandleFunc("/debug/refresh", o.handleRefresh)
+		server := &http.Server{Addr: o.DebugAddr}
+		servers = append(servers, server)
 		go func() {
-			if err := http.ListenAndServe(o.DebugAddr, nil); err != nil {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				klog.Exitf("Debug server exited: %v", err)
 			}
 		}()
 	}
 	if len(o.ListenAddr) > 0 {
+		var accessLog *accessLog
+		if len(o.AccessLogPath) > 0 {
+			accessLog, err = openAccessLog(o.AccessLogPath)
+			if err != nil {
+				return fmt.Errorf("unable to open --access-log-file: %v", err)
+			}
+			defer accessLog.Close()
+		}
 		mux := mux.NewRouter()
 
 		h := prometheus.NewHistogramVec(prometheus.HistogramOpts{
@@ -760,41 +1084,88 @@ func (o *options) Run() error {
 		prometheus.MustRegister(h)
 		handle := func(path string, handler http.Handler) {
 			handler = promhttp.InstrumentHandlerDuration(h.MustCurryWith(prometheus.Labels{"path": path}), handler)
+			handler = accessLog.Handler(handler)
+			handler = withRequestID(handler)
 			mux.Handle(path, handler)
 		}
 		health := NewHealth()
 		mux.PathPrefix("/static/").Handler(static.Handler("/static/"))
 		handle("/graph/metrics", http.HandlerFunc(g.HandleGraph))
 		handle("/graph/api/metrics/job", http.HandlerFunc(g.HandleAPIJobGraph))
+		handle("/graph/api/metrics/names", http.HandlerFunc(g.HandleAPIMetricNames))
 		handle("/chart", http.HandlerFunc(o.handleChart))
 		handle("/chart.png", http.HandlerFunc(o.handleChartPNG))
 		handle("/config", http.HandlerFunc(o.handleConfig))
+		handle("/status", http.HandlerFunc(o.handleStatus))
 		handle("/jobs", http.HandlerFunc(o.handleJobs))
+		handle("/api/jobs/names", http.HandlerFunc(o.handleJobNames))
+		handle("/api/similar", http.HandlerFunc(o.handleSimilarFailures))
 		handle("/search", http.HandlerFunc(o.handleSearch))
+		handle("/search.csv", http.HandlerFunc(o.handleSearchCSV))
+		handle("/permalink", http.HandlerFunc(o.handlePermalink))
 		handle("/v2/search", http.HandlerFunc(o.handleSearchV2))
+		handle("/v2/search/summary", http.HandlerFunc(o.handleSearchSummary))
+		handle("/v2/search/exists", http.HandlerFunc(o.handleSearchExists))
 		handle("/metrics", promhttp.Handler())
+		handle("/metrics/jobs", o.jobMetricsHandler())
 		handle("/", http.HandlerFunc(o.handleIndex))
 
+		server := &http.Server{Addr: o.ListenAddr, Handler: mux}
+		servers = append(servers, server)
 		go func() {
 			klog.Infof("Listening on %s", o.ListenAddr)
-			if err := http.ListenAndServe(o.ListenAddr, mux); err != nil {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				klog.Exitf("Server exited: %v", err)
 			}
 		}()
 		health.ServeReady(func() bool {
-			if !informer.HasSynced() || !jiraInformer.HasSynced() || !bzInformer.HasSynced() {
-				return false
-			}
-			// TODO - find a better way to check this
-			// if the disk cache is deleted, we want to build it first, before accepting traffic. The check value is not
-			// 0 since is expected for the queue to be constantly populated with new items.
-			if store.QueueLen() > 10000 {
-				return true
+			for _, i := range []cache.SharedIndexInformer{informer, jiraInformer, bzInformer} {
+				if i != nil && !i.HasSynced() {
+					return false
+				}
 			}
-			return false
+			// if the disk cache is deleted, we want to build it first, before accepting traffic
+			return store == nil || store.HasSynced()
+		})
+		health.ServeLive(func() bool {
+			return pathIndexLive(indexedPaths, started, time.Now())
 		})
 	}
-	select {}
+
+	<-ctx.Done()
+	stop()
+	klog.Infof("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			klog.Errorf("Unable to shut down server %s: %v", server.Addr, err)
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		stores.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		return fmt.Errorf("disk writes did not complete within %s", shutdownTimeout)
+	}
+	klog.Infof("Shut down")
+	return nil
+}
+
+// excludeBugKeywords returns a bug filter that rejects any bug with one of keywords.
+func excludeBugKeywords(keywords []string) func(*bugzilla.BugInfo) bool {
+	return func(info *bugzilla.BugInfo) bool {
+		for _, keyword := range keywords {
+			if contains(info.Keywords, keyword) {
+				return false
+			}
+		}
+		return true
+	}
 }
 
 func contains(arr []string, s string) bool {
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/openshift/ci-search/bugzilla"
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_jobCountBuckets(t *testing.T) {
+	hour := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	job := func(state string, started, completed time.Time) *prow.Job {
+		return &prow.Job{Status: prow.JobStatus{
+			State:          state,
+			StartTime:      metav1.Time{Time: started},
+			CompletionTime: metav1.Time{Time: completed},
+		}}
+	}
+
+	tests := []struct {
+		name        string
+		jobs        []*prow.Job
+		wantTotal   int
+		wantFailed  int
+		wantBuckets []JobCountBucket
+	}{
+		{
+			name: "no jobs",
+		},
+		{
+			name:       "single job has no buckets",
+			jobs:       []*prow.Job{job("failure", hour, hour.Add(time.Minute))},
+			wantTotal:  1,
+			wantFailed: 1,
+		},
+		{
+			name: "jobs without times have no buckets",
+			jobs: []*prow.Job{
+				job("failure", time.Time{}, time.Time{}),
+				job("success", time.Time{}, time.Time{}),
+			},
+			wantTotal:  2,
+			wantFailed: 1,
+		},
+		{
+			name: "completion time with start time fallback",
+			jobs: []*prow.Job{
+				job("success", hour.Add(-time.Hour), hour.Add(10*time.Minute)),
+				job("failure", hour.Add(2*time.Hour+5*time.Minute), time.Time{}),
+				job("error", hour.Add(30*time.Minute), hour.Add(50*time.Minute)),
+				job("failure", time.Time{}, time.Time{}),
+			},
+			wantTotal:  4,
+			wantFailed: 3,
+			wantBuckets: []JobCountBucket{
+				{T: hour.Unix(), Jobs: 2, FailedJobs: 1},
+				{T: hour.Add(time.Hour).Unix()},
+				{T: hour.Add(2 * time.Hour).Unix(), Jobs: 1, FailedJobs: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, failed, buckets := jobCountBuckets(tt.jobs)
+			if total != tt.wantTotal || failed != tt.wantFailed {
+				t.Errorf("jobCountBuckets() total=%d failed=%d, want total=%d failed=%d", total, failed, tt.wantTotal, tt.wantFailed)
+			}
+			if !reflect.DeepEqual(buckets, tt.wantBuckets) {
+				t.Errorf("jobCountBuckets() buckets=%#v, want %#v", buckets, tt.wantBuckets)
+			}
+		})
+	}
+}
+
+func Test_RipgrepSourceArguments_buildLog(t *testing.T) {
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	bugURIPrefix, _ := url.Parse("https://bugzilla.example.com/show_bug.cgi")
+	o := &options{
+		jobsPath:     "/var/lib/ci-search/jobs",
+		bugsPath:     "/var/lib/ci-search/bugs",
+		jobURIPrefix: jobURIPrefix,
+		bugURIPrefix: bugURIPrefix,
+		jobsIndex:    &pathIndex{base: "/var/lib/ci-search/jobs"},
+	}
+	index := &Index{SearchType: "build-log"}
+
+	// before the index is loaded the jobs directory is globbed for build logs only
+	args, paths, err := o.RipgrepSourceArguments(index, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"--glob", "build-log.txt*", "/var/lib/ci-search/jobs"}; !reflect.DeepEqual(args, want) || len(paths) != 0 {
+		t.Errorf("unexpected arguments %v and paths %v", args, paths)
+	}
+
+	now := time.Now()
+	o.jobsIndex.ordered = []pathAge{
+		{path: "logs/job-a/1/build-log.txt", index: "build-log.txt", age: now},
+		{path: "logs/job-a/1/junit.failures", index: "junit.failures", age: now},
+		{path: "logs/job-b/2/build-log.txt", index: "build-log.txt", age: now},
+	}
+	index.JobFilter = func(name string) bool { return name == "job-a" }
+	jobNames := sets.NewString()
+	args, paths, err = o.RipgrepSourceArguments(index, jobNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/var/lib/ci-search/jobs/logs/job-a/1/build-log.txt"}; len(args) != 0 || !reflect.DeepEqual(paths, want) {
+		t.Errorf("unexpected arguments %v and paths %v", args, paths)
+	}
+	if !jobNames.Equal(sets.NewString("job-a")) {
+		t.Errorf("unexpected job names: %v", jobNames.List())
+	}
+}
+
+func Test_RipgrepSourceArguments_searchTypes(t *testing.T) {
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	bugURIPrefix, _ := url.Parse("https://bugzilla.example.com/show_bug.cgi")
+	issueURIPrefix, _ := url.Parse("https://issues.example.com/browse/")
+	o := &options{
+		jobsPath:       "/var/lib/ci-search/jobs",
+		bugsPath:       "/var/lib/ci-search/bugs",
+		issuesPath:     "/var/lib/ci-search/issues",
+		jobURIPrefix:   jobURIPrefix,
+		bugURIPrefix:   bugURIPrefix,
+		issueURIPrefix: issueURIPrefix,
+		jobsIndex:      &pathIndex{base: "/var/lib/ci-search/jobs"},
+	}
+	bugsAndIssues := []string{"/var/lib/ci-search/bugs", "/var/lib/ci-search/issues"}
+	for _, tt := range []struct {
+		searchType string
+		wantArgs   []string
+		wantPaths  []string
+	}{
+		{
+			searchType: "bug",
+			wantArgs:   []string{"--glob", "bug-*"},
+			wantPaths:  []string{"/var/lib/ci-search/bugs"},
+		},
+		{
+			searchType: "issue",
+			wantArgs:   []string{"--glob", "issue__*"},
+			wantPaths:  []string{"/var/lib/ci-search/issues"},
+		},
+		{
+			searchType: "bug+issue",
+			wantArgs:   []string{"--glob", "bug-*", "--glob", "issue__*"},
+			wantPaths:  bugsAndIssues,
+		},
+		{
+			searchType: "bug+junit",
+			wantArgs:   []string{"--glob", "bug-*", "--glob", "junit.failures*", "/var/lib/ci-search/jobs"},
+			wantPaths:  []string{"/var/lib/ci-search/bugs"},
+		},
+		{
+			searchType: "bug+issue+junit",
+			wantArgs:   []string{"--glob", "bug-*", "--glob", "issue__*", "--glob", "junit.failures*", "/var/lib/ci-search/jobs"},
+			wantPaths:  bugsAndIssues,
+		},
+		{
+			searchType: "junit",
+			wantArgs:   []string{"--glob", "junit.failures*", "/var/lib/ci-search/jobs"},
+		},
+		{
+			searchType: "build-log",
+			wantArgs:   []string{"--glob", "build-log.txt*", "/var/lib/ci-search/jobs"},
+		},
+		{
+			searchType: "must-gather",
+			wantArgs:   []string{"--glob", "must-gather.txt*", "/var/lib/ci-search/jobs"},
+		},
+		{
+			searchType: "e2e-log",
+			wantArgs:   []string{"--glob", "e2e.log*", "/var/lib/ci-search/jobs"},
+		},
+		{
+			searchType: "everything",
+			wantArgs:   []string{"--glob", "bug-*", "--glob", "issue__*", "--glob", "junit.failures*", "--glob", "build-log.txt*", "--glob", "must-gather.txt*", "--glob", "e2e.log*", "/var/lib/ci-search/jobs"},
+			wantPaths:  bugsAndIssues,
+		},
+		{
+			searchType: "all",
+			wantArgs:   []string{"--glob", "bug-*", "--glob", "issue__*", "--glob", "junit.failures*", "--glob", "build-log.txt*", "--glob", "must-gather.txt*", "--glob", "e2e.log*", "/var/lib/ci-search/jobs"},
+			wantPaths:  bugsAndIssues,
+		},
+	} {
+		t.Run(tt.searchType, func(t *testing.T) {
+			args, paths, err := o.RipgrepSourceArguments(&Index{SearchType: tt.searchType}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) || !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("unexpected arguments %v and paths %v", args, paths)
+			}
+		})
+	}
+}
+
+func Test_RipgrepSourceArguments_excludeType(t *testing.T) {
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	bugURIPrefix, _ := url.Parse("https://bugzilla.example.com/show_bug.cgi")
+	issueURIPrefix, _ := url.Parse("https://issues.example.com/browse/")
+	o := &options{
+		jobsPath:       "/var/lib/ci-search/jobs",
+		bugsPath:       "/var/lib/ci-search/bugs",
+		issuesPath:     "/var/lib/ci-search/issues",
+		jobURIPrefix:   jobURIPrefix,
+		bugURIPrefix:   bugURIPrefix,
+		issueURIPrefix: issueURIPrefix,
+		jobsIndex:      &pathIndex{base: "/var/lib/ci-search/jobs"},
+	}
+	for _, tt := range []struct {
+		excludeTypes []string
+		wantArgs     []string
+		wantPaths    []string
+	}{
+		{
+			wantArgs:  []string{"--glob", "bug-*", "--glob", "issue__*", "--glob", "junit.failures*", "--glob", "build-log.txt*", "--glob", "must-gather.txt*", "--glob", "e2e.log*", "/var/lib/ci-search/jobs"},
+			wantPaths: []string{"/var/lib/ci-search/bugs", "/var/lib/ci-search/issues"},
+		},
+		{
+			excludeTypes: []string{"bug"},
+			wantArgs:     []string{"--glob", "issue__*", "--glob", "junit.failures*", "--glob", "build-log.txt*", "--glob", "must-gather.txt*", "--glob", "e2e.log*", "/var/lib/ci-search/jobs"},
+			wantPaths:    []string{"/var/lib/ci-search/issues"},
+		},
+		{
+			excludeTypes: []string{"issue", "build-log", "must-gather", "e2e-log"},
+			wantArgs:     []string{"--glob", "bug-*", "--glob", "junit.failures*", "/var/lib/ci-search/jobs"},
+			wantPaths:    []string{"/var/lib/ci-search/bugs"},
+		},
+	} {
+		t.Run(fmt.Sprintf("%v", tt.excludeTypes), func(t *testing.T) {
+			args, paths, err := o.RipgrepSourceArguments(&Index{SearchType: "all", ExcludeTypes: tt.excludeTypes}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) || !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("unexpected arguments %v and paths %v", args, paths)
+			}
+		})
+	}
+}
+
+func Test_pathIndex_SearchPaths_perJobLimit(t *testing.T) {
+	now := time.Now()
+	i := &pathIndex{base: "/var/lib/ci-search/jobs", ordered: []pathAge{
+		{path: "logs/job-a/4/build-log.txt", index: "build-log.txt", age: now},
+		{path: "logs/job-a/4/junit.failures", index: "junit.failures", age: now},
+		{path: "logs/job-b/9/build-log.txt", index: "build-log.txt", age: now.Add(-time.Minute)},
+		// a build without a searched file does not count towards the limit
+		{path: "logs/job-a/3/junit.failures", index: "junit.failures", age: now.Add(-2 * time.Minute)},
+		{path: "logs/job-a/2/build-log.txt", index: "build-log.txt", age: now.Add(-3 * time.Minute)},
+		{path: "pr-logs/pull/org_repo/1/job-a/1/build-log.txt", index: "build-log.txt", age: now.Add(-4 * time.Minute)},
+		{path: "logs/job-b/8/build-log.txt", index: "build-log.txt", age: now.Add(-5 * time.Minute)},
+		{path: "logs/job-b/7/build-log.txt", index: "build-log.txt", age: now.Add(-3 * time.Hour)},
+	}}
+
+	paths, err := i.SearchPaths(&Index{SearchType: "build-log", MaxAge: 2 * time.Hour, PerJobLimit: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/var/lib/ci-search/jobs/logs/job-a/4/build-log.txt",
+		"/var/lib/ci-search/jobs/logs/job-b/9/build-log.txt",
+		"/var/lib/ci-search/jobs/logs/job-a/2/build-log.txt",
+		"/var/lib/ci-search/jobs/logs/job-b/8/build-log.txt",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("unexpected paths:\n%v\nwant\n%v", paths, want)
+	}
+
+	// every file of a selected build is searched
+	paths, err = i.SearchPaths(&Index{SearchType: "all", MaxAge: 2 * time.Hour, PerJobLimit: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"/var/lib/ci-search/jobs/logs/job-a/4/build-log.txt",
+		"/var/lib/ci-search/jobs/logs/job-a/4/junit.failures",
+		"/var/lib/ci-search/jobs/logs/job-b/9/build-log.txt",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("unexpected paths:\n%v\nwant\n%v", paths, want)
+	}
+}
+
+func Test_parseJob(t *testing.T) {
+	for _, tt := range []struct {
+		value     string
+		wantJob   string
+		wantBuild string
+		wantErr   bool
+	}{
+		{value: "https://prow.example.com/view/gs/bucket/logs/job-a/1234", wantJob: "job-a", wantBuild: "1234"},
+		{value: "https://prow.example.com/view/gs/bucket/pr-logs/pull/org_repo/1/job-b/5678/", wantJob: "job-b", wantBuild: "5678"},
+		{value: "job-history/gs/bucket/logs/job-a/1234", wantJob: "job-a", wantBuild: "1234"},
+		{value: "1234", wantBuild: "1234"},
+		{value: "https://prow.example.com/job-history/gs/bucket/logs/job-a", wantErr: true},
+		{value: "job-a", wantErr: true},
+	} {
+		t.Run(tt.value, func(t *testing.T) {
+			job, build, err := parseJob(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if job != tt.wantJob || build != tt.wantBuild {
+				t.Errorf("parseJob() = %q, %q, want %q, %q", job, build, tt.wantJob, tt.wantBuild)
+			}
+		})
+	}
+}
+
+func Test_excludeBugKeywords(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		exclude  []string
+		keywords []string
+		want     bool
+	}{
+		{name: "no keywords", exclude: []string{"Security"}, want: true},
+		{name: "other keyword", exclude: []string{"Security"}, keywords: []string{"Regression"}, want: true},
+		{name: "excluded keyword", exclude: []string{"Security"}, keywords: []string{"Regression", "Security"}, want: false},
+		{name: "any excluded keyword", exclude: []string{"Security", "Triaged"}, keywords: []string{"Triaged"}, want: false},
+		{name: "keywords are case sensitive", exclude: []string{"Security"}, keywords: []string{"security"}, want: true},
+		{name: "nothing excluded", keywords: []string{"Security"}, want: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := excludeBugKeywords(tt.exclude)(&bugzilla.BugInfo{Keywords: tt.keywords}); got != tt.want {
+				t.Errorf("excludeBugKeywords() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_RipgrepSourceArguments_job(t *testing.T) {
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/bucket/")
+	bugURIPrefix, _ := url.Parse("https://bugzilla.example.com/show_bug.cgi")
+	o := &options{
+		jobsPath:     "/var/lib/ci-search/jobs",
+		bugsPath:     "/var/lib/ci-search/bugs",
+		jobURIPrefix: jobURIPrefix,
+		bugURIPrefix: bugURIPrefix,
+		jobsIndex:    &pathIndex{base: "/var/lib/ci-search/jobs"},
+	}
+	index := &Index{SearchType: "all", MaxAge: time.Hour, jobName: "job-a", buildID: "1"}
+
+	// before the index is loaded the jobs directory is globbed for the build
+	args, paths, err := o.RipgrepSourceArguments(index, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"--glob", "**/job-a/1/junit.failures*", "--glob", "**/job-a/1/build-log.txt*", "--glob", "**/job-a/1/must-gather.txt*", "--glob", "**/job-a/1/e2e.log*", "/var/lib/ci-search/jobs"}; !reflect.DeepEqual(args, want) || len(paths) != 0 {
+		t.Errorf("unexpected arguments %v and paths %v", args, paths)
+	}
+
+	now := time.Now()
+	o.jobsIndex.ordered = []pathAge{
+		{path: "logs/job-a/2/build-log.txt", index: "build-log.txt", age: now},
+		{path: "logs/job-b/1/build-log.txt", index: "build-log.txt", age: now},
+		{path: "logs/job-a/1/build-log.txt", index: "build-log.txt", age: now.Add(-2 * time.Hour)},
+	}
+	// the build is searched even though it is older than the max age, and bugs are not
+	args, paths, err = o.RipgrepSourceArguments(index, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/var/lib/ci-search/jobs/logs/job-a/1/build-log.txt"}; len(args) != 0 || !reflect.DeepEqual(paths, want) {
+		t.Errorf("unexpected arguments %v and paths %v", args, paths)
+	}
+
+	// a build number alone matches that build of any job
+	index.jobName = ""
+	_, paths, err = o.RipgrepSourceArguments(index, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/var/lib/ci-search/jobs/logs/job-b/1/build-log.txt", "/var/lib/ci-search/jobs/logs/job-a/1/build-log.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("unexpected paths %v", paths)
+	}
+
+	if _, _, err := o.RipgrepSourceArguments(&Index{SearchType: "bug", buildID: "1"}, nil); err == nil {
+		t.Errorf("expected an error when searching only bugs for a build")
+	}
+}
+
+func Test_pathIndexLive(t *testing.T) {
+	started := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	limit := pathIndexLivenessIntervals * pathIndexInterval
+	index := &pathIndex{}
+	if !pathIndexLive(index, started, started.Add(limit)) {
+		t.Errorf("expected a process that has not loaded yet to be live until the limit")
+	}
+	if pathIndexLive(index, started, started.Add(limit+time.Second)) {
+		t.Errorf("expected a process that never loaded to not be live")
+	}
+	index.loaded = started.Add(time.Hour)
+	if !pathIndexLive(index, started, index.loaded.Add(limit)) {
+		t.Errorf("expected a recent load to be live")
+	}
+	if pathIndexLive(index, started, index.loaded.Add(limit+time.Second)) {
+		t.Errorf("expected a stale load to not be live")
+	}
+}
+
+func Test_bucketForJobURI(t *testing.T) {
+	jobURIPrefix, _ := url.Parse("https://prow.example.com/view/gs/")
+	o := &options{jobURIPrefix: jobURIPrefix, IndexBuckets: []string{"bucket-a", "bucket-b"}}
+	for _, tt := range []struct {
+		uri  string
+		want string
+	}{
+		{uri: "https://prow.example.com/view/gs/bucket-b/logs/job/1", want: "bucket-b"},
+		{uri: "https://prow.example.com/view/gs/bucket-a/pr-logs/pull/org_repo/1/job/2", want: "bucket-a"},
+		{uri: "https://other.example.com/job/1", want: "bucket-a"},
+	} {
+		uri, _ := url.Parse(tt.uri)
+		if got := o.bucketForJobURI(uri); got != tt.want {
+			t.Errorf("bucketForJobURI(%s) = %s, want %s", tt.uri, got, tt.want)
+		}
+	}
+}
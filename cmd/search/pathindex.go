@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	pathpkg "path"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -46,6 +47,8 @@ type pathIndex struct {
 	ordered   []pathAge
 	stats     PathIndexStats
 	pathIndex map[string]int
+	// loaded is the time of the last successful Load
+	loaded time.Time
 }
 
 type pathAge struct {
@@ -67,6 +70,10 @@ func (index *pathIndex) parseJobPath(path string) (*Result, error) {
 		result.FileType = "build-log"
 	case "junit.failures":
 		result.FileType = "junit"
+	case "must-gather.txt":
+		result.FileType = "must-gather"
+	case "e2e.log":
+		result.FileType = "e2e-log"
 	default:
 		result.FileType = parts[last]
 	}
@@ -140,6 +147,10 @@ func (index *pathIndex) Load() error {
 			indexName = "build-log.txt"
 		case strings.HasPrefix(name, "junit.failures"):
 			indexName = "junit.failures"
+		case strings.HasPrefix(name, "must-gather.txt"):
+			indexName = "must-gather.txt"
+		case strings.HasPrefix(name, "e2e.log"):
+			indexName = "e2e.log"
 		default:
 			return nil
 		}
@@ -173,23 +184,63 @@ func (index *pathIndex) Load() error {
 	index.ordered = ordered
 	index.pathIndex = pathIndex
 	index.stats = stats
+	index.loaded = start
 
 	return nil
 }
 
+// Freshness returns the time the index was last loaded and the modification time of
+// the most recently indexed file, either of which is zero if unknown.
+func (i *pathIndex) Freshness() (loaded, newest time.Time) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if len(i.ordered) > 0 {
+		newest = i.ordered[0].age
+	}
+	return i.loaded, newest
+}
+
 func (i *pathIndex) FilenamesForSearchType(searchType string) []string {
 	switch searchType {
 	case "", "bug+junit", "junit", "bug+issue+junit":
 		return []string{"junit.failures"}
 	case "build-log":
 		return []string{"build-log.txt"}
-	case "all":
-		return []string{"junit.failures", "build-log.txt"}
+	case "must-gather":
+		return []string{"must-gather.txt"}
+	case "e2e-log":
+		return []string{"e2e.log"}
+	case "all", "everything":
+		return []string{"junit.failures", "build-log.txt", "must-gather.txt", "e2e.log"}
 	default:
 		return nil
 	}
 }
 
+// jobFileTypes maps the names of indexed job files to the file type used to exclude them.
+var jobFileTypes = map[string]string{
+	"junit.failures":  "junit",
+	"build-log.txt":   "build-log",
+	"must-gather.txt": "must-gather",
+	"e2e.log":         "e2e-log",
+}
+
+// FilenamesForIndex returns the job file names searched for the search type of index,
+// without any file types excluded by index.
+func (i *pathIndex) FilenamesForIndex(index *Index) []string {
+	names := i.FilenamesForSearchType(index.SearchType)
+	if len(index.ExcludeTypes) == 0 {
+		return names
+	}
+	filtered := make([]string, 0, len(names))
+	for _, name := range names {
+		if !index.ExcludesType(jobFileTypes[name]) {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
 func (i *pathIndex) Stats() PathIndexStats {
 	i.lock.Lock()
 	defer i.lock.Unlock()
@@ -198,7 +249,7 @@ func (i *pathIndex) Stats() PathIndexStats {
 
 func (i *pathIndex) SearchPaths(index *Index, jobNames sets.String) ([]string, error) {
 	// if there are no search targets return nil
-	names := i.FilenamesForSearchType(index.SearchType)
+	names := i.FilenamesForIndex(index)
 	if len(names) == 0 {
 		return nil, nil
 	}
@@ -216,15 +267,29 @@ func (i *pathIndex) SearchPaths(index *Index, jobNames sets.String) ([]string, e
 	// grow the map to the desired size up front
 	copied := make([]string, 0, len(paths))
 
-	var oldest time.Time
-	if index.MaxAge > 0 {
-		oldest = time.Now().Add(-index.MaxAge)
+	oldest, newest := index.TimeRange(time.Now())
+
+	// the build directories selected for each job when the builds per job are limited,
+	// which are the newest since paths are ordered newest first
+	var jobBuilds map[string]sets.String
+	if index.PerJobLimit > 0 && len(index.buildID) == 0 {
+		jobBuilds = make(map[string]sets.String)
 	}
 
 	for _, path := range paths {
-		if path.age.Before(oldest) {
+		if len(index.buildID) > 0 {
+			// Paths should be .../job/build/file - the requested build is searched even
+			// if it is older than the max age
+			dir := pathpkg.Dir(path.path)
+			if !index.IncludesBuild(pathpkg.Base(pathpkg.Dir(dir)), pathpkg.Base(dir)) {
+				continue
+			}
+		} else if path.age.Before(oldest) {
 			klog.V(2).Infof("Stopped path index at %s because it is before %s", path.path, oldest)
 			break
+		} else if !index.To.IsZero() && path.age.After(newest) {
+			// paths are ordered newest first
+			continue
 		}
 		if index.JobFilter != nil {
 			// Paths should be .../job/build/file - isolate the job and verify it matches the job regex
@@ -243,7 +308,26 @@ func (i *pathIndex) SearchPaths(index *Index, jobNames sets.String) ([]string, e
 			}
 		}
 		if contains(names, path.index) {
-			copied = append(copied, filepath.Join(i.base, filepath.FromSlash(path.path)))
+			if jobBuilds != nil {
+				dir := pathpkg.Dir(path.path)
+				jobName := pathpkg.Base(pathpkg.Dir(dir))
+				builds, ok := jobBuilds[jobName]
+				if !ok {
+					builds = sets.NewString()
+					jobBuilds[jobName] = builds
+				}
+				if !builds.Has(dir) {
+					if builds.Len() >= index.PerJobLimit {
+						continue
+					}
+					builds.Insert(dir)
+				}
+			}
+			fullPath := filepath.Join(i.base, filepath.FromSlash(path.path))
+			if index.pathFilter != nil && !index.pathFilter(fullPath) {
+				continue
+			}
+			copied = append(copied, fullPath)
 		}
 	}
 
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// preferencesCookie stores the search form settings of a browser between visits.
+const preferencesCookie = "ci-search-prefs"
+
+// preferencesMaxAge is how long the preferences cookie is kept by the browser.
+const preferencesMaxAge = 365 * 24 * time.Hour
+
+// searchPreferences are the search form settings remembered between visits.
+type searchPreferences struct {
+	Context    *int   `json:"context,omitempty"`
+	MaxAge     string `json:"maxAge,omitempty"`
+	WrapLines  bool   `json:"wrap,omitempty"`
+	SearchType string `json:"type,omitempty"`
+}
+
+// applyPreferences fills in the form settings missing from req with the preferences
+// stored in the request's cookie, so that explicit query parameters always take
+// precedence. Since an unchecked wrap checkbox is omitted from a submitted form, the
+// wrap preference only applies to requests without a search parameter.
+func applyPreferences(req *http.Request) error {
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+	cookie, err := req.Cookie(preferencesCookie)
+	if err != nil {
+		return nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	var prefs searchPreferences
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil
+	}
+
+	setDefault := func(key, value string) {
+		if _, ok := req.Form[key]; !ok && len(value) > 0 {
+			req.Form.Set(key, value)
+		}
+	}
+	if prefs.Context != nil && *prefs.Context >= -1 && *prefs.Context <= 15 {
+		setDefault("context", strconv.Itoa(*prefs.Context))
+	}
+	if d, err := time.ParseDuration(prefs.MaxAge); err == nil && d > 0 {
+		setDefault("maxAge", prefs.MaxAge)
+	}
+	setDefault("type", prefs.SearchType)
+	if _, ok := req.Form["search"]; !ok && prefs.WrapLines {
+		setDefault("wrap", "on")
+	}
+	return nil
+}
+
+// setPreferences stores the form settings of index in the preferences cookie. The search
+// type is only stored if it was requested, since some requests choose their own type.
+func setPreferences(w http.ResponseWriter, req *http.Request, index *Index) {
+	context := index.Context
+	data, err := json.Marshal(searchPreferences{
+		Context:    &context,
+		MaxAge:     index.MaxAge.String(),
+		WrapLines:  index.WrapLines,
+		SearchType: req.FormValue("type"),
+	})
+	if err != nil {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     preferencesCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(data),
+		Path:     "/",
+		MaxAge:   int(preferencesMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
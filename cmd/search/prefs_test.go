@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_preferences(t *testing.T) {
+	w := httptest.NewRecorder()
+	setPreferences(w, httptest.NewRequest("GET", "/?search=timeout&type=build-log", nil), &Index{Context: 3, MaxAge: 48 * time.Hour, WrapLines: true})
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != preferencesCookie {
+		t.Fatalf("unexpected cookies: %v", cookies)
+	}
+
+	parse := func(t *testing.T, target string) *Index {
+		req := httptest.NewRequest("GET", target, nil)
+		req.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: cookies[0].Value})
+		if err := applyPreferences(req); err != nil {
+			t.Fatal(err)
+		}
+		index, err := parseRequest(req, "text", 14*24*time.Hour, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index
+	}
+
+	index := parse(t, "/")
+	if index.Context != 3 || index.MaxAge != 48*time.Hour || !index.WrapLines || index.SearchType != "build-log" {
+		t.Errorf("preferences were not applied: %#v", index)
+	}
+
+	// explicit parameters take precedence, and a submitted form without wrap is unwrapped
+	index = parse(t, "/?search=etcd&context=0&maxAge=6h&type=junit")
+	if index.Context != 0 || index.MaxAge != 6*time.Hour || index.WrapLines || index.SearchType != "junit" {
+		t.Errorf("query parameters were not authoritative: %#v", index)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: preferencesCookie, Value: "not-valid"})
+	if err := applyPreferences(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Form) != 0 {
+		t.Errorf("invalid cookie should be ignored: %v", req.Form)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+// requestIDHeader carries the ID of a request so that a slow or failed search reported
+// by a user can be found in the server logs.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request ID accepted from a client.
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+// withRequestID assigns each request served by handler an ID, reusing a valid ID sent by
+// the client, stores it in the request context, and returns it in the response.
+func withRequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), requestIDContextKey{}, id)))
+	})
+}
+
+// requestID returns the ID of the request that ctx belongs to, or "-" if there is none,
+// for inclusion in log lines.
+func requestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDContextKey{}).(string); ok {
+		return id
+	}
+	return "-"
+}
+
+// validRequestID returns true if id is short and contains only characters that are safe
+// to write to logs and headers.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "-"
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// requestLogger writes log lines that end with the ID of the request they were written
+// for, so that every line logged while serving a request can be found by its ID.
+type requestLogger struct {
+	id string
+}
+
+// requestLog returns a logger for the request that ctx belongs to.
+func requestLog(ctx context.Context) requestLogger {
+	return requestLogger{id: requestID(ctx)}
+}
+
+func (l requestLogger) Infof(format string, args ...interface{}) {
+	klog.InfoDepth(1, l.line(format, args))
+}
+
+func (l requestLogger) Warningf(format string, args ...interface{}) {
+	klog.WarningDepth(1, l.line(format, args))
+}
+
+func (l requestLogger) Errorf(format string, args ...interface{}) {
+	klog.ErrorDepth(1, l.line(format, args))
+}
+
+// V returns a logger that only writes lines if klog verbosity is at least level.
+func (l requestLogger) V(level klog.Level) requestVerboseLogger {
+	return requestVerboseLogger{requestLogger: l, verbose: klog.V(level)}
+}
+
+func (l requestLogger) line(format string, args []interface{}) string {
+	return fmt.Sprintf(format, args...) + " request=" + l.id
+}
+
+type requestVerboseLogger struct {
+	requestLogger
+	verbose klog.Verbose
+}
+
+func (l requestVerboseLogger) Infof(format string, args ...interface{}) {
+	if l.verbose.Enabled() {
+		l.verbose.InfoDepth(1, l.line(format, args))
+	}
+}
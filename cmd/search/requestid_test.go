@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_withRequestID(t *testing.T) {
+	var seen string
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen = requestID(req.Context())
+	}))
+
+	// a valid incoming ID is reused
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/search?search=error", nil)
+	req.Header.Set(requestIDHeader, "client-abc.123")
+	handler.ServeHTTP(w, req)
+	if seen != "client-abc.123" || w.Header().Get(requestIDHeader) != seen {
+		t.Errorf("expected the client ID to be used: context=%q header=%q", seen, w.Header().Get(requestIDHeader))
+	}
+
+	// invalid or missing IDs are replaced with a generated one
+	for _, incoming := range []string{"", "bad id\n", strings.Repeat("a", maxRequestIDLength+1)} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/search?search=error", nil)
+		if len(incoming) > 0 {
+			req.Header.Set(requestIDHeader, incoming)
+		}
+		handler.ServeHTTP(w, req)
+		if len(seen) != 16 || seen == incoming || w.Header().Get(requestIDHeader) != seen {
+			t.Errorf("expected a generated ID for %q: context=%q header=%q", incoming, seen, w.Header().Get(requestIDHeader))
+		}
+	}
+
+	if id := requestID(req.Context()); id != "-" {
+		t.Errorf("unexpected ID outside of a request: %q", id)
+	}
+}
+
+func Test_requestLog(t *testing.T) {
+	var logger requestLogger
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		logger = requestLog(req.Context())
+	}))
+	req := httptest.NewRequest("GET", "/search?search=error", nil)
+	req.Header.Set(requestIDHeader, "client-abc.123")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if line := logger.line("Search %q failed: %v", []interface{}{"error", "timeout"}); line != `Search "error" failed: timeout request=client-abc.123` {
+		t.Errorf("unexpected line: %s", line)
+	}
+	if line := requestLog(req.Context()).line("Done", nil); line != "Done request=-" {
+		t.Errorf("unexpected line outside of a request: %s", line)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricSearchesRejected = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "search_requests_rejected_total",
+	Help: "The number of search requests rejected because --max-concurrent-searches searches were already running.",
+})
+
+func init() {
+	prometheus.MustRegister(metricSearchesRejected)
+}
+
+// searchRetryAfter is how long clients are asked to wait before retrying a search that
+// was rejected because too many searches were running.
+const searchRetryAfter = 5 * time.Second
+
+// acquireSearch reserves one of the search slots without waiting. If every slot is in
+// use, it responds to w with 503 and returns false. A reserved slot must be released by
+// calling the returned function once the search completes.
+func (o *options) acquireSearch(w http.ResponseWriter) (func(), bool) {
+	if o.searches == nil {
+		return func() {}, true
+	}
+	if !o.searches.TryAcquire(1) {
+		metricSearchesRejected.Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(searchRetryAfter.Seconds())))
+		http.Error(w, "Too many searches are running, try again later", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return func() { o.searches.Release(1) }, true
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/sync/semaphore"
+)
+
+func Test_acquireSearch(t *testing.T) {
+	o := &options{searches: semaphore.NewWeighted(1)}
+
+	release, ok := o.acquireSearch(httptest.NewRecorder())
+	if !ok {
+		t.Fatal("expected a free search slot")
+	}
+
+	w := httptest.NewRecorder()
+	o.handleSearch(w, httptest.NewRequest("GET", "/search?search=operator", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") != "5" {
+		t.Errorf("unexpected Retry-After %q", w.Header().Get("Retry-After"))
+	}
+
+	// requests that fail validation are not counted against the limit
+	w = httptest.NewRecorder()
+	o.handleSearch(w, httptest.NewRequest("GET", "/search", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	release()
+	if _, ok := o.acquireSearch(httptest.NewRecorder()); !ok {
+		t.Fatal("expected the released slot to be free")
+	}
+
+	// no limit is applied without a semaphore
+	o = &options{}
+	for i := 0; i < 3; i++ {
+		if _, ok := o.acquireSearch(httptest.NewRecorder()); !ok {
+			t.Fatal("expected searches to be unlimited")
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// compileSearch converts a ripgrep search into an equivalent Go regular expression,
+// mirroring the smart casing rules passed to ripgrep with -S.
+func compileSearch(search string) (*regexp.Regexp, error) {
+	if !strings.ContainsFunc(search, unicode.IsUpper) {
+		search = "(?i)" + search
+	}
+	return regexp.Compile(search)
+}
+
+// matchedLine returns the line from the context of a match that matched search,
+// or the line at the position of the match within the context if the search cannot
+// be evaluated.
+func matchedLine(search string, contextLines int, lines []string) string {
+	i := matchedLineIndex(search, contextLines, lines)
+	if i < 0 {
+		return ""
+	}
+	return lines[i]
+}
+
+// matchedLineIndex returns the index of the line returned by matchedLine, or -1 if there
+// are no lines.
+func matchedLineIndex(search string, contextLines int, lines []string) int {
+	if len(lines) == 0 {
+		return -1
+	}
+	if re, err := compileSearch(search); err == nil {
+		for i, line := range lines {
+			if re.MatchString(line) {
+				return i
+			}
+		}
+	}
+	i := contextLines
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(lines) {
+		i = len(lines) - 1
+	}
+	return i
+}
+
+// matchedLineNumber returns the text of the line of a match that matched search and its
+// line number in the file, given the line number of the first of lines as reported by
+// ripgrep. The line number is zero if lineNumber is zero.
+func matchedLineNumber(lineNumber int, search string, contextLines int, lines []string) (int, string) {
+	i := matchedLineIndex(search, contextLines, lines)
+	if i < 0 {
+		return 0, ""
+	}
+	if lineNumber > 0 {
+		lineNumber += i
+	}
+	return lineNumber, lines[i]
+}
+
+// scanForLine invokes fn with each line of the file at path until the matched line
+// is reached, and returns true if the matched line was found. The matched line is the
+// line numbered lineNumber, counting from one, or if lineNumber is zero the first line
+// whose text is matched, which may be an earlier copy of a repeated line.
+func scanForLine(path string, lineNumber int, matched string, fn func(lineNumber int, text string)) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	// allow lines of up to 4MB, matching the comment readers
+	sr := bufio.NewScanner(f)
+	sr.Buffer(make([]byte, 4*1024), 4*1024*1024)
+	for i := 0; sr.Scan(); i++ {
+		text := sr.Text()
+		fn(i, text)
+		if lineNumber > 0 {
+			if i+1 == lineNumber {
+				return true
+			}
+			continue
+		}
+		if strings.TrimRight(text, " ") == matched {
+			return true
+		}
+	}
+	return false
+}
+
+// fileContains returns true if any line of the file at path matches re. Files ending in
+// .gz are decompressed, as ripgrep does when searching them.
+func fileContains(path string, re *regexp.Regexp) bool {
+	_, _, ok := firstMatchingLine(path, re)
+	return ok
+}
+
+// firstMatchingLine returns the first line of the file at path that matches re and its
+// line number, or false if no line matches. Files ending in .gz are decompressed.
+func firstMatchingLine(path string, re *regexp.Regexp) ([]byte, int, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, false
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, 0, false
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	sr := bufio.NewScanner(r)
+	sr.Buffer(make([]byte, 4*1024), 4*1024*1024)
+	for lineNumber := 1; sr.Scan(); lineNumber++ {
+		if re.Match(sr.Bytes()) {
+			return sr.Bytes(), lineNumber, true
+		}
+	}
+	return nil, 0, false
+}
+
+// matchSection identifies which part of a bug or issue file on disk contains the
+// matched line. The header lines of the file report their field name (for example
+// "description", "status", or "labels"), the first line is the "summary", and any
+// match after the header separator is in a "comment". lineNumber is the line number
+// of the first of lines reported by ripgrep, or zero if it is not known. If the
+// matching line cannot be located an empty string is returned.
+func matchSection(path string, lineNumber int, search string, contextLines int, lines []string) string {
+	lineNumber, matched := matchedLineNumber(lineNumber, search, contextLines, lines)
+	if len(matched) == 0 {
+		return ""
+	}
+	section := "summary"
+	found := scanForLine(path, lineNumber, matched, func(lineNumber int, text string) {
+		switch {
+		case section == "comment":
+		case text == "---":
+			section = "comment"
+		case lineNumber > 0:
+			if i := strings.Index(text, ":"); i > 0 {
+				section = strings.ReplaceAll(strings.ToLower(text[:i]), " ", "-")
+			}
+		}
+	})
+	if !found {
+		return ""
+	}
+	return section
+}
+
+// reBugCommentHeader matches the line that starts each comment in a bug file on disk.
+// Every comment after the first is preceded by the comment delimiter.
+var reBugCommentHeader = regexp.MustCompile(`^\x1e?Comment \d+ by (.+) at (\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ)$`)
+
+// matchBugComment identifies the comment in a bug file on disk that contains the
+// matched line and returns its author and creation time. If the matching line cannot
+// be located or is not within a comment, false is returned.
+func matchBugComment(path string, lineNumber int, search string, contextLines int, lines []string) (string, time.Time, bool) {
+	lineNumber, matched := matchedLineNumber(lineNumber, search, contextLines, lines)
+	if len(matched) == 0 {
+		return "", time.Time{}, false
+	}
+	var inComments bool
+	var header []string
+	found := scanForLine(path, lineNumber, matched, func(lineNumber int, text string) {
+		switch {
+		case !inComments:
+			inComments = text == "---"
+		default:
+			if m := reBugCommentHeader.FindStringSubmatch(text); m != nil {
+				header = m
+			}
+		}
+	})
+	if !found || header == nil {
+		return "", time.Time{}, false
+	}
+	created, err := time.Parse(time.RFC3339, header[2])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return header[1], created, true
+}
+
+// matchJUnitTest identifies the name of the test in a junit.failures file on disk
+// that contains the matched line, using the "# NAME" line that precedes the output
+// of each failed test. If the test cannot be identified an empty string is returned.
+func matchJUnitTest(path string, lineNumber int, search string, contextLines int, lines []string) string {
+	lineNumber, matched := matchedLineNumber(lineNumber, search, contextLines, lines)
+	if len(matched) == 0 {
+		return ""
+	}
+	var test string
+	found := scanForLine(path, lineNumber, matched, func(lineNumber int, text string) {
+		if strings.HasPrefix(text, "# ") {
+			test = text[2:]
+		}
+	})
+	if !found {
+		return ""
+	}
+	return test
+}
+
+// junitFlakes holds the tests of a junit.failures file that were recorded as having
+// both failed and passed in the same run.
+type junitFlakes struct {
+	path   string
+	flakes sets.String
+	// starts holds the line number of the "# NAME" line of each test in the file, in
+	// order, and names holds the name of each test
+	starts []int
+	names  []string
+}
+
+// loadJUnitFlakes reads the flaky tests recorded beside the junit.failures file at path
+// and the line each test in the file starts at, or returns nil if no test flaked.
+func loadJUnitFlakes(path string) *junitFlakes {
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), "junit.flakes"))
+	if err != nil {
+		return nil
+	}
+	flakes := sets.NewString()
+	for _, name := range strings.Split(string(data), "\n") {
+		if len(name) > 0 {
+			flakes.Insert(name)
+		}
+	}
+	if flakes.Len() == 0 {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	result := &junitFlakes{path: path, flakes: flakes}
+	sr := bufio.NewScanner(f)
+	sr.Buffer(make([]byte, 4*1024), 4*1024*1024)
+	for lineNumber := 1; sr.Scan(); lineNumber++ {
+		if text := sr.Text(); strings.HasPrefix(text, "# ") {
+			result.starts = append(result.starts, lineNumber)
+			result.names = append(result.names, text[2:])
+		}
+	}
+	return result
+}
+
+// isFlake returns true if the match is from a flaky test. lineNumber is the line number
+// of the first of lines reported by ripgrep, or zero if it is not known.
+func (f *junitFlakes) isFlake(lineNumber int, search string, contextLines int, lines []string) bool {
+	if f == nil {
+		return false
+	}
+	var test string
+	if lineNumber, _ = matchedLineNumber(lineNumber, search, contextLines, lines); lineNumber > 0 {
+		// the match is in the last test that starts at or before the matched line
+		if i := sort.SearchInts(f.starts, lineNumber+1) - 1; i >= 0 {
+			test = f.names[i]
+		}
+	} else {
+		test = matchJUnitTest(f.path, 0, search, contextLines, lines)
+	}
+	return len(test) > 0 && f.flakes.Has(test)
+}
+
+// flakeDetector identifies flaky junit matches for a search, reading each file once as
+// long as the matches of each file are reported together.
+type flakeDetector struct {
+	path   string
+	flakes *junitFlakes
+}
+
+// isFlake returns true if the junit match at path is from a test that was recorded
+// as having both failed and passed in the same run.
+func (d *flakeDetector) isFlake(path string, lineNumber int, search string, contextLines int, lines []string) bool {
+	if path != d.path {
+		d.path, d.flakes = path, loadJUnitFlakes(path)
+	}
+	return d.flakes.isFlake(lineNumber, search, contextLines, lines)
+}
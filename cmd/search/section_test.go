@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_matchBugComment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bug-1")
+	data := "Bug 1: cluster fails to install\nStatus: NEW \nComponent: Installer\nEnvironment:\n---\n" +
+		"Comment 10 by alice@example.com at 2020-01-02T03:04:05Z\nThe install timed out\n\x1e" +
+		"Comment 11 by bob@example.com at 2020-01-03T03:04:05Z\nSeen again\nerror: connection refused\n\x1e"
+	if err := os.WriteFile(path, []byte(data), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	author, created, ok := matchBugComment(path, 0, "connection refused", 1, []string{"Seen again", "error: connection refused", ""})
+	if !ok || author != "bob@example.com" || !created.Equal(time.Date(2020, 1, 3, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected comment: %q %s %t", author, created, ok)
+	}
+	author, _, ok = matchBugComment(path, 0, "timed out", 0, []string{"The install timed out"})
+	if !ok || author != "alice@example.com" {
+		t.Errorf("unexpected comment: %q %t", author, ok)
+	}
+	if _, _, ok := matchBugComment(path, 0, "Installer", 0, []string{"Component: Installer"}); ok {
+		t.Errorf("a match in the header should not be attributed to a comment")
+	}
+}
+
+func Test_matchSection_repeatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bug-1")
+	data := "Bug 1: cluster fails to install\nStatus: NEW\nComponent: Installer\n---\n" +
+		"Comment 10 by alice@example.com at 2020-01-02T03:04:05Z\nerror: connection refused\n\x1e" +
+		"Comment 11 by bob@example.com at 2020-01-03T03:04:05Z\nStatus: NEW\nerror: connection refused\n\x1e"
+	if err := os.WriteFile(path, []byte(data), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	// without a line number, the first copy of the line is found
+	if section := matchSection(path, 0, "Status: NEW", 0, []string{"Status: NEW"}); section != "status" {
+		t.Errorf("unexpected section without a line number: %q", section)
+	}
+	if section := matchSection(path, 8, "Status: NEW", 0, []string{"Status: NEW"}); section != "comment" {
+		t.Errorf("unexpected section: %q", section)
+	}
+	// the line number is of the first line of context
+	author, _, ok := matchBugComment(path, 8, "connection refused", 1, []string{"Status: NEW", "error: connection refused", ""})
+	if !ok || author != "bob@example.com" {
+		t.Errorf("unexpected comment: %q %t", author, ok)
+	}
+	author, _, ok = matchBugComment(path, 6, "connection refused", 0, []string{"error: connection refused"})
+	if !ok || author != "alice@example.com" {
+		t.Errorf("unexpected comment: %q %t", author, ok)
+	}
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	jiraBaseClient "github.com/andygrunwald/go-jira"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/lru"
 
 	"github.com/openshift/ci-search/bugzilla"
 )
@@ -21,7 +25,7 @@ type Result struct {
 	// URI is the job detail page, e.g. https://prow.ci.openshift.org/view/gs/test-platform-results/logs/release-openshift-origin-installer-e2e-aws-4.1/309
 	URI *url.URL
 
-	// FileType is the type of file where the match was found: "bug", "build-log" or "junit".
+	// FileType is the type of file where the match was found: "bug", "issue", "build-log", "junit", "must-gather" or "e2e-log".
 	FileType string
 
 	// Trigger is "pull" or "build".
@@ -36,6 +40,10 @@ type Result struct {
 	// IgnoreAge is true if the result should be included regardless of age.
 	IgnoreAge bool
 
+	// Duration is the time between the start and completion of the job run, or zero
+	// if the run is not known or has not completed.
+	Duration time.Duration
+
 	Bug *bugzilla.BugInfo
 
 	// Key is the identifier of a Jira issue
@@ -59,14 +67,29 @@ type Index struct {
 	IncludeName string
 	// ExcludeName is the string value a regular expression to filter job results.
 	ExcludeName string
+	// Job restricts the search to the files of a single build, given as a prow job URL,
+	// a path ending in JOB/BUILD, or a build number.
+	Job string
 
 	// MaxAge excludes jobs which failed longer than MaxAge ago.
 	MaxAge time.Duration
+	// From excludes jobs which failed before this time instead of MaxAge, if set.
+	From time.Time
+	// To excludes jobs which failed after this time, if set. If From is not set, jobs
+	// which failed longer than MaxAge before To are excluded.
+	To time.Time
 
 	// MaxMatches caps the number of individual results within a file
 	// that can be returned.
 	MaxMatches int
 
+	// MaxResults stops the search once this many files have been shown, if set.
+	MaxResults int
+
+	// PerJobLimit only searches the newest this many builds of each job that are
+	// within the time range of the search, if set.
+	PerJobLimit int
+
 	// MaxBytes will terminate a search if the specified number of bytes
 	// are found within matches. An error will be printed.
 	MaxBytes int64
@@ -74,34 +97,356 @@ type Index struct {
 	// Context includes this many lines of context around each match.
 	Context int
 
+	// MaxLineLength truncates each rendered line of context to this many bytes, if
+	// set. Otherwise lines are truncated at maxRenderedLineLength.
+	MaxLineLength int
+
 	// WrapLines instructs the renderer to use wrapped lines
 	WrapLines bool
 
 	// GroupByJob will batch results by the job and display data about match
 	// rate and failure rates.
 	GroupByJob bool
+	// GroupByComponent will batch matching bugs and issues by their component.
+	GroupByComponent bool
+	// Collapse merges the matches of the runs of a grouped job whose context is
+	// identical into a single match.
+	Collapse bool
+	// Sort orders grouped jobs by impact, matches, name, or recent. If empty, jobs
+	// are shown in the order they were found.
+	Sort string
+
+	// Offset is the position in the ordered list of grouped jobs to begin
+	// rendering from. It is passed to clients as an opaque cursor.
+	Offset int
+
+	// OnlyUnexplained excludes job results for any search string that also
+	// matched an indexed bug or issue.
+	OnlyUnexplained bool
+	// CountOnly reports each matching file once with the number of matches in the
+	// file as the only line, instead of the matching lines.
+	CountOnly bool
+
+	// ExcludeTypes are the file types (bug, issue, junit, build-log, must-gather, or
+	// e2e-log) that are not searched even if the search type includes them.
+	ExcludeTypes []string
+
+	// AllOf only includes files that match every search, instead of files that match
+	// any search.
+	AllOf bool
+	// Exclude drops matching files that also contain a line matching any of these
+	// searches. Exclusion applies to the whole file, not only to the lines that
+	// matched, and follows the Literal and Case settings of the search.
+	Exclude []string
+
+	// Literal matches each search as a fixed string instead of a regular expression.
+	Literal bool
+	// Case is sensitive or insensitive to override the default smart casing, where a
+	// search is case-insensitive unless it contains an uppercase letter.
+	Case string
+
+	// HideFlakes excludes junit results from tests that failed and then passed
+	// within the same run.
+	HideFlakes bool
+
+	// MinDuration excludes job results from runs that took less time than this.
+	MinDuration time.Duration
+	// MaxDuration excludes job results from runs that took more time than this.
+	MaxDuration time.Duration
+
+	// InstallOnly scopes the search to the configured install artifacts and only
+	// includes files that also match the configured install failure pattern.
+	InstallOnly bool
+
+	// HideFreshnessWarning suppresses the warning shown when the index is behind, for
+	// pages embedded elsewhere.
+	HideFreshnessWarning bool
+
+	// explained is the set of search strings that matched a bug or issue,
+	// populated before searching when OnlyUnexplained is set.
+	explained sets.String
+	// pathFilter, if set, excludes job files from the search when it returns false
+	// for the absolute path of the file.
+	pathFilter func(path string) bool
+	// require, if set, excludes matching files that do not also contain a line
+	// matching this pattern.
+	require string
+	// jobName and buildID identify the build parsed from Job. jobName is empty if Job
+	// was only a build number.
+	jobName string
+	buildID string
+	// highlight, if set, marks the text of rendered lines that matched a search.
+	highlight *regexp.Regexp
+	// outputBytes counts the matching lines and context read from ripgrep across every
+	// search, if set. The bytes ripgrep searched are not counted.
+	outputBytes *atomic.Int64
+	// bytesScanned counts the bytes ripgrep reported searching across every search, if
+	// set.
+	bytesScanned *atomic.Int64
+	// combineSearches runs every search in a single ripgrep pass when possible, instead
+	// of one pass per search.
+	combineSearches bool
+}
+
+// OutputBytes returns the number of bytes of matching lines and context read from
+// ripgrep so far by the searches of the index. This is the output limited by MaxBytes,
+// not the size of the files ripgrep searched.
+func (i *Index) OutputBytes() int64 {
+	if i.outputBytes == nil {
+		return 0
+	}
+	return i.outputBytes.Load()
+}
+
+func (i *Index) addOutputBytes(n int64) {
+	if i.outputBytes != nil {
+		i.outputBytes.Add(n)
+	}
+}
+
+// BytesScanned returns the number of bytes ripgrep reported searching so far for the
+// searches of the index. An invocation of ripgrep that is stopped early, because the
+// search was cancelled or reached MaxBytes, does not report the bytes it searched.
+func (i *Index) BytesScanned() int64 {
+	if i.bytesScanned == nil {
+		return 0
+	}
+	return i.bytesScanned.Load()
+}
+
+func (i *Index) addBytesScanned(n int64) {
+	if i.bytesScanned != nil {
+		i.bytesScanned.Add(n)
+	}
+}
+
+// IsExplained returns true if a job result for search should be excluded because
+// the search also matched a bug or issue.
+func (i *Index) IsExplained(fileType, search string) bool {
+	if !i.OnlyUnexplained || fileType == "bug" || fileType == "issue" {
+		return false
+	}
+	return i.explained.Has(search)
+}
+
+// InDurationRange returns true if a result is within the requested run duration range.
+// Bugs and issues are always in range, and job results from runs of unknown duration are
+// only in range if no range is requested.
+func (i *Index) InDurationRange(result Result) bool {
+	if i.MinDuration == 0 && i.MaxDuration == 0 {
+		return true
+	}
+	if result.FileType == "bug" || result.FileType == "issue" {
+		return true
+	}
+	if result.Duration == 0 {
+		return false
+	}
+	if i.MinDuration > 0 && result.Duration < i.MinDuration {
+		return false
+	}
+	if i.MaxDuration > 0 && result.Duration > i.MaxDuration {
+		return false
+	}
+	return true
+}
+
+// TimeRange returns the window of failure times searched as of now. Without an explicit
+// From, the window begins MaxAge before its end, or is unbounded if MaxAge is zero.
+func (i *Index) TimeRange(now time.Time) (from, to time.Time) {
+	from, to = i.From, i.To
+	if to.IsZero() {
+		to = now
+	}
+	if from.IsZero() && i.MaxAge > 0 {
+		from = to.Add(-i.MaxAge)
+	}
+	return from, to
+}
+
+// InTimeRange returns true if a result that failed at t is within the time range of the
+// index as of now. Results of unknown time are always in range, and results after now
+// are only excluded by an explicit To.
+func (i *Index) InTimeRange(t, now time.Time) bool {
+	if t.IsZero() {
+		return true
+	}
+	from, _ := i.TimeRange(now)
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	return i.To.IsZero() || !t.After(i.To)
+}
+
+// ExcludesType returns true if files of fileType are excluded from the search.
+func (i *Index) ExcludesType(fileType string) bool {
+	for _, t := range i.ExcludeTypes {
+		if t == fileType {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludesBuild returns true if the files of the build of job are searched.
+func (i *Index) IncludesBuild(job, buildID string) bool {
+	if len(i.buildID) == 0 {
+		return true
+	}
+	return buildID == i.buildID && (len(i.jobName) == 0 || job == i.jobName)
+}
+
+// parseJob returns the job name and build ID identified by value, which may be a prow
+// job URL, a path ending in JOB/BUILD such as a GCS or job history path, or a build
+// number alone.
+func parseJob(value string) (jobName, buildID string, err error) {
+	if u, err := url.Parse(value); err == nil && len(u.Scheme) > 0 {
+		value = u.Path
+	}
+	parts := strings.Split(strings.Trim(value, "/"), "/")
+	buildID = parts[len(parts)-1]
+	if _, err := strconv.ParseUint(buildID, 10, 64); err != nil {
+		return "", "", fmt.Errorf("job must be a prow job URL, a path ending in JOB/BUILD, or a build number")
+	}
+	if len(parts) > 1 {
+		jobName = parts[len(parts)-2]
+	}
+	return jobName, buildID, nil
+}
+
+// Pattern returns search as a regular expression, quoting it if the search is literal
+// and setting its case sensitivity if the smart casing default was overridden.
+func (i *Index) Pattern(search string) string {
+	if i.Literal {
+		search = regexp.QuoteMeta(search)
+	}
+	switch i.Case {
+	case "sensitive":
+		return "(?-i)" + search
+	case "insensitive":
+		return "(?i)" + search
+	}
+	return search
 }
 
 func (i *Index) Query() url.Values {
 	v := make(url.Values)
 	v["search"] = i.Search
 	v.Set("mode", i.Mode)
-	v.Set("searchType", i.SearchType)
+	v.Set("type", i.SearchType)
 	v.Set("maxAge", i.MaxAge.String())
+	if !i.From.IsZero() {
+		v.Set("from", i.From.UTC().Format(time.RFC3339))
+	}
+	if !i.To.IsZero() {
+		v.Set("to", i.To.UTC().Format(time.RFC3339))
+	}
 	v.Set("name", i.IncludeName)
 	v.Set("excludeName", i.ExcludeName)
+	if len(i.Job) > 0 {
+		v.Set("job", i.Job)
+	}
 	v.Set("maxMatches", strconv.Itoa(i.MaxMatches))
 	v.Set("maxBytes", strconv.FormatInt(i.MaxBytes, 10))
+	if i.MaxResults > 0 {
+		v.Set("maxResults", strconv.Itoa(i.MaxResults))
+	}
+	if i.PerJobLimit > 0 {
+		v.Set("perJobLimit", strconv.Itoa(i.PerJobLimit))
+	}
 	v.Set("context", strconv.Itoa(i.Context))
-	v.Set("wrapLines", strconv.FormatBool(i.WrapLines))
-	if i.GroupByJob {
-		v.Set("groupByJob", "job")
-	} else {
-		v.Set("groupByJob", "none")
+	if i.MaxLineLength > 0 {
+		v.Set("maxLineLength", strconv.Itoa(i.MaxLineLength))
+	}
+	if i.WrapLines {
+		v.Set("wrap", "1")
+	}
+	switch {
+	case i.GroupByComponent:
+		v.Set("groupBy", "component")
+	case i.GroupByJob:
+		v.Set("groupBy", "job")
+	default:
+		v.Set("groupBy", "none")
+	}
+	if i.Collapse {
+		v.Set("collapse", "1")
+	}
+	if len(i.Sort) > 0 {
+		v.Set("sort", i.Sort)
+	}
+	if i.Offset > 0 {
+		v.Set("cursor", encodeCursor(i.Offset))
+	}
+	if i.OnlyUnexplained {
+		v.Set("onlyUnexplained", "1")
+	}
+	if len(i.ExcludeTypes) > 0 {
+		v.Set("excludeType", strings.Join(i.ExcludeTypes, ","))
+	}
+	if i.AllOf {
+		v.Set("allOf", "1")
+	}
+	if len(i.Exclude) > 0 {
+		v["exclude"] = i.Exclude
+	}
+	if i.Literal {
+		v.Set("literal", "1")
+	}
+	if len(i.Case) > 0 {
+		v.Set("case", i.Case)
+	}
+	if i.HideFlakes {
+		v.Set("hideFlakes", "1")
+	}
+	if i.InstallOnly {
+		v.Set("installOnly", "1")
+	}
+	if i.HideFreshnessWarning {
+		v.Set("hideFreshnessWarning", "1")
+	}
+	if i.MinDuration > 0 {
+		v.Set("minDuration", i.MinDuration.String())
+	}
+	if i.MaxDuration > 0 {
+		v.Set("maxDuration", i.MaxDuration.String())
 	}
 	return v
 }
 
+// searchKey identifies the results of searching for index, ignoring the requested page
+// and the options that only change how the results are rendered.
+func (i *Index) searchKey() string {
+	copied := *i
+	copied.Offset = 0
+	copied.MaxLineLength = 0
+	copied.WrapLines = false
+	copied.Collapse = false
+	copied.HideFreshnessWarning = false
+	return copied.Query().Encode()
+}
+
+// encodeCursor returns an opaque token for a position in a paged result.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the position encoded by encodeCursor.
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("offset must be non-negative")
+	}
+	return offset, nil
+}
+
 func (i *Index) String() string {
 	if i == nil {
 		return "nil"
@@ -121,36 +466,83 @@ func (i *Index) String() string {
 	return sb.String()
 }
 
-func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index, error) {
-	if err := req.ParseForm(); err != nil {
+// jobFilterCacheSize is the number of compiled job name filters reused across requests.
+const jobFilterCacheSize = 256
+
+// jobFilterCache holds compiled job name filters by their expression, since the same
+// filters are requested repeatedly. A compiled expression is safe for concurrent use.
+var jobFilterCache = lru.New(jobFilterCacheSize)
+
+// compileJobFilter returns the compiled regular expression for a job name filter,
+// reusing a previous compilation of the same expression if possible.
+func compileJobFilter(value string) (*regexp.Regexp, error) {
+	if obj, ok := jobFilterCache.Get(value); ok {
+		return obj.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(value)
+	if err != nil {
 		return nil, err
 	}
+	jobFilterCache.Add(value, re)
+	return re, nil
+}
 
-	index := &Index{
-		Mode: mode,
+// durationDaysWeeks matches the day and week components of a duration such as 1w2d12h.
+var durationDaysWeeks = regexp.MustCompile(`([0-9]*\.?[0-9]+)([dw])`)
+
+// parseDuration parses a Go duration that may also use the units d for days and w for
+// weeks, such as 2d or 1w12h. Days are always 24 hours.
+func parseDuration(value string) (time.Duration, error) {
+	var err error
+	converted := durationDaysWeeks.ReplaceAllStringFunc(value, func(s string) string {
+		parts := durationDaysWeeks.FindStringSubmatch(s)
+		n, parseErr := strconv.ParseFloat(parts[1], 64)
+		if parseErr != nil {
+			err = parseErr
+			return s
+		}
+		hours := n * 24
+		if parts[2] == "w" {
+			hours *= 7
+		}
+		return strconv.FormatFloat(hours, 'f', -1, 64) + "h"
+	})
+	if err != nil {
+		return 0, fmt.Errorf("time: invalid duration %q", value)
 	}
+	d, err := time.ParseDuration(converted)
+	if err != nil {
+		return 0, fmt.Errorf("time: invalid duration %q", value)
+	}
+	return d, nil
+}
 
-	index.Search = req.Form["search"]
-	if len(index.Search) == 0 && mode == "chart" {
-
-		// CI-cluster issues
-		index.Search = append(index.Search, "could not create or restart template instance.*")
-		index.Search = append(index.Search, "could not (wait for|get) build.*") // https://bugzilla.redhat.com/show_bug.cgi?id=1696483
+// timeLayouts are the formats accepted for the from and to parameters of a request. Times
+// without a zone are UTC.
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
 
-		// Installer and bootstrapping issues issues
-		index.Search = append(index.Search, "level=error.*timeout while waiting for state.*") // https://bugzilla.redhat.com/show_bug.cgi?id=1690069 https://bugzilla.redhat.com/show_bug.cgi?id=1691516
-		index.Search = append(index.Search, "Container setup exited with code ., reason Error")
+// parseTime parses an absolute time in one of timeLayouts.
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time in RFC3339 or YYYY-MM-DD format", value)
+}
 
-		// Cluster-under-test issues
-		index.Search = append(index.Search, "no providers available to validate pod")                          // https://bugzilla.redhat.com/show_bug.cgi?id=1705102
-		index.Search = append(index.Search, "Error deleting EBS volume .* since volume is currently attached") // https://bugzilla.redhat.com/show_bug.cgi?id=1704356
-		index.Search = append(index.Search, "clusteroperator/.* changed Degraded to True: .*")                 // e.g. https://bugzilla.redhat.com/show_bug.cgi?id=1702829 https://bugzilla.redhat.com/show_bug.cgi?id=1702832
-		index.Search = append(index.Search, "Cluster operator .* is still updating.*")                         // e.g. https://bugzilla.redhat.com/show_bug.cgi?id=1700416
-		index.Search = append(index.Search, "Pod .* is not healthy")                                           // e.g. https://bugzilla.redhat.com/show_bug.cgi?id=1700100
+func parseRequest(req *http.Request, mode string, maxAge time.Duration, aliases jobAliases) (*Index, error) {
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
 
-		index.Search = append(index.Search, "failed: \\(.*")
+	index := &Index{
+		Mode:         mode,
+		outputBytes:  &atomic.Int64{},
+		bytesScanned: &atomic.Int64{},
 	}
 
+	index.Search = req.Form["search"]
 	switch req.FormValue("type") {
 	case "":
 		if mode == "chart" {
@@ -172,10 +564,17 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 		index.SearchType = "junit"
 	case "build-log":
 		index.SearchType = "build-log"
+	case "must-gather":
+		index.SearchType = "must-gather"
+	case "e2e-log":
+		index.SearchType = "e2e-log"
 	case "all":
 		index.SearchType = "all"
+	case "everything":
+		// bugs, issues, junit, and build logs
+		index.SearchType = "everything"
 	default:
-		return nil, fmt.Errorf("search type must be 'bug', 'issue, 'junit', 'build-log', or 'all'")
+		return nil, fmt.Errorf("search type must be 'bug', 'issue, 'junit', 'build-log', 'must-gather', 'e2e-log', 'everything', or 'all'")
 	}
 
 	var includeRE *regexp.Regexp
@@ -184,7 +583,7 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 			value = "-e2e-"
 		}
 		var err error
-		includeRE, err = regexp.Compile(value)
+		includeRE, err = compileJobFilter(aliases.Expand(value))
 		if err != nil {
 			return nil, fmt.Errorf("name is an invalid regular expression: %v", err)
 		}
@@ -193,7 +592,7 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 	var excludeRE *regexp.Regexp
 	if value := req.FormValue("excludeName"); len(value) > 0 {
 		var err error
-		excludeRE, err = regexp.Compile(value)
+		excludeRE, err = compileJobFilter(aliases.Expand(value))
 		if err != nil {
 			return nil, fmt.Errorf("name is an invalid regular expression: %v", err)
 		}
@@ -208,6 +607,14 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 		index.JobFilter = func(name string) bool { return !excludeRE.MatchString(name) }
 	}
 
+	if value := strings.TrimSpace(req.FormValue("job")); len(value) > 0 {
+		jobName, buildID, err := parseJob(value)
+		if err != nil {
+			return nil, err
+		}
+		index.Job, index.jobName, index.buildID = value, jobName, buildID
+	}
+
 	if value := req.FormValue("maxMatches"); len(value) > 0 {
 		maxMatches, err := strconv.Atoi(value)
 		if err != nil || maxMatches < 0 || maxMatches > 500 {
@@ -216,6 +623,30 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 		index.MaxMatches = maxMatches
 	}
 
+	if value := req.FormValue("maxResults"); len(value) > 0 {
+		maxResults, err := strconv.Atoi(value)
+		if err != nil || maxResults < 0 {
+			return nil, fmt.Errorf("maxResults must be a non-negative number")
+		}
+		index.MaxResults = maxResults
+	}
+
+	if value := req.FormValue("perJobLimit"); len(value) > 0 {
+		perJobLimit, err := strconv.Atoi(value)
+		if err != nil || perJobLimit < 0 {
+			return nil, fmt.Errorf("perJobLimit must be a non-negative number")
+		}
+		index.PerJobLimit = perJobLimit
+	}
+
+	if value := req.FormValue("maxLineLength"); len(value) > 0 {
+		maxLineLength, err := strconv.Atoi(value)
+		if err != nil || maxLineLength < 0 || maxLineLength > maxRenderedLineLength {
+			return nil, fmt.Errorf("maxLineLength must be a number between 0 and %d", maxRenderedLineLength)
+		}
+		index.MaxLineLength = maxLineLength
+	}
+
 	if value := req.FormValue("maxBytes"); len(value) > 0 {
 		maxBytes, err := strconv.ParseInt(value, 10, 64)
 		if err != nil || maxBytes < 0 || maxBytes > 100*1024*1024 {
@@ -228,7 +659,7 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 	}
 
 	if value := req.FormValue("maxAge"); len(value) > 0 {
-		maxAge, err := time.ParseDuration(value)
+		maxAge, err := parseDuration(value)
 		if err != nil {
 			return nil, fmt.Errorf("maxAge is an invalid duration: %v", err)
 		} else if maxAge < 0 {
@@ -242,14 +673,47 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 	if index.MaxAge > maxAge {
 		index.MaxAge = maxAge
 	}
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{
+		{name: "from", value: &index.From},
+		{name: "to", value: &index.To},
+	} {
+		if value := req.FormValue(param.name); len(value) > 0 {
+			t, err := parseTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s is an invalid time: %v", param.name, err)
+			}
+			*param.value = t
+		}
+	}
+	if !index.From.IsZero() && !index.To.IsZero() && !index.From.Before(index.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
 
 	if value := req.FormValue("wrap"); len(value) > 0 {
 		index.WrapLines = true
 	}
-	if value := req.FormValue("groupBy"); value != "none" {
+	switch req.FormValue("groupBy") {
+	case "none":
+	case "component":
+		index.GroupByComponent = true
+	default:
 		index.GroupByJob = true
 	}
 
+	if value := req.FormValue("collapse"); len(value) > 0 && value != "0" && value != "false" {
+		index.Collapse = true
+	}
+
+	switch value := req.FormValue("sort"); value {
+	case "", "impact", "matches", "name", "recent":
+		index.Sort = value
+	default:
+		return nil, fmt.Errorf("sort must be one of impact, matches, name, or recent")
+	}
+
 	if context := req.FormValue("context"); len(context) > 0 {
 		num, err := strconv.Atoi(context)
 		if err != nil || num < -1 || num > 15 {
@@ -260,5 +724,115 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 		index.Context = 1
 	}
 
+	if value := req.FormValue("onlyUnexplained"); len(value) > 0 && value != "0" && value != "false" {
+		index.OnlyUnexplained = true
+	}
+
+	if value := req.FormValue("hideFlakes"); len(value) > 0 && value != "0" && value != "false" {
+		index.HideFlakes = true
+	}
+
+	if value := req.FormValue("excludeType"); len(value) > 0 {
+		for _, t := range strings.Split(value, ",") {
+			switch t = strings.TrimSpace(t); t {
+			case "":
+			case "bug", "issue", "junit", "build-log", "must-gather", "e2e-log":
+				if !index.ExcludesType(t) {
+					index.ExcludeTypes = append(index.ExcludeTypes, t)
+				}
+			default:
+				return nil, fmt.Errorf("excludeType must be a comma-separated list of bug, issue, junit, build-log, must-gather, or e2e-log")
+			}
+		}
+	}
+
+	if value := req.FormValue("allOf"); len(value) > 0 && value != "0" && value != "false" {
+		index.AllOf = true
+	}
+
+	if value := req.FormValue("literal"); len(value) > 0 && value != "0" && value != "false" {
+		index.Literal = true
+	}
+
+	switch value := req.FormValue("case"); value {
+	case "", "smart":
+	case "sensitive", "insensitive":
+		index.Case = value
+	default:
+		return nil, fmt.Errorf("case must be one of smart, sensitive, or insensitive")
+	}
+
+	for _, exclude := range req.Form["exclude"] {
+		if len(exclude) > 0 {
+			index.Exclude = append(index.Exclude, exclude)
+		}
+	}
+	if _, err := excludeMatchers(index); err != nil {
+		return nil, err
+	}
+
+	for _, param := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{name: "minDuration", value: &index.MinDuration},
+		{name: "maxDuration", value: &index.MaxDuration},
+	} {
+		if value := req.FormValue(param.name); len(value) > 0 {
+			d, err := parseDuration(value)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("%s must be a non-negative duration", param.name)
+			}
+			*param.value = d
+		}
+	}
+	if index.MinDuration > 0 && index.MaxDuration > 0 && index.MinDuration > index.MaxDuration {
+		return nil, fmt.Errorf("minDuration must not be greater than maxDuration")
+	}
+
+	if value := req.FormValue("installOnly"); len(value) > 0 && value != "0" && value != "false" {
+		index.InstallOnly = true
+	}
+
+	if value := req.FormValue("hideFreshnessWarning"); len(value) > 0 && value != "0" && value != "false" {
+		index.HideFreshnessWarning = true
+	}
+
+	if value := req.FormValue("cursor"); len(value) > 0 {
+		offset, err := decodeCursor(value)
+		if err != nil {
+			return nil, fmt.Errorf("cursor is not valid")
+		}
+		index.Offset = offset
+	}
+
 	return index, nil
 }
+
+// applyInstallScope restricts an installOnly request to the configured install search
+// type, unless the request specified a type, and requires that matching files also
+// contain the configured install failure pattern.
+func (o *options) applyInstallScope(req *http.Request, index *Index) {
+	if !index.InstallOnly {
+		return
+	}
+	if len(req.FormValue("type")) == 0 && len(o.InstallSearchType) > 0 {
+		index.SearchType = o.InstallSearchType
+	}
+	index.require = o.InstallPattern
+}
+
+// applyTypeDefaults sets the context and max matches of index from the configured
+// per search type defaults, unless the request specified them explicitly.
+func (o *options) applyTypeDefaults(req *http.Request, index *Index) {
+	if len(req.FormValue("context")) == 0 {
+		if value, ok := o.DefaultContext[index.SearchType]; ok {
+			index.Context = value
+		}
+	}
+	if len(req.FormValue("maxMatches")) == 0 {
+		if value, ok := o.DefaultMaxMatches[index.SearchType]; ok {
+			index.MaxMatches = value
+		}
+	}
+}
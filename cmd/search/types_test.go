@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_compileJobFilter(t *testing.T) {
+	a, err := compileJobFilter("^periodic-.*-e2e-aws$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := compileJobFilter("^periodic-.*-e2e-aws$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("expected the compiled filter to be reused")
+	}
+	if _, err := compileJobFilter("("); err == nil {
+		t.Errorf("expected an invalid expression to fail")
+	}
+}
+
+func Test_parseDuration(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "24h", want: 24 * time.Hour},
+		{value: "90m", want: 90 * time.Minute},
+		{value: "48h0m0s", want: 48 * time.Hour},
+		{value: "2d", want: 48 * time.Hour},
+		{value: "1w", want: 7 * 24 * time.Hour},
+		{value: "1w2d12h", want: 9*24*time.Hour + 12*time.Hour},
+		{value: "1.5d", want: 36 * time.Hour},
+		{value: "0", want: 0},
+		{value: "", wantErr: true},
+		{value: "2days", wantErr: true},
+		{value: "d", wantErr: true},
+		{value: "1y", wantErr: true},
+	} {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseDuration(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseDuration(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	index, err := parseRequest(httptest.NewRequest("GET", "/?search=x&maxAge=1w&minDuration=1d", nil), "text", 14*24*time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.MaxAge != 7*24*time.Hour || index.MinDuration != 24*time.Hour {
+		t.Errorf("unexpected maxAge=%s minDuration=%s", index.MaxAge, index.MinDuration)
+	}
+}
+
+func TestIndex_Query_roundTrip(t *testing.T) {
+	for _, index := range []*Index{
+		{
+			Search:        []string{"timeout", "etcd.*leader"},
+			SearchType:    "build-log",
+			IncludeName:   "-e2e-aws",
+			ExcludeName:   "upgrade",
+			Job:           "periodic-ci-e2e/1234",
+			MaxAge:        6 * time.Hour,
+			MaxMatches:    10,
+			MaxResults:    50,
+			PerJobLimit:   3,
+			MaxBytes:      1024,
+			Context:       -1,
+			MaxLineLength: 200,
+			WrapLines:     true,
+			GroupByJob:    true,
+			Collapse:      true,
+			Sort:          "impact",
+			Offset:        100,
+
+			OnlyUnexplained:      true,
+			ExcludeTypes:         []string{"bug", "must-gather"},
+			AllOf:                true,
+			Exclude:              []string{"context canceled", "(?i)retrying"},
+			Literal:              true,
+			Case:                 "sensitive",
+			HideFlakes:           true,
+			MinDuration:          time.Minute,
+			MaxDuration:          time.Hour,
+			InstallOnly:          true,
+			HideFreshnessWarning: true,
+			From:                 time.Date(2024, 5, 7, 9, 0, 0, 0, time.UTC),
+			To:                   time.Date(2024, 5, 7, 17, 30, 0, 0, time.UTC),
+		},
+		{
+			Search:           []string{"panic"},
+			SearchType:       "bug+issue+junit",
+			MaxAge:           24 * time.Hour,
+			MaxBytes:         20 * 1024 * 1024,
+			GroupByComponent: true,
+		},
+		{
+			Search:     []string{"panic"},
+			SearchType: "junit",
+			MaxAge:     24 * time.Hour,
+			MaxBytes:   20 * 1024 * 1024,
+			Context:    3,
+		},
+	} {
+		index.Mode = "text"
+		parsed, err := parseRequest(httptest.NewRequest("GET", "/?"+index.Query().Encode(), nil), "text", 14*24*time.Hour, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// derived fields are compared through the fields they are parsed from
+		parsed.JobFilter, parsed.jobName, parsed.buildID, parsed.outputBytes, parsed.bytesScanned = nil, "", "", nil, nil
+		if !reflect.DeepEqual(index, parsed) {
+			t.Errorf("query %s did not round trip:\n%#v\n%#v", index.Query().Encode(), index, parsed)
+		}
+	}
+}
+
+// BenchmarkParseRequest_jobFilter compares parsing a request with the same job name
+// filters, which are compiled once and then found in the filter cache, with parsing
+// requests whose filters differ every time and are always compiled.
+func BenchmarkParseRequest_jobFilter(b *testing.B) {
+	const include, exclude = "^(periodic|release)-ci-openshift-.*-e2e-(aws|gcp|azure)(-ovn)?-upgrade$", "-(4\\.[0-9]+|okd)-"
+	target := "/?" + url.Values{"search": {"timeout"}, "name": {include}, "excludeName": {exclude}}.Encode()
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := parseRequest(httptest.NewRequest("GET", target, nil), "text", 24*time.Hour, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			// a unique filter is never in the cache
+			target := "/?" + url.Values{"search": {"timeout"}, "name": {fmt.Sprintf("%s|^job-%d$", include, i)}, "excludeName": {fmt.Sprintf("%s|^job-%d$", exclude, i)}}.Encode()
+			if _, err := parseRequest(httptest.NewRequest("GET", target, nil), "text", 24*time.Hour, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func Test_parseRequest_timeRange(t *testing.T) {
+	index, err := parseRequest(httptest.NewRequest("GET", "/?search=x&from=2024-05-07&to=2024-05-08T12:00:00%2B02:00", nil), "text", 14*24*time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to := time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 8, 10, 0, 0, 0, time.UTC)
+	if !index.From.Equal(from) || !index.To.Equal(to) {
+		t.Fatalf("unexpected range %s to %s", index.From, index.To)
+	}
+
+	for _, query := range []string{"from=yesterday", "to=2024-13-01", "from=2024-05-08&to=2024-05-07"} {
+		if _, err := parseRequest(httptest.NewRequest("GET", "/?search=x&"+query, nil), "text", 14*24*time.Hour, nil); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestIndex_InTimeRange(t *testing.T) {
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name  string
+		index Index
+		t     time.Time
+		want  bool
+	}{
+		{name: "unknown time", index: Index{MaxAge: time.Hour}, want: true},
+		{name: "within max age", index: Index{MaxAge: 2 * time.Hour}, t: now.Add(-time.Hour), want: true},
+		{name: "older than max age", index: Index{MaxAge: time.Hour}, t: now.Add(-2 * time.Hour)},
+		{name: "after now without to", index: Index{MaxAge: time.Hour}, t: now.Add(time.Hour), want: true},
+		{name: "within window", index: Index{MaxAge: time.Hour, From: now.Add(-72 * time.Hour), To: now.Add(-48 * time.Hour)}, t: now.Add(-60 * time.Hour), want: true},
+		{name: "after window", index: Index{MaxAge: time.Hour, From: now.Add(-72 * time.Hour), To: now.Add(-48 * time.Hour)}, t: now.Add(-time.Minute)},
+		{name: "before window", index: Index{From: now.Add(-72 * time.Hour), To: now.Add(-48 * time.Hour)}, t: now.Add(-73 * time.Hour)},
+		{name: "max age before to", index: Index{MaxAge: time.Hour, To: now.Add(-48 * time.Hour)}, t: now.Add(-48*time.Hour - 30*time.Minute), want: true},
+		{name: "older than max age before to", index: Index{MaxAge: time.Hour, To: now.Add(-48 * time.Hour)}, t: now.Add(-50 * time.Hour)},
+	} {
+		if got := tt.index.InTimeRange(tt.t, now); got != tt.want {
+			t.Errorf("%s: got %t", tt.name, got)
+		}
+	}
+}
@@ -3,9 +3,13 @@ package jira
 import (
 	"context"
 	"fmt"
-	"k8s.io/klog/v2"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"k8s.io/klog/v2"
+
 	jiraBaseClient "github.com/andygrunwald/go-jira"
 	jiraClient "sigs.k8s.io/prow/prow/jira"
 )
@@ -29,6 +33,27 @@ func IssueTargetVersionIDs(s jiraBaseClient.Issue) []string {
 	return listOfTargetVersions
 }
 
+// IssueLinkDescriptions returns the links of an issue as the relation to the linked issue
+// followed by its key, e.g. "blocks OCPBUGS-1234".
+func IssueLinkDescriptions(s jiraBaseClient.Issue) []string {
+	if s.Fields == nil {
+		return nil
+	}
+	var links []string
+	for _, link := range s.Fields.IssueLinks {
+		if link == nil {
+			continue
+		}
+		switch {
+		case link.OutwardIssue != nil && len(link.OutwardIssue.Key) > 0:
+			links = append(links, fmt.Sprintf("%s %s", link.Type.Outward, link.OutwardIssue.Key))
+		case link.InwardIssue != nil && len(link.InwardIssue.Key) > 0:
+			links = append(links, fmt.Sprintf("%s %s", link.Type.Inward, link.InwardIssue.Key))
+		}
+	}
+	return links
+}
+
 func FilterPrivateIssues(issue *jiraBaseClient.Issue) bool {
 	securityField, err := jiraClient.GetIssueSecurityLevel(issue)
 	if err != nil {
@@ -51,6 +76,34 @@ func FilterPrivateIssues(issue *jiraBaseClient.Issue) bool {
 	return false
 }
 
+// FilterByProject returns a filter that includes only issues in one of the projects with
+// the provided keys. If no keys are provided all issues are included.
+func FilterByProject(keys ...string) func(issue *jiraBaseClient.Issue) bool {
+	return func(issue *jiraBaseClient.Issue) bool {
+		if len(keys) == 0 {
+			return true
+		}
+		for _, key := range keys {
+			if strings.HasPrefix(issue.Key, key+"-") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AndFilter returns a filter that includes only issues included by every filter.
+func AndFilter(filters ...func(issue *jiraBaseClient.Issue) bool) func(issue *jiraBaseClient.Issue) bool {
+	return func(issue *jiraBaseClient.Issue) bool {
+		for _, filter := range filters {
+			if !filter(issue) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 // TODO - currently unused jira field. check what is necessary, remove the rest. Move to the Jira client/plugin
 // This might be moved to the Jira client
 //func fixVersionJira(s jiraClient.Issue) []string {
@@ -89,13 +142,101 @@ func addTimeToJQL(t time.Time, jql string) string {
 	}
 	return jql
 }
+
+// commentPageSize is the number of comments requested per page when an issue has more
+// comments than were returned by a search.
+const commentPageSize = 100
+
+// commentPage is a page of the comments of an issue, as returned both in the comment
+// field of a search and by the issue comment endpoint.
+type commentPage struct {
+	StartAt    int                       `json:"startAt"`
+	MaxResults int                       `json:"maxResults"`
+	Total      int                       `json:"total"`
+	Comments   []*jiraBaseClient.Comment `json:"comments"`
+}
+
+// commentSearchResult is a search for the comments of issues. The search result of the
+// jira library omits the total number of comments of each issue, which is needed to tell
+// whether comments are missing.
+type commentSearchResult struct {
+	Issues []struct {
+		ID     string `json:"id"`
+		Key    string `json:"key"`
+		Fields struct {
+			Comment commentPage `json:"comment"`
+		} `json:"fields"`
+	} `json:"issues"`
+}
+
+// IssueCommentsByID returns all comments of the provided issues. Jira limits the number
+// of comments returned for each issue by a search, so any remaining comments are
+// retrieved page by page.
 func (c *Client) IssueCommentsByID(ctx context.Context, issues ...int) ([]jiraBaseClient.Issue, error) {
-	var searchOptions jiraBaseClient.SearchOptions
-	jqlQuery := fmt.Sprintf("id IN (%s)", jqlParseIds(issues))
-	searchOptions.MaxResults = len(issues)
-	searchOptions.Fields = []string{"comment"}
-	search, _, err := c.Client.SearchWithContext(ctx, jqlQuery, &searchOptions)
-	return search, err
+	query := url.Values{}
+	query.Set("jql", fmt.Sprintf("id IN (%s)", jqlParseIds(issues)))
+	query.Set("maxResults", strconv.Itoa(len(issues)))
+	query.Set("fields", "comment")
+	var search commentSearchResult
+	if err := c.get(ctx, "rest/api/2/search?"+query.Encode(), &search); err != nil {
+		return nil, err
+	}
+
+	result := make([]jiraBaseClient.Issue, 0, len(search.Issues))
+	for _, issue := range search.Issues {
+		comments := issue.Fields.Comment.Comments
+		for len(comments) < issue.Fields.Comment.Total {
+			query := url.Values{}
+			query.Set("startAt", strconv.Itoa(len(comments)))
+			query.Set("maxResults", strconv.Itoa(commentPageSize))
+			var page commentPage
+			if err := c.get(ctx, fmt.Sprintf("rest/api/2/issue/%s/comment?%s", url.PathEscape(issue.ID), query.Encode()), &page); err != nil {
+				return nil, fmt.Errorf("unable to retrieve comments of issue %s: %w", issue.ID, err)
+			}
+			if len(page.Comments) == 0 {
+				break
+			}
+			comments = append(comments, page.Comments...)
+		}
+		result = append(result, jiraBaseClient.Issue{
+			ID:  issue.ID,
+			Key: issue.Key,
+			Fields: &jiraBaseClient.IssueFields{
+				Comments: &jiraBaseClient.Comments{Comments: comments},
+			},
+		})
+	}
+	return result, nil
+}
+
+// get decodes the response to a GET of the API path into v.
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	jc := c.Client.JiraClient()
+	req, err := jc.NewRequestWithContext(ctx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := jc.Do(req, v)
+	if err != nil {
+		return jiraClient.HandleJiraError(resp, err)
+	}
+	return nil
+}
+
+// CountIssues returns the number of issues matching jql without retrieving them, or the
+// error reported by the server if the query is invalid.
+func (c *Client) CountIssues(ctx context.Context, jql string) (int, error) {
+	// a MaxResults of zero is not sent to the server, so retrieve a single issue id
+	searchOptions := jiraBaseClient.SearchOptions{
+		MaxResults:    1,
+		Fields:        []string{"id"},
+		ValidateQuery: "strict",
+	}
+	_, resp, err := c.Client.SearchWithContext(ctx, jql, &searchOptions)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Total, nil
 }
 
 func (c *Client) SearchIssues(ctx context.Context, args SearchIssuesArgs) ([]jiraBaseClient.Issue, error) {
@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"context"
 	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
+	jiraBaseClient "github.com/andygrunwald/go-jira"
 	"k8s.io/klog/v2"
 	jiraClient "sigs.k8s.io/prow/prow/jira"
 )
@@ -101,3 +106,95 @@ func TestClient_Search(t *testing.T) {
 	}
 	t.Logf("%d issues after %s", len(got), closeToNowTime)
 }
+
+func TestClient_IssueCommentsByID_paginated(t *testing.T) {
+	comment := func(id int) string {
+		return fmt.Sprintf(`{"id":"%d","body":"comment %d","created":"2023-01-01T00:00:00.000+0000"}`, id, id)
+	}
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/rest/api/2/search":
+			// the search returns the first two comments of issue 1 and all comments of issue 2
+			fmt.Fprintf(w, `{"issues":[
+				{"id":"1","key":"OCPBUGS-1","fields":{"comment":{"startAt":0,"maxResults":2,"total":5,"comments":[%s,%s]}}},
+				{"id":"2","key":"OCPBUGS-2","fields":{"comment":{"startAt":0,"maxResults":2,"total":1,"comments":[%s]}}}
+			]}`, comment(0), comment(1), comment(10))
+		case "/rest/api/2/issue/1/comment":
+			startAt := req.URL.Query().Get("startAt")
+			pages = append(pages, startAt)
+			switch startAt {
+			case "2":
+				fmt.Fprintf(w, `{"startAt":2,"maxResults":2,"total":5,"comments":[%s,%s]}`, comment(2), comment(3))
+			case "4":
+				fmt.Fprintf(w, `{"startAt":4,"maxResults":2,"total":5,"comments":[%s]}`, comment(4))
+			default:
+				http.Error(w, "unexpected page", http.StatusBadRequest)
+			}
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	jc, err := jiraClient.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{Client: jc}
+	got, err := c.IssueCommentsByID(context.TODO(), 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("unexpected issues: %#v", got)
+	}
+	var ids []string
+	for _, comment := range got[0].Fields.Comments.Comments {
+		ids = append(ids, comment.ID)
+	}
+	if want := []string{"0", "1", "2", "3", "4"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("unexpected comments for the first issue: %v", ids)
+	}
+	if got[0].Key != "OCPBUGS-1" || got[0].Fields.Comments.Comments[4].Body != "comment 4" {
+		t.Errorf("unexpected first issue: %#v", got[0])
+	}
+	if len(got[1].Fields.Comments.Comments) != 1 {
+		t.Errorf("unexpected comments for the second issue: %#v", got[1].Fields.Comments.Comments)
+	}
+	if want := []string{"2", "4"}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("unexpected pages requested: %v", pages)
+	}
+}
+
+func TestFilterByProject(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		keys []string
+		key  string
+		want bool
+	}{
+		{name: "no projects", key: "OCPBUGS-1", want: true},
+		{name: "matching project", keys: []string{"OCPBUGS", "TRT"}, key: "TRT-12", want: true},
+		{name: "other project", keys: []string{"OCPBUGS", "TRT"}, key: "OCPQE-12", want: false},
+		{name: "project with the same prefix", keys: []string{"OCP"}, key: "OCPBUGS-1", want: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilterByProject(tt.keys...)(&jiraBaseClient.Issue{Key: tt.key}); got != tt.want {
+				t.Errorf("FilterByProject() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAndFilter(t *testing.T) {
+	include := func(*jiraBaseClient.Issue) bool { return true }
+	exclude := func(*jiraBaseClient.Issue) bool { return false }
+	issue := &jiraBaseClient.Issue{Key: "OCPBUGS-1"}
+	if !AndFilter()(issue) || !AndFilter(include, include)(issue) {
+		t.Errorf("expected issue to be included")
+	}
+	if AndFilter(include, exclude)(issue) || AndFilter(FilterByProject("TRT"), include)(issue) {
+		t.Errorf("expected issue to be excluded")
+	}
+}
@@ -2,6 +2,7 @@ package jira
 
 import (
 	"context"
+	"fmt"
 	helpers "github.com/openshift/ci-search/pkg/jira"
 	"k8s.io/klog/v2"
 	"reflect"
@@ -65,6 +66,18 @@ func (s *CommentStore) Stats() Stats {
 	}
 }
 
+// Freshness returns the most recent time the comments of any issue in the store were
+// refreshed, or the zero time if the store is empty.
+func (s *CommentStore) Freshness() time.Time {
+	var newest time.Time
+	for _, item := range s.store.List() {
+		if t := item.(*IssueComments).RefreshTime; t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
+
 func (s *CommentStore) Get(id int) (*IssueComments, bool) {
 	item, ok, err := s.store.GetByKey(strconv.Itoa(id))
 	if err != nil || !ok {
@@ -73,6 +86,42 @@ func (s *CommentStore) Get(id int) (*IssueComments, bool) {
 	return item.(*IssueComments), true
 }
 
+// GetByKey returns the comments of the issue with the given key, such as OCPBUGS-1.
+func (s *CommentStore) GetByKey(key string) (*IssueComments, bool) {
+	for _, obj := range s.store.List() {
+		comments := obj.(*IssueComments)
+		if strings.EqualFold(comments.Info.Key, key) {
+			return comments, true
+		}
+	}
+	return nil, false
+}
+
+// Refresh fetches the comments of an issue in the store immediately instead of waiting for
+// the next refresh interval, and returns the updated comments.
+func (s *CommentStore) Refresh(ctx context.Context, id int) (*IssueComments, error) {
+	if s.client == nil {
+		return nil, fmt.Errorf("issue comments are not being fetched")
+	}
+	if _, ok := s.Get(id); !ok {
+		return nil, fmt.Errorf("issue %d is not indexed", id)
+	}
+	now := time.Now()
+	issueComments, err := s.client.IssueCommentsByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !s.includePrivate {
+		helpers.FilterIssueComments(&issueComments)
+	}
+	s.mergeIssues(&issueComments, now)
+	comments, ok := s.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("issue %d is not indexed", id)
+	}
+	return comments, nil
+}
+
 func (s *CommentStore) Run(ctx context.Context, informer cache.SharedInformer) error {
 	defer klog.V(2).Infof("Comment worker exited")
 	if s.refreshInterval == 0 {
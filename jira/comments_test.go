@@ -89,3 +89,19 @@ func TestCommentStore(t *testing.T) {
 		break
 	}
 }
+
+func TestCommentStore_Freshness(t *testing.T) {
+	s := NewCommentStore(nil, time.Minute, nil)
+	if !s.Freshness().IsZero() {
+		t.Fatalf("expected an empty store to have no refresh time")
+	}
+	newest := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	for i, refreshed := range []time.Time{newest, newest.Add(-time.Hour)} {
+		if err := s.store.Add(&IssueComments{ObjectMeta: metav1.ObjectMeta{Name: strconv.Itoa(i)}, RefreshTime: refreshed}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.Freshness(); !got.Equal(newest) {
+		t.Errorf("unexpected freshness %s", got)
+	}
+}
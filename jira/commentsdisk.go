@@ -40,12 +40,22 @@ func NewCommentDiskStore(path string, maxAge time.Duration) *CommentDiskStore {
 
 func (s *CommentDiskStore) Run(ctx context.Context, lister *IssueLister, store CommentAccessor, disableWrite bool) {
 	defer klog.V(2).Infof("Comment disk worker exited")
+	// stop waiting for changes once the context is cancelled, so that Run returns after
+	// any in-flight write completes
+	go func() {
+		<-ctx.Done()
+		s.queue.ShutDown()
+	}()
 	wait.UntilWithContext(ctx, func(ctx context.Context) {
 		for {
 			obj, done := s.queue.Get()
 			if done {
 				return
 			}
+			if ctx.Err() != nil {
+				s.queue.Done(obj)
+				return
+			}
 			if disableWrite {
 				s.queue.Done(obj)
 				return
@@ -190,7 +200,7 @@ func (s *CommentDiskStore) write(issue *Issue, comments *IssueComments) error {
 
 	if _, err := fmt.Fprintf(
 		w,
-		"Issue %s: %s\nDescription: %s \nStatus: %s\nResolution: %s\nPriority: %s\nCreator: %s\nAssigned To: %s\nLabels: %s\nTarget Version: %s\n---\n",
+		"Issue %s: %s\nDescription: %s \nStatus: %s\nResolution: %s\nPriority: %s\nCreator: %s\nAssigned To: %s\nLabels: %s\nTarget Version: %s\nLinks: %s\n---\n",
 		issue.Info.ID,
 		helpers.LineSafe(issue.Info.Fields.Summary),
 		helpers.LineSafe(issue.Info.Fields.Description),
@@ -201,6 +211,7 @@ func (s *CommentDiskStore) write(issue *Issue, comments *IssueComments) error {
 		helpers.UserFieldDisplayName(issue.Info.Fields.Assignee),
 		helpers.ArrayLineSafeString(issue.Info.Fields.Labels, ", "),
 		helpers.ArrayLineSafeString(IssueTargetVersionIDs(issue.Info), ", "),
+		helpers.ArrayLineSafeString(IssueLinkDescriptions(issue.Info), ", "),
 		//TODO these fields might or might not contain usefully information. Check what makes sense to keep, and what the requirements are
 		//arrayLineSafe(fixVersionJira(issue.Info), ", "),
 		//arrayLineSafe(versionsJira(issue.Info), ", "),
@@ -244,6 +255,23 @@ func (s *CommentDiskStore) write(issue *Issue, comments *IssueComments) error {
 	return os.Rename(path, finalPath)
 }
 
+// parseIssueLinks reverses IssueLinkDescriptions. Since the direction of a link is not
+// stored, every link is returned as an outward link.
+func parseIssueLinks(text string) []*jiraBaseClient.IssueLink {
+	var links []*jiraBaseClient.IssueLink
+	for _, description := range strings.Split(text, ", ") {
+		i := strings.LastIndex(description, " ")
+		if i == -1 {
+			continue
+		}
+		links = append(links, &jiraBaseClient.IssueLink{
+			Type:         jiraBaseClient.IssueLinkType{Outward: description[:i]},
+			OutwardIssue: &jiraBaseClient.Issue{Key: description[i+1:]},
+		})
+	}
+	return links
+}
+
 var (
 	reDiskCommentsLineHeader        = regexp.MustCompile(`^Issue (\d+): (.*)$`)
 	reDiskCommentsLineCommentHeader = regexp.MustCompile(`^Comment (\d+) by (.+) at (\d\d\d\d-\d\d-\d\dT\d\d:\d\d:\d\d\.\d\d\d[+-]\d\d\d\d)$`)
@@ -365,6 +393,12 @@ ScanHeader:
 			}
 			resolution.Name = parts[1]
 			fields.Resolution = &resolution
+		case strings.HasPrefix(text, "Links: "):
+			parts := strings.SplitN(text, " ", 2)
+			if len(parts) < 2 || len(parts[1]) == 0 {
+				continue
+			}
+			fields.IssueLinks = parseIssueLinks(parts[1])
 
 		case text == "---":
 			foundSeparator = true
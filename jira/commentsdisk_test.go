@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"k8s.io/utils/diff"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -43,6 +44,10 @@ func TestCommentDiskStore_write(t *testing.T) {
 				Summary: "This is a test issue description",
 				Creator: &jiraBaseClient.User{DisplayName: "John Smith"},
 				Labels:  []string{"Openshift"},
+				IssueLinks: []*jiraBaseClient.IssueLink{
+					{Type: jiraBaseClient.IssueLinkType{Outward: "blocks"}, OutwardIssue: &jiraBaseClient.Issue{Key: "OCPBUGS-1234"}},
+					{Type: jiraBaseClient.IssueLinkType{Outward: "is related to"}, OutwardIssue: &jiraBaseClient.Issue{Key: "OCPBUGS-5"}},
+				},
 			},
 		},
 	}
@@ -67,6 +72,10 @@ func TestCommentDiskStore_write(t *testing.T) {
 				Summary: "This is a test issue description",
 				Creator: &jiraBaseClient.User{DisplayName: "John Smith"},
 				Labels:  []string{"Openshift"},
+				IssueLinks: []*jiraBaseClient.IssueLink{
+					{Type: jiraBaseClient.IssueLinkType{Outward: "blocks"}, OutwardIssue: &jiraBaseClient.Issue{Key: "OCPBUGS-1234"}},
+					{Type: jiraBaseClient.IssueLinkType{Outward: "is related to"}, OutwardIssue: &jiraBaseClient.Issue{Key: "OCPBUGS-5"}},
+				},
 			},
 		},
 		Comments: []*jiraBaseClient.Comment{
@@ -154,3 +163,60 @@ func TestCommentDiskStore_write(t *testing.T) {
 		t.Fatalf("%#v", list)
 	}
 }
+
+func TestReadBugComments_links(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name   string
+		header string
+		want   []*jiraBaseClient.IssueLink
+	}{
+		{
+			name:   "file without links",
+			header: "Issue 181: Summary\nStatus: New\nLabels: \nTarget Version: \n---\n",
+		},
+		{
+			name:   "empty links",
+			header: "Issue 181: Summary\nStatus: New\nLinks: \n---\n",
+		},
+		{
+			name:   "links are read as outward links",
+			header: "Issue 181: Summary\nStatus: New\nLinks: is blocked by OCPBUGS-1, duplicates OCPBUGS-2\n---\n",
+			want: []*jiraBaseClient.IssueLink{
+				{Type: jiraBaseClient.IssueLinkType{Outward: "is blocked by"}, OutwardIssue: &jiraBaseClient.Issue{Key: "OCPBUGS-1"}},
+				{Type: jiraBaseClient.IssueLinkType{Outward: "duplicates"}, OutwardIssue: &jiraBaseClient.Issue{Key: "OCPBUGS-2"}},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "issue__OCP-123__181")
+			data := tt.header + "Comment 1 by Alice at 1970-01-01T00:01:40.000+0000\nText\n\x1e"
+			if err := os.WriteFile(path, []byte(data), 0640); err != nil {
+				t.Fatal(err)
+			}
+			comments, err := ReadBugComments(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(comments.Info.Fields.IssueLinks, tt.want) {
+				t.Errorf("unexpected links: %s", diff.ObjectReflectDiff(tt.want, comments.Info.Fields.IssueLinks))
+			}
+		})
+	}
+}
+
+func TestIssueLinkDescriptions(t *testing.T) {
+	issue := jiraBaseClient.Issue{
+		Fields: &jiraBaseClient.IssueFields{
+			IssueLinks: []*jiraBaseClient.IssueLink{
+				{Type: jiraBaseClient.IssueLinkType{Inward: "is blocked by", Outward: "blocks"}, OutwardIssue: &jiraBaseClient.Issue{Key: "OCPBUGS-1"}},
+				{Type: jiraBaseClient.IssueLinkType{Inward: "is blocked by", Outward: "blocks"}, InwardIssue: &jiraBaseClient.Issue{Key: "OCPBUGS-2"}},
+				{Type: jiraBaseClient.IssueLinkType{Inward: "is cloned by", Outward: "clones"}},
+			},
+		},
+	}
+	want := []string{"blocks OCPBUGS-1", "is blocked by OCPBUGS-2"}
+	if got := IssueLinkDescriptions(issue); !reflect.DeepEqual(got, want) {
+		t.Errorf("IssueLinkDescriptions() = %v, want %v", got, want)
+	}
+}
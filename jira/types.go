@@ -3,6 +3,7 @@ package jira
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"k8s.io/klog/v2"
 	"strconv"
 	"time"
@@ -72,7 +73,7 @@ type CommentVisibility struct {
 }
 
 // TODO-check what filed is of interest, the rest can be removed
-var issueInfoFields = []string{"created", "priority", "labels", "versions", "assignee", "updated", "status", "components", "summary", "creator", "subtasks", "reporter", "progress", "resolution", "fixVersions", IssueTargetVersionField}
+var issueInfoFields = []string{"created", "priority", "labels", "versions", "assignee", "updated", "status", "components", "summary", "creator", "subtasks", "reporter", "progress", "resolution", "fixVersions", "issuelinks", IssueTargetVersionField}
 
 type SearchIssuesArgs struct {
 	LastChangeTime time.Time
@@ -128,8 +129,27 @@ func Metav1ToJiraTimeString(t metav1.Time) string {
 	return a
 }
 
+// timeLayouts are the formats Jira uses for timestamps, most common first. Fractional
+// seconds are optional in each, and Z0700 accepts both a Z suffix and a -0700 offset.
+var timeLayouts = []string{
+	"2006-01-02T15:04:05.999Z0700",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999Z0700",
+	"2006-01-02",
+}
+
+// ParseTime parses a Jira timestamp in any of the known Jira formats.
+func ParseTime(timeString string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, timeString); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized Jira timestamp %q", timeString)
+}
+
 func StringToTime(timeString string) time.Time {
-	created, err := time.Parse("2006-01-02T15:04:05.999-0700", timeString)
+	created, err := ParseTime(timeString)
 	if err != nil {
 		klog.Errorf("failed to format the Jira timestamp : %s", timeString)
 	}
@@ -0,0 +1,35 @@
+package jira
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2023-03-14T10:22:51.123+0000", want: time.Date(2023, 3, 14, 10, 22, 51, 123000000, time.UTC)},
+		{value: "2023-03-14T06:22:51.123-0400", want: time.Date(2023, 3, 14, 10, 22, 51, 123000000, time.UTC)},
+		{value: "2023-03-14T10:22:51+0000", want: time.Date(2023, 3, 14, 10, 22, 51, 0, time.UTC)},
+		{value: "2023-03-14T10:22:51.123Z", want: time.Date(2023, 3, 14, 10, 22, 51, 123000000, time.UTC)},
+		{value: "2023-03-14T10:22:51Z", want: time.Date(2023, 3, 14, 10, 22, 51, 0, time.UTC)},
+		{value: "2023-03-14T12:22:51.123+02:00", want: time.Date(2023, 3, 14, 10, 22, 51, 123000000, time.UTC)},
+		{value: "2023-03-14", want: time.Date(2023, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{value: "", wantErr: true},
+		{value: "14/Mar/23 10:22 AM", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTime(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseTime(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
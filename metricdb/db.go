@@ -3,6 +3,7 @@ package metricdb
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -21,8 +22,10 @@ type DB struct {
 	statusURL url.URL
 	db        *sqlx.DB
 	maxAge    time.Duration
+	limits    Limits
 
 	recentlyDeleted int64
+	status          Status
 
 	lock            sync.Mutex
 	jobsByName      map[string]int64
@@ -30,7 +33,7 @@ type DB struct {
 	metricsByName   map[string]int64
 }
 
-func New(path string, statusURL url.URL, maxAge time.Duration) (*DB, error) {
+func New(path string, statusURL url.URL, maxAge time.Duration, limits Limits) (*DB, error) {
 	db, err := sqlx.Open("sqlite", fmt.Sprintf("file:%s?_timeout=3000", url.PathEscape(path)))
 	if err != nil {
 		return nil, fmt.Errorf("unable to open database: %v", err)
@@ -39,6 +42,7 @@ func New(path string, statusURL url.URL, maxAge time.Duration) (*DB, error) {
 		path:      path,
 		statusURL: statusURL,
 		maxAge:    maxAge,
+		limits:    limits,
 		db:        db,
 	}, nil
 }
@@ -58,17 +62,28 @@ func (d *DB) Run() error {
 	if err := d.refreshJobCounts(); err != nil {
 		return fmt.Errorf("unable to load job counts: %v", err)
 	}
-	if d.recentlyDeleted > 10000 {
-		if _, err := d.db.Exec("VACUUM"); err != nil {
-			klog.Errorf("unable to vacuum database: %v", err)
-		} else {
-			d.recentlyDeleted = 0
-		}
+	if d.needsVacuum() {
+		d.vacuum()
 	}
 	if _, err := d.db.Exec("PRAGMA OPTIMIZE"); err != nil {
 		klog.Errorf("unable to optimize database: %v", err)
 	}
-	return d.indexFromGCS(start)
+	err := d.indexFromGCS(start)
+	if sizeErr := d.enforceSizeLimit(); sizeErr != nil {
+		klog.Errorf("unable to limit database size: %v", sizeErr)
+	}
+	if statusErr := d.refreshStatus(); statusErr != nil {
+		klog.Errorf("unable to read database status: %v", statusErr)
+	}
+	return err
+}
+
+func (d *DB) vacuum() {
+	if _, err := d.db.Exec("VACUUM"); err != nil {
+		klog.Errorf("unable to vacuum database: %v", err)
+		return
+	}
+	d.recentlyDeleted = 0
 }
 
 func (d *DB) NewReadConnection() (*sqlx.DB, error) {
@@ -233,14 +248,8 @@ func (d *DB) indexFromGCS(start time.Time) error {
 	}
 
 	if d.maxAge > 0 {
-		oldestTimestamp := start.Add(-d.maxAge).Unix()
-		res, err := d.db.Exec("DELETE FROM metric_value WHERE metric_value.timestamp < ?", oldestTimestamp)
-		if err != nil {
-			return fmt.Errorf("unable to delete metrics older than timestamp %d: %v", oldestTimestamp, err)
-		}
-		if rows, err := res.RowsAffected(); err == nil {
-			klog.Infof("Removed %d metrics older than %s", rows, d.maxAge)
-			d.recentlyDeleted += rows
+		if err := d.expireMetrics(start); err != nil {
+			return err
 		}
 	}
 
@@ -265,7 +274,19 @@ func (d *DB) indexFromGCS(start time.Time) error {
 
 	b.CompletedKey(index.IndexName, lastKey)
 
-	if err := index.EachJob(context.TODO(), gcsClient, 0, d.statusURL, func(partialJob prow.Job, attr *storage.ObjectAttrs) error {
+	ctx := context.Background()
+	if d.limits.ScrapeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.limits.ScrapeBudget)
+		defer cancel()
+	}
+
+	if err := index.EachJob(ctx, gcsClient, 0, d.statusURL, func(partialJob prow.Job, attr *storage.ObjectAttrs) error {
+		// stop before reading another key once over budget, the next scrape resumes from
+		// the last completed key
+		if ctx.Err() != nil {
+			return prow.ErrStop
+		}
 		keysScanned++
 		if keysScanned%1000 == 0 {
 			klog.Infof("Scanned %d job-metrics keys", keysScanned)
@@ -405,9 +426,12 @@ func (d *DB) indexFromGCS(start time.Time) error {
 
 		b.CompletedKey(index.IndexName, attr.Name)
 		return nil
-	}); err != nil {
+	}); err != nil && !budgetExceeded(err) {
 		return err
 	}
+	if ctx.Err() != nil {
+		klog.Infof("Metrics scrape exceeded its budget of %s, remaining keys will be read on the next scrape", d.limits.ScrapeBudget)
+	}
 
 	if err := b.Flush(); err != nil {
 		return err
@@ -420,3 +444,9 @@ func (d *DB) indexFromGCS(start time.Time) error {
 	)
 	return nil
 }
+
+// budgetExceeded returns true if err only reports that a scrape ran out of time, after
+// which the scrape stores the metrics read so far instead of failing.
+func budgetExceeded(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
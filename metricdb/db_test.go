@@ -0,0 +1,29 @@
+package metricdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func Test_budgetExceeded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{err: ctx.Err(), want: true},
+		{err: fmt.Errorf("scan failed: %w", context.DeadlineExceeded), want: true},
+		{err: context.Canceled, want: true},
+		// an error that happens while the budget is exceeded is still returned
+		{err: fmt.Errorf("failed to read index/job-metrics/1: permission denied"), want: false},
+		{err: fmt.Errorf("unexpected end of JSON input"), want: false},
+	} {
+		if got := budgetExceeded(tt.err); got != tt.want {
+			t.Errorf("%v: expected %t, got %t", tt.err, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package metricdb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"k8s.io/klog/v2"
+)
+
+// expireMetrics removes the metric values older than the maximum age as of now. If
+// downsampling is enabled, the removed values are first added to the daily averages of
+// each job, metric, and release version, and any averages older than the downsample
+// maximum age are removed.
+func (d *DB) expireMetrics(now time.Time) error {
+	oldestTimestamp := now.Add(-d.maxAge).Unix()
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := d.removeMetricsBefore(tx, oldestTimestamp)
+	if err != nil {
+		return err
+	}
+
+	if d.limits.DownsampleMaxAge > 0 {
+		oldestDay := now.Add(-d.limits.DownsampleMaxAge).Unix()
+		if _, err := tx.Exec("DELETE FROM release_job_daily WHERE day < ?", oldestDay); err != nil {
+			return fmt.Errorf("unable to delete daily averages older than timestamp %d: %v", oldestDay, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	klog.Infof("Removed %d metrics older than %s", rows, d.maxAge)
+	d.recentlyDeleted += rows
+	return nil
+}
+
+// removeMetricsBefore removes the metric values older than timestamp in tx and returns
+// the number removed. If downsampling is enabled, the removed values are first added to
+// the daily averages of each job, metric, and release version.
+func (d *DB) removeMetricsBefore(tx *sqlx.Tx, timestamp int64) (int64, error) {
+	if d.limits.DownsampleMaxAge != 0 {
+		// existing averages are combined with the newly expired values by weight
+		res, err := tx.Exec(`
+			INSERT INTO release_job_daily (day, job_id, metric_id, metric_selector, version, value, samples)
+			SELECT (m.timestamp / 86400) * 86400, m.job_id, m.metric_id, m.metric_selector, r.version, avg(m.value), count(*)
+			FROM metric_value AS m, release_job AS r
+			WHERE
+				m.timestamp < ? AND
+				r.job_id = m.job_id AND r.job_number = m.job_number AND
+				r.type == 'target'
+			GROUP BY 1, 2, 3, 4, 5
+			ON CONFLICT(day, job_id, metric_id, metric_selector, version) DO UPDATE SET
+				value = (value * samples + excluded.value * excluded.samples) / (samples + excluded.samples),
+				samples = samples + excluded.samples
+		`, timestamp)
+		if err != nil {
+			return 0, fmt.Errorf("unable to downsample metrics older than timestamp %d: %v", timestamp, err)
+		}
+		if rows, err := res.RowsAffected(); err == nil {
+			klog.Infof("Recorded %d daily averages of metrics older than timestamp %d", rows, timestamp)
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM metric_value WHERE metric_value.timestamp < ?", timestamp)
+	if err != nil {
+		return 0, fmt.Errorf("unable to delete metrics older than timestamp %d: %v", timestamp, err)
+	}
+	rows, _ := res.RowsAffected()
+	return rows, nil
+}
@@ -0,0 +1,84 @@
+package metricdb
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestDB_expireMetrics(t *testing.T) {
+	d, err := New(filepath.Join(t.TempDir(), "metrics.db"), url.URL{}, 48*time.Hour, Limits{DownsampleMaxAge: 30 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// simulate a database created before the daily averages were added
+	if _, err := d.db.Exec(`PRAGMA user_version = 0`); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateSchema(d.db); err != nil {
+		t.Fatal(err)
+	}
+	var version int
+	if err := d.db.Get(&version, "PRAGMA user_version"); err != nil || version != len(migrations) {
+		t.Fatalf("unexpected schema version %d: %v", version, err)
+	}
+
+	day := int64(10 * 86400)
+	now := time.Unix(day+5*86400, 0)
+	insert := func(jobNumber, timestamp int64, value float64) {
+		t.Helper()
+		if _, err := d.db.Exec(`INSERT INTO release_job (major, minor, micro, timestamp, stream, pre, version, job_id, job_number, type) VALUES (4, 8, 0, ?, 'nightly', '', '4.8.0', 1, ?, 'target')`, timestamp, jobNumber); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.db.Exec(`INSERT INTO metric_value (job_id, job_number, metric_id, metric_selector, timestamp, value) VALUES (1, ?, 1, '', ?, ?)`, jobNumber, timestamp, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert(1, day+100, 1)
+	insert(2, day+200, 3)
+	insert(3, now.Unix(), 100)
+	if err := d.expireMetrics(now); err != nil {
+		t.Fatal(err)
+	}
+
+	type daily struct {
+		Day     int64   `db:"day"`
+		Value   float64 `db:"value"`
+		Samples int64   `db:"samples"`
+	}
+	var averages []daily
+	if err := d.db.Select(&averages, "SELECT day, value, samples FROM release_job_daily"); err != nil {
+		t.Fatal(err)
+	}
+	if len(averages) != 1 || averages[0] != (daily{Day: day, Value: 2, Samples: 2}) {
+		t.Fatalf("unexpected daily averages: %#v", averages)
+	}
+	if rows, err := d.rows(); err != nil || rows != 1 {
+		t.Fatalf("expected only the recent metric to remain: %d %v", rows, err)
+	}
+
+	// values expiring later on the same day are averaged with the existing average
+	insert(4, day+300, 8)
+	if err := d.expireMetrics(now); err != nil {
+		t.Fatal(err)
+	}
+	averages = nil
+	if err := d.db.Select(&averages, "SELECT day, value, samples FROM release_job_daily"); err != nil {
+		t.Fatal(err)
+	}
+	if len(averages) != 1 || averages[0] != (daily{Day: day, Value: 4, Samples: 3}) {
+		t.Fatalf("unexpected daily averages: %#v", averages)
+	}
+
+	// averages older than the downsample age are removed
+	if err := d.expireMetrics(now.Add(30 * 24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := d.db.Get(&count, "SELECT count(*) FROM release_job_daily"); err != nil || count != 1 {
+		t.Fatalf("expected only the newer daily average to remain: %d %v", count, err)
+	}
+}
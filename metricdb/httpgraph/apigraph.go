@@ -16,12 +16,15 @@ import (
 )
 
 type APIJobGraphResponse struct {
-	Success bool                              `json:"success"`
-	Reason  string                            `json:"reason"`
-	Message string                            `json:"message"`
-	Labels  []string                          `json:"labels"`
-	Data    map[string]APIGraphSeriesNullable `json:"data"`
-	Series  []APIGraphSeriesDefinition        `json:"series"`
+	Success bool     `json:"success"`
+	Reason  string   `json:"reason"`
+	Message string   `json:"message"`
+	Labels  []string `json:"labels"`
+	// Timestamps is set when a time axis is requested and holds the unix time in seconds
+	// of each release in Labels, in increasing order.
+	Timestamps []int64                           `json:"timestamps,omitempty"`
+	Data       map[string]APIGraphSeriesNullable `json:"data"`
+	Series     []APIGraphSeriesDefinition        `json:"series"`
 
 	MaxValue float64 `json:"maxValue"`
 }
@@ -81,6 +84,34 @@ func (s APIGraphSeriesValuesNullableFromFloat64) MarshalJSON() ([]byte, error) {
 	return buf, nil
 }
 
+// maxSmoothWindow is the largest number of values that may be averaged by smooth.
+const maxSmoothWindow = 100
+
+// movingAverage returns a copy of series where each value is replaced by the average of
+// it and up to window-1 preceding values. Zero values are missing and are neither
+// averaged nor replaced, so gaps in the series are preserved.
+func movingAverage(series []float64, window int) []float64 {
+	if window <= 1 {
+		return series
+	}
+	averaged := make([]float64, len(series))
+	recent := make([]float64, 0, window)
+	var sum float64
+	for i, v := range series {
+		if v == 0 {
+			continue
+		}
+		if len(recent) == window {
+			sum -= recent[0]
+			recent = recent[1:]
+		}
+		recent = append(recent, v)
+		sum += v
+		averaged[i] = sum / float64(len(recent))
+	}
+	return averaged
+}
+
 func (s *Server) HandleAPIJobGraph(w http.ResponseWriter, req *http.Request) {
 	if s.DB == nil {
 		http.Error(w, "Metrics graphing is disabled", http.StatusMethodNotAllowed)
@@ -95,33 +126,35 @@ func (s *Server) HandleAPIJobGraph(w http.ResponseWriter, req *http.Request) {
 		klog.Infof("Render API graph %s query=%s render=%s duration=%s success=%t", graph.String(), queryDuration.Truncate(time.Millisecond/10), renderDuration.Truncate(time.Millisecond/10), time.Now().Sub(start).Truncate(time.Millisecond), success)
 	}()
 
-	db, err := s.DB.NewReadConnection()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Unable to connect to database: %v", err), http.StatusInternalServerError)
+	format := req.FormValue("format")
+	switch format {
+	case "", "json", "csv":
+	default:
+		http.Error(w, fmt.Sprintf("Bad input: unrecognized format %q", format), http.StatusBadRequest)
 		return
 	}
 
 	queryStart := time.Now()
-	result, reason, err := handleAPIJobGraph(req, db)
-	if err != nil {
-		result = &APIJobGraphResponse{Reason: reason, Message: err.Error()}
+	var result *APIJobGraphResponse
+	if s.tryAcquireQuery() {
+		result = s.queryAPIJobGraph(req)
+		s.releaseQuery()
 	} else {
-		result.Success = true
-		result.Reason = ""
-		result.Message = ""
+		result = &APIJobGraphResponse{Reason: "TooManyRequests", Message: "Too many graph queries are running, try again later"}
 	}
 	renderStart := time.Now()
 	queryDuration = renderStart.Sub(queryStart)
 
+	if format == "csv" {
+		success = writeAPIJobGraphCSV(w, req, result)
+		renderDuration = time.Now().Sub(renderStart)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	writer := httpwriter.ForRequest(w, req)
 	if !result.Success {
-		switch result.Reason {
-		case "BadRequest":
-			w.WriteHeader(http.StatusBadRequest)
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		w.WriteHeader(responseStatus(result))
 	}
 	jw := json.NewEncoder(writer)
 	if err := jw.Encode(result); err != nil {
@@ -134,6 +167,118 @@ func (s *Server) HandleAPIJobGraph(w http.ResponseWriter, req *http.Request) {
 	success = true
 }
 
+// responseStatus returns the HTTP status code for an unsuccessful graph response.
+func responseStatus(result *APIJobGraphResponse) int {
+	switch result.Reason {
+	case "BadRequest":
+		return http.StatusBadRequest
+	case "TooManyRequests":
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// queryAPIJobGraph answers a graph request from a new read connection to the database.
+func (s *Server) queryAPIJobGraph(req *http.Request) *APIJobGraphResponse {
+	db, err := s.DB.NewReadConnection()
+	if err != nil {
+		return &APIJobGraphResponse{Reason: "InternalError", Message: fmt.Sprintf("Unable to connect to database: %v", err)}
+	}
+	defer db.Close()
+
+	result, reason, err := handleAPIJobGraph(req, db)
+	if err != nil {
+		return &APIJobGraphResponse{Reason: reason, Message: err.Error()}
+	}
+	result.Success = true
+	result.Reason = ""
+	result.Message = ""
+	return result
+}
+
+// APIMetricName describes how many values are stored for a metric.
+type APIMetricName struct {
+	Name       string `json:"name"`
+	ValueCount int64  `json:"valueCount"`
+	JobCount   int64  `json:"jobCount"`
+}
+
+// HandleAPIMetricNames lists every known metric with the number of stored values and the
+// number of jobs that have values. If one or more job parameters are passed, only values
+// for those jobs are counted.
+func (s *Server) HandleAPIMetricNames(w http.ResponseWriter, req *http.Request) {
+	if s.DB == nil {
+		http.Error(w, "Metrics graphing is disabled", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("Bad form input: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	db, err := s.DB.NewReadConnection()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to connect to database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	names, err := metricNames(db, req.Form["job"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to list metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+	if err := json.NewEncoder(writer).Encode(names); err != nil {
+		klog.Errorf("Failed to write response: %v", err)
+	}
+}
+
+// metricNames returns the metrics in db ordered by name, counting only the values of
+// jobNames if any are provided.
+func metricNames(db *sqlx.DB, jobNames []string) ([]APIMetricName, error) {
+	query, args := `
+		SELECT metric.name, count(m.metric_id), count(DISTINCT m.job_id)
+		FROM metric LEFT JOIN metric_value AS m ON m.metric_id = metric.id
+		GROUP BY metric.id
+		ORDER BY metric.name
+	`, []interface{}(nil)
+	if len(jobNames) > 0 {
+		var err error
+		query, args, err = sqlx.In(`
+			SELECT metric.name, count(m.metric_id), count(DISTINCT m.job_id)
+			FROM metric LEFT JOIN metric_value AS m ON m.metric_id = metric.id AND m.job_id IN (
+				SELECT id FROM job WHERE name IN (?)
+			)
+			GROUP BY metric.id
+			ORDER BY metric.name
+		`, jobNames)
+		if err != nil {
+			return nil, err
+		}
+		query = db.Rebind(query)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := make([]APIMetricName, 0, 64)
+	for rows.Next() {
+		var name APIMetricName
+		if err := rows.Scan(&name.Name, &name.ValueCount, &name.JobCount); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
 func handleAPIJobGraph(req *http.Request, db *sqlx.DB) (*APIJobGraphResponse, string, error) {
 	if err := req.ParseForm(); err != nil {
 		return nil, "BadRequest", fmt.Errorf("invalid input, must be GET or POST with url encoded body")
@@ -144,13 +289,39 @@ func handleAPIJobGraph(req *http.Request, db *sqlx.DB) (*APIJobGraphResponse, st
 		return nil, "BadRequest", fmt.Errorf("'job' must be specified as one or more jobs to query")
 	}
 
-	metricName := req.FormValue("metric")
-	if len(metricName) == 0 {
-		return nil, "BadRequest", fmt.Errorf("'metric' must be specified as the name of a metric")
+	var metricNames []string
+	for _, name := range req.Form["metric"] {
+		if len(name) > 0 {
+			metricNames = append(metricNames, name)
+		}
+	}
+	if len(metricNames) == 0 {
+		return nil, "BadRequest", fmt.Errorf("'metric' must be specified as the name of one or more metrics")
+	}
+
+	smooth := 1
+	if value := req.FormValue("smooth"); len(value) > 0 {
+		var err error
+		smooth, err = strconv.Atoi(value)
+		if err != nil || smooth < 1 || smooth > maxSmoothWindow {
+			return nil, "BadRequest", fmt.Errorf("'smooth' must be a number of values between 1 and %d to average", maxSmoothWindow)
+		}
+	}
+
+	// the time axis places each release at its timestamp instead of at its position, so
+	// releases without a timestamp cannot be shown
+	var timeAxis bool
+	if value := req.FormValue("timeAxis"); len(value) > 0 {
+		var err error
+		timeAxis, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, "BadRequest", fmt.Errorf("'timeAxis' must be true or false")
+		}
 	}
 
 	type seriesKey struct {
 		jobId    int64
+		metric   string
 		selector string
 	}
 
@@ -165,16 +336,17 @@ func handleAPIJobGraph(req *http.Request, db *sqlx.DB) (*APIJobGraphResponse, st
 		}
 
 		query, args, err := sqlx.In(`
-		SELECT r.timestamp, r.version, m.job_id, m.metric_selector, avg(m.value) as value 
+		SELECT r.timestamp, r.version, m.job_id, metric.name, m.metric_selector, avg(m.value) as value 
 		FROM metric_value AS m, release_job AS r, job, metric
 		WHERE
-			m.metric_id == metric.id AND metric.name == ? AND
+			m.metric_id == metric.id AND metric.name IN (?) AND
 			r.job_id = m.job_id AND r.job_id = job.id AND job.name IN (?) AND
 			m.job_number = r.job_number AND 
-			r.type == 'target' 
-		GROUP BY r.job_number, m.metric_selector
-		ORDER by r.timestamp, r.version, r.job_id, m.metric_selector;
-		`, metricName, jobNames)
+			r.type == 'target' AND
+			(? OR r.timestamp > 0)
+		GROUP BY r.job_number, m.metric_id, m.metric_selector
+		ORDER by r.timestamp, r.version, r.job_id, metric.name, m.metric_selector;
+		`, metricNames, jobNames, !timeAxis)
 		if err != nil {
 			return fmt.Errorf("unable to query series: %v", err)
 		}
@@ -188,10 +360,11 @@ func handleAPIJobGraph(req *http.Request, db *sqlx.DB) (*APIJobGraphResponse, st
 		var timestamp int64
 		var version string
 		var jobId int64
+		var metric string
 		var selector string
 		var value float64
 		for rows.Next() {
-			if err := rows.Scan(&timestamp, &version, &jobId, &selector, &value); err != nil {
+			if err := rows.Scan(&timestamp, &version, &jobId, &metric, &selector, &value); err != nil {
 				return fmt.Errorf("unable to scan query: %v", err)
 			}
 			rowCount++
@@ -203,7 +376,7 @@ func handleAPIJobGraph(req *http.Request, db *sqlx.DB) (*APIJobGraphResponse, st
 				maxValue = value
 			}
 
-			key := seriesKey{jobId: jobId, selector: selector}
+			key := seriesKey{jobId: jobId, metric: metric, selector: selector}
 			series, ok := seriesByJobId[key]
 			if !ok {
 				series = make([]float64, 0, 1024)
@@ -284,6 +457,9 @@ func handleAPIJobGraph(req *http.Request, db *sqlx.DB) (*APIJobGraphResponse, st
 	}
 
 	result.Labels = labels
+	if timeAxis {
+		result.Timestamps = timestamps
+	}
 
 	result.Data = make(map[string]APIGraphSeriesNullable)
 
@@ -293,6 +469,10 @@ func handleAPIJobGraph(req *http.Request, db *sqlx.DB) (*APIJobGraphResponse, st
 	result.Data[""] = APIGraphSeriesValuesNullableFromInt64(timestamps)
 	for k, v := range seriesByJobId {
 		label := seriesLabelById[k.jobId]
+		// series of different metrics for the same job are distinguished by metric name
+		if len(metricNames) > 1 {
+			label = fmt.Sprintf("%s %s", label, k.metric)
+		}
 		if len(k.selector) > 0 {
 			label = fmt.Sprintf("%s{%s}", label, k.selector)
 		}
@@ -300,7 +480,7 @@ func handleAPIJobGraph(req *http.Request, db *sqlx.DB) (*APIJobGraphResponse, st
 			Label:  label,
 			Stroke: "blue",
 		})
-		result.Data[label] = APIGraphSeriesValuesNullableFromFloat64(v)
+		result.Data[label] = APIGraphSeriesValuesNullableFromFloat64(movingAverage(v, smooth))
 	}
 	sort.Slice(result.Series, func(i, j int) bool {
 		return result.Series[i].Label < result.Series[j].Label
@@ -0,0 +1,235 @@
+package httpgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/openshift/ci-search/metricdb"
+)
+
+func Test_movingAverage(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		series []float64
+		window int
+		want   []float64
+	}{
+		{name: "no smoothing", series: []float64{1, 0, 3}, window: 1, want: []float64{1, 0, 3}},
+		{name: "empty", window: 3, want: []float64{}},
+		{name: "partial window", series: []float64{3, 6, 9, 12}, window: 3, want: []float64{3, 4.5, 6, 9}},
+		{name: "gaps are preserved and skipped", series: []float64{0, 2, 0, 0, 4, 6, 0, 8}, window: 2, want: []float64{0, 2, 0, 0, 3, 5, 0, 7}},
+		{name: "window larger than series", series: []float64{2, 0, 4}, window: 10, want: []float64{2, 0, 3}},
+		{name: "only gaps", series: []float64{0, 0}, window: 2, want: []float64{0, 0}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := movingAverage(tt.series, tt.window); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("movingAverage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestDB returns a metrics database with the schema created and the rows inserted
+// by statements. The database is closed when the test ends.
+func newTestDB(t *testing.T, statements string) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Open("sqlite", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "metrics.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := metricdb.CreateSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(statements); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func Test_handleAPIJobGraph_multipleMetrics(t *testing.T) {
+	db := newTestDB(t, `
+		INSERT INTO job (id, name) VALUES (1, 'job-a'), (2, 'job-b');
+		INSERT INTO metric (id, name) VALUES (1, 'cpu'), (2, 'memory'), (3, 'disk');
+		INSERT INTO release_job (major, minor, micro, timestamp, stream, pre, version, job_id, job_number, type) VALUES
+			(4, 8, 0, 100, 'nightly', '', '4.8.0-1', 1, 10, 'target'),
+			(4, 8, 0, 200, 'nightly', '', '4.8.0-2', 1, 11, 'target'),
+			(4, 8, 0, 200, 'nightly', '', '4.8.0-2', 2, 20, 'target');
+		INSERT INTO metric_value (job_id, job_number, metric_id, metric_selector, timestamp, value) VALUES
+			(1, 10, 1, '', 100, 1.5),
+			(1, 10, 2, '', 100, 1024),
+			(1, 11, 1, '', 200, 2.5),
+			(1, 11, 3, '', 200, 7),
+			(2, 20, 1, '', 200, 3.5);
+	`)
+
+	labelsOf := func(result *APIJobGraphResponse) []string {
+		var labels []string
+		for _, series := range result.Series {
+			labels = append(labels, series.Label)
+		}
+		sort.Strings(labels)
+		return labels
+	}
+
+	result, _, err := handleAPIJobGraph(httptest.NewRequest("GET", "/graph/api/metrics/job?job=job-a&metric=cpu&metric=memory", nil), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"", "job-a cpu", "job-a memory"}; !reflect.DeepEqual(labelsOf(result), want) {
+		t.Errorf("unexpected series: %v", labelsOf(result))
+	}
+	if want := []string{"4.8.0-1", "4.8.0-2"}; !reflect.DeepEqual(result.Labels, want) {
+		t.Errorf("unexpected labels: %v", result.Labels)
+	}
+	if cpu := result.Data["job-a cpu"].(APIGraphSeriesValuesNullableFromFloat64); !reflect.DeepEqual([]float64(cpu), []float64{1.5, 2.5}) {
+		t.Errorf("unexpected cpu series: %v", cpu)
+	}
+	if memory := result.Data["job-a memory"].(APIGraphSeriesValuesNullableFromFloat64); !reflect.DeepEqual([]float64(memory), []float64{1024, 0}) {
+		t.Errorf("unexpected memory series: %v", memory)
+	}
+
+	// a single metric keeps the job name as the label
+	result, _, err = handleAPIJobGraph(httptest.NewRequest("GET", "/graph/api/metrics/job?job=job-a&job=job-b&metric=cpu", nil), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"", "job-a", "job-b"}; !reflect.DeepEqual(labelsOf(result), want) {
+		t.Errorf("unexpected series: %v", labelsOf(result))
+	}
+
+	if _, reason, err := handleAPIJobGraph(httptest.NewRequest("GET", "/graph/api/metrics/job?job=job-a&metric=", nil), db); err == nil || reason != "BadRequest" {
+		t.Errorf("expected a missing metric to be rejected: %s %v", reason, err)
+	}
+}
+
+func Test_metricNames(t *testing.T) {
+	db := newTestDB(t, `
+		INSERT INTO job (id, name) VALUES (1, 'job-a'), (2, 'job-b');
+		INSERT INTO metric (id, name) VALUES (1, 'memory'), (2, 'cpu'), (3, 'disk');
+		INSERT INTO metric_value (job_id, job_number, metric_id, metric_selector, timestamp, value) VALUES
+			(1, 10, 2, '', 100, 1),
+			(1, 11, 2, '', 200, 2),
+			(2, 20, 2, '', 200, 3),
+			(2, 20, 1, '', 200, 4);
+	`)
+
+	names, err := metricNames(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []APIMetricName{
+		{Name: "cpu", ValueCount: 3, JobCount: 2},
+		{Name: "disk"},
+		{Name: "memory", ValueCount: 1, JobCount: 1},
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("unexpected metrics: %#v", names)
+	}
+
+	names, err = metricNames(db, []string{"job-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []APIMetricName{
+		{Name: "cpu", ValueCount: 2, JobCount: 1},
+		{Name: "disk"},
+		{Name: "memory"},
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("unexpected metrics for job-a: %#v", names)
+	}
+}
+
+func Test_handleAPIJobGraph_timeAxis(t *testing.T) {
+	db := newTestDB(t, `
+		INSERT INTO job (id, name) VALUES (1, 'job-a');
+		INSERT INTO metric (id, name) VALUES (1, 'cpu');
+		INSERT INTO release_job (major, minor, micro, timestamp, stream, pre, version, job_id, job_number, type) VALUES
+			(4, 8, 0, 0, 'ci', '', '4.8.0-0.ci', 1, 9, 'target'),
+			(4, 8, 0, 1617321600, 'nightly', '', '4.8.0-0.nightly-2021-04-02-000000', 1, 11, 'target'),
+			(4, 8, 0, 1617235200, 'nightly', '', '4.8.0-0.nightly-2021-04-01-000000', 1, 10, 'target');
+		INSERT INTO metric_value (job_id, job_number, metric_id, metric_selector, timestamp, value) VALUES
+			(1, 9, 1, '', 1617000000, 0.5),
+			(1, 10, 1, '', 1617235300, 1.5),
+			(1, 11, 1, '', 1617321700, 2.5);
+	`)
+
+	// the ordinal axis includes releases without a timestamp and omits timestamps
+	result, _, err := handleAPIJobGraph(httptest.NewRequest("GET", "/graph/api/metrics/job?job=job-a&metric=cpu", nil), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Labels) != 3 || result.Timestamps != nil {
+		t.Errorf("unexpected ordinal axis: %v %v", result.Labels, result.Timestamps)
+	}
+
+	result, _, err = handleAPIJobGraph(httptest.NewRequest("GET", "/graph/api/metrics/job?job=job-a&metric=cpu&timeAxis=true", nil), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1617235200, 1617321600}; !reflect.DeepEqual(result.Timestamps, want) {
+		t.Fatalf("unexpected timestamps: %v", result.Timestamps)
+	}
+	for i, timestamp := range result.Timestamps {
+		// timestamps in milliseconds would be far in the future
+		if time.Unix(timestamp, 0).After(time.Now()) {
+			t.Errorf("timestamp %d is not in seconds", timestamp)
+		}
+		if i > 0 && timestamp <= result.Timestamps[i-1] {
+			t.Errorf("timestamps are not increasing: %v", result.Timestamps)
+		}
+	}
+	if want := []string{"4.8.0-0.nightly-2021-04-01-000000", "4.8.0-0.nightly-2021-04-02-000000"}; !reflect.DeepEqual(result.Labels, want) {
+		t.Errorf("unexpected labels: %v", result.Labels)
+	}
+	if cpu := result.Data["job-a"].(APIGraphSeriesValuesNullableFromFloat64); !reflect.DeepEqual([]float64(cpu), []float64{1.5, 2.5}) {
+		t.Errorf("unexpected cpu series: %v", cpu)
+	}
+
+	if _, reason, err := handleAPIJobGraph(httptest.NewRequest("GET", "/graph/api/metrics/job?job=job-a&metric=cpu&timeAxis=maybe", nil), db); err == nil || reason != "BadRequest" {
+		t.Errorf("expected an invalid time axis to be rejected: %s %v", reason, err)
+	}
+}
+
+func TestServer_HandleAPIJobGraph_tooManyRequests(t *testing.T) {
+	d, err := metricdb.New(filepath.Join(t.TempDir(), "metrics.db"), url.URL{}, time.Hour, metricdb.Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{DB: d, MaxQueries: 1}
+	if !s.tryAcquireQuery() {
+		t.Fatal("expected a free query slot")
+	}
+
+	w := httptest.NewRecorder()
+	s.HandleAPIJobGraph(w, httptest.NewRequest("GET", "/graph/api/metrics/job?job=job-a&metric=cpu", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	var result APIJobGraphResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || result.Reason != "TooManyRequests" {
+		t.Errorf("unexpected response: %#v", result)
+	}
+
+	// once the slot is released, queries run again
+	s.releaseQuery()
+	w = httptest.NewRecorder()
+	s.HandleAPIJobGraph(w, httptest.NewRequest("GET", "/graph/api/metrics/job?job=", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,110 @@
+package httpgraph
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/ci-search/pkg/httpwriter"
+)
+
+// writeAPIJobGraphCSV writes a graph response as CSV for export to a spreadsheet. Each row
+// is a release with its version and timestamp followed by one column per series, and
+// missing values are left empty. It returns true if the response was written completely.
+func writeAPIJobGraphCSV(w http.ResponseWriter, req *http.Request, result *APIJobGraphResponse) bool {
+	if !result.Success {
+		http.Error(w, result.Message, responseStatus(result))
+		return false
+	}
+
+	header := []string{"version", "timestamp"}
+	columns := make([][]string, 0, len(result.Series))
+	for _, series := range result.Series {
+		if len(series.Label) == 0 {
+			continue
+		}
+		header = append(header, series.Label)
+		columns = append(columns, nullableValues(result.Data[series.Label]))
+	}
+	timestamps, _ := result.Data[""].(APIGraphSeriesValuesNullableFromInt64)
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, csvFilename(req.Form["job"], req.Form["metric"])))
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+
+	cw := csv.NewWriter(writer)
+	cw.Write(header)
+	for i, label := range result.Labels {
+		row := make([]string, 0, len(header))
+		var timestamp string
+		if i < len(timestamps) && timestamps[i] != 0 {
+			timestamp = time.Unix(timestamps[i], 0).UTC().Format(time.RFC3339)
+		}
+		row = append(row, label, timestamp)
+		for _, values := range columns {
+			var value string
+			if i < len(values) {
+				value = values[i]
+			}
+			row = append(row, value)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		klog.Errorf("Failed to write response: %v", err)
+		return false
+	}
+	return true
+}
+
+// nullableValues formats the values of a series for CSV, with missing values as empty
+// strings.
+func nullableValues(series APIGraphSeriesNullable) []string {
+	var values []string
+	switch s := series.(type) {
+	case APIGraphSeriesValuesNullableFromFloat64:
+		values = make([]string, len(s))
+		for i, v := range s {
+			if v != 0 {
+				values[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+	case APIGraphSeriesValuesNullableFromInt64:
+		values = make([]string, len(s))
+		for i, v := range s {
+			if v != 0 {
+				values[i] = strconv.FormatInt(v, 10)
+			}
+		}
+	}
+	return values
+}
+
+// csvFilename returns a download filename for a graph of the given jobs and metrics that
+// contains only characters safe in a filename.
+func csvFilename(jobs, metrics []string) string {
+	var parts []string
+	for _, name := range append(append([]string(nil), jobs...), metrics...) {
+		if len(name) > 0 {
+			parts = append(parts, name)
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{"metrics"}
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, strings.Join(parts, "_"))
+	return name + ".csv"
+}
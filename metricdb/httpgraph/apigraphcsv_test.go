@@ -0,0 +1,76 @@
+package httpgraph
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/metricdb"
+)
+
+func Test_writeAPIJobGraphCSV(t *testing.T) {
+	req := httptest.NewRequest("GET", "/graph/api/metrics/job?job=job-a&metric=cpu&metric=memory:rss&format=csv", nil)
+	if err := req.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+	result := &APIJobGraphResponse{
+		Success: true,
+		Labels:  []string{"4.8.0-1", "4.8.0-2"},
+		Series:  []APIGraphSeriesDefinition{{Label: ""}, {Label: "job-a cpu"}, {Label: "job-a memory:rss"}},
+		Data: map[string]APIGraphSeriesNullable{
+			"":                 APIGraphSeriesValuesNullableFromInt64{1617235200, 0},
+			"job-a cpu":        APIGraphSeriesValuesNullableFromFloat64{1.5, 2.5},
+			"job-a memory:rss": APIGraphSeriesValuesNullableFromFloat64{1024, 0},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	if !writeAPIJobGraphCSV(w, req, result) {
+		t.Fatalf("failed to write csv: %s", w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/csv; charset=utf-8" {
+		t.Errorf("unexpected content type %q", contentType)
+	}
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename="job-a_cpu_memory_rss.csv"` {
+		t.Errorf("unexpected content disposition %q", disposition)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"version", "timestamp", "job-a cpu", "job-a memory:rss"},
+		{"4.8.0-1", "2021-04-01T00:00:00Z", "1.5", "1024"},
+		{"4.8.0-2", "", "2.5", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("unexpected rows: %v", rows)
+	}
+
+	// failures are reported as plain text with the status of the response
+	w = httptest.NewRecorder()
+	if writeAPIJobGraphCSV(w, req, &APIJobGraphResponse{Reason: "BadRequest", Message: "'job' must be specified"}) {
+		t.Fatal("expected a failed response")
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status %d", w.Code)
+	}
+}
+
+func TestServer_HandleAPIJobGraph_unknownFormat(t *testing.T) {
+	d, err := metricdb.New(filepath.Join(t.TempDir(), "metrics.db"), url.URL{}, time.Hour, metricdb.Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{DB: d, MaxQueries: 1}
+	w := httptest.NewRecorder()
+	s.HandleAPIJobGraph(w, httptest.NewRequest("GET", "/graph/api/metrics/job?job=job-a&metric=cpu&format=xml", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"html"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/openshift/ci-search/metricdb"
@@ -14,8 +16,43 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// defaultMaxQueries is the number of graph queries that may run at once if no limit is
+// configured.
+const defaultMaxQueries = 4
+
 type Server struct {
 	DB *metricdb.DB
+	// MaxQueries is the number of graph queries that may run against the database at
+	// once. Requests beyond the limit are rejected. Defaults to 4.
+	MaxQueries int
+	// JobLabel, if set, returns a friendlier label to show for a job in the job select,
+	// or an empty string to show the name of the job.
+	JobLabel func(name string) string
+
+	queriesOnce sync.Once
+	queries     chan struct{}
+}
+
+// tryAcquireQuery reserves a query slot without waiting and returns false if all slots
+// are in use. A reserved slot must be released with releaseQuery.
+func (s *Server) tryAcquireQuery() bool {
+	s.queriesOnce.Do(func() {
+		limit := s.MaxQueries
+		if limit <= 0 {
+			limit = defaultMaxQueries
+		}
+		s.queries = make(chan struct{}, limit)
+	})
+	select {
+	case s.queries <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) releaseQuery() {
+	<-s.queries
 }
 
 type Graph struct{}
@@ -115,15 +152,28 @@ func (s *Server) HandleGraph(w http.ResponseWriter, req *http.Request) {
 	if len(jobIds) == 0 {
 		jobOptions = append(jobOptions, `<option value="">--- Select a metric ---</option>`)
 	}
+	labels := jobLabels(allJobNames, s.JobLabel)
 	for _, name := range allJobNames {
+		escapedName := html.EscapeString(name)
+		escapedLabel := html.EscapeString(labels[name])
 		if count, ok := jobCountsByName[name]; ok {
-			escapedName := html.EscapeString(name)
-			jobOptions = append(jobOptions, fmt.Sprintf(`<option value="%s" %s>%s <em>%d</em></option>`, escapedName, stringSliceSelected(jobNames, name), escapedName, count))
+			jobOptions = append(jobOptions, fmt.Sprintf(`<option value="%s" title="%s" %s>%s <em>%d</em></option>`, escapedName, escapedName, stringSliceSelected(jobNames, name), escapedLabel, count))
 		} else {
-			jobOptions = append(jobOptions, fmt.Sprintf(`<option %s>%s</option>`, stringSliceSelected(jobNames, name), html.EscapeString(name)))
+			jobOptions = append(jobOptions, fmt.Sprintf(`<option value="%s" title="%s" %s>%s</option>`, escapedName, escapedName, stringSliceSelected(jobNames, name), escapedLabel))
 		}
 	}
 
+	smooth := req.FormValue("smooth")
+	smoothOptions := []string{fmt.Sprintf(`<option value="" %s>No smoothing</option>`, stringSelected(smooth, ""))}
+	for _, window := range []string{"3", "5", "10", "20"} {
+		smoothOptions = append(smoothOptions, fmt.Sprintf(`<option value="%s" %s>Average of %s</option>`, window, stringSelected(smooth, window), window))
+	}
+
+	var timeAxisChecked string
+	if timeAxis, _ := strconv.ParseBool(req.FormValue("timeAxis")); timeAxis {
+		timeAxisChecked = "checked"
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	writer := httpwriter.ForRequest(w, req)
 	defer writer.Close()
@@ -141,6 +191,8 @@ func (s *Server) HandleGraph(w http.ResponseWriter, req *http.Request) {
 	fmt.Fprintf(writer, htmlIndexForm,
 		strings.Join(metricOptions, ""),
 		strings.Join(jobOptions, ""),
+		strings.Join(smoothOptions, ""),
+		timeAxisChecked,
 	)
 
 	fmt.Fprint(writer, htmlWarning)
@@ -207,6 +259,8 @@ const htmlIndexForm = `
 		<div class="input-group-prepend"><span class="input-group-text" for="name">Metric:</span></div>
 		<select title="Metrics to visualize" class="form-control custom-select" name="metric" onchange="refresh();">%[1]s</select>
 		<select id="graph-controls-job" title="Jobs to show metrics for" class="form-control custom-select" name="job" multiple="multiple" onchange="refresh();">%[2]s</select>
+		<select title="Average each value with the preceding values of the series" class="form-control custom-select" name="smooth" onchange="refresh();">%[3]s</select>
+		<div class="input-group-append"><label class="input-group-text" title="Place releases at the time they were created instead of evenly"><input type="checkbox" class="mr-1" name="timeAxis" value="true" %[4]s onchange="refresh();"> Time axis</label></div>
 	</div>
 </form>
 <script>$(document).ready(function() { $('#graph-controls-job').multiselect(); });</script>
@@ -470,7 +524,8 @@ function refresh() {
 				},
 			],
 		}
-		if (page.ordinal) {
+		// the server only returns timestamps when a time axis was requested
+		if (page.ordinal && !x.timestamps) {
 			data[0].forEach((e, i) => { data[0][i] = i+1; })
 			opt.scales.x = {
 				distr: 2,
@@ -496,6 +551,30 @@ refresh()
 </script>
 `
 
+// jobLabels returns the label to show for each job name. A label from labelFn is only
+// used if no other job has the same label, so that every job remains distinguishable,
+// and the name is used otherwise.
+func jobLabels(names []string, labelFn func(name string) string) map[string]string {
+	labels := make(map[string]string, len(names))
+	counts := make(map[string]int, len(names))
+	for _, name := range names {
+		label := name
+		if labelFn != nil {
+			if l := labelFn(name); len(l) > 0 {
+				label = l
+			}
+		}
+		labels[name] = label
+		counts[label]++
+	}
+	for _, name := range names {
+		if counts[labels[name]] > 1 {
+			labels[name] = name
+		}
+	}
+	return labels
+}
+
 func stringSelected(current, expected string) string {
 	if current == expected {
 		return "selected"
@@ -0,0 +1,35 @@
+package httpgraph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_jobLabels(t *testing.T) {
+	names := []string{"job-4.8-aws", "job-4.8-gcp", "job-4.9-aws", "job-4.9-gcp", "other"}
+	labels := jobLabels(names, func(name string) string {
+		switch {
+		case strings.HasPrefix(name, "job-4.8-"):
+			return "4.8"
+		case name == "job-4.9-aws":
+			return "4.9-aws"
+		}
+		return ""
+	})
+	want := map[string]string{
+		// a label shared by several jobs would hide which job is which
+		"job-4.8-aws": "job-4.8-aws",
+		"job-4.8-gcp": "job-4.8-gcp",
+		"job-4.9-aws": "4.9-aws",
+		"job-4.9-gcp": "job-4.9-gcp",
+		"other":       "other",
+	}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+
+	if labels := jobLabels(names, nil); labels["other"] != "other" || len(labels) != len(names) {
+		t.Errorf("expected names without a label function: %v", labels)
+	}
+}
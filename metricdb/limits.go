@@ -0,0 +1,245 @@
+package metricdb
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+var (
+	metricDBSizeBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "metric_db_size_bytes",
+		Help: "The size of the metric database in bytes.",
+	})
+	metricDBRows = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "metric_db_rows",
+		Help: "The number of metric values stored in the metric database.",
+	})
+	metricDBFileSizeBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "metric_db_file_size_bytes",
+		Help: "The size of the metric database file on disk in bytes, including free pages.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		metricDBSizeBytes,
+		metricDBRows,
+		metricDBFileSizeBytes,
+	)
+}
+
+// defaultVacuumThreshold is the number of deleted metric values after which the
+// database is vacuumed if no threshold is configured.
+const defaultVacuumThreshold = 10000
+
+// Limits controls how large the metric database may grow.
+type Limits struct {
+	// VacuumThreshold is the number of deleted metric values after which the database
+	// is vacuumed to reclaim space. Defaults to 10000.
+	VacuumThreshold int64
+	// VacuumFreeFraction is the fraction of the database file that may be unused before
+	// the database is vacuumed, regardless of how many values were deleted. If zero, the
+	// database is only vacuumed after VacuumThreshold deletions.
+	VacuumFreeFraction float64
+	// MaxSizeBytes is the size the database is kept below by removing the oldest metric
+	// values, regardless of their age. If zero, the size is not limited.
+	MaxSizeBytes int64
+	// DownsampleMaxAge is how long the daily averages of expired metric values are kept.
+	// If zero, expired values are not averaged, and if negative the averages are kept
+	// forever.
+	DownsampleMaxAge time.Duration
+	// ScrapeBudget is the longest a single scrape of new metrics may run. When exceeded,
+	// the metrics read so far are stored and the next scrape resumes after the last one
+	// stored. If zero, a scrape runs until all new metrics are read.
+	ScrapeBudget time.Duration
+}
+
+func (l Limits) vacuumThreshold() int64 {
+	if l.VacuumThreshold <= 0 {
+		return defaultVacuumThreshold
+	}
+	return l.VacuumThreshold
+}
+
+// freeFraction returns the size of the database file and the fraction of the file that
+// is not used by any live page.
+func (d *DB) freeFraction() (int64, float64, error) {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return 0, 0, err
+	}
+	fileSize := info.Size()
+	if fileSize == 0 {
+		return 0, 0, nil
+	}
+	var pageCount, freePages, pageSize int64
+	if err := d.db.Get(&pageCount, "PRAGMA page_count"); err != nil {
+		return 0, 0, err
+	}
+	if err := d.db.Get(&freePages, "PRAGMA freelist_count"); err != nil {
+		return 0, 0, err
+	}
+	if err := d.db.Get(&pageSize, "PRAGMA page_size"); err != nil {
+		return 0, 0, err
+	}
+	live := (pageCount - freePages) * pageSize
+	if live >= fileSize {
+		return fileSize, 0, nil
+	}
+	return fileSize, float64(fileSize-live) / float64(fileSize), nil
+}
+
+// needsVacuum returns true if enough values were deleted since the last vacuum, or if
+// more of the database file is free than the configured fraction.
+func (d *DB) needsVacuum() bool {
+	// the file size is reported even when the deletions alone require a vacuum
+	fileSize, free, err := d.freeFraction()
+	if err != nil {
+		klog.Errorf("unable to check free space in database: %v", err)
+	} else {
+		metricDBFileSizeBytes.Set(float64(fileSize))
+	}
+	if d.recentlyDeleted > d.limits.vacuumThreshold() {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	if d.limits.VacuumFreeFraction > 0 && free > d.limits.VacuumFreeFraction {
+		klog.Infof("Vacuuming database because %.0f%% of the %d byte file is free", free*100, fileSize)
+		return true
+	}
+	return false
+}
+
+// Status reports the current size of the database.
+type Status struct {
+	SizeBytes       int64 `json:"sizeBytes"`
+	Rows            int64 `json:"rows"`
+	RecentlyDeleted int64 `json:"recentlyDeleted"`
+	MaxSizeBytes    int64 `json:"maxSizeBytes,omitempty"`
+}
+
+// Status returns the size of the database as of the last refresh.
+func (d *DB) Status() Status {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.status
+}
+
+func (d *DB) size() (int64, error) {
+	var pageCount, pageSize int64
+	if err := d.db.Get(&pageCount, "PRAGMA page_count"); err != nil {
+		return 0, err
+	}
+	if err := d.db.Get(&pageSize, "PRAGMA page_size"); err != nil {
+		return 0, err
+	}
+	return pageCount * pageSize, nil
+}
+
+func (d *DB) rows() (int64, error) {
+	var rows int64
+	if err := d.db.Get(&rows, "SELECT count(*) FROM metric_value"); err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (d *DB) refreshStatus() error {
+	size, err := d.size()
+	if err != nil {
+		return err
+	}
+	rows, err := d.rows()
+	if err != nil {
+		return err
+	}
+	metricDBSizeBytes.Set(float64(size))
+	metricDBRows.Set(float64(rows))
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.status = Status{
+		SizeBytes:       size,
+		Rows:            rows,
+		RecentlyDeleted: d.recentlyDeleted,
+		MaxSizeBytes:    d.limits.MaxSizeBytes,
+	}
+	return nil
+}
+
+const (
+	// sizeLimitPasses is the most times the oldest metric values are removed in a single
+	// attempt to bring the database under its size limit.
+	sizeLimitPasses = 10
+	// sizeLimitMaxRemoveFraction is the largest fraction of the metric values removed in
+	// one pass, so that an overestimate of the space used by metric values, such as from
+	// the other tables, does not empty the database.
+	sizeLimitMaxRemoveFraction = 4
+)
+
+// enforceSizeLimit removes the oldest metric values and vacuums the database until the
+// database is smaller than the configured limit. The number of values removed in each
+// pass is in proportion to how far the database exceeds the limit, plus a margin, but
+// never more than a quarter of the values. Removed values are added to the daily
+// averages like expired values.
+func (d *DB) enforceSizeLimit() error {
+	if d.limits.MaxSizeBytes <= 0 {
+		return nil
+	}
+	for i := 0; i < sizeLimitPasses; i++ {
+		size, err := d.size()
+		if err != nil {
+			return err
+		}
+		if size <= d.limits.MaxSizeBytes {
+			return nil
+		}
+		rows, err := d.rows()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return fmt.Errorf("database is %d bytes with no metric values, above the limit of %d bytes", size, d.limits.MaxSizeBytes)
+		}
+		remove := rows*(size-d.limits.MaxSizeBytes)/size + rows/20
+		if max := rows / sizeLimitMaxRemoveFraction; remove > max {
+			remove = max
+		}
+		if remove < 1 {
+			remove = 1
+		}
+		// values of the same job share a timestamp, so all values with the timestamp of
+		// the last value to remove are removed
+		var newest int64
+		if err := d.db.Get(&newest, `SELECT timestamp FROM metric_value ORDER BY timestamp LIMIT 1 OFFSET ?`, remove-1); err != nil {
+			return fmt.Errorf("unable to find oldest metrics: %v", err)
+		}
+		deleted, err := d.removeOldestMetrics(newest + 1)
+		if err != nil {
+			return fmt.Errorf("unable to delete oldest metrics: %v", err)
+		}
+		d.recentlyDeleted += deleted
+		klog.Infof("Removed %d oldest metrics because the database size %d exceeds %d bytes", deleted, size, d.limits.MaxSizeBytes)
+		d.vacuum()
+	}
+	return fmt.Errorf("database is still larger than %d bytes after removing metrics", d.limits.MaxSizeBytes)
+}
+
+func (d *DB) removeOldestMetrics(timestamp int64) (int64, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	deleted, err := d.removeMetricsBefore(tx, timestamp)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, tx.Commit()
+}
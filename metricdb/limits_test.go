@@ -0,0 +1,110 @@
+package metricdb
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	_ "modernc.org/sqlite"
+)
+
+func TestDB_needsVacuum(t *testing.T) {
+	d, err := New(filepath.Join(t.TempDir(), "metrics.db"), url.URL{}, 48*time.Hour, Limits{VacuumThreshold: 1000000, VacuumFreeFraction: 0.25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateSchema(d.db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.db.Exec(`
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n WHERE i < 5000)
+		INSERT INTO metric_value (job_id, job_number, metric_id, metric_selector, timestamp, value)
+		SELECT 1, i, 1, printf('%0200d', i), i, i FROM n
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if d.needsVacuum() {
+		t.Fatalf("a database without free pages should not be vacuumed")
+	}
+
+	// deleting most rows leaves free pages in the file but is below the deletion count
+	res, err := d.db.Exec(`DELETE FROM metric_value WHERE timestamp > 100`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, _ := res.RowsAffected()
+	d.recentlyDeleted += deleted
+	if !d.needsVacuum() {
+		t.Fatalf("a mostly free database should be vacuumed")
+	}
+	d.vacuum()
+	if d.needsVacuum() {
+		t.Fatalf("a vacuumed database should not need another vacuum")
+	}
+
+	// the deletion count still triggers a vacuum on its own
+	d.limits.VacuumFreeFraction = 0
+	d.recentlyDeleted = d.limits.VacuumThreshold + 1
+	metricDBFileSizeBytes.Set(0)
+	if !d.needsVacuum() {
+		t.Fatalf("a database with many deletions should be vacuumed")
+	}
+	if size := testutil.ToFloat64(metricDBFileSizeBytes); size <= 0 {
+		t.Errorf("expected the file size to be reported, got %f", size)
+	}
+}
+
+func TestDB_enforceSizeLimit(t *testing.T) {
+	d, err := New(filepath.Join(t.TempDir(), "metrics.db"), url.URL{}, 48*time.Hour, Limits{DownsampleMaxAge: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateSchema(d.db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.db.Exec(`
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n WHERE i < 20000)
+		INSERT INTO metric_value (job_id, job_number, metric_id, metric_selector, timestamp, value)
+		SELECT 1, i, 1, printf('%0200d', i), i, i FROM n
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.db.Exec(`INSERT INTO release_job (major, minor, micro, timestamp, stream, pre, version, job_id, job_number, type) VALUES (4, 8, 0, 1, 'nightly', '', '4.8.0', 1, 1, 'target')`); err != nil {
+		t.Fatal(err)
+	}
+	size, err := d.size()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the database is far over the limit, so the values are removed over several passes
+	d.limits.MaxSizeBytes = size / 8
+	if err := d.enforceSizeLimit(); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := d.size(); err != nil || size > d.limits.MaxSizeBytes {
+		t.Fatalf("expected the database to be under the limit of %d bytes: %d %v", d.limits.MaxSizeBytes, size, err)
+	}
+	rows, err := d.rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows < 20000/10 || rows > 20000/4 {
+		t.Fatalf("expected only enough values to reach the limit to be removed, %d remain", rows)
+	}
+	var oldest int64
+	if err := d.db.Get(&oldest, "SELECT min(timestamp) FROM metric_value"); err != nil {
+		t.Fatal(err)
+	}
+	if oldest != 20000-rows+1 {
+		t.Fatalf("expected the oldest values to be removed, oldest remaining is %d of %d", oldest, rows)
+	}
+
+	// removed values are recorded in the daily averages
+	var samples int64
+	if err := d.db.Get(&samples, "SELECT sum(samples) FROM release_job_daily"); err != nil || samples != 1 {
+		t.Fatalf("expected the removed value of the release job to be averaged: %d %v", samples, err)
+	}
+}
@@ -1,6 +1,10 @@
 package metricdb
 
-import "github.com/jmoiron/sqlx"
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
 
 func CreateSchema(db *sqlx.DB) error {
 	if _, err := db.Exec(`
@@ -67,5 +71,60 @@ func CreateSchema(db *sqlx.DB) error {
 	); err != nil {
 		return err
 	}
+	return migrateSchema(db)
+}
+
+// migrations are applied in order to databases created before each change to the schema.
+// The number of migrations applied is recorded in the user_version of the database, so
+// new migrations must only be appended.
+var migrations = []string{
+	// daily averages of metric values that have expired
+	`
+	CREATE TABLE IF NOT EXISTS release_job_daily (
+		day             UNSIGNED BIG INT NOT NULL,
+		job_id          INTEGER NOT NULL,
+		metric_id       INTEGER NOT NULL,
+		metric_selector TEXT NOT NULL,
+		version         TEXT NOT NULL,
+
+		value   REAL NOT NULL,
+		samples INTEGER NOT NULL,
+
+		PRIMARY KEY(day,job_id,metric_id,metric_selector,version)
+		FOREIGN KEY(metric_id) REFERENCES metrics(id)
+		FOREIGN KEY(job_id) REFERENCES job(id)
+	) WITHOUT ROWID;
+	`,
+	// the oldest metric values are found by timestamp when they expire or the database
+	// exceeds its size limit
+	`
+	CREATE INDEX IF NOT EXISTS metric_value_timestamp ON metric_value (timestamp);
+	`,
+}
+
+// migrateSchema applies any migrations that have not yet been applied to db.
+func migrateSchema(db *sqlx.DB) error {
+	var version int
+	if err := db.Get(&version, "PRAGMA user_version"); err != nil {
+		return fmt.Errorf("unable to read schema version: %v", err)
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to migrate schema to version %d: %v", i+1, err)
+		}
+		// pragmas do not accept bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to record schema version %d: %v", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
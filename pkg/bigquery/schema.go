@@ -0,0 +1,100 @@
+package bigquery
+
+import (
+	"cloud.google.com/go/bigquery"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/googleapi"
+	"k8s.io/klog/v2"
+	"net/http"
+	"strings"
+)
+
+// EnsureTable creates the table with schema if it does not exist, and otherwise adds any
+// columns of schema that are missing from the table. Columns are never removed or
+// changed, so calling EnsureTable again with the same schema does nothing.
+func (c Client) EnsureTable(ctx context.Context, dataset, table string, schema bigquery.Schema) error {
+	t := c.Dataset(dataset).Table(table)
+	md, err := t.Metadata(ctx)
+	if hasStatus(err, http.StatusNotFound) {
+		err = t.Create(ctx, &bigquery.TableMetadata{Schema: schema})
+		if err == nil {
+			klog.Infof("Created bigquery table %s.%s", dataset, table)
+			return nil
+		}
+		// another process may have created the table first
+		if !hasStatus(err, http.StatusConflict) {
+			return fmt.Errorf("unable to create table %s.%s: %w", dataset, table, err)
+		}
+		md, err = t.Metadata(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read table %s.%s: %w", dataset, table, err)
+	}
+
+	merged, added := mergeSchema(md.Schema, schema)
+	if len(added) == 0 {
+		return nil
+	}
+	if _, err := t.Update(ctx, bigquery.TableMetadataToUpdate{Schema: merged}, md.ETag); err != nil {
+		return fmt.Errorf("unable to add columns %s to table %s.%s: %w", strings.Join(added, ", "), dataset, table, err)
+	}
+	klog.Infof("Added columns %s to bigquery table %s.%s", strings.Join(added, ", "), dataset, table)
+	return nil
+}
+
+// mergeSchema returns existing with the fields of desired that it lacks appended, along
+// with the names of the added fields. Fields are matched by name, ignoring case as
+// BigQuery does, and the fields of records present in both are merged recursively.
+// Added fields are nullable, since BigQuery cannot add required columns to a table.
+func mergeSchema(existing, desired bigquery.Schema) (bigquery.Schema, []string) {
+	var added []string
+	merged := make(bigquery.Schema, 0, len(existing))
+	for _, field := range existing {
+		copied := *field
+		if want := findField(desired, field.Name); want != nil && field.Type == bigquery.RecordFieldType && want.Type == bigquery.RecordFieldType {
+			var nested []string
+			copied.Schema, nested = mergeSchema(field.Schema, want.Schema)
+			for _, name := range nested {
+				added = append(added, field.Name+"."+name)
+			}
+		}
+		merged = append(merged, &copied)
+	}
+	for _, field := range desired {
+		if findField(existing, field.Name) != nil {
+			continue
+		}
+		merged = append(merged, nullableField(field))
+		added = append(added, field.Name)
+	}
+	return merged, added
+}
+
+func findField(schema bigquery.Schema, name string) *bigquery.FieldSchema {
+	for _, field := range schema {
+		if strings.EqualFold(field.Name, name) {
+			return field
+		}
+	}
+	return nil
+}
+
+// nullableField returns a copy of field and its nested fields that are not required.
+func nullableField(field *bigquery.FieldSchema) *bigquery.FieldSchema {
+	copied := *field
+	copied.Required = false
+	if len(field.Schema) > 0 {
+		copied.Schema = make(bigquery.Schema, 0, len(field.Schema))
+		for _, nested := range field.Schema {
+			copied.Schema = append(copied.Schema, nullableField(nested))
+		}
+	}
+	return &copied
+}
+
+func hasStatus(err error, code int) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
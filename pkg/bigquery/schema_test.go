@@ -0,0 +1,53 @@
+package bigquery
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func Test_mergeSchema(t *testing.T) {
+	existing := bigquery.Schema{
+		{Name: "summary", Type: bigquery.StringFieldType, Required: true},
+		{Name: "issue", Type: bigquery.RecordFieldType, Required: true, Schema: bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		}},
+	}
+	desired := bigquery.Schema{
+		{Name: "Summary", Type: bigquery.StringFieldType, Required: true},
+		{Name: "issue", Type: bigquery.RecordFieldType, Required: true, Schema: bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType, Required: true},
+			{Name: "key", Type: bigquery.StringFieldType, Required: true},
+		}},
+		{Name: "custom_fields", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+			{Name: "field_name", Type: bigquery.StringFieldType, Required: true},
+		}},
+	}
+
+	merged, added := mergeSchema(existing, desired)
+	if !reflect.DeepEqual(added, []string{"issue.key", "custom_fields"}) {
+		t.Fatalf("unexpected added columns: %v", added)
+	}
+	expected := bigquery.Schema{
+		{Name: "summary", Type: bigquery.StringFieldType, Required: true},
+		{Name: "issue", Type: bigquery.RecordFieldType, Required: true, Schema: bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType, Required: true},
+			{Name: "key", Type: bigquery.StringFieldType},
+		}},
+		{Name: "custom_fields", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+			{Name: "field_name", Type: bigquery.StringFieldType},
+		}},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("unexpected merged schema")
+	}
+	if !desired[1].Schema[1].Required {
+		t.Fatalf("the desired schema should not be modified")
+	}
+
+	// merging again adds nothing
+	if _, added := mergeSchema(merged, desired); len(added) != 0 {
+		t.Fatalf("expected no columns to be added, got %v", added)
+	}
+}
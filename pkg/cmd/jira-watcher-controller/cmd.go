@@ -27,16 +27,20 @@ type Options struct {
 	JiraSearch          string
 	JiraTokenPath       string
 	ShowPrivateMessages bool
+	IgnoreCustomFields  []string
+	DeadLetterFile      string
 
 	// BigQuery Options
 	GoogleProjectID                    string
 	GoogleServiceAccountCredentialFile string
 	BigQueryRefreshInterval            time.Duration
+	BigQueryBatchSize                  int
 }
 
 func NewJiraWatcherControllerCommand(name string) *cobra.Command {
 	o := &Options{
 		BigQueryRefreshInterval: 1 * time.Minute,
+		BigQueryBatchSize:       500,
 		JiraURL:                 "https://issues.redhat.com",
 		JiraSearch:              "(project=OCPBUGS&updated>='-60d'&affectedVersion IN versionMatch('4\\\\.\\\\d+')&level IN (null)) OR (project=TRT&updated>='-60d'&level IN (null))",
 	}
@@ -72,9 +76,12 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.JiraTokenPath, "jira-token-file", o.JiraTokenPath, "A file to read a Jira token from.")
 	fs.StringVar(&o.JiraSearch, "jira-search", o.JiraSearch, "A JQL query to search for issues to index.")
 	fs.BoolVar(&o.ShowPrivateMessages, "show-private-messages", o.ShowPrivateMessages, "Display Jira comments that are flagged as private.")
+	fs.StringSliceVar(&o.IgnoreCustomFields, "ignore-custom-fields", o.IgnoreCustomFields, "Custom fields, such as customfield_12310243, whose changes alone do not write a new ticket row to BigQuery.")
+	fs.StringVar(&o.DeadLetterFile, "dead-letter-file", o.DeadLetterFile, "A file to append a JSON line to for every issue field that could not be converted for BigQuery and every ticket BigQuery rejected. Disabled if empty.")
 	fs.StringVar(&o.GoogleProjectID, "google-project-id", os.Getenv("GOOGLE_PROJECT_ID"), "Google project name.")
 	fs.StringVar(&o.GoogleServiceAccountCredentialFile, "google-service-account-credential-file", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), "location of a credential file described by https://cloud.google.com/docs/authentication/production")
-	fs.DurationVar(&o.BigQueryRefreshInterval, "bigquery-refresh-interval", o.BigQueryRefreshInterval, "How often to push comments into BigQuery. Defaults to 15 minutes.")
+	fs.DurationVar(&o.BigQueryRefreshInterval, "bigquery-refresh-interval", o.BigQueryRefreshInterval, "How often to push comments into BigQuery. Defaults to 1 minute.")
+	fs.IntVar(&o.BigQueryBatchSize, "bigquery-batch-size", o.BigQueryBatchSize, "The maximum number of tickets to insert into BigQuery at once. A batch is written as soon as it is full.")
 	fs.BoolVar(&o.DryRun, "dry-run", o.DryRun, "Perform no actions.")
 }
 
@@ -95,6 +102,12 @@ func (o *Options) Validate(ctx context.Context) error {
 	if len(o.GoogleServiceAccountCredentialFile) == 0 {
 		return errors.New("--google-service-account-credential-file flag must be set")
 	}
+	if o.BigQueryRefreshInterval <= 0 {
+		return errors.New("--bigquery-refresh-interval must be positive")
+	}
+	if o.BigQueryBatchSize <= 0 {
+		return errors.New("--bigquery-batch-size must be positive")
+	}
 	return nil
 }
 
@@ -133,16 +146,43 @@ func (o *Options) Run(ctx context.Context) error {
 	if err != nil {
 		klog.Fatalf("Unable to configure bigquery client: %v", err)
 	}
+	if !o.DryRun {
+		schema, err := ticketSchema()
+		if err != nil {
+			return err
+		}
+		if err := bqc.EnsureTable(ctx, BigqueryDatasetId, BigqueryTableId, schema); err != nil {
+			return err
+		}
+	}
+
+	var deadLetter *DeadLetter
+	if len(o.DeadLetterFile) > 0 {
+		deadLetter, err = OpenDeadLetter(o.DeadLetterFile)
+		if err != nil {
+			return err
+		}
+		defer deadLetter.Close()
+	}
+
+	inserter := NewTicketInserter(bqc, deadLetter, o.BigQueryBatchSize, o.BigQueryRefreshInterval)
 
-	jiraWatcherController, err := NewJiraWatcherController(c, jiraInformer, jiraLister, o.ShowPrivateMessages, bqc, o.DryRun)
+	jiraWatcherController, err := NewJiraWatcherController(c, jiraInformer, jiraLister, o.ShowPrivateMessages, inserter, deadLetter, o.IgnoreCustomFields, o.DryRun)
 	if err != nil {
 		return err
 	}
 
+	inserterDone := make(chan struct{})
+	go func() {
+		defer close(inserterDone)
+		inserter.Run(ctx)
+	}()
 	go jiraInformer.Run(ctx.Done())
 	go jiraWatcherController.RunWorkers(ctx, 1)
 
 	<-ctx.Done()
 
+	// write any tickets that are still pending before exiting
+	<-inserterDone
 	return nil
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/openshift/ci-search/jira"
-	"github.com/openshift/ci-search/pkg/bigquery"
 	helpers "github.com/openshift/ci-search/pkg/jira"
 	"golang.org/x/time/rate"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -13,6 +12,7 @@ import (
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -22,7 +22,17 @@ type JiraWatcherController struct {
 	jiraLister          *jira.IssueLister
 	showPrivateMessages bool
 
-	bigqueryClient *bigquery.Client
+	inserter *TicketInserter
+	// deadLetter records issue fields that could not be converted to a ticket
+	deadLetter *DeadLetter
+
+	// ignoreCustomFields are the custom fields whose changes alone do not write a ticket
+	ignoreCustomFields []string
+	// fingerprints holds the fingerprint of the last ticket written for each issue ID, and
+	// queued the fingerprint of the ticket waiting in the inserter for each issue ID
+	fingerprintLock sync.Mutex
+	fingerprints    map[string]string
+	queued          map[string]string
 
 	dryRun       bool
 	maxBatch     int
@@ -31,13 +41,17 @@ type JiraWatcherController struct {
 	queue        workqueue.RateLimitingInterface
 }
 
-func NewJiraWatcherController(jiraClient *jira.Client, jiraInformer cache.SharedIndexInformer, jiraLister *jira.IssueLister, showPrivateMessages bool, bigQueryClient *bigquery.Client, dryRun bool) (*JiraWatcherController, error) {
+func NewJiraWatcherController(jiraClient *jira.Client, jiraInformer cache.SharedIndexInformer, jiraLister *jira.IssueLister, showPrivateMessages bool, inserter *TicketInserter, deadLetter *DeadLetter, ignoreCustomFields []string, dryRun bool) (*JiraWatcherController, error) {
 	c := &JiraWatcherController{
 		jiraClient:          jiraClient,
 		jiraInformer:        jiraInformer,
 		jiraLister:          jiraLister,
 		showPrivateMessages: showPrivateMessages,
-		bigqueryClient:      bigQueryClient,
+		inserter:            inserter,
+		deadLetter:          deadLetter,
+		ignoreCustomFields:  ignoreCustomFields,
+		fingerprints:        make(map[string]string),
+		queued:              make(map[string]string),
 		dryRun:              dryRun,
 		maxBatch:            250,
 		rateLimit:           rate.NewLimiter(rate.Every(15*time.Second), 3),
@@ -45,6 +59,7 @@ func NewJiraWatcherController(jiraClient *jira.Client, jiraInformer cache.Shared
 
 	c.queue = workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: "JiraWatcherController"})
 	c.cachesToSync = append(c.cachesToSync, jiraInformer.HasSynced)
+	inserter.OnFlushed(c.ticketsFlushed)
 
 	_, err := jiraInformer.AddEventHandler(&cache.ResourceEventHandlerFuncs{
 		AddFunc:    c.Enqueue,
@@ -169,6 +184,41 @@ func (c *JiraWatcherController) processQueue(ctx context.Context) bool {
 	return true
 }
 
+// ticketChanged returns true if ticket differs from the last ticket written or queued for
+// the same issue in more than the ignored custom fields, and records it as queued. The
+// ticket is recorded as written by ticketsFlushed once the inserter has written it.
+func (c *JiraWatcherController) ticketChanged(ticket *Ticket) bool {
+	fingerprint := ticketFingerprint(ticket, c.ignoreCustomFields)
+	c.fingerprintLock.Lock()
+	defer c.fingerprintLock.Unlock()
+	previous, ok := c.queued[ticket.Issue.ID]
+	if !ok {
+		previous, ok = c.fingerprints[ticket.Issue.ID]
+	}
+	if ok && len(fingerprint) > 0 && previous == fingerprint {
+		return false
+	}
+	c.queued[ticket.Issue.ID] = fingerprint
+	return true
+}
+
+// ticketsFlushed records tickets as the last tickets written for their issues if err is
+// nil. Otherwise the tickets were not written and are forgotten, so that the next sync of
+// their issues queues them again.
+func (c *JiraWatcherController) ticketsFlushed(tickets []*Ticket, err error) {
+	for _, ticket := range tickets {
+		fingerprint := ticketFingerprint(ticket, c.ignoreCustomFields)
+		c.fingerprintLock.Lock()
+		if err == nil {
+			c.fingerprints[ticket.Issue.ID] = fingerprint
+		}
+		if c.queued[ticket.Issue.ID] == fingerprint {
+			delete(c.queued, ticket.Issue.ID)
+		}
+		c.fingerprintLock.Unlock()
+	}
+}
+
 func (c *JiraWatcherController) sync(ctx context.Context, issueIDs []int, timestamp time.Time) error {
 	var tickets []*Ticket
 
@@ -199,17 +249,24 @@ func (c *JiraWatcherController) sync(ctx context.Context, issueIDs []int, timest
 		updated.Info = existing.Info
 		updated.RefreshTime = timestamp
 
-		tickets = append(tickets, convertToTicket(updated, timestamp))
+		ticket := convertToTicket(updated, timestamp, c.deadLetter)
+		if !c.ticketChanged(ticket) {
+			klog.V(5).Infof("JiraIssue %s has no meaningful changes since it was last written", issue.ID)
+			continue
+		}
+		tickets = append(tickets, ticket)
 	}
 
 	if len(tickets) > 0 {
 		if c.dryRun {
 			klog.Infof("[Dry Run] Syncing %d issues to bigquery", len(tickets))
+			c.ticketsFlushed(tickets, nil)
 		} else {
-			klog.V(5).Infof("Syncing %d issues to bigquery", len(tickets))
-			err := c.bigqueryClient.WriteRows(ctx, BigqueryDatasetId, BigqueryTableId, tickets)
-			if err != nil {
-				return fmt.Errorf("unable to write to bigquery: %v", err)
+			klog.V(5).Infof("Queueing %d issues to sync to bigquery", len(tickets))
+			if err := c.inserter.Add(tickets...); err != nil {
+				// the issues are retried with backoff until the inserter catches up
+				c.ticketsFlushed(tickets, err)
+				return err
 			}
 		}
 	}
@@ -0,0 +1,42 @@
+package jira_watcher_controller
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestJiraWatcherController_ticketChanged(t *testing.T) {
+	c := &JiraWatcherController{fingerprints: make(map[string]string), queued: make(map[string]string)}
+	ticket := &Ticket{Issue: Issue{ID: "1"}, Summary: "a"}
+
+	if !c.ticketChanged(ticket) {
+		t.Fatalf("expected a new ticket to be changed")
+	}
+	if c.ticketChanged(ticket) {
+		t.Errorf("expected a queued ticket to be unchanged")
+	}
+	if _, ok := c.fingerprints["1"]; ok {
+		t.Fatalf("a ticket should not be recorded as written before the inserter writes it")
+	}
+
+	c.ticketsFlushed([]*Ticket{ticket}, nil)
+	if _, ok := c.queued["1"]; ok {
+		t.Errorf("expected the written ticket to no longer be queued")
+	}
+	if c.ticketChanged(ticket) {
+		t.Errorf("expected a written ticket to be unchanged")
+	}
+	changed := &Ticket{Issue: Issue{ID: "1"}, Summary: "b"}
+	if !c.ticketChanged(changed) {
+		t.Errorf("expected a new summary to change the ticket")
+	}
+
+	// a ticket that was dropped is queued again on the next sync
+	c.ticketsFlushed([]*Ticket{changed}, errors.New("invalid row"))
+	if !c.ticketChanged(changed) {
+		t.Errorf("expected a dropped ticket to be changed")
+	}
+	if !c.ticketChanged(ticket) {
+		t.Errorf("expected the written ticket to differ from the queued ticket")
+	}
+}
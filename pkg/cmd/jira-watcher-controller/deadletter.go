@@ -0,0 +1,136 @@
+package jira_watcher_controller
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"k8s.io/klog/v2"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetterEntry describes a field of a jira issue that could not be converted into a
+// ticket and was left out of BigQuery, or a ticket that BigQuery rejected, in which case
+// FieldName is empty and Value holds the ticket.
+type DeadLetterEntry struct {
+	Time      time.Time       `json:"time"`
+	IssueKey  string          `json:"issueKey"`
+	FieldName string          `json:"fieldName"`
+	Reason    string          `json:"reason"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// deadLetterMaxBytes is the size past which the dead letter file is rotated.
+const deadLetterMaxBytes = 64 * 1024 * 1024
+
+// DeadLetter appends an entry to a JSON lines file for every issue field that could not
+// be converted and every ticket that could not be written. An entry with the same issue,
+// field, and value as an entry already in the file is skipped, so that resyncs do not
+// repeat it. Once the file grows past its size limit it is renamed with a .1 suffix,
+// replacing any earlier rotated file, and a new file is started. A nil DeadLetter
+// discards all entries.
+type DeadLetter struct {
+	lock     sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	maxBytes int64
+	// seen holds the fingerprints of the entries written to the current file since it
+	// was opened, and is bounded by the size of the file
+	seen map[[sha256.Size]byte]struct{}
+}
+
+// OpenDeadLetter opens path for appending, creating it if necessary.
+func OpenDeadLetter(path string) (*DeadLetter, error) {
+	d := &DeadLetter{path: path, maxBytes: deadLetterMaxBytes}
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DeadLetter) open() error {
+	f, err := os.OpenFile(d.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("unable to open dead letter file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to open dead letter file: %w", err)
+	}
+	d.file = f
+	d.size = info.Size()
+	d.seen = make(map[[sha256.Size]byte]struct{})
+	return nil
+}
+
+// rotate replaces the rotated file with the current file and starts a new file. If the
+// new file cannot be opened, entries are discarded.
+func (d *DeadLetter) rotate() error {
+	if err := os.Rename(d.path, d.path+".1"); err != nil {
+		return err
+	}
+	d.file.Close()
+	d.file = nil
+	return d.open()
+}
+
+// Record writes an entry for the named field of an issue with the raw field value. An
+// empty fieldName records a whole ticket.
+func (d *DeadLetter) Record(issueKey, fieldName string, reason error, value interface{}) {
+	if d == nil {
+		return
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		raw, _ = json.Marshal(fmt.Sprintf("%#v", value))
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", issueKey, fieldName)
+	h.Write(raw)
+	var fingerprint [sha256.Size]byte
+	copy(fingerprint[:], h.Sum(nil))
+
+	data, err := json.Marshal(DeadLetterEntry{
+		Time:      time.Now().UTC(),
+		IssueKey:  issueKey,
+		FieldName: fieldName,
+		Reason:    reason.Error(),
+		Value:     raw,
+	})
+	if err != nil {
+		klog.Errorf("Unable to record dead letter for %s field %s: %v", issueKey, fieldName, err)
+		return
+	}
+	data = append(data, '\n')
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.seen[fingerprint]; ok {
+		return
+	}
+	if d.file != nil && d.size > 0 && d.size+int64(len(data)) > d.maxBytes {
+		if err := d.rotate(); err != nil {
+			klog.Errorf("Unable to rotate dead letter file: %v", err)
+		}
+	}
+	if d.file == nil {
+		return
+	}
+	n, err := d.file.Write(data)
+	d.size += int64(n)
+	if err != nil {
+		klog.Errorf("Unable to record dead letter for %s field %s: %v", issueKey, fieldName, err)
+		return
+	}
+	d.seen[fingerprint] = struct{}{}
+}
+
+func (d *DeadLetter) Close() error {
+	if d == nil || d.file == nil {
+		return nil
+	}
+	return d.file.Close()
+}
@@ -0,0 +1,119 @@
+package jira_watcher_controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jiraBaseClient "github.com/andygrunwald/go-jira"
+	"github.com/trivago/tgo/tcontainer"
+)
+
+func TestDeadLetter_getCustomFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	deadLetter, err := OpenDeadLetter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := jiraBaseClient.Issue{
+		Key: "OCPBUGS-1",
+		Fields: &jiraBaseClient.IssueFields{
+			Unknowns: tcontainer.MarshalMap{
+				"customfield_1": "4.14",
+				"customfield_2": []string{"unexpected"},
+			},
+		},
+	}
+	fields := getCustomFields(issue, deadLetter)
+	if err := deadLetter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 1 || fields[0].FieldName != "customfield_1" {
+		t.Fatalf("unexpected fields: %#v", fields)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("expected one entry, got %q", data)
+	}
+	var entry DeadLetterEntry
+	if err := json.Unmarshal(lines[0], &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.IssueKey != "OCPBUGS-1" || entry.FieldName != "customfield_2" || len(entry.Reason) == 0 || string(entry.Value) != `["unexpected"]` {
+		t.Fatalf("unexpected entry: %#v", entry)
+	}
+}
+
+func TestDeadLetter_nil(t *testing.T) {
+	var deadLetter *DeadLetter
+	if _, err := processCustomFieldValue("customfield_1", []string{}); err == nil {
+		t.Fatalf("expected an error for an unknown type")
+	}
+	deadLetter.Record("OCPBUGS-1", "customfield_1", os.ErrInvalid, nil)
+	if err := deadLetter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeadLetter_Record_duplicates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	deadLetter, err := OpenDeadLetter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deadLetter.Close()
+
+	// every resync records the same field again
+	for i := 0; i < 3; i++ {
+		deadLetter.Record("OCPBUGS-1", "customfield_1", os.ErrInvalid, []string{"unexpected"})
+	}
+	deadLetter.Record("OCPBUGS-1", "customfield_1", os.ErrInvalid, []string{"changed"})
+	deadLetter.Record("OCPBUGS-2", "customfield_1", os.ErrInvalid, []string{"unexpected"})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Split(bytes.TrimSpace(data), []byte("\n")); len(lines) != 3 {
+		t.Fatalf("expected three entries, got %q", data)
+	}
+}
+
+func TestDeadLetter_Record_rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	deadLetter, err := OpenDeadLetter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deadLetter.Close()
+	deadLetter.maxBytes = 300
+
+	for i := 0; i < 10; i++ {
+		deadLetter.Record(fmt.Sprintf("OCPBUGS-%d", i), "customfield_1", os.ErrInvalid, []string{"unexpected"})
+	}
+
+	for _, name := range []string{path, path + ".1"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 || info.Size() > deadLetter.maxBytes {
+			t.Errorf("unexpected size of %s: %d", name, info.Size())
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"OCPBUGS-9"`)) {
+		t.Errorf("expected the newest entry in the current file, got %q", data)
+	}
+}
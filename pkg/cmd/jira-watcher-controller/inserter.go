@@ -0,0 +1,284 @@
+package jira_watcher_controller
+
+import (
+	"cloud.google.com/go/bigquery"
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// shutdownFlushTimeout bounds how long pending tickets are written for once the inserter
+// is asked to stop.
+const shutdownFlushTimeout = 30 * time.Second
+
+// ErrInserterFull is returned by Add when the inserter already holds as many tickets as
+// it may keep pending.
+var ErrInserterFull = errors.New("too many tickets are waiting to be written to bigquery")
+
+var (
+	metricRowsInserted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jira_watcher_bigquery_rows_inserted",
+		Help: "The number of ticket rows inserted into BigQuery.",
+	})
+	metricFailedBatches = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jira_watcher_bigquery_failed_batches",
+		Help: "The number of ticket batches that could not be inserted into BigQuery after retrying.",
+	})
+	metricDroppedTickets = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jira_watcher_bigquery_dropped_tickets",
+		Help: "The number of tickets BigQuery rejected that were recorded in the dead letter file instead.",
+	})
+	metricRejectedTickets = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jira_watcher_bigquery_rejected_tickets",
+		Help: "The number of tickets that were not queued because too many tickets were pending.",
+	})
+	metricPendingTickets = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "jira_watcher_bigquery_pending_tickets",
+		Help: "The number of tickets waiting to be written to BigQuery.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		metricRowsInserted,
+		metricFailedBatches,
+		metricDroppedTickets,
+		metricRejectedTickets,
+		metricPendingTickets,
+	)
+}
+
+// RowWriter writes rows to a BigQuery table.
+type RowWriter interface {
+	WriteRows(ctx context.Context, dataset, table string, rows interface{}) error
+}
+
+// TicketInserter accumulates tickets and writes them to BigQuery in batches, either
+// when a full batch is available or when the flush interval elapses. Batches that fail
+// with a server or quota error are retried with backoff, and any batch that still cannot
+// be written is kept for the next flush. Only batches that BigQuery rejects as invalid
+// are split to find the rejected tickets, which are recorded in the dead letter file and
+// dropped. At most
+// maxPending tickets are held, and Add refuses tickets beyond that.
+type TicketInserter struct {
+	client        RowWriter
+	deadLetter    *DeadLetter
+	batchSize     int
+	maxPending    int
+	flushInterval time.Duration
+	backoff       wait.Backoff
+	// flushed is invoked with each batch of tickets once it has been written, or with the
+	// error that caused the tickets to be dropped
+	flushed func(tickets []*Ticket, err error)
+
+	lock    sync.Mutex
+	pending []*Ticket
+	full    chan struct{}
+}
+
+func NewTicketInserter(client RowWriter, deadLetter *DeadLetter, batchSize int, flushInterval time.Duration) *TicketInserter {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &TicketInserter{
+		client:        client,
+		deadLetter:    deadLetter,
+		batchSize:     batchSize,
+		maxPending:    20 * batchSize,
+		flushInterval: flushInterval,
+		backoff: wait.Backoff{
+			Duration: time.Second,
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    5,
+		},
+		full: make(chan struct{}, 1),
+	}
+}
+
+// OnFlushed sets a function that is invoked with each batch of tickets once it has been
+// written to BigQuery, or with the error that caused BigQuery to reject them. It must be
+// set before Run is called.
+func (i *TicketInserter) OnFlushed(fn func(tickets []*Ticket, err error)) {
+	i.flushed = fn
+}
+
+// Add queues tickets to be written on the next flush. If the tickets would exceed the
+// number of tickets the inserter may hold, none are queued and ErrInserterFull is
+// returned so that the caller can retry later.
+func (i *TicketInserter) Add(tickets ...*Ticket) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if len(i.pending)+len(tickets) > i.maxPending {
+		metricRejectedTickets.Add(float64(len(tickets)))
+		return ErrInserterFull
+	}
+	i.pending = append(i.pending, tickets...)
+	metricPendingTickets.Set(float64(len(i.pending)))
+	if len(i.pending) >= i.batchSize {
+		select {
+		case i.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Len returns the number of tickets waiting to be written.
+func (i *TicketInserter) Len() int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return len(i.pending)
+}
+
+// Run flushes pending tickets every flush interval or whenever a full batch is available,
+// until the context is cancelled. Tickets still pending when the context is cancelled are
+// flushed one last time before Run returns.
+func (i *TicketInserter) Run(ctx context.Context) {
+	ticker := time.NewTicker(i.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+			defer cancel()
+			i.Flush(flushCtx)
+			if n := i.Len(); n > 0 {
+				klog.Errorf("Exiting with %d tickets that were not written to bigquery", n)
+			}
+			return
+		case <-ticker.C:
+		case <-i.full:
+		}
+		i.Flush(ctx)
+	}
+}
+
+// Flush writes all pending tickets in batches, stopping at the first batch that cannot be
+// written for any reason other than BigQuery rejecting its rows. Tickets that were not
+// written remain pending, except for tickets BigQuery rejected, which are dropped.
+func (i *TicketInserter) Flush(ctx context.Context) {
+	for {
+		i.lock.Lock()
+		n := len(i.pending)
+		if n > i.batchSize {
+			n = i.batchSize
+		}
+		batch := i.pending[:n:n]
+		i.lock.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+
+		done, err := i.writeBatch(ctx, batch)
+
+		i.lock.Lock()
+		i.pending = i.pending[done:]
+		metricPendingTickets.Set(float64(len(i.pending)))
+		i.lock.Unlock()
+
+		if err != nil {
+			metricFailedBatches.Inc()
+			klog.Errorf("Unable to write %d tickets to bigquery, will retry on next flush: %v", len(batch)-done, err)
+			return
+		}
+	}
+}
+
+// writeBatch writes batch to BigQuery and returns the number of tickets from the start of
+// batch that were written or dropped. A batch whose rows BigQuery rejects is split in
+// halves until the rejected tickets are found, and those are recorded in the dead letter
+// file and dropped. Any other error, such as an outage or a network failure, is returned
+// so that the remaining tickets are written by a later flush.
+func (i *TicketInserter) writeBatch(ctx context.Context, batch []*Ticket) (int, error) {
+	err := i.write(ctx, batch)
+	switch {
+	case err == nil:
+		metricRowsInserted.Add(float64(len(batch)))
+		klog.V(5).Infof("Wrote %d tickets to bigquery", len(batch))
+		i.notifyFlushed(batch, nil)
+		return len(batch), nil
+	case !isRejected(err) || ctx.Err() != nil:
+		return 0, err
+	case len(batch) == 1:
+		ticket := batch[0]
+		klog.Errorf("Dropping ticket for issue %s that bigquery rejected: %v", ticket.Issue.Key, err)
+		metricDroppedTickets.Inc()
+		i.deadLetter.Record(ticket.Issue.Key, "", err, ticket)
+		i.notifyFlushed(batch, err)
+		return 1, nil
+	}
+	half := len(batch) / 2
+	done, err := i.writeBatch(ctx, batch[:half])
+	if err != nil {
+		return done, err
+	}
+	rest, err := i.writeBatch(ctx, batch[half:])
+	return done + rest, err
+}
+
+func (i *TicketInserter) notifyFlushed(tickets []*Ticket, err error) {
+	if i.flushed != nil {
+		i.flushed(tickets, err)
+	}
+}
+
+func (i *TicketInserter) write(ctx context.Context, batch []*Ticket) error {
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, i.backoff, func(ctx context.Context) (bool, error) {
+		if err := i.client.WriteRows(ctx, BigqueryDatasetId, BigqueryTableId, batch); err != nil {
+			if !isRetryable(err) {
+				return false, err
+			}
+			klog.V(4).Infof("Failed to write %d tickets to bigquery: %v", len(batch), err)
+			lastErr = err
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// isRejected returns true if err shows that BigQuery refused to insert some of the rows
+// because they are invalid, which will fail again if the same rows are written.
+func isRejected(err error) bool {
+	var multiErr bigquery.PutMultiError
+	if errors.As(err, &multiErr) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == http.StatusBadRequest || apiErr.Code == http.StatusRequestEntityTooLarge
+}
+
+// isRetryable returns true if err shows that BigQuery failed to write rows because of a
+// server error or an exceeded quota, which may succeed if the write is repeated.
+func isRetryable(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code >= http.StatusInternalServerError || apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	if apiErr.Code == http.StatusForbidden {
+		for _, item := range apiErr.Errors {
+			switch item.Reason {
+			case "quotaExceeded", "rateLimitExceeded":
+				return true
+			}
+		}
+	}
+	return false
+}
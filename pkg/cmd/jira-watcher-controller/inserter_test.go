@@ -0,0 +1,200 @@
+package jira_watcher_controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type fakeRowWriter struct {
+	lock     sync.Mutex
+	failures []error
+	// reject holds the IDs of issues whose tickets are never written
+	reject  map[string]bool
+	calls   int
+	written []*Ticket
+}
+
+func (w *fakeRowWriter) WriteRows(ctx context.Context, dataset, table string, rows interface{}) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.calls++
+	if len(w.failures) > 0 {
+		err := w.failures[0]
+		w.failures = w.failures[1:]
+		return err
+	}
+	for _, ticket := range rows.([]*Ticket) {
+		if w.reject[ticket.Issue.ID] {
+			return bigquery.PutMultiError{{RowIndex: 0, Errors: bigquery.MultiError{errors.New("invalid row")}}}
+		}
+	}
+	w.written = append(w.written, rows.([]*Ticket)...)
+	return nil
+}
+
+func newTestInserter(writer RowWriter, deadLetter *DeadLetter, batchSize int) *TicketInserter {
+	i := NewTicketInserter(writer, deadLetter, batchSize, time.Hour)
+	i.backoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+	return i
+}
+
+func testTickets(n int) []*Ticket {
+	var tickets []*Ticket
+	for i := 0; i < n; i++ {
+		tickets = append(tickets, &Ticket{Issue: Issue{ID: string(rune('a' + i))}})
+	}
+	return tickets
+}
+
+func TestTicketInserter_Flush_transientFailure(t *testing.T) {
+	writer := &fakeRowWriter{failures: []error{
+		&googleapi.Error{Code: http.StatusServiceUnavailable},
+		&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}},
+	}}
+	i := newTestInserter(writer, nil, 2)
+	i.Add(testTickets(3)...)
+	i.Flush(context.Background())
+
+	if i.Len() != 0 {
+		t.Fatalf("expected all tickets to be written, %d pending", i.Len())
+	}
+	if len(writer.written) != 3 || writer.calls != 4 {
+		t.Fatalf("unexpected written=%d calls=%d", len(writer.written), writer.calls)
+	}
+}
+
+func TestTicketInserter_Flush_retriesExhausted(t *testing.T) {
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	writer := &fakeRowWriter{failures: []error{unavailable, unavailable, unavailable}}
+	i := newTestInserter(writer, nil, 2)
+	var flushed []*Ticket
+	i.OnFlushed(func(tickets []*Ticket, err error) { flushed = append(flushed, tickets...) })
+	i.Add(testTickets(3)...)
+	i.Flush(context.Background())
+
+	if i.Len() != 3 || len(flushed) != 0 {
+		t.Fatalf("expected tickets to remain pending, pending=%d flushed=%d", i.Len(), len(flushed))
+	}
+
+	// the pending tickets are written on the next flush
+	i.Flush(context.Background())
+	if i.Len() != 0 || len(writer.written) != 3 || len(flushed) != 3 {
+		t.Fatalf("unexpected pending=%d written=%d flushed=%d", i.Len(), len(writer.written), len(flushed))
+	}
+}
+
+func TestTicketInserter_Flush_networkFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	deadLetter, err := OpenDeadLetter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deadLetter.Close()
+	writer := &fakeRowWriter{failures: []error{
+		&url.Error{Op: "Post", URL: "https://bigquery.googleapis.com", Err: errors.New("connection reset by peer")},
+	}}
+	i := newTestInserter(writer, deadLetter, 2)
+	i.Add(testTickets(3)...)
+	i.Flush(context.Background())
+
+	// an outage does not split the batch or drop any tickets
+	if writer.calls != 1 || i.Len() != 3 {
+		t.Fatalf("unexpected calls=%d pending=%d", writer.calls, i.Len())
+	}
+	if data, err := os.ReadFile(path); err != nil || len(data) > 0 {
+		t.Fatalf("expected no dead letter entries, got %q: %v", data, err)
+	}
+
+	i.Flush(context.Background())
+	if i.Len() != 0 || len(writer.written) != 3 {
+		t.Fatalf("unexpected pending=%d written=%d", i.Len(), len(writer.written))
+	}
+}
+
+func TestTicketInserter_Flush_permanentFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	deadLetter, err := OpenDeadLetter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deadLetter.Close()
+	writer := &fakeRowWriter{reject: map[string]bool{"b": true}}
+	i := newTestInserter(writer, deadLetter, 2)
+	var written, dropped []string
+	i.OnFlushed(func(tickets []*Ticket, err error) {
+		for _, ticket := range tickets {
+			if err != nil {
+				dropped = append(dropped, ticket.Issue.ID)
+			} else {
+				written = append(written, ticket.Issue.ID)
+			}
+		}
+	})
+	i.Add(testTickets(3)...)
+	i.Flush(context.Background())
+
+	// a rejected ticket is not retried and does not block the tickets after it
+	if i.Len() != 0 {
+		t.Fatalf("expected no tickets to remain pending, %d pending", i.Len())
+	}
+	if !reflect.DeepEqual(written, []string{"a", "c"}) || !reflect.DeepEqual(dropped, []string{"b"}) {
+		t.Fatalf("unexpected written=%v dropped=%v", written, dropped)
+	}
+	if writer.calls != 4 {
+		t.Fatalf("a permanent failure should not be retried, got %d calls", writer.calls)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry DeadLetterEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("expected one dead letter entry, got %q: %v", data, err)
+	}
+	if entry.FieldName != "" || !strings.Contains(string(entry.Value), `"ID":"b"`) {
+		t.Fatalf("unexpected entry: %s", data)
+	}
+}
+
+func TestTicketInserter_Add_full(t *testing.T) {
+	i := newTestInserter(&fakeRowWriter{}, nil, 2)
+	i.maxPending = 3
+	if err := i.Add(testTickets(2)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Add(testTickets(2)...); err != ErrInserterFull {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if i.Len() != 2 {
+		t.Fatalf("expected the refused tickets to not be queued, %d pending", i.Len())
+	}
+}
+
+func TestTicketInserter_Run_flushesOnShutdown(t *testing.T) {
+	writer := &fakeRowWriter{}
+	i := newTestInserter(writer, nil, 10)
+	i.Add(testTickets(2)...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	i.Run(ctx)
+
+	if i.Len() != 0 || len(writer.written) != 2 {
+		t.Fatalf("unexpected pending=%d written=%d", i.Len(), len(writer.written))
+	}
+}
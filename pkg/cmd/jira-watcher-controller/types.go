@@ -2,7 +2,10 @@ package jira_watcher_controller
 
 import (
 	"cloud.google.com/go/bigquery"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	jiraBaseClient "github.com/andygrunwald/go-jira"
 	"github.com/openshift/ci-search/jira"
@@ -88,6 +91,15 @@ type Ticket struct {
 	CustomFields    []CustomField `bigquery:"custom_fields"`
 }
 
+// ticketSchema returns the schema of the tickets table as described by the Ticket fields.
+func ticketSchema() (bigquery.Schema, error) {
+	schema, err := bigquery.InferSchema(Ticket{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to infer the ticket schema: %w", err)
+	}
+	return schema, nil
+}
+
 func (t *Ticket) Save() (map[string]bigquery.Value, string, error) {
 	return map[string]bigquery.Value{
 		"record_created":    t.RecordCreated,
@@ -110,7 +122,9 @@ func (t *Ticket) Save() (map[string]bigquery.Value, string, error) {
 	}, bigquery.NoDedupeID, nil
 }
 
-func convertToTicket(issueComments *jira.IssueComments, timestamp time.Time) *Ticket {
+// convertToTicket converts an issue to a ticket row, recording any fields that cannot be
+// converted to deadLetter.
+func convertToTicket(issueComments *jira.IssueComments, timestamp time.Time, deadLetter *DeadLetter) *Ticket {
 	return &Ticket{
 		RecordCreated: timestamp,
 		Issue: Issue{
@@ -131,7 +145,7 @@ func convertToTicket(issueComments *jira.IssueComments, timestamp time.Time) *Ti
 		FixVersions:     getFixVersions(issueComments.Info.Fields.FixVersions),
 		AffectsVersions: getAffectsVersions(issueComments.Info.Fields.AffectsVersions),
 		LastChangedTime: getUpdatedTime(issueComments.Info.Fields.Updated),
-		CustomFields:    getCustomFields(issueComments.Info),
+		CustomFields:    getCustomFields(issueComments.Info, deadLetter),
 	}
 }
 
@@ -198,7 +212,7 @@ func getComments(issueComments []*jiraBaseClient.Comment) []Comment {
 }
 
 func getCreatedTime(created string) time.Time {
-	out, err := time.Parse("2006-01-02T15:04:05.999-0700", created)
+	out, err := jira.ParseTime(created)
 	if err != nil {
 		klog.Errorf("unable to parse jira comment created time: %v", err)
 		return time.Time{}
@@ -240,24 +254,20 @@ func getAffectsVersions(affectsVersions []*jiraBaseClient.AffectsVersion) []Vers
 }
 
 func getUpdatedTime(updated jiraBaseClient.Time) time.Time {
-	b, err := updated.MarshalJSON()
-	if err != nil {
-		return time.Time{}
-	}
-	t, err := time.Parse("\"2006-01-02T15:04:05.000-0700\"", string(b))
-	if err != nil {
-		return time.Time{}
-	}
-	return t
+	// the client has already parsed the timestamp
+	return time.Time(updated)
 }
 
-func getCustomFields(i jiraBaseClient.Issue) []CustomField {
+func getCustomFields(i jiraBaseClient.Issue, deadLetter *DeadLetter) []CustomField {
 	var customFields []CustomField
 	for k, v := range i.Fields.Unknowns {
 		if v == nil {
 			continue
 		}
-		field := processCustomFieldValue(k, v)
+		field, err := processCustomFieldValue(k, v)
+		if err != nil {
+			deadLetter.Record(i.Key, k, err, v)
+		}
 		if field != nil {
 			customFields = append(customFields, *field)
 		}
@@ -265,10 +275,13 @@ func getCustomFields(i jiraBaseClient.Issue) []CustomField {
 	return customFields
 }
 
-func processCustomFieldValue(name string, value interface{}) *CustomField {
+// processCustomFieldValue converts the value of a custom field. If all or part of the
+// value could not be converted an error is returned, along with any part that was.
+func processCustomFieldValue(name string, value interface{}) (*CustomField, error) {
 	var field *CustomField
 	var fields []CustomField
 	var valueStr string
+	var errs []error
 
 	switch t := value.(type) {
 	case int:
@@ -281,39 +294,44 @@ func processCustomFieldValue(name string, value interface{}) *CustomField {
 		valueStr = fmt.Sprintf("%t", value)
 	case []interface{}:
 		for _, n := range t {
-			cf := getCustomField(name, n)
-			if cf != nil {
-				fields = append(fields, *cf)
+			cf, err := getCustomField(name, n)
+			if err != nil {
+				errs = append(errs, err)
+				continue
 			}
+			fields = append(fields, *cf)
 		}
 	case map[string]interface{}:
-		field = getCustomField(name, value)
+		var err error
+		if field, err = getCustomField(name, value); err != nil {
+			return nil, err
+		}
 	default:
 		var r = reflect.TypeOf(t)
 		klog.Warningf("Unknown CustomField type: %v", r)
-		return nil
+		return nil, fmt.Errorf("unknown custom field type %v", r)
 	}
 
 	switch {
 	case field != nil:
 		field.FieldName = name
-		return field
+		return field, nil
 	case fields != nil && len(fields) > 0:
 		return &CustomField{
 			FieldName:       name,
 			StructuredValue: generateBigQueryJson(fields),
-		}
+		}, errors.Join(errs...)
 	case len(valueStr) > 0:
 		return &CustomField{
 			FieldName: name,
 			Value:     valueStr,
-		}
+		}, nil
 	default:
-		return nil
+		return nil, errors.Join(errs...)
 	}
 }
 
-func getCustomField(name string, value interface{}) *CustomField {
+func getCustomField(name string, value interface{}) (*CustomField, error) {
 	field := &CustomField{}
 	switch v := value.(type) {
 	case string:
@@ -322,14 +340,41 @@ func getCustomField(name string, value interface{}) *CustomField {
 		bytes, err := json.Marshal(value)
 		if err != nil {
 			klog.Errorf("failed to process the custom field %s. Error : %v", name, err)
-			return nil
+			return nil, err
 		}
 		if err = json.Unmarshal(bytes, field); err != nil {
 			klog.Errorf("failed to unmarshall the json to struct for %s. Error: %v", name, err)
-			return nil
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// ticketFingerprint returns a hash of the contents of t that changes only when a field
+// other than the record and update times or an ignored custom field changes. Custom
+// fields are compared independent of their order.
+func ticketFingerprint(t *Ticket, ignoreCustomFields []string) string {
+	copied := *t
+	copied.RecordCreated = time.Time{}
+	copied.LastChangedTime = time.Time{}
+	copied.CustomFields = make([]CustomField, 0, len(t.CustomFields))
+	for _, field := range t.CustomFields {
+		if slices.Contains(ignoreCustomFields, field.FieldName) {
+			continue
 		}
+		copied.CustomFields = append(copied.CustomFields, field)
+	}
+	slices.SortFunc(copied.CustomFields, func(a, b CustomField) int {
+		return strings.Compare(generateBigQueryJson(a), generateBigQueryJson(b))
+	})
+	data, err := json.Marshal(copied)
+	if err != nil {
+		// an unknown fingerprint never matches, so the ticket is always written
+		klog.Errorf("failed to fingerprint ticket %s: %v", t.Issue.ID, err)
+		return ""
 	}
-	return field
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
 func generateBigQueryJson(src interface{}) string {
@@ -0,0 +1,58 @@
+package jira_watcher_controller
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ticketFingerprint(t *testing.T) {
+	ticket := func(updated time.Time, fields ...CustomField) *Ticket {
+		return &Ticket{
+			RecordCreated:   updated,
+			Issue:           Issue{ID: "1", Key: "OCPBUGS-1"},
+			Summary:         "test failure",
+			LastChangedTime: updated,
+			CustomFields:    fields,
+		}
+	}
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	rank := CustomField{FieldName: "customfield_1", Value: "0|a"}
+	release := CustomField{FieldName: "customfield_2", Value: "4.14"}
+	ignore := []string{"customfield_1"}
+	base := ticketFingerprint(ticket(now, rank, release), ignore)
+
+	if fp := ticketFingerprint(ticket(now.Add(time.Hour), release, rank), ignore); fp != base {
+		t.Errorf("reordered custom fields and a new update time should not change the fingerprint")
+	}
+	if fp := ticketFingerprint(ticket(now, CustomField{FieldName: "customfield_1", Value: "0|b"}, release), ignore); fp != base {
+		t.Errorf("an ignored custom field should not change the fingerprint")
+	}
+	if fp := ticketFingerprint(ticket(now, rank, CustomField{FieldName: "customfield_2", Value: "4.15"}), ignore); fp == base {
+		t.Errorf("a custom field that is not ignored should change the fingerprint")
+	}
+	changed := ticket(now, rank, release)
+	changed.Summary = "other"
+	if fp := ticketFingerprint(changed, ignore); fp == base {
+		t.Errorf("a summary change should change the fingerprint")
+	}
+}
+
+func Test_ticketSchema(t *testing.T) {
+	schema, err := ticketSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket := &Ticket{}
+	row, _, err := ticket.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema) != len(row) {
+		t.Fatalf("schema has %d columns but a ticket saves %d", len(schema), len(row))
+	}
+	for _, field := range schema {
+		if _, ok := row[field.Name]; !ok {
+			t.Errorf("schema column %s is not saved by a ticket", field.Name)
+		}
+	}
+}
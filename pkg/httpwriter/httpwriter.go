@@ -4,6 +4,7 @@ import (
 	"compress/gzip"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -18,27 +19,79 @@ type nopCloser struct {
 
 func (nopCloser) Close() error { return nil }
 
+// ForRequest returns a writer for the response to req that compresses the response if
+// the client accepts a supported encoding. The writer must be closed to flush the
+// response. A response that already has a Content-Encoding is never compressed again.
 func ForRequest(w http.ResponseWriter, req *http.Request) WriteCloser {
-	var encoding string
-	for _, header := range req.Header["Accept-Encoding"] {
-		// FIXME: Propert quality parsing
-		// https://tools.ietf.org/html/rfc7231#section-5.3.4
-		// https://github.com/golang/go/issues/19307
-		for _, enc := range strings.Split(header, ",") {
-			if strings.TrimSpace(enc) == "gzip" {
-				encoding = "gzip"
-				break
-			}
-		}
-		if encoding != "" {
-			break
-		}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if len(w.Header().Get("Content-Encoding")) > 0 {
+		return nopCloser{w}
 	}
 
-	if encoding == "gzip" {
+	if negotiateEncoding(req.Header.Values("Accept-Encoding")) == "gzip" {
 		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
 		return gzip.NewWriter(w)
 	}
 
 	return nopCloser{w}
 }
+
+// negotiateEncoding returns the content coding to use for a response given the values of
+// the Accept-Encoding header of the request, or an empty string if the response should
+// not be encoded. Only gzip is supported, and it is only chosen when the client gives it
+// a non-zero quality that is at least the quality of identity, as described in
+// https://tools.ietf.org/html/rfc7231#section-5.3.4.
+func negotiateEncoding(headers []string) string {
+	gzipQ, identityQ, anyQ := -1.0, -1.0, -1.0
+	for _, header := range headers {
+		for _, value := range strings.Split(header, ",") {
+			coding, q, ok := parseCoding(value)
+			if !ok {
+				continue
+			}
+			switch coding {
+			case "gzip", "x-gzip":
+				gzipQ = q
+			case "identity":
+				identityQ = q
+			case "*":
+				anyQ = q
+			}
+		}
+	}
+	// codings that are not listed take the quality of *, if present
+	if gzipQ < 0 {
+		gzipQ = anyQ
+	}
+	if gzipQ <= 0 {
+		return ""
+	}
+	if identityQ > gzipQ {
+		return ""
+	}
+	return "gzip"
+}
+
+// parseCoding returns the lowercase content coding and quality of a single element of an
+// Accept-Encoding header, e.g. "gzip;q=0.5". Elements that cannot be parsed are not ok.
+func parseCoding(value string) (string, float64, bool) {
+	parts := strings.Split(value, ";")
+	coding := strings.ToLower(strings.TrimSpace(parts[0]))
+	if len(coding) == 0 {
+		return "", 0, false
+	}
+	q := 1.0
+	for _, param := range parts[1:] {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			return "", 0, false
+		}
+		q = parsed
+	}
+	return coding, q, true
+}
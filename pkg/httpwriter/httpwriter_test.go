@@ -0,0 +1,81 @@
+package httpwriter
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_negotiateEncoding(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		headers []string
+		want    string
+	}{
+		{name: "no header"},
+		{name: "empty header", headers: []string{""}},
+		{name: "gzip", headers: []string{"gzip"}, want: "gzip"},
+		{name: "gzip among others", headers: []string{"br, gzip, deflate"}, want: "gzip"},
+		{name: "uppercase gzip", headers: []string{"GZIP"}, want: "gzip"},
+		{name: "x-gzip", headers: []string{"x-gzip"}, want: "gzip"},
+		{name: "multiple headers", headers: []string{"br", "gzip;q=0.5"}, want: "gzip"},
+		{name: "br only", headers: []string{"br"}},
+		{name: "deflate only", headers: []string{"deflate"}},
+		{name: "identity", headers: []string{"identity"}},
+		{name: "gzip refused", headers: []string{"gzip;q=0, br"}},
+		{name: "gzip refused with spaces", headers: []string{"br, gzip ; q=0.000"}},
+		{name: "identity refused", headers: []string{"identity;q=0, gzip"}, want: "gzip"},
+		{name: "identity preferred", headers: []string{"gzip;q=0.5, identity"}},
+		{name: "gzip preferred", headers: []string{"gzip, identity;q=0.5"}, want: "gzip"},
+		{name: "wildcard", headers: []string{"*"}, want: "gzip"},
+		{name: "wildcard refused", headers: []string{"br, *;q=0"}},
+		{name: "gzip overrides wildcard", headers: []string{"*;q=0, gzip"}, want: "gzip"},
+		{name: "invalid quality is ignored", headers: []string{"gzip;q=2"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateEncoding(tt.headers); got != tt.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.headers, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	writer := ForRequest(w, req)
+	io.WriteString(writer, "response")
+	writer.Close()
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+	r, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(r); err != nil || string(data) != "response" {
+		t.Errorf("unexpected body %q: %v", data, err)
+	}
+
+	req.Header.Set("Accept-Encoding", "identity")
+	w = httptest.NewRecorder()
+	writer = ForRequest(w, req)
+	io.WriteString(writer, "response")
+	writer.Close()
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "response" {
+		t.Errorf("expected an unencoded response: %v %q", w.Header(), w.Body.String())
+	}
+
+	// an already encoded response is not compressed again
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	w.Header().Set("Content-Encoding", "br")
+	writer = ForRequest(w, req)
+	io.WriteString(writer, "response")
+	writer.Close()
+	if w.Header().Get("Content-Encoding") != "br" || w.Body.String() != "response" {
+		t.Errorf("expected the response to be written unchanged: %v %q", w.Header(), w.Body.String())
+	}
+}
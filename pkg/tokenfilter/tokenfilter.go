@@ -0,0 +1,311 @@
+// Package tokenfilter records the words present in a set of files in a compact bloom
+// filter, so that a search for a literal string can be answered "definitely not present"
+// without reading the files.
+//
+// Files are split into tokens on any byte that is not an ASCII letter, digit, or
+// underscore, and tokens are lowercased before they are recorded. A literal search can
+// only match a file if every token in the search that is bounded on both sides by a
+// non-word character is present in the file.
+package tokenfilter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"regexp/syntax"
+	"strings"
+)
+
+const (
+	// MinTokenLength is the shortest token recorded in a filter.
+	MinTokenLength = 3
+	// MaxTokenLength is the longest token recorded in a filter. Longer tokens are ignored
+	// when building and when checking a filter.
+	MaxTokenLength = 64
+
+	// maxUniqueTokens is the largest number of distinct tokens a filter is built for.
+	maxUniqueTokens = 4 * 1024 * 1024
+
+	magic = "cstf"
+)
+
+// ErrTooManyTokens is returned by Build when the files contain too many distinct tokens
+// for a filter to be useful.
+var ErrTooManyTokens = fmt.Errorf("too many distinct tokens to build a filter")
+
+// Filter is a bloom filter over tokens.
+type Filter struct {
+	bits []uint64
+	k    uint32
+}
+
+// New returns a filter sized to hold n tokens with the provided false positive rate.
+func New(n int, falsePositiveRate float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.01
+	}
+	m := math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	// round up to a power of two number of bits
+	words := 1
+	for words*64 < int(m) {
+		words *= 2
+	}
+	return &Filter{bits: make([]uint64, words), k: uint32(k)}
+}
+
+func (f *Filter) locations(token string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(token))
+	sum := h.Sum64()
+	// an odd step visits distinct bits for each hash since the filter size is a power of two
+	return sum & 0xffffffff, (sum >> 32) | 1
+}
+
+// Add records token in the filter.
+func (f *Filter) Add(token string) {
+	m := uint64(len(f.bits)) * 64
+	h1, h2 := f.locations(token)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain returns false if token was definitely not added to the filter.
+func (f *Filter) MayContain(token string) bool {
+	m := uint64(len(f.bits)) * 64
+	h1, h2 := f.locations(token)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MayContainAll returns false if any of tokens was definitely not added to the filter.
+func (f *Filter) MayContainAll(tokens []string) bool {
+	for _, token := range tokens {
+		if !f.MayContain(token) {
+			return false
+		}
+	}
+	return true
+}
+
+// Size returns the number of bytes the filter holds in memory.
+func (f *Filter) Size() int {
+	return len(f.bits) * 8
+}
+
+// WriteFile writes the filter to path.
+func (f *Filter) WriteFile(path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	w.WriteString(magic)
+	binary.Write(w, binary.LittleEndian, f.k)
+	binary.Write(w, binary.LittleEndian, uint64(len(f.bits)))
+	if err := binary.Write(w, binary.LittleEndian, f.bits); err != nil {
+		out.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		os.Remove(path)
+		return err
+	}
+	return out.Close()
+}
+
+// ReadFile reads a filter written by WriteFile.
+func ReadFile(path string) (*Filter, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	r := bufio.NewReader(in)
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != magic {
+		return nil, fmt.Errorf("%s is not a token filter", path)
+	}
+	var k uint32
+	var words uint64
+	if err := binary.Read(r, binary.LittleEndian, &k); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &words); err != nil {
+		return nil, err
+	}
+	if k == 0 || words == 0 || words > 64*1024*1024 {
+		return nil, fmt.Errorf("%s has an invalid token filter header", path)
+	}
+	bits := make([]uint64, words)
+	if err := binary.Read(r, binary.LittleEndian, bits); err != nil {
+		return nil, fmt.Errorf("%s is truncated: %v", path, err)
+	}
+	return &Filter{bits: bits, k: k}, nil
+}
+
+// Build returns a filter containing the tokens of every file in paths. Files ending in
+// .gz are decompressed. Files that do not exist are ignored.
+func Build(paths []string, falsePositiveRate float64) (*Filter, error) {
+	tokens := make(map[string]struct{}, 16*1024)
+	for _, path := range paths {
+		if err := readFileTokens(path, func(token string) error {
+			if _, ok := tokens[token]; ok {
+				return nil
+			}
+			if len(tokens) >= maxUniqueTokens {
+				return ErrTooManyTokens
+			}
+			tokens[token] = struct{}{}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	f := New(len(tokens), falsePositiveRate)
+	for token := range tokens {
+		f.Add(token)
+	}
+	return f, nil
+}
+
+func readFileTokens(path string, fn func(token string) error) error {
+	in, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+	var r io.Reader = in
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %v", path, err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+	return Tokens(r, fn)
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+func toLowerByte(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// Tokens invokes fn with each lowercased token read from r that is between
+// MinTokenLength and MaxTokenLength bytes long.
+func Tokens(r io.Reader, fn func(token string) error) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	token := make([]byte, 0, MaxTokenLength)
+	length := 0
+	emit := func() error {
+		defer func() {
+			token = token[:0]
+			length = 0
+		}()
+		if length < MinTokenLength || length > MaxTokenLength {
+			return nil
+		}
+		return fn(string(token))
+	}
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return emit()
+		}
+		if err != nil {
+			return err
+		}
+		if !isWordByte(b) {
+			if length > 0 {
+				if err := emit(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		length++
+		if length <= MaxTokenLength {
+			token = append(token, toLowerByte(b))
+		}
+	}
+}
+
+// RequiredTokens returns the tokens that must be present in a file for the ripgrep
+// search to match it. If the search is not a literal string, false is returned. Only
+// tokens bounded by non-word characters within the search are returned, since the
+// tokens at either end of the search may be part of a longer token in the file.
+func RequiredTokens(search string) ([]string, bool) {
+	re, err := syntax.Parse(search, syntax.Perl)
+	if err != nil {
+		return nil, false
+	}
+	re = re.Simplify()
+	var literal strings.Builder
+	switch re.Op {
+	case syntax.OpLiteral:
+		literal.WriteString(string(re.Rune))
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if sub.Op != syntax.OpLiteral {
+				return nil, false
+			}
+			literal.WriteString(string(sub.Rune))
+		}
+	default:
+		return nil, false
+	}
+
+	s := literal.String()
+	var tokens []string
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && isWordByte(s[i]) {
+			if start == -1 {
+				start = i
+			}
+			continue
+		}
+		if start == -1 {
+			continue
+		}
+		// tokens touching either end of the search may continue in the file
+		if start > 0 && i < len(s) {
+			if l := i - start; l >= MinTokenLength && l <= MaxTokenLength {
+				tokens = append(tokens, strings.ToLower(s[start:i]))
+			}
+		}
+		start = -1
+	}
+	return tokens, true
+}
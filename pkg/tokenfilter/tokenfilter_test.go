@@ -0,0 +1,156 @@
+package tokenfilter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequiredTokens(t *testing.T) {
+	tests := []struct {
+		search string
+		want   []string
+		ok     bool
+	}{
+		{search: "etcdserver", ok: true},
+		{search: "etcdserver: request timed out", want: []string{"request", "timed"}, ok: true},
+		{search: "Error deleting EBS volume", want: []string{"deleting", "ebs"}, ok: true},
+		{search: " leading and trailing ", want: []string{"leading", "and", "trailing"}, ok: true},
+		{search: `failed to get \(.*`, ok: false},
+		{search: `pod a\.b is not healthy`, want: []string{"not"}, ok: true},
+		{search: "level=error.*timeout", ok: false},
+		{search: "(?i)Cluster operator is still", want: []string{"operator"}, ok: true},
+		{search: "[", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			got, ok := RequiredTokens(tt.search)
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RequiredTokens() = %v %t, want %v %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTokens(t *testing.T) {
+	var got []string
+	input := "I0102 level=Error msg=\"a_b_c failed\" " + strings.Repeat("x", MaxTokenLength+1) + " end"
+	if err := Tokens(strings.NewReader(input), func(token string) error {
+		got = append(got, token)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"i0102", "level", "error", "msg", "a_b_c", "failed", "end"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokens() = %v, want %v", got, want)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "junit.failures"), []byte("# test\nerror: etcdserver: request timed out\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	fmt.Fprint(gw, "level=fatal msg=failed to initialize the cluster\n")
+	gw.Close()
+	if err := os.WriteFile(filepath.Join(dir, "build-log.txt.gz"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Build([]string{
+		filepath.Join(dir, "junit.failures"),
+		filepath.Join(dir, "build-log.txt.gz"),
+		filepath.Join(dir, "missing"),
+	}, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "tokens.filter")
+	if err := f.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err = ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, search := range []string{"etcdserver: request timed out", "msg=failed to initialize the cluster", "Initialize the"} {
+		tokens, ok := RequiredTokens(search)
+		if !ok || !f.MayContainAll(tokens) {
+			t.Errorf("expected filter to allow %q", search)
+		}
+	}
+	for _, search := range []string{"etcdserver: leader changed", "unable to install the cluster operator"} {
+		tokens, ok := RequiredTokens(search)
+		if !ok || f.MayContainAll(tokens) {
+			t.Errorf("expected filter to exclude %q", search)
+		}
+	}
+}
+
+func TestReadFileInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.filter")
+	if err := os.WriteFile(path, []byte("not a filter"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(path); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// BenchmarkExistence compares answering a negative existence check from a filter with
+// scanning the file contents for the search.
+func BenchmarkExistence(b *testing.B) {
+	var lines []string
+	for i := 0; i < 100000; i++ {
+		lines = append(lines, fmt.Sprintf("I0102 12:00:00.%06d controller.go:%d] synced object namespace-%d/pod-%d in %dms", i, i%500, i%50, i, i%97))
+	}
+	data := []byte(strings.Join(lines, "\n"))
+	path := filepath.Join(b.TempDir(), "build-log.txt")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+	filter, err := Build([]string{path}, 0.01)
+	if err != nil {
+		b.Fatal(err)
+	}
+	filterPath := path + ".filter"
+	if err := filter.WriteFile(filterPath); err != nil {
+		b.Fatal(err)
+	}
+	search := "etcdserver: request timed out"
+
+	b.Run("scan", func(b *testing.B) {
+		re := regexp.MustCompile(search)
+		for i := 0; i < b.N; i++ {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if re.Match(data) {
+				b.Fatal("unexpected match")
+			}
+		}
+	})
+	b.Run("filter", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			f, err := ReadFile(filterPath)
+			if err != nil {
+				b.Fatal(err)
+			}
+			tokens, _ := RequiredTokens(search)
+			if f.MayContainAll(tokens) {
+				b.Fatal("unexpected match")
+			}
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package prow
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"google.golang.org/api/googleapi"
+)
+
+// adaptiveConcurrency limits the number of workers that download jobs. The limit is
+// halved each time GCS throttles a download and raised by one after each run of
+// successful downloads as long as the current limit, up to the maximum.
+type adaptiveConcurrency struct {
+	lock      sync.Mutex
+	max       int
+	current   int
+	successes int
+}
+
+func newAdaptiveConcurrency(max int) *adaptiveConcurrency {
+	if max < 1 {
+		max = 1
+	}
+	metricScrapeConcurrency.Set(float64(max))
+	return &adaptiveConcurrency{max: max, current: max}
+}
+
+// Active returns true if the worker with the given zero based index may download jobs.
+func (c *adaptiveConcurrency) Active(worker int) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return worker < c.current
+}
+
+// Current returns the number of workers that may download jobs.
+func (c *adaptiveConcurrency) Current() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.current
+}
+
+// Throttled halves the number of active workers.
+func (c *adaptiveConcurrency) Throttled() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.successes = 0
+	if c.current == 1 {
+		return
+	}
+	c.current /= 2
+	metricScrapeConcurrency.Set(float64(c.current))
+}
+
+// Succeeded records a download that was not throttled.
+func (c *adaptiveConcurrency) Succeeded() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.current == c.max {
+		return
+	}
+	c.successes++
+	if c.successes < c.current {
+		return
+	}
+	c.successes = 0
+	c.current++
+	metricScrapeConcurrency.Set(float64(c.current))
+}
+
+// isThrottled returns true if err shows that GCS rejected a request because of load.
+func isThrottled(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == http.StatusTooManyRequests || apiErr.Code == http.StatusServiceUnavailable
+}
@@ -0,0 +1,98 @@
+package prow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	c := newAdaptiveConcurrency(8)
+	if !c.Active(7) || c.Active(8) {
+		t.Fatalf("expected all workers to start active")
+	}
+
+	c.Throttled()
+	c.Throttled()
+	if c.Current() != 2 || c.Active(2) {
+		t.Fatalf("expected throttling to halve concurrency: %d", c.Current())
+	}
+	c.Throttled()
+	c.Throttled()
+	if c.Current() != 1 || !c.Active(0) {
+		t.Fatalf("expected at least one worker to remain active: %d", c.Current())
+	}
+
+	// each run of successes as long as the current limit adds a worker
+	for _, want := range []int{2, 3, 4} {
+		for i := 0; i < want-1; i++ {
+			c.Succeeded()
+		}
+		if c.Current() != want {
+			t.Fatalf("expected concurrency %d after successes: %d", want, c.Current())
+		}
+	}
+	for i := 0; i < 100; i++ {
+		c.Succeeded()
+	}
+	if c.Current() != 8 {
+		t.Fatalf("expected concurrency to be restored to the maximum: %d", c.Current())
+	}
+}
+
+func Test_isThrottled(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{err: fmt.Errorf("failed to read build: %w", &googleapi.Error{Code: http.StatusTooManyRequests}), want: true},
+		{err: &googleapi.Error{Code: http.StatusServiceUnavailable}, want: true},
+		{err: &googleapi.Error{Code: http.StatusNotFound}},
+		{err: fmt.Errorf("failed to read build: %v", &googleapi.Error{Code: http.StatusTooManyRequests})},
+	} {
+		if got := isThrottled(tt.err); got != tt.want {
+			t.Errorf("isThrottled(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+// Test_isThrottled_readBuild verifies that a throttled GCS response is still recognized
+// after the build reader wraps it.
+func Test_isThrottled_readBuild(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"code":429,"message":"rate limit exceeded"}}`)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx, option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication(), option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetry(storage.WithPolicy(storage.RetryNever))
+	build := Build{
+		Bucket:     client.Bucket("test-platform-results"),
+		Context:    ctx,
+		BucketPath: "test-platform-results",
+		Prefix:     "logs/job-a/1/",
+	}
+
+	artifacts := make(chan *storage.ObjectAttrs, 1)
+	if err := build.Artifacts(artifacts); !isThrottled(err) {
+		t.Errorf("expected listing artifacts to be throttled: %v", err)
+	}
+
+	accumulator, _ := NewAccumulator(t.TempDir(), &build, time.Now(), IndexOptions{})
+	if err := ReadBuild(build, accumulator); !isThrottled(err) {
+		t.Errorf("expected reading the build to be throttled: %v", err)
+	}
+}
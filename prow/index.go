@@ -3,16 +3,20 @@ package prow
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
@@ -32,6 +36,18 @@ var (
 		Name: "job_scraped_ignored",
 		Help: "The number of times we ignored a completed job due to unexpected data in the job.",
 	})
+	metricScrapedJobsSkippedAborted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "job_scraped_skipped_aborted",
+		Help: "The number of aborted jobs whose artifacts were not downloaded.",
+	})
+	metricPrunedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "job_pruned_bytes",
+		Help: "The number of bytes reclaimed by removing the directories of expired jobs that are no longer known.",
+	})
+	metricScrapeConcurrency = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "job_scrape_concurrency",
+		Help: "The number of workers downloading completed jobs, which is reduced while GCS throttles downloads.",
+	})
 )
 
 func init() {
@@ -39,24 +55,76 @@ func init() {
 		metricScrapedJobs,
 		metricScrapedJobsFailed,
 		metricScrapedJobsIgnored,
+		metricScrapedJobsSkippedAborted,
+		metricScrapeConcurrency,
+		metricPrunedBytes,
 	)
 }
 
+// IndexOptions controls which jobs and artifacts are downloaded to disk.
+type IndexOptions struct {
+	// SkipAborted prevents artifacts from being downloaded for aborted jobs. Aborted
+	// jobs are still reported in job statistics.
+	SkipAborted bool
+	// MustGather controls extraction of files from must-gather archives.
+	MustGather MustGatherOptions
+	// TokenFilter writes a filter of the tokens in the searchable files of each build
+	// so that literal searches can skip builds that cannot match.
+	TokenFilter bool
+	// SuccessJunit parses the junit results of successful builds, so that tests that
+	// failed and passed on retry are searchable. Build logs are only downloaded for
+	// builds that did not succeed.
+	SuccessJunit bool
+	// Artifacts are the kinds of artifacts indexed for each build: junit, build-log, and
+	// e2e-log. Build logs and the tail of e2e.log are only downloaded for builds that
+	// did not succeed. If empty, junit and build-log are indexed.
+	Artifacts []string
+}
+
+// ArtifactKinds are the kinds of artifacts that may be indexed.
+var ArtifactKinds = []string{"junit", "build-log", "e2e-log"}
+
+// indexes returns true if artifacts of the given kind are indexed.
+func (o IndexOptions) indexes(kind string) bool {
+	if len(o.Artifacts) == 0 {
+		return kind == "junit" || kind == "build-log"
+	}
+	for _, artifact := range o.Artifacts {
+		if artifact == kind {
+			return true
+		}
+	}
+	return false
+}
+
 type DiskStore struct {
-	base   string
-	maxAge time.Duration
-	queue  workqueue.RateLimitingInterface
-	client *storage.Client
+	base    string
+	maxAge  time.Duration
+	queue   workqueue.RateLimitingInterface
+	client  *storage.Client
+	options IndexOptions
+
+	// initialLock guards started and initial
+	initialLock sync.Mutex
+	// started is true once Run has been called
+	started bool
+	// initial is the set of items queued before Run started that have not been
+	// processed yet. An item that is retried is only removed once.
+	initial sets.String
+	// synced is true once every item queued when Run started has been processed
+	synced atomic.Bool
 }
 
-func NewDiskStore(client *storage.Client, path string, maxAge time.Duration) *DiskStore {
+func NewDiskStore(client *storage.Client, path string, maxAge time.Duration, options IndexOptions) *DiskStore {
 	rate := workqueue.NewItemExponentialFailureRateLimiter(time.Minute, 30*time.Minute)
 	queue := workqueue.NewRateLimitingQueue(rate)
 	return &DiskStore{
-		base:   path,
-		maxAge: maxAge,
-		queue:  queue,
-		client: client,
+		base:    path,
+		maxAge:  maxAge,
+		queue:   queue,
+		client:  client,
+		options: options,
+		initial: sets.NewString(),
 	}
 }
 
@@ -115,32 +183,167 @@ func (s *DiskStore) QueueLen() int {
 	return s.queue.Len()
 }
 
+// HasSynced returns true once Run has processed every job that was queued when it
+// started, which is the initial build of the disk cache.
+func (s *DiskStore) HasSynced() bool {
+	return s.synced.Load()
+}
+
+// pruneInterval is how often the directories of jobs that are no longer known are removed.
+const pruneInterval = time.Hour
+
+// Prune removes the build directories that are older than the maximum age of the store
+// and whose build is not known to accessor, returning the number of directories removed
+// and the bytes reclaimed. A build directory is any directory that contains files.
+func (s *DiskStore) Prune(accessor JobAccessor, now time.Time) (int, int64, error) {
+	if s.maxAge <= 0 {
+		return 0, 0, nil
+	}
+	expiredAt := now.Add(-s.maxAge)
+	var removed int
+	var reclaimed int64
+	err := filepath.WalkDir(s.base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() || path == s.base {
+			return nil
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		var isBuild bool
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				isBuild = true
+				break
+			}
+		}
+		if !isBuild {
+			return nil
+		}
+
+		buildID, job := filepath.Base(path), filepath.Base(filepath.Dir(path))
+		if _, err := accessor.GetBuild(job, buildID); err == nil {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(expiredAt) {
+			return filepath.SkipDir
+		}
+		size := directorySize(path)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		removed++
+		reclaimed += size
+		return filepath.SkipDir
+	})
+	metricPrunedBytes.Add(float64(reclaimed))
+	if removed > 0 {
+		klog.Infof("Pruned %d job directories that are no longer known, reclaimed %d bytes", removed, reclaimed)
+	}
+	return removed, reclaimed, err
+}
+
+// directorySize returns the total size of the files under path.
+func directorySize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// done marks obj as processed, and records that the initial sync is complete once the
+// items queued when Run started have all been processed.
+func (s *DiskStore) done(obj interface{}) {
+	s.queue.Done(obj)
+	if s.synced.Load() {
+		return
+	}
+	id, _ := obj.(string)
+	s.initialLock.Lock()
+	defer s.initialLock.Unlock()
+	if !s.initial.Has(id) {
+		return
+	}
+	s.initial.Delete(id)
+	if s.initial.Len() == 0 && s.synced.CompareAndSwap(false, true) {
+		klog.Infof("Prow disk store completed its initial sync")
+	}
+}
+
+// Run downloads queued jobs with up to workers concurrent downloads until ctx is
+// cancelled. While GCS throttles downloads fewer workers are used, which also slows the
+// initial sync that HasSynced reports.
 func (s *DiskStore) Run(ctx context.Context, accessor JobAccessor, notifier PathNotifier, disableWrite bool, workers int) {
+	concurrency := newAdaptiveConcurrency(workers)
+	if !disableWrite && s.maxAge > 0 {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			if _, _, err := s.Prune(accessor, time.Now()); err != nil {
+				klog.Errorf("Unable to prune job directories: %v", err)
+			}
+		}, pruneInterval)
+	}
+	s.initialLock.Lock()
+	s.started = true
+	if s.initial.Len() == 0 {
+		s.synced.Store(true)
+	}
+	s.initialLock.Unlock()
+	// stop waiting for changes once the context is cancelled, so that Run returns after
+	// the in-flight writes of each worker complete
+	go func() {
+		<-ctx.Done()
+		s.queue.ShutDown()
+	}()
+	var wg sync.WaitGroup
 	for i := 0; i < workers; i++ {
+		wg.Add(1)
 		go func(i int) {
+			defer wg.Done()
 			defer klog.V(2).Infof("Prow disk worker %d exited", i)
 			wait.UntilWithContext(ctx, func(ctx context.Context) {
 				for {
+					// idle workers resume once throttling stops
+					if !concurrency.Active(i) {
+						return
+					}
 					// temporary log the queue length
 					klog.Infof("Prow queue length: %d", s.queue.Len())
 					obj, done := s.queue.Get()
 					if done {
 						return
 					}
+					if ctx.Err() != nil {
+						s.queue.Done(obj)
+						return
+					}
 					if disableWrite {
 						s.queue.Forget(obj)
-						s.queue.Done(obj)
+						s.done(obj)
 						return
 					}
 					id, ok := obj.(string)
 					if !ok {
-						s.queue.Done(id)
+						s.done(id)
 						klog.Errorf("unexpected id in queue: %v", obj)
 						continue
 					}
 					job, err := accessor.Get(id)
 					if err != nil {
-						s.queue.Done(id)
+						s.done(id)
 						klog.V(5).Infof("No job for %s: %v", id, err)
 						continue
 					}
@@ -148,24 +351,30 @@ func (s *DiskStore) Run(ctx context.Context, accessor JobAccessor, notifier Path
 					func() {
 						defer cancelFn()
 						paths, err := s.write(ctx, job, notifier)
+						if err != nil && isThrottled(err) {
+							concurrency.Throttled()
+							klog.Warningf("Download throttled by GCS, reduced concurrency to %d", concurrency.Current())
+						} else {
+							concurrency.Succeeded()
+						}
 						if err != nil {
 							if s.queue.NumRequeues(obj) > 5 {
 								s.queue.Forget(obj)
 							} else {
 								s.queue.AddRateLimited(obj)
 							}
-							s.queue.Done(obj)
+							s.done(obj)
 							klog.Errorf("failed to write job: %v", err)
 							return
 						}
 						notifier.Notify(paths)
-						s.queue.Done(id)
+						s.done(id)
 					}()
 				}
 			}, time.Second)
 		}(i)
 	}
-	<-ctx.Done()
+	wg.Wait()
 }
 
 func (s *DiskStore) write(ctx context.Context, job *Job, notifier PathNotifier) ([]string, error) {
@@ -173,6 +382,11 @@ func (s *DiskStore) write(ctx context.Context, job *Job, notifier PathNotifier)
 		metricScrapedJobsIgnored.Add(1)
 		return nil, nil
 	}
+	if s.options.SkipAborted && job.Status.State == "aborted" {
+		klog.V(7).Infof("Job %s was aborted, skipping download", job.Status.URL)
+		metricScrapedJobsSkippedAborted.Inc()
+		return nil, nil
+	}
 	u, err := url.Parse(job.Status.URL)
 	if err != nil {
 		metricScrapedJobsFailed.Add(1)
@@ -199,12 +413,19 @@ func (s *DiskStore) write(ctx context.Context, job *Job, notifier PathNotifier)
 		Prefix:     path.Join(parts...) + "/",
 	}
 	start := time.Now()
-	accumulator, stale := NewAccumulator(s.base, &build, job.Status.CompletionTime.Time)
+	accumulator, stale := NewAccumulator(s.base, &build, job.Status.CompletionTime.Time, s.options)
 	if !stale {
 		klog.V(7).Infof("Job %s is up to date", job.Status.URL)
 		return nil, nil
 	}
-	if err := ReadBuild(build, accumulator); err != nil {
+	if err := accumulator.StartDownload(); err != nil {
+		metricScrapedJobsFailed.Add(1)
+		return nil, fmt.Errorf("unable to start download of %s: %v", job.Status.URL, err)
+	}
+	err = ReadBuild(build, accumulator)
+	// must-gather extraction is not limited by ReadBuild and may still be running
+	accumulator.Wait()
+	if err != nil {
 		klog.Infof("Download %s failed in %s: %v", job.Status.URL, time.Now().Sub(start).Truncate(time.Millisecond), err)
 		metricScrapedJobsFailed.Add(1)
 		return nil, err
@@ -223,6 +444,11 @@ func (s *DiskStore) pathForJob(job *Job) string {
 }
 
 func (s *DiskStore) notifyChanged(id string) {
+	s.initialLock.Lock()
+	if !s.started {
+		s.initial.Insert(id)
+	}
+	s.initialLock.Unlock()
 	s.queue.Add(id)
 }
 
@@ -0,0 +1,127 @@
+package prow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestDiskStore_HasSynced(t *testing.T) {
+	store := NewDiskStore(nil, t.TempDir(), 0, IndexOptions{})
+	for _, id := range []string{"job-a", "job-b", "job-c"} {
+		store.notifyChanged(id)
+	}
+	if store.HasSynced() {
+		t.Fatalf("store should not be synced before it runs")
+	}
+
+	// no jobs are known, so every queued item is processed without writing
+	lister, err := NewListerForJobs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Run(ctx, lister, nil, false, 2)
+
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return store.HasSynced(), nil
+	}); err != nil {
+		t.Fatalf("store did not complete its initial sync: %v", err)
+	}
+
+	// later items do not reset the initial sync
+	store.notifyChanged("job-d")
+	if !store.HasSynced() {
+		t.Fatalf("store should remain synced")
+	}
+}
+
+func TestDiskStore_HasSynced_retries(t *testing.T) {
+	store := NewDiskStore(nil, t.TempDir(), 0, IndexOptions{})
+	store.notifyChanged("job-a")
+	store.notifyChanged("job-b")
+
+	// a failed item that is retried is only counted once
+	store.done("job-a")
+	store.done("job-a")
+	if store.HasSynced() {
+		t.Fatalf("store should not be synced until every initial item is processed")
+	}
+	// an item that was not queued before Run started is not part of the initial sync
+	store.done("job-c")
+	if store.HasSynced() {
+		t.Fatalf("store should not be synced by an item that was not initially queued")
+	}
+	store.done("job-b")
+	if !store.HasSynced() {
+		t.Fatalf("store should be synced once every initial item is processed")
+	}
+}
+
+func TestDiskStore_HasSynced_Empty(t *testing.T) {
+	store := NewDiskStore(nil, t.TempDir(), 0, IndexOptions{})
+	lister, err := NewListerForJobs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Run(ctx, lister, nil, false, 1)
+
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return store.HasSynced(), nil
+	}); err != nil {
+		t.Fatalf("empty store did not report synced: %v", err)
+	}
+}
+
+func TestDiskStore_Prune(t *testing.T) {
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	base := t.TempDir()
+	writeBuild := func(dir string, modified time.Time) string {
+		t.Helper()
+		path := filepath.Join(base, "test-platform-results", dir)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(path, "build-log.txt"), []byte("12345"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	known := writeBuild("logs/job-a/1", now.Add(-48*time.Hour))
+	expired := writeBuild("logs/job-a/2", now.Add(-48*time.Hour))
+	expiredPull := writeBuild("pr-logs/pull/org_repo/10/job-b/3", now.Add(-48*time.Hour))
+	recent := writeBuild("logs/job-a/4", now.Add(-time.Hour))
+
+	lister, err := NewListerForJobs([]*Job{testJob("job-a-1", "job-a", "1", "success", now.Add(-48*time.Hour))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewDiskStore(nil, base, 24*time.Hour, IndexOptions{})
+	removed, reclaimed, err := store.Prune(lister, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 || reclaimed != 10 {
+		t.Errorf("unexpected removed=%d reclaimed=%d", removed, reclaimed)
+	}
+	for _, path := range []string{known, recent} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be kept: %v", path, err)
+		}
+	}
+	for _, path := range []string{expired, expiredPull} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed: %v", path, err)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"cloud.google.com/go/storage"
 	"google.golang.org/api/iterator"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/klog/v2"
 )
 
@@ -19,6 +20,30 @@ type ListerFunc func(ctx context.Context) ([]*Job, error)
 
 func (l ListerFunc) ListJobs(ctx context.Context) ([]*Job, error) { return l(ctx) }
 
+// MultiLister returns the jobs of every lister, such as the indices of several buckets.
+// Builds found by more than one lister are merged by the informer. A lister that fails
+// is skipped so that the other buckets are still listed, and an error is returned only
+// if every lister fails.
+type MultiLister []JobLister
+
+func (l MultiLister) ListJobs(ctx context.Context) ([]*Job, error) {
+	var all []*Job
+	var errs []error
+	for i, lister := range l {
+		jobs, err := lister.ListJobs(ctx)
+		if err != nil {
+			klog.Errorf("Unable to list jobs from source %d of %d: %v", i+1, len(l), err)
+			errs = append(errs, err)
+			continue
+		}
+		all = append(all, jobs...)
+	}
+	if len(errs) > 0 && len(errs) == len(l) {
+		return nil, errors.NewAggregate(errs)
+	}
+	return all, nil
+}
+
 type CachingLister struct {
 	Lister JobLister
 	jobs   []*Job
@@ -178,12 +203,9 @@ func (i *Index) EachJob(ctx context.Context, client *storage.Client, limit int64
 		}
 		return nil
 	}); err != nil && err != ErrStop {
-		if err == ctx.Err() {
-			return err
-		}
+		return err
 	}
 	return nil
-
 }
 
 const (
@@ -3,6 +3,7 @@ package prow
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"sync"
 	"time"
 
@@ -12,7 +13,6 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/tools/cache"
@@ -44,12 +44,31 @@ func NewLister(indexer cache.Indexer) *Lister {
 			}
 			return []string{job.Spec.Job}, nil
 		},
+		"by-build": func(obj interface{}) ([]string, error) {
+			job, ok := obj.(*Job)
+			if !ok || len(job.Status.BuildID) == 0 {
+				return nil, nil
+			}
+			return []string{job.Spec.Job + "/" + job.Status.BuildID}, nil
+		},
 	}); err != nil {
 		panic(err)
 	}
 	return &Lister{indexer: indexer}
 }
 
+// NewListerForJobs returns a lister containing only the provided jobs, without an
+// informer. It is intended for tests and for replaying a stored job list.
+func NewListerForJobs(jobs []*Job) (*Lister, error) {
+	lister := NewLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	for _, job := range jobs {
+		if err := lister.indexer.Add(job); err != nil {
+			return nil, err
+		}
+	}
+	return lister, nil
+}
+
 type Lister struct {
 	indexer cache.Indexer
 }
@@ -72,6 +91,17 @@ func (s *Lister) Get(name string) (*Job, error) {
 	return obj.(*Job), nil
 }
 
+func (s *Lister) GetBuild(job, buildID string) (*Job, error) {
+	arr, err := s.indexer.ByIndex("by-build", job+"/"+buildID)
+	if err != nil {
+		return nil, err
+	}
+	if len(arr) == 0 {
+		return nil, errors.NewNotFound(prowGR, job+"/"+buildID)
+	}
+	return arr[0].(*Job), nil
+}
+
 func (s *Lister) JobStats(name string, names sets.String, from, to time.Time) JobStats {
 	var stats JobStats
 	hasNameScope := names.Len() > 0
@@ -134,13 +164,19 @@ type JobLister interface {
 	ListJobs(ctx context.Context) ([]*Job, error)
 }
 
-var metricJobSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-	Name: "informer_list_jobs",
-	Help: "Prints the current number of jobs known to a jobs informer.",
-}, []string{"name", "type"})
+var (
+	metricJobSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "informer_list_jobs",
+		Help: "Prints the current number of jobs known to a jobs informer.",
+	}, []string{"name", "type"})
+	metricListErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "informer_list_errors_total",
+		Help: "The number of times listing jobs from a source failed, by informer and source.",
+	}, []string{"name", "source"})
+)
 
 func init() {
-	prometheus.MustRegister(metricJobSize)
+	prometheus.MustRegister(metricJobSize, metricListErrors)
 }
 
 func NewInformer(interval, resyncInterval, maxAge time.Duration, initialLister JobLister, listers ...JobLister) cache.SharedIndexInformer {
@@ -165,6 +201,8 @@ type ListWatcher struct {
 
 	lock     sync.Mutex
 	lastList []*Job
+	// listed is true once the initial lister has succeeded or a list has completed
+	listed bool
 }
 
 func jobExpired(job *Job, expires time.Time) bool {
@@ -177,12 +215,31 @@ func jobExpired(job *Job, expires time.Time) bool {
 	return job.Status.CompletionTime.Time.Before(expires)
 }
 
+// jobKey identifies a build across listers. Buckets may contain builds of the same job
+// with the same build ID, which are different builds.
+type jobKey struct {
+	bucket  string
+	job     string
+	buildID string
+}
+
+// jobBucket returns the bucket named by the status URL of job, or an empty string if the
+// URL does not name one.
+func jobBucket(job *Job) string {
+	u, err := url.Parse(job.Status.URL)
+	if err != nil {
+		return ""
+	}
+	bucket, _, _, _, _, _ := jobPathToAttributes(u.Path, job.Status.URL)
+	return bucket
+}
+
 func mergeJobs(lists [][]*Job, expires time.Time) (list *JobList, expiredCount int, emptyCount int) {
 	size := 0
 	for _, list := range lists {
 		size += len(list)
 	}
-	keys := make(map[types.NamespacedName]struct{}, size)
+	keys := make(map[jobKey]int, size)
 	var jobList JobList
 	jobList.Items = make([]*Job, 0, size)
 	for _, list := range lists {
@@ -195,38 +252,68 @@ func mergeJobs(lists [][]*Job, expires time.Time) (list *JobList, expiredCount i
 				emptyCount++
 				continue
 			}
-			key := types.NamespacedName{Namespace: job.Spec.Job, Name: job.Status.BuildID}
-			if _, ok := keys[key]; ok {
+			key := jobKey{bucket: jobBucket(job), job: job.Spec.Job, buildID: job.Status.BuildID}
+			if i, ok := keys[key]; ok {
+				if replacesJob(jobList.Items[i], job) {
+					jobList.Items[i] = job
+				}
 				continue
 			}
-			keys[key] = struct{}{}
+			keys[key] = len(jobList.Items)
 			jobList.Items = append(jobList.Items, job)
 		}
 	}
 	return &jobList, expiredCount, emptyCount
 }
 
+// replacesJob returns true if job is a later state of the same build as existing, which
+// is the case when only job has completed or job completed after existing. Otherwise
+// the job seen first is kept.
+func replacesJob(existing, job *Job) bool {
+	existingCompleted, completed := existing.Status.CompletionTime.Time, job.Status.CompletionTime.Time
+	switch {
+	case completed.IsZero():
+		return false
+	case existingCompleted.IsZero():
+		return true
+	default:
+		return completed.After(existingCompleted)
+	}
+}
+
+// mostRecentJobs returns the jobs from the last successful list, or the jobs from the
+// initial lister if no list has succeeded yet. An error is returned only if there is
+// no previous state and the initial lister fails, so that the informer does not report
+// itself synced with an empty set of jobs.
 func (lw *ListWatcher) mostRecentJobs() ([]*Job, error) {
 	lw.lock.Lock()
-	list := lw.lastList
+	list, listed := lw.lastList, lw.listed
 	lw.lock.Unlock()
-	if list != nil || lw.initialLister == nil {
+	if listed || lw.initialLister == nil {
 		return list, nil
 	}
 
 	ctx := context.Background()
 	list, err := lw.initialLister.ListJobs(ctx)
 	if err != nil {
-		return nil, err
+		metricListErrors.WithLabelValues(lw.name, "initial").Inc()
+		return nil, fmt.Errorf("unable to list initial jobs: %v", err)
 	}
 	metricJobSize.WithLabelValues(lw.name, "initial").Set(float64(len(list)))
 
 	lw.lock.Lock()
 	defer lw.lock.Unlock()
 	lw.lastList = list
+	lw.listed = true
 	return list, nil
 }
 
+func (lw *ListWatcher) hasListed() bool {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	return lw.listed
+}
+
 func (lw *ListWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
 	// keep items until they are expired by using the previous result as the seed for
 	// the next result
@@ -240,10 +327,18 @@ func (lw *ListWatcher) List(options metav1.ListOptions) (runtime.Object, error)
 	// are no longer live with their last visible state)
 	ctx := context.Background()
 	lists := make([][]*Job, 0, len(lw.listers)+1)
-	for _, lister := range lw.listers {
+	for i, lister := range lw.listers {
 		list, err := lister.ListJobs(ctx)
 		if err != nil {
-			return nil, err
+			metricListErrors.WithLabelValues(lw.name, fmt.Sprintf("lister-%d", i)).Inc()
+			// without any previous state, fail so the list is retried rather than
+			// reporting a partial set of jobs as synced
+			if !lw.hasListed() {
+				return nil, err
+			}
+			// the previous state already contains the last jobs seen from this lister
+			klog.Warningf("Unable to list jobs, using the last known jobs: %v", err)
+			continue
 		}
 		lists = append(lists, list)
 	}
@@ -261,6 +356,7 @@ func (lw *ListWatcher) List(options metav1.ListOptions) (runtime.Object, error)
 	lw.lock.Lock()
 	defer lw.lock.Unlock()
 	lw.lastList = append(lw.lastList[:0], merged.Items...)
+	lw.listed = true
 	return merged, nil
 }
 
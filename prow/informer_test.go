@@ -3,11 +3,15 @@ package prow
 import (
 	"context"
 	"flag"
+	"fmt"
 	"net/http"
 	"net/url"
+	"reflect"
 	"testing"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
@@ -59,3 +63,267 @@ func TestInformer(t *testing.T) {
 
 	time.Sleep(2 * time.Minute)
 }
+
+func testJob(name, job, buildID, state string, completed time.Time) *Job {
+	return &Job{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.Time{Time: completed.Add(-time.Hour)}},
+		Spec:       JobSpec{Job: job},
+		Status: JobStatus{
+			State:          state,
+			BuildID:        buildID,
+			StartTime:      metav1.Time{Time: completed.Add(-time.Hour)},
+			CompletionTime: metav1.Time{Time: completed},
+		},
+	}
+}
+
+func TestLister_JobStats(t *testing.T) {
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	lister, err := NewListerForJobs([]*Job{
+		testJob("a-1", "a", "1", "success", now.Add(-time.Hour)),
+		testJob("a-2", "a", "2", "failure", now.Add(-2*time.Hour)),
+		testJob("a-3", "a", "3", "aborted", now.Add(-3*time.Hour)),
+		testJob("a-4", "a", "4", "failure", now.Add(-48*time.Hour)),
+		testJob("b-1", "b", "1", "error", now.Add(-time.Hour)),
+		testJob("c-1", "c", "1", "success", now.Add(-time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to := now.Add(-24*time.Hour), now
+
+	tests := []struct {
+		name  string
+		job   string
+		names sets.String
+		want  JobStats
+	}{
+		{name: "all jobs", want: JobStats{Count: 5, Failures: 2, Jobs: 3}},
+		{name: "scoped to names", names: sets.NewString("a", "b"), want: JobStats{Count: 4, Failures: 2, Jobs: 2}},
+		{name: "single job", job: "a", want: JobStats{Count: 3, Failures: 1, Jobs: 1}},
+		{name: "unknown job", job: "d", want: JobStats{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lister.JobStats(tt.job, tt.names, from, to); got != tt.want {
+				t.Errorf("JobStats() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeJobs(t *testing.T) {
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	running := testJob("a-5", "a", "5", "pending", time.Time{})
+	running.CreationTimestamp = metav1.Time{Time: now.Add(-time.Minute)}
+	oldRunning := testJob("a-6", "a", "6", "pending", time.Time{})
+	oldRunning.CreationTimestamp = metav1.Time{Time: now.Add(-48 * time.Hour)}
+
+	lists := [][]*Job{
+		{
+			testJob("a-1", "a", "1", "success", now.Add(-time.Hour)),
+			testJob("a-2", "a", "2", "failure", now.Add(-48*time.Hour)),
+			testJob("a-3", "a", "", "failure", now.Add(-time.Hour)),
+			running,
+			oldRunning,
+		},
+		{
+			testJob("a-1-dup", "a", "1", "success", now.Add(-time.Hour)),
+			testJob("b-1", "b", "1", "failure", now.Add(-time.Hour)),
+		},
+	}
+	list, expired, empty := mergeJobs(lists, now.Add(-24*time.Hour))
+	if expired != 2 || empty != 1 {
+		t.Errorf("unexpected expired=%d empty=%d", expired, empty)
+	}
+	var names []string
+	for _, job := range list.Items {
+		names = append(names, job.Name)
+	}
+	if want := []string{"a-1", "a-5", "b-1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("unexpected jobs %v, want %v", names, want)
+	}
+}
+
+func Test_mergeJobs_pendingThenCompleted(t *testing.T) {
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	pending := testJob("a-1-pending", "a", "1", "pending", time.Time{})
+	pending.CreationTimestamp = metav1.Time{Time: now.Add(-time.Hour)}
+	completed := testJob("a-1-completed", "a", "1", "failure", now.Add(-time.Minute))
+	rerun := testJob("a-1-rerun", "a", "1", "success", now)
+
+	for _, tt := range []struct {
+		name  string
+		lists [][]*Job
+		want  string
+	}{
+		{name: "pending first", lists: [][]*Job{{pending}, {completed}}, want: "a-1-completed"},
+		{name: "completed first", lists: [][]*Job{{completed}, {pending}}, want: "a-1-completed"},
+		{name: "later completion", lists: [][]*Job{{completed}, {rerun}, {pending}}, want: "a-1-rerun"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			list, _, _ := mergeJobs(tt.lists, now.Add(-24*time.Hour))
+			if len(list.Items) != 1 || list.Items[0].Name != tt.want {
+				var names []string
+				for _, job := range list.Items {
+					names = append(names, job.Name)
+				}
+				t.Errorf("unexpected jobs %v, want %s", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestLister_GetBuild(t *testing.T) {
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	lister, err := NewListerForJobs([]*Job{
+		testJob("a-1", "a", "1", "success", now),
+		testJob("a-2", "a", "2", "failure", now),
+		testJob("b-1", "b", "1", "failure", now),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := lister.GetBuild("a", "2")
+	if err != nil || job.Name != "a-2" {
+		t.Fatalf("unexpected job: %v %v", job, err)
+	}
+	if _, err := lister.GetBuild("b", "2"); err == nil {
+		t.Fatal("expected not found")
+	}
+}
+
+func TestListWatcher_MultipleBuckets(t *testing.T) {
+	now := time.Now()
+	bucketA := []*Job{
+		testJob("a-1", "a", "1", "failure", now.Add(-2*time.Hour)),
+		testJob("shared-pending", "shared", "1", "pending", time.Time{}),
+	}
+	bucketA[1].CreationTimestamp = metav1.Time{Time: now.Add(-time.Hour)}
+	bucketB := []*Job{
+		testJob("b-1", "b", "1", "success", now.Add(-time.Hour)),
+		testJob("shared-completed", "shared", "1", "success", now.Add(-time.Minute)),
+	}
+	lw := &ListWatcher{
+		maxAge: 24 * time.Hour,
+		initialLister: MultiLister{
+			ListerFunc(func(ctx context.Context) ([]*Job, error) { return bucketA, nil }),
+			ListerFunc(func(ctx context.Context) ([]*Job, error) { return bucketB, nil }),
+		},
+	}
+	obj, err := lw.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sets.NewString()
+	for _, job := range obj.(*JobList).Items {
+		got.Insert(job.Name)
+	}
+	if want := sets.NewString("a-1", "b-1", "shared-completed"); !got.Equal(want) {
+		t.Fatalf("unexpected jobs: %v", got.List())
+	}
+
+	// a failing bucket does not prevent the other buckets from being listed
+	unavailable := ListerFunc(func(ctx context.Context) ([]*Job, error) { return nil, fmt.Errorf("bucket unavailable") })
+	partial := &ListWatcher{
+		maxAge:        24 * time.Hour,
+		initialLister: MultiLister{ListerFunc(func(ctx context.Context) ([]*Job, error) { return bucketA, nil }), unavailable},
+	}
+	obj, err = partial.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("expected the available bucket to be listed: %v", err)
+	}
+	got = sets.NewString()
+	for _, job := range obj.(*JobList).Items {
+		got.Insert(job.Name)
+	}
+	if want := sets.NewString("a-1", "shared-pending"); !got.Equal(want) {
+		t.Fatalf("unexpected jobs: %v", got.List())
+	}
+
+	// if every bucket fails the initial list fails so that it is retried
+	failing := &ListWatcher{
+		maxAge:        24 * time.Hour,
+		initialLister: MultiLister{unavailable, unavailable},
+	}
+	if _, err := failing.List(metav1.ListOptions{}); err == nil {
+		t.Fatal("expected an error when no bucket can be listed")
+	}
+}
+
+func Test_mergeJobs_buckets(t *testing.T) {
+	now := time.Now()
+	jobInBucket := func(name, bucket string, completed time.Time) *Job {
+		job := testJob(name, "periodic-e2e", "100", "success", completed)
+		job.Status.URL = "https://prow.example.com/view/gs/" + bucket + "/logs/periodic-e2e/100"
+		return job
+	}
+	list, _, _ := mergeJobs([][]*Job{
+		{jobInBucket("a", "bucket-a", now.Add(-time.Hour))},
+		{jobInBucket("b", "bucket-b", now.Add(-time.Hour)), jobInBucket("a-later", "bucket-a", now)},
+	}, now.Add(-24*time.Hour))
+	got := sets.NewString()
+	for _, job := range list.Items {
+		got.Insert(job.Name)
+	}
+	// builds with the same job and build ID in different buckets are both kept
+	if want := sets.NewString("a-later", "b"); !got.Equal(want) {
+		t.Fatalf("unexpected jobs: %v", got.List())
+	}
+}
+
+func TestListWatcher_ListErrors(t *testing.T) {
+	now := time.Now()
+	var initialErr, liveErr error
+	initial := []*Job{testJob("a-1", "a", "1", "failure", now.Add(-2*time.Hour))}
+	live := []*Job{testJob("b-1", "b", "1", "success", now.Add(-time.Minute))}
+	lw := &ListWatcher{
+		maxAge: 24 * time.Hour,
+		initialLister: ListerFunc(func(ctx context.Context) ([]*Job, error) {
+			return initial, initialErr
+		}),
+		listers: []JobLister{ListerFunc(func(ctx context.Context) ([]*Job, error) {
+			return live, liveErr
+		})},
+	}
+	names := func(obj interface{}) sets.String {
+		s := sets.NewString()
+		for _, job := range obj.(*JobList).Items {
+			s.Insert(job.Name)
+		}
+		return s
+	}
+
+	// a failed initial list is an error so the informer does not sync with no jobs
+	initialErr = fmt.Errorf("index unavailable")
+	if _, err := lw.List(metav1.ListOptions{}); err == nil {
+		t.Fatal("expected an error when the initial list fails")
+	}
+
+	// once the initial list succeeds, a failing live lister keeps the initial jobs
+	initialErr, liveErr = nil, fmt.Errorf("prow unavailable")
+	obj, err := lw.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(obj); !got.Equal(sets.NewString("a-1")) {
+		t.Fatalf("unexpected jobs: %v", got.List())
+	}
+
+	liveErr = nil
+	if obj, err = lw.List(metav1.ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(obj); !got.Equal(sets.NewString("a-1", "b-1")) {
+		t.Fatalf("unexpected jobs: %v", got.List())
+	}
+
+	// later errors retain the last known jobs
+	initialErr, liveErr = fmt.Errorf("index unavailable"), fmt.Errorf("prow unavailable")
+	if obj, err = lw.List(metav1.ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(obj); !got.Equal(sets.NewString("a-1", "b-1")) {
+		t.Fatalf("unexpected jobs: %v", got.List())
+	}
+}
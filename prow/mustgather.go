@@ -0,0 +1,169 @@
+package prow
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"k8s.io/klog/v2"
+)
+
+// MustGatherOptions controls which files are extracted from must-gather archives
+// of failed jobs so that they can be searched.
+type MustGatherOptions struct {
+	// Files is a list of glob patterns matched against the trailing path segments of
+	// each file in the archive, so "namespaces/*/pods/*/*/*/logs/current.log" matches
+	// that path under any must-gather directory. If empty, no archives are extracted.
+	Files []string
+	// MaxFiles is the maximum number of files extracted from a single archive.
+	MaxFiles int
+	// MaxBytes is the maximum number of bytes extracted from a single archive.
+	MaxBytes int64
+	// MaxArchiveBytes skips archives larger than this size.
+	MaxArchiveBytes int64
+	// Timeout bounds downloading and extracting a single archive. Extraction is not
+	// limited by the time allowed to read the rest of the build, which is too short for
+	// a large archive. If zero, extraction is only stopped with the informer.
+	Timeout time.Duration
+}
+
+// Enabled returns true if must-gather archives should be extracted.
+func (o MustGatherOptions) Enabled() bool {
+	return len(o.Files) > 0
+}
+
+// Matches returns true if the provided slash delimited path within an archive
+// matches one of the configured globs.
+func (o MustGatherOptions) Matches(name string) bool {
+	name = strings.TrimPrefix(path.Clean(name), "/")
+	segments := strings.Split(name, "/")
+	for _, glob := range o.Files {
+		n := strings.Count(glob, "/") + 1
+		if n > len(segments) {
+			continue
+		}
+		if ok, _ := path.Match(glob, strings.Join(segments[len(segments)-n:], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isMustGatherArchive(rel string) bool {
+	switch path.Base(rel) {
+	case "must-gather.tar", "must-gather.tar.gz", "must-gather.tgz":
+		return true
+	default:
+		return false
+	}
+}
+
+// extractMustGatherIfMissing reads the must-gather archive and writes every file matching
+// the configured globs into a single must-gather.txt file, with each file preceded by a
+// "# PATH" header line.
+func (a *LogAccumulator) extractMustGatherIfMissing(ctx context.Context, artifact *storage.ObjectAttrs) error {
+	const base = "must-gather.txt"
+	options := a.options.MustGather
+
+	if _, ok := a.exists[base]; ok {
+		return nil
+	}
+	// only the first archive in a build is extracted
+	a.lock.Lock()
+	extracted := a.mustGatherExtracted
+	a.mustGatherExtracted = true
+	a.lock.Unlock()
+	if extracted {
+		return nil
+	}
+	if options.MaxArchiveBytes > 0 && artifact.Size > options.MaxArchiveBytes {
+		klog.V(4).Infof("Skipping must-gather archive %s, size %d exceeds limit", artifact.Name, artifact.Size)
+		return nil
+	}
+
+	r, err := a.build.Bucket.Object(artifact.Name).NewReader(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	br := bufio.NewReader(r)
+	var in io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		in = gr
+	}
+
+	if err := os.MkdirAll(a.path, 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(a.path, base))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+
+	files := 0
+	remaining := options.MaxBytes
+	tr := tar.NewReader(in)
+	for {
+		if options.MaxFiles > 0 && files >= options.MaxFiles {
+			break
+		}
+		if options.MaxBytes > 0 && remaining <= 0 {
+			break
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return fmt.Errorf("unable to read must-gather archive %s: %v", artifact.Name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !options.Matches(hdr.Name) {
+			continue
+		}
+		files++
+		fmt.Fprintf(w, "\n\n# %s\n", hdr.Name)
+		var src io.Reader = tr
+		if options.MaxBytes > 0 {
+			src = io.LimitReader(tr, remaining)
+		}
+		n, err := io.Copy(w, src)
+		remaining -= n
+		metricDownloadedBytes.Add(float64(n))
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if files == 0 {
+		os.Remove(f.Name())
+	}
+	klog.V(4).Infof("Extracted %d files from must-gather archive %s", files, artifact.Name)
+	return nil
+}
@@ -0,0 +1,130 @@
+package prow
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+
+	"github.com/openshift/ci-search/testgrid/util/gcs"
+)
+
+func TestMustGatherOptions_Matches(t *testing.T) {
+	o := MustGatherOptions{Files: []string{
+		"namespaces/*/pods/*/*/*/logs/current.log",
+		"clusteroperators.yaml",
+	}}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "must-gather.local.1/quay-io-image/namespaces/openshift-etcd/pods/etcd-0/etcd/etcd/logs/current.log", want: true},
+		{name: "namespaces/openshift-etcd/pods/etcd-0/etcd/etcd/logs/current.log", want: true},
+		{name: "must-gather.local.1/quay-io-image/cluster-scoped-resources/config.openshift.io/clusteroperators.yaml", want: true},
+		{name: "must-gather.local.1/quay-io-image/namespaces/openshift-etcd/pods/etcd-0/etcd/etcd/logs/previous.log", want: false},
+		{name: "logs/current.log", want: false},
+		{name: "must-gather.local.1/event-filter.html", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := o.Matches(tt.name); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// mustGatherAccumulator returns an accumulator for a failed build whose must-gather
+// archive is served by handler.
+func mustGatherAccumulator(t *testing.T, handler http.HandlerFunc, options MustGatherOptions) *LogAccumulator {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication(), option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetry(storage.WithPolicy(storage.RetryNever))
+	a := &LogAccumulator{
+		build:       &gcs.Build{Bucket: client.Bucket("test-platform-results"), Context: context.Background(), Prefix: "logs/job/1/"},
+		path:        t.TempDir(),
+		finished:    1,
+		exists:      make(map[string]struct{}),
+		options:     IndexOptions{MustGather: options},
+		hasMetadata: make(chan struct{}),
+	}
+	close(a.hasMetadata)
+	return a
+}
+
+// extractArtifacts passes a must-gather archive to the accumulator and cancels the
+// context of the build as soon as the accumulator returns, as ReadBuild does.
+func extractArtifacts(t *testing.T, a *LogAccumulator) {
+	artifacts := make(chan *storage.ObjectAttrs, 1)
+	artifacts <- &storage.ObjectAttrs{Name: "logs/job/1/artifacts/must-gather.tar", Size: 1024}
+	close(artifacts)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := a.Artifacts(ctx, artifacts, make(chan *storage.ObjectAttrs, 1)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+}
+
+func TestLogAccumulator_extractMustGather_outlivesBuild(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	content := "etcdserver: request timed out\n"
+	if err := tw.WriteHeader(&tar.Header{Name: "must-gather.local.1/clusteroperators.yaml", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte(content))
+	tw.Close()
+
+	// the archive is only served after the build has been read
+	release := make(chan struct{})
+	a := mustGatherAccumulator(t, func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		w.Write(archive.Bytes())
+	}, MustGatherOptions{Files: []string{"clusteroperators.yaml"}, Timeout: time.Minute})
+	extractArtifacts(t, a)
+	close(release)
+	a.Wait()
+
+	data, err := os.ReadFile(filepath.Join(a.path, "must-gather.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), content) {
+		t.Errorf("unexpected extracted content: %q", string(data))
+	}
+}
+
+func TestLogAccumulator_extractMustGather_timeout(t *testing.T) {
+	// the archive is never served
+	a := mustGatherAccumulator(t, func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}, MustGatherOptions{Files: []string{"clusteroperators.yaml"}, Timeout: 50 * time.Millisecond})
+	extractArtifacts(t, a)
+
+	done := make(chan struct{})
+	go func() {
+		a.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("extraction was not stopped by its timeout")
+	}
+	if _, err := os.Stat(filepath.Join(a.path, "must-gather.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected no extracted file after the timeout: %v", err)
+	}
+}
@@ -15,8 +15,10 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 
+	"github.com/openshift/ci-search/pkg/tokenfilter"
 	"github.com/openshift/ci-search/testgrid/metadata/junit"
 	"github.com/openshift/ci-search/testgrid/util/gcs"
 	"github.com/prometheus/client_golang/prometheus"
@@ -164,7 +166,7 @@ func ReadBuild(inputBuild Build, acc Accumulator) error {
 		case err := <-ec:
 			if err != nil {
 				cancel()
-				return fmt.Errorf("failed to read %s: %v", build, err)
+				return fmt.Errorf("failed to read %s: %w", build, err)
 			}
 			break
 		case s := <-sc:
@@ -188,7 +190,7 @@ func ReadBuild(inputBuild Build, acc Accumulator) error {
 	case err := <-ec:
 		if err != nil {
 			cancel()
-			return fmt.Errorf("failed to read %s: %v", build, err)
+			return fmt.Errorf("failed to read %s: %w", build, err)
 		}
 	}
 
@@ -202,7 +204,16 @@ func Days(days int) time.Duration {
 	return time.Hour * 24 * time.Duration(days)
 }
 
-func NewAccumulator(base string, build *gcs.Build, modifiedBefore time.Time) (*LogAccumulator, bool) {
+// downloadingMarker is the file in a build directory that shows a download of the build
+// started and was not marked completed. Writing the files of a build changes the
+// modification time of its directory, so an interrupted download would otherwise look
+// up to date.
+const downloadingMarker = ".downloading"
+
+// NewAccumulator returns an accumulator for the files of build, and false if the build
+// directory was marked completed at or after modifiedBefore and does not need to be
+// downloaded again.
+func NewAccumulator(base string, build *gcs.Build, modifiedBefore time.Time, options IndexOptions) (*LogAccumulator, bool) {
 	prefix := filepath.FromSlash(build.Prefix)
 	number := path.Base(build.Prefix)
 	buildPath := filepath.Join(base, build.BucketPath, prefix)
@@ -210,7 +221,7 @@ func NewAccumulator(base string, build *gcs.Build, modifiedBefore time.Time) (*L
 	if !modifiedBefore.IsZero() {
 		if fi, err := os.Stat(buildPath); err == nil {
 			mod := fi.ModTime()
-			if !mod.Before(modifiedBefore) {
+			if _, err := os.Stat(filepath.Join(buildPath, downloadingMarker)); !mod.Before(modifiedBefore) && os.IsNotExist(err) {
 				return nil, false
 			}
 		} else if !os.IsNotExist(err) {
@@ -230,7 +241,11 @@ func NewAccumulator(base string, build *gcs.Build, modifiedBefore time.Time) (*L
 		path:   buildPath,
 		number: number,
 
-		exists: exists,
+		exists:  exists,
+		options: options,
+
+		passed: sets.NewString(),
+		failed: sets.NewString(),
 
 		hasMetadata: make(chan struct{}),
 	}, true
@@ -246,18 +261,45 @@ type LogAccumulator struct {
 	finished   int64
 	lastUpdate int64
 
-	exists map[string]struct{}
+	exists  map[string]struct{}
+	options IndexOptions
 
 	hasMetadata chan struct{}
 
-	lock     sync.Mutex
-	failures int
+	lock                sync.Mutex
+	failures            int
+	passed              sets.String
+	failed              sets.String
+	mustGatherExtracted bool
+
+	// extracting tracks must-gather extraction, which may continue after ReadBuild returns
+	extracting sync.WaitGroup
+}
+
+// Wait blocks until the must-gather archive of the build, if any, has been extracted.
+func (a *LogAccumulator) Wait() {
+	a.extracting.Wait()
+}
+
+// StartDownload records that the build is being downloaded, so that the build is
+// downloaded again if the download is interrupted before MarkCompleted is called.
+func (a *LogAccumulator) StartDownload() error {
+	if err := os.MkdirAll(a.path, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(a.path, downloadingMarker), nil, 0644)
 }
 
+// MarkCompleted records that the build was completely downloaded as of at, which is
+// compared with the time the build was last modified to decide whether to download it
+// again.
 func (a *LogAccumulator) MarkCompleted(at time.Time) error {
 	if err := os.MkdirAll(a.path, 0755); err != nil {
 		return err
 	}
+	if err := os.Remove(filepath.Join(a.path, downloadingMarker)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return os.Chtimes(a.path, at, at)
 }
 
@@ -294,12 +336,24 @@ func (a *LogAccumulator) AddSuites(ctx context.Context, suites junit.Suites) {
 		return
 	}
 	failures := 0
+	var passed, failed []string
 	var f *os.File
 	for _, suite := range suites.Suites {
 		for _, test := range suite.Results {
+			// testgrid prefixes testnames with their suitename, if the junit xml they came from
+			// has a wrapping <testsuites> element.  So keep the testnames aligned
+			// by prefixing here as well.
+			name := test.Name
+			if !suites.Unwrapped {
+				name = suite.Name + "." + test.Name
+			}
 			if test.Failure == nil && test.Error == nil {
+				if test.Skipped == nil {
+					passed = append(passed, name)
+				}
 				continue
 			}
+			failed = append(failed, name)
 			failures++
 			if f == nil {
 				if err := os.MkdirAll(a.path, 0755); err != nil {
@@ -326,14 +380,7 @@ func (a *LogAccumulator) AddSuites(ctx context.Context, suites junit.Suites) {
 			case test.Error != nil:
 				out = *test.Error
 			}
-			// testgrid prefixes testnames with their suitename, if the junit xml they came from
-			// has a wrapping <testsuites> element.  So keep the testnames aligned
-			// by prefixing here as well.
-			if suites.Unwrapped {
-				fmt.Fprintf(f, "\n\n# %s\n", test.Name)
-			} else {
-				fmt.Fprintf(f, "\n\n# %s.%s\n", suite.Name, test.Name)
-			}
+			fmt.Fprintf(f, "\n\n# %s\n", name)
 			fmt.Fprint(f, out)
 		}
 	}
@@ -341,6 +388,73 @@ func (a *LogAccumulator) AddSuites(ctx context.Context, suites junit.Suites) {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 	a.failures += failures
+	a.passed.Insert(passed...)
+	a.failed.Insert(failed...)
+}
+
+// writeFlakes records the names of tests that both failed and passed within the build,
+// one per line, to junit.flakes.
+func (a *LogAccumulator) writeFlakes() error {
+	if _, ok := a.exists["junit.flakes"]; ok {
+		return nil
+	}
+	a.lock.Lock()
+	flakes := a.failed.Intersection(a.passed).List()
+	a.lock.Unlock()
+	if len(flakes) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(a.path, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(a.path, "junit.flakes"), []byte(strings.Join(flakes, "\n")+"\n"), 0644)
+}
+
+// TokenFilterFile is the name of the file in each build directory containing the
+// token filter for the searchable files of the build.
+const TokenFilterFile = "tokens.filter"
+
+// tokenFilterFiles are the files in a build directory covered by the token filter.
+var tokenFilterFiles = []string{"junit.failures", "build-log.txt", "build-log.txt.gz", "must-gather.txt", "e2e.log", "e2e.log.gz"}
+
+// writeTokenFilter records the tokens of the searchable files of the build, unless a
+// filter already exists and none of the files were written by this accumulator.
+func (a *LogAccumulator) writeTokenFilter() error {
+	if _, ok := a.exists[TokenFilterFile]; ok {
+		changed := false
+		for _, file := range tokenFilterFiles {
+			if _, ok := a.exists[file]; ok {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(a.path, file)); err == nil {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return nil
+		}
+	}
+	paths := make([]string, 0, len(tokenFilterFiles))
+	for _, file := range tokenFilterFiles {
+		paths = append(paths, filepath.Join(a.path, file))
+	}
+	filter, err := tokenfilter.Build(paths, 0.01)
+	if err == tokenfilter.ErrTooManyTokens {
+		// searches will fall back to reading the files
+		os.Remove(filepath.Join(a.path, TokenFilterFile))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(a.path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return filter.WriteFile(filepath.Join(a.path, TokenFilterFile))
 }
 
 func (a *LogAccumulator) AddMetadata(ctx context.Context, started *gcs.Started, finished *gcs.Finished) (ok bool, err error) {
@@ -373,11 +487,20 @@ func (a *LogAccumulator) Finished(ctx context.Context) {
 
 	at := time.Unix(a.finished, 0)
 
+	if err := a.writeFlakes(); err != nil {
+		klog.Errorf("Unable to record flaky tests for %s: %v", a.path, err)
+	}
+	if a.options.TokenFilter {
+		if err := a.writeTokenFilter(); err != nil {
+			klog.Errorf("Unable to record token filter for %s: %v", a.path, err)
+		}
+	}
+
 	// update the timestamps of things we always write
 	if err := os.Chtimes(a.path, at, at); err != nil && !os.IsNotExist(err) {
 		klog.Errorf("Unable to set modification time of %s to %d: %v", a.path, a.finished, err)
 	}
-	for _, file := range []string{"junit.failures", "build-log.txt", "build-log.txt.gz"} {
+	for _, file := range []string{"junit.failures", "build-log.txt", "build-log.txt.gz", "must-gather.txt", "e2e.log", "e2e.log.gz", "junit.flakes", TokenFilterFile} {
 		_, ok := a.exists[file]
 		if ok {
 			continue
@@ -405,19 +528,77 @@ func (a *LogAccumulator) waitMetadata(ctx context.Context) bool {
 	}
 }
 
-func (a *LogAccumulator) downloadIfMissing(ctx context.Context, artifact *storage.ObjectAttrs, base string) error {
-	for _, s := range []string{base, base + ".gz"} {
-		if _, ok := a.exists[s]; ok {
-			return nil
+// metadataReceived returns true if the build metadata has been received, without waiting.
+func (a *LogAccumulator) metadataReceived() bool {
+	select {
+	case <-a.hasMetadata:
+		return true
+	default:
+		return false
+	}
+}
+
+// downloadMarker returns the name of the file recording the object that base was
+// downloaded from.
+func downloadMarker(base string) string {
+	return "." + base + ".gcs"
+}
+
+// hasDownloaded returns true if base, or its compressed form, was completely downloaded
+// from the current version of artifact. Files without a marker were written before
+// markers were recorded, and are complete if uncompressed and as large as artifact, or
+// if compressed, since their original size is unknown.
+func (a *LogAccumulator) hasDownloaded(artifact *storage.ObjectAttrs, base string) bool {
+	_, plain := a.exists[base]
+	_, compressed := a.exists[base+".gz"]
+	if !plain && !compressed {
+		return false
+	}
+	if _, ok := a.exists[downloadMarker(base)]; ok {
+		data, err := os.ReadFile(filepath.Join(a.path, downloadMarker(base)))
+		if err != nil {
+			return false
 		}
+		var generation, size int64
+		if _, err := fmt.Sscanf(string(data), "%d %d", &generation, &size); err != nil {
+			return false
+		}
+		return generation == artifact.Generation && size == artifact.Size
 	}
-	if err := os.MkdirAll(a.path, 0755); err != nil {
+	if compressed {
+		return true
+	}
+	fi, err := os.Stat(filepath.Join(a.path, base))
+	return err == nil && fi.Size() == artifact.Size
+}
+
+// prepareDownload removes any previous, possibly partial, download of base.
+func (a *LogAccumulator) prepareDownload(base string) error {
+	for _, name := range []string{downloadMarker(base), base, base + ".gz"} {
+		if err := os.Remove(filepath.Join(a.path, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.MkdirAll(a.path, 0755)
+}
+
+// completeDownload records that base was completely downloaded from artifact.
+func (a *LogAccumulator) completeDownload(artifact *storage.ObjectAttrs, base string) error {
+	return os.WriteFile(filepath.Join(a.path, downloadMarker(base)), []byte(fmt.Sprintf("%d %d\n", artifact.Generation, artifact.Size)), 0644)
+}
+
+func (a *LogAccumulator) downloadIfMissing(ctx context.Context, artifact *storage.ObjectAttrs, base string) error {
+	if a.hasDownloaded(artifact, base) {
+		return nil
+	}
+	if err := a.prepareDownload(base); err != nil {
 		return err
 	}
+	name := base
 	if artifact.Size > 1*1024*1024 {
-		base += ".gz"
+		name += ".gz"
 	}
-	f, err := os.Create(filepath.Join(a.path, base))
+	f, err := os.Create(filepath.Join(a.path, name))
 	if err != nil {
 		return err
 	}
@@ -445,22 +626,21 @@ func (a *LogAccumulator) downloadIfMissing(ctx context.Context, artifact *storag
 		os.Remove(f.Name())
 		return err
 	}
-	return nil
+	return a.completeDownload(artifact, base)
 }
 
 func (a *LogAccumulator) downloadIfMissingTail(ctx context.Context, artifact *storage.ObjectAttrs, base string, length int64) error {
-	for _, s := range []string{base, base + ".gz"} {
-		if _, ok := a.exists[s]; ok {
-			return nil
-		}
+	if a.hasDownloaded(artifact, base) {
+		return nil
 	}
-	if err := os.MkdirAll(a.path, 0755); err != nil {
+	if err := a.prepareDownload(base); err != nil {
 		return err
 	}
+	name := base
 	if artifact.Size > 1*1024*1024 {
-		base += ".gz"
+		name += ".gz"
 	}
-	f, err := os.Create(filepath.Join(a.path, base))
+	f, err := os.Create(filepath.Join(a.path, name))
 	if err != nil {
 		return err
 	}
@@ -489,7 +669,7 @@ func (a *LogAccumulator) downloadIfMissingTail(ctx context.Context, artifact *st
 		return err
 	}
 	metricDownloadedBytes.Add(float64(length))
-	return nil
+	return a.completeDownload(artifact, base)
 }
 
 func (a *LogAccumulator) Artifacts(ctx context.Context, artifacts <-chan *storage.ObjectAttrs, unprocessedArtifacts chan<- *storage.ObjectAttrs) error {
@@ -497,13 +677,14 @@ func (a *LogAccumulator) Artifacts(ctx context.Context, artifacts <-chan *storag
 	ec := make(chan error)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	var e2eLog bool
 	for art := range artifacts {
 		var rel string
 		if strings.HasPrefix(art.Name, a.build.Prefix) {
 			rel = art.Name[len(a.build.Prefix):]
 		}
 		switch {
-		case rel == "build-log.txt":
+		case rel == "build-log.txt" && a.options.indexes("build-log"):
 			wg.Add(1)
 			go func(art *storage.ObjectAttrs) {
 				defer wg.Done()
@@ -519,6 +700,58 @@ func (a *LogAccumulator) Artifacts(ctx context.Context, artifacts <-chan *storag
 					}
 				}
 			}(art)
+		case a.options.indexes("e2e-log") && !e2eLog && path.Base(rel) == "e2e.log":
+			// a build may run several test steps, only the first e2e.log is kept
+			e2eLog = true
+			wg.Add(1)
+			go func(art *storage.ObjectAttrs) {
+				defer wg.Done()
+				if !a.waitMetadata(ctx) || a.succeeded || a.finished == 0 {
+					return
+				}
+				if err := a.downloadIfMissingTail(ctx, art, "e2e.log", 20*1024*1024); err != nil {
+					log.Printf("error: Unable to download %s: %v", art.Name, err)
+					select {
+					case <-ctx.Done():
+					case ec <- err:
+					}
+				}
+			}(art)
+		case a.options.MustGather.Enabled() && isMustGatherArchive(rel):
+			a.extracting.Add(1)
+			go func(art *storage.ObjectAttrs) {
+				defer a.extracting.Done()
+				// ReadBuild may return and cancel ctx before extraction starts
+				if !a.metadataReceived() && !a.waitMetadata(ctx) {
+					return
+				}
+				// only extract must-gather for failed builds, and don't fail the build if extraction fails
+				if a.succeeded || a.finished == 0 {
+					return
+				}
+				// a large archive takes longer than the time allowed to read the build, so
+				// extraction is bounded by its own timeout under the informer's context
+				var extractCtx context.Context
+				var cancel context.CancelFunc
+				if timeout := a.options.MustGather.Timeout; timeout > 0 {
+					extractCtx, cancel = context.WithTimeout(a.build.Context, timeout)
+				} else {
+					extractCtx, cancel = context.WithCancel(a.build.Context)
+				}
+				defer cancel()
+				if err := a.extractMustGatherIfMissing(extractCtx, art); err != nil {
+					klog.Errorf("Unable to extract must-gather %s: %v", art.Name, err)
+				}
+			}(art)
+		case !a.options.indexes("junit") && gcs.MatchesSuite(art):
+			continue
+		case !a.options.SuccessJunit && gcs.MatchesSuite(art):
+			// junit results of successful builds are skipped, which requires waiting for
+			// the build result
+			if !a.waitMetadata(ctx) || a.succeeded {
+				continue
+			}
+			unprocessedArtifacts <- art
 		default:
 			unprocessedArtifacts <- art
 			continue
@@ -0,0 +1,204 @@
+package prow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/openshift/ci-search/testgrid/util/gcs"
+)
+
+func TestLogAccumulator_Artifacts(t *testing.T) {
+	prefix := "logs/job/1/"
+	for _, tt := range []struct {
+		name      string
+		succeeded bool
+		options   IndexOptions
+		artifacts []string
+		want      []string
+	}{
+		{
+			name:      "failed build",
+			artifacts: []string{"artifacts/junit_e2e.xml", "artifacts/other.txt"},
+			want:      []string{prefix + "artifacts/junit_e2e.xml", prefix + "artifacts/other.txt"},
+		},
+		{
+			name:      "successful build skips junit",
+			succeeded: true,
+			artifacts: []string{"artifacts/junit_e2e.xml", "artifacts/other.txt"},
+			want:      []string{prefix + "artifacts/other.txt"},
+		},
+		{
+			name:      "successful build with junit",
+			succeeded: true,
+			options:   IndexOptions{SuccessJunit: true},
+			artifacts: []string{"artifacts/junit_e2e.xml", "artifacts/other.txt"},
+			want:      []string{prefix + "artifacts/junit_e2e.xml", prefix + "artifacts/other.txt"},
+		},
+		{
+			name:      "e2e log disabled",
+			succeeded: true,
+			options:   IndexOptions{SuccessJunit: true},
+			artifacts: []string{"artifacts/e2e/e2e.log"},
+			want:      []string{prefix + "artifacts/e2e/e2e.log"},
+		},
+		{
+			// the build succeeded, so the log is consumed without being downloaded
+			name:      "e2e log enabled",
+			succeeded: true,
+			options:   IndexOptions{Artifacts: []string{"junit", "e2e-log"}, SuccessJunit: true},
+			artifacts: []string{"artifacts/e2e/e2e.log"},
+		},
+		{
+			// the build log is downloaded by the accumulator
+			name:      "default kinds",
+			succeeded: true,
+			options:   IndexOptions{SuccessJunit: true},
+			artifacts: []string{"build-log.txt", "artifacts/junit_e2e.xml"},
+			want:      []string{prefix + "artifacts/junit_e2e.xml"},
+		},
+		{
+			name:      "junit only",
+			succeeded: true,
+			options:   IndexOptions{Artifacts: []string{"junit"}, SuccessJunit: true},
+			artifacts: []string{"build-log.txt", "artifacts/junit_e2e.xml"},
+			want:      []string{prefix + "build-log.txt", prefix + "artifacts/junit_e2e.xml"},
+		},
+		{
+			name:      "build-log only",
+			succeeded: true,
+			options:   IndexOptions{Artifacts: []string{"build-log"}, SuccessJunit: true},
+			artifacts: []string{"build-log.txt", "artifacts/junit_e2e.xml"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &LogAccumulator{
+				build:       &gcs.Build{Prefix: prefix},
+				succeeded:   tt.succeeded,
+				finished:    1,
+				options:     tt.options,
+				hasMetadata: make(chan struct{}),
+			}
+			close(a.hasMetadata)
+
+			artifacts := make(chan *storage.ObjectAttrs, len(tt.artifacts))
+			for _, name := range tt.artifacts {
+				artifacts <- &storage.ObjectAttrs{Name: prefix + name}
+			}
+			close(artifacts)
+
+			unprocessed := make(chan *storage.ObjectAttrs, len(tt.artifacts))
+			if err := a.Artifacts(context.Background(), artifacts, unprocessed); err != nil {
+				t.Fatal(err)
+			}
+			close(unprocessed)
+			var got []string
+			for art := range unprocessed {
+				got = append(got, art.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected unprocessed artifacts: %v", got)
+			}
+		})
+	}
+}
+
+func TestLogAccumulator_hasDownloaded(t *testing.T) {
+	artifact := &storage.ObjectAttrs{Name: "logs/job/1/build-log.txt", Size: 5, Generation: 2}
+	for _, tt := range []struct {
+		name  string
+		files map[string]string
+		want  bool
+	}{
+		{name: "missing"},
+		{name: "complete without marker", files: map[string]string{"build-log.txt": "12345"}, want: true},
+		{name: "truncated without marker", files: map[string]string{"build-log.txt": "123"}},
+		{name: "compressed without marker", files: map[string]string{"build-log.txt.gz": "x"}, want: true},
+		{name: "matching marker", files: map[string]string{"build-log.txt.gz": "x", ".build-log.txt.gcs": "2 5\n"}, want: true},
+		{name: "marker for older generation", files: map[string]string{"build-log.txt": "12345", ".build-log.txt.gcs": "1 5\n"}},
+		{name: "marker without file", files: map[string]string{".build-log.txt.gcs": "2 5\n"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			exists := make(map[string]struct{})
+			for name, contents := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+				exists[name] = struct{}{}
+			}
+			a := &LogAccumulator{path: dir, exists: exists}
+			if got := a.hasDownloaded(artifact, "build-log.txt"); got != tt.want {
+				t.Errorf("hasDownloaded() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogAccumulator_prepareDownload(t *testing.T) {
+	dir := t.TempDir()
+	a := &LogAccumulator{path: dir}
+	for _, name := range []string{"build-log.txt", ".build-log.txt.gcs", "junit.failures"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("1"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.prepareDownload("build-log.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.completeDownload(&storage.ObjectAttrs{Size: 10, Generation: 3}, "build-log.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build-log.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected partial download to be removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "junit.failures")); err != nil {
+		t.Errorf("expected other files to be kept: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, ".build-log.txt.gcs")); err != nil || string(data) != "3 10\n" {
+		t.Errorf("unexpected marker %q: %v", data, err)
+	}
+}
+
+func TestNewAccumulator_interruptedDownload(t *testing.T) {
+	base := t.TempDir()
+	build := &gcs.Build{BucketPath: "test-platform-results", Prefix: "logs/job/1/"}
+	completed := time.Now().Add(-time.Hour)
+
+	a, stale := NewAccumulator(base, build, completed, IndexOptions{})
+	if !stale {
+		t.Fatalf("a build that was never downloaded should be stale")
+	}
+	if err := a.StartDownload(); err != nil {
+		t.Fatal(err)
+	}
+	// the process stops after writing a file, which changes the directory to the current time
+	if err := os.WriteFile(filepath.Join(a.path, "build-log.txt"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(a.path); err != nil || fi.ModTime().Before(completed) {
+		t.Fatalf("expected the build directory to be modified after completion: %v", err)
+	}
+
+	a, stale = NewAccumulator(base, build, completed, IndexOptions{})
+	if !stale {
+		t.Fatalf("an interrupted download should be stale")
+	}
+	if err := a.StartDownload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.MarkCompleted(completed); err != nil {
+		t.Fatal(err)
+	}
+	if _, stale := NewAccumulator(base, build, completed, IndexOptions{}); stale {
+		t.Errorf("a completed download should not be stale")
+	}
+	if _, stale := NewAccumulator(base, build, completed.Add(time.Minute), IndexOptions{}); !stale {
+		t.Errorf("a build that completed again after its download should be stale")
+	}
+}
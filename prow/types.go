@@ -12,6 +12,8 @@ import (
 
 type JobAccessor interface {
 	Get(name string) (*Job, error)
+	// GetBuild returns the run of job with the provided build ID.
+	GetBuild(job, buildID string) (*Job, error)
 	List(labels.Selector) ([]*Job, error)
 	JobStats(name string, names sets.String, from, to time.Time) JobStats
 }
@@ -23,6 +25,9 @@ type emptyJobAccessor struct{}
 func (emptyJobAccessor) Get(name string) (*Job, error) {
 	return nil, errors.NewNotFound(prowGR, name)
 }
+func (emptyJobAccessor) GetBuild(job, buildID string) (*Job, error) {
+	return nil, errors.NewNotFound(prowGR, job+"/"+buildID)
+}
 func (emptyJobAccessor) List(_ labels.Selector) ([]*Job, error) {
 	return nil, nil
 }
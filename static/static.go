@@ -1,17 +1,70 @@
 package static
 
 import (
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
 )
 
 // staticContent holds our static web server content.
 //go:embed *
 var staticContent embed.FS
 
+// versionedMaxAge is how long browsers may cache files whose name includes their version
+// without checking for a newer copy.
+const versionedMaxAge = 365 * 24 * time.Hour
+
+// reVersionedName matches file names that include a version, e.g. jquery-3.6.0.min.js,
+// which change name instead of content when they are updated.
+var reVersionedName = regexp.MustCompile(`-\d+(\.\d+)+\.`)
+
 // Handler returns a file server with the contents of files in the `static` directory.
 // `prefix` is used for nested static files ex: /static/
 // An empty string can be passed in if contents are desired to be served at the root of the path.
+// Files are served with a strong ETag so that browsers can revalidate them cheaply, and files
+// with a version in their name may be cached for a year.
 func Handler(prefix string) http.Handler {
-	return http.StripPrefix(prefix, http.FileServer(http.FS(staticContent)))
+	etags, err := contentETags(staticContent)
+	if err != nil {
+		panic(fmt.Sprintf("unable to hash static content: %v", err))
+	}
+	files := http.FileServer(http.FS(staticContent))
+	return http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.TrimPrefix(req.URL.Path, "/")
+		if etag, ok := etags[name]; ok {
+			// the file server responds with 304 Not Modified if the ETag matches If-None-Match
+			w.Header().Set("ETag", etag)
+			if reVersionedName.MatchString(name) {
+				w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(versionedMaxAge.Seconds())))
+			} else {
+				w.Header().Set("Cache-Control", "public, no-cache")
+			}
+		}
+		files.ServeHTTP(w, req)
+	}))
+}
+
+// contentETags returns the quoted ETag of each file in fsys, derived from a hash of its
+// contents.
+func contentETags(fsys fs.FS) (map[string]string, error) {
+	etags := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		etags[path] = `"` + hex.EncodeToString(sum[:16]) + `"`
+		return nil
+	})
+	return etags, err
 }
@@ -0,0 +1,41 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler_ETag(t *testing.T) {
+	handler := Handler("/static/")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/static/jquery-3.6.0.min.js", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || len(etag) == 0 || w.Body.Len() == 0 {
+		t.Fatalf("unexpected response: %d etag=%q length=%d", w.Code, etag, w.Body.Len())
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "max-age=31536000") {
+		t.Errorf("expected versioned file to be cached: %q", cc)
+	}
+
+	req := httptest.NewRequest("GET", "/static/jquery-3.6.0.min.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected a matching ETag to be not modified: %d length=%d", w.Code, w.Body.Len())
+	}
+
+	req = httptest.NewRequest("GET", "/static/placement.min.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("expected a different file to be served: %d etag=%q", w.Code, w.Header().Get("ETag"))
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, no-cache" {
+		t.Errorf("expected unversioned file to be revalidated: %q", cc)
+	}
+}
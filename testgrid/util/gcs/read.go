@@ -152,6 +152,11 @@ func matchesSuite(obj *storage.ObjectAttrs) bool {
 	return re.MatchString(obj.Name)
 }
 
+// MatchesSuite returns true if obj is a junit file that Suites would parse.
+func MatchesSuite(obj *storage.ObjectAttrs) bool {
+	return matchesSuite(obj)
+}
+
 // parseSuitesMeta returns the metadata for this junit file (nil for a non-junit file).
 //
 // Expected format: junit_context_20180102-1256-07.xml
@@ -185,10 +190,10 @@ func readJSON(ctx context.Context, obj *storage.ObjectHandle, i interface{}) err
 		return err
 	}
 	if err != nil {
-		return fmt.Errorf("open: %v", err)
+		return fmt.Errorf("open: %w", err)
 	}
 	if err = json.NewDecoder(reader).Decode(i); err != nil {
-		return fmt.Errorf("decode: %v", err)
+		return fmt.Errorf("decode: %w", err)
 	}
 	return nil
 }
@@ -203,7 +208,7 @@ func (build Build) Started() (*Started, error) {
 		return &started, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("read %s: %v", uri, err)
+		return nil, fmt.Errorf("read %s: %w", uri, err)
 	}
 	return &started, nil
 }
@@ -218,7 +223,7 @@ func (build Build) Finished() (*Finished, error) {
 		return &finished, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("read %s: %v", uri, err)
+		return nil, fmt.Errorf("read %s: %w", uri, err)
 	}
 	return &finished, nil
 }
@@ -227,7 +232,7 @@ func (build Build) Finished() (*Finished, error) {
 func (build Build) Artifacts(artifacts chan<- *storage.ObjectAttrs) error {
 	pref := build.Prefix
 	query := &storage.Query{Prefix: pref}
-	query.SetAttrSelection([]string{"Name", "Size"})
+	query.SetAttrSelection([]string{"Name", "Size", "Generation"})
 	objs := build.Bucket.Objects(build.Context, query)
 	for {
 		obj, err := objs.Next()
@@ -235,7 +240,7 @@ func (build Build) Artifacts(artifacts chan<- *storage.ObjectAttrs) error {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("failed to list %s: %v", pref, err)
+			return fmt.Errorf("failed to list %s: %w", pref, err)
 		}
 		select {
 		case <-build.Context.Done():
@@ -250,7 +255,7 @@ func (build Build) Artifacts(artifacts chan<- *storage.ObjectAttrs) error {
 func readSuites(ctx context.Context, obj *storage.ObjectHandle) (*junit.Suites, error) {
 	reader, err := obj.NewReader(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("open: %v", err)
+		return nil, fmt.Errorf("open: %w", err)
 	}
 
 	buf, err := ioutil.ReadAll(reader)